@@ -0,0 +1,472 @@
+package alarms
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+//names of the items holding the rules and the alarms in the persistence provider
+const (
+	rulesItem  = "alarmRules"
+	alarmsItem = "alarms"
+)
+
+//maxHistory is the number of alarms kept. When there are more,
+//the oldest cleared alarms are dropped
+const maxHistory = 1000
+
+//Active is used with GetAlarms to get the alarms not cleared yet
+const Active = "active"
+
+//ForecastFunc returns the forecast value (common.ForecastRate,
+//common.DaysUntilEmpty or common.DaysUntilMin) of the product having sku
+type ForecastFunc func(sku string, value string) (float64, error)
+
+//watch follows one threshold of a rule. count is the number of consecutive
+//readings beyond the threshold while no alarm is raised, or back in range
+//while alarmID is raised
+type watch struct {
+	count   int
+	alarmID int
+}
+
+//byRuleID sorts the rules by their id
+type byRuleID []common.AlarmRule
+
+func (rules byRuleID) Len() int           { return len(rules) }
+func (rules byRuleID) Swap(i, j int)      { rules[i], rules[j] = rules[j], rules[i] }
+func (rules byRuleID) Less(i, j int) bool { return rules[i].ID < rules[j].ID }
+
+//Engine checks every reading against the alarm rules and keeps the alarms
+//raised by them. The rules and the alarm history are saved in the
+//persistence provider. The event listeners are told of every alarm state change
+type Engine struct {
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	inventory           *inventory.Inventory
+	forecast            ForecastFunc
+	rules               map[int]common.AlarmRule
+	alarms              []common.Alarm
+	watches             map[string]*watch
+	nextRuleID          int
+	nextAlarmID         int
+	events              *common.EventQueue
+	mutex               *sync.Mutex
+}
+
+//NewEngine returns an Engine keeping its rules and alarms in pp. The rules
+//on products take the stock from inv, which can be nil if there are none.
+//The rules and the alarms already saved in pp are loaded
+func (Engine) NewEngine(pp *persistenceprovider.PersistenceProvider, inv *inventory.Inventory) (*Engine, error) {
+	engine := &Engine{persistenceProvider: pp, inventory: inv,
+		rules:      make(map[int]common.AlarmRule),
+		watches:    make(map[string]*watch),
+		nextRuleID: 1, nextAlarmID: 1, events: common.EventQueue{}.NewEventQueue(),
+		mutex: &sync.Mutex{}}
+	if err := engine.load(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return engine, nil
+}
+
+//load reads the rules and the alarms saved in the persistence provider
+func (engine *Engine) load() error {
+	var rules []common.AlarmRule
+	if err := persistenceprovider.ReadItemInto(*engine.persistenceProvider, rulesItem, &rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		engine.rules[rule.ID] = rule
+		if rule.ID >= engine.nextRuleID {
+			engine.nextRuleID = rule.ID + 1
+		}
+	}
+	if err := persistenceprovider.ReadItemInto(*engine.persistenceProvider, alarmsItem, &engine.alarms); err != nil {
+		return err
+	}
+	for _, alarm := range engine.alarms {
+		if alarm.ID >= engine.nextAlarmID {
+			engine.nextAlarmID = alarm.ID + 1
+		}
+		if alarm.IsActive() {
+			engine.watches[watchKey(alarm.RuleID, alarm.Kind)] = &watch{alarmID: alarm.ID}
+		}
+	}
+	return nil
+}
+
+func (engine *Engine) saveRules() error {
+	return (*engine.persistenceProvider).SaveItem(rulesItem, engine.sortedRules())
+}
+
+//saveAlarms drops the oldest cleared alarms above maxHistory
+//and saves the alarms
+func (engine *Engine) saveAlarms() error {
+	for i := 0; len(engine.alarms) > maxHistory && i < len(engine.alarms); {
+		if engine.alarms[i].IsActive() {
+			i++
+			continue
+		}
+		engine.alarms = append(engine.alarms[:i], engine.alarms[i+1:]...)
+	}
+	return (*engine.persistenceProvider).SaveItem(alarmsItem, engine.alarms)
+}
+
+func (engine *Engine) sortedRules() []common.AlarmRule {
+	rules := make([]common.AlarmRule, 0, len(engine.rules))
+	for _, rule := range engine.rules {
+		rules = append(rules, rule)
+	}
+	sort.Sort(byRuleID(rules))
+	return rules
+}
+
+//AddEventListener adds listener to the listeners told
+//when an alarm is raised, acknowledged or cleared
+func (engine *Engine) AddEventListener(listener common.EventListener) {
+	engine.events.AddListener(listener)
+}
+
+//SetForecast sets the forecast used by the rules watching
+//a forecast value of a product
+func (engine *Engine) SetForecast(forecast ForecastFunc) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.forecast = forecast
+}
+
+//emit queues the event of alarm changing to its current state.
+//The events are sent once the engine is unlocked
+func (engine *Engine) emit(alarm common.Alarm, at string) {
+	eventTypes := map[string]string{common.Raised: common.AlarmRaisedEvent,
+		common.Acknowledged: common.AlarmAcknowledgedEvent, common.Cleared: common.AlarmClearedEvent}
+	engine.events.Emit(common.Event{Type: eventTypes[alarm.State],
+		Time: at, Alarm: &alarm})
+}
+
+func watchKey(ruleID int, kind string) string {
+	return fmt.Sprintf("%d:%s", ruleID, kind)
+}
+
+//IsRuleValid checks that rule watches either a calculated value or a
+//product and that it has valid thresholds
+func (engine *Engine) IsRuleValid(rule common.AlarmRule) error {
+	if (rule.Key == "") == (rule.SKU == "") {
+		return errors.New("The alarm rule must watch either a calculated value or a product")
+	}
+	if rule.Low == nil && rule.High == nil {
+		return errors.New("The alarm rule must have a low or a high threshold")
+	}
+	if rule.Low != nil && rule.High != nil && *rule.Low >= *rule.High {
+		return fmt.Errorf("The low threshold %v must be under the high threshold %v", *rule.Low, *rule.High)
+	}
+	if rule.Hysteresis < 0 || rule.Debounce < 0 {
+		return errors.New("The hysteresis and the debounce of the alarm rule can not be negative")
+	}
+	if rule.SKU != "" {
+		if engine.inventory == nil {
+			return errors.New("No inventory to watch products")
+		}
+		if _, err := engine.inventory.GetProduct(rule.SKU); err != nil {
+			return err
+		}
+	}
+	if rule.Forecast != "" {
+		if rule.SKU == "" {
+			return errors.New("Only the alarm rules watching a product can watch its forecast")
+		}
+		if rule.Forecast != common.ForecastRate && rule.Forecast != common.DaysUntilEmpty &&
+			rule.Forecast != common.DaysUntilMin {
+			return fmt.Errorf("Unknown forecast value %s", rule.Forecast)
+		}
+	}
+	return nil
+}
+
+//AddRule adds rule to the alarm rules and returns it with its new id
+func (engine *Engine) AddRule(rule common.AlarmRule) (*common.AlarmRule, error) {
+	rule.Bus = common.BusName(rule.Bus)
+	if err := engine.IsRuleValid(rule); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	rule.ID = engine.nextRuleID
+	engine.nextRuleID++
+	engine.rules[rule.ID] = rule
+	return &rule, engine.saveRules()
+}
+
+//ChangeRule changes the rule having id to be similar with after. The alarms
+//already raised by the rule are kept, except the ones of a removed threshold
+//and, if after watches another value, all of them. These are cleared
+func (engine *Engine) ChangeRule(id int, after common.AlarmRule) error {
+	after.ID = id
+	after.Bus = common.BusName(after.Bus)
+	if err := engine.IsRuleValid(after); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	engine.mutex.Lock()
+	defer engine.events.Flush()
+	defer engine.mutex.Unlock()
+	before, ok := engine.rules[id]
+	if !ok {
+		return fmt.Errorf("No alarm rule with id %d", id)
+	}
+	engine.rules[id] = after
+	//the alarms of a threshold removed or of a value no longer watched are cleared
+	moved := before.Bus != after.Bus || before.Sensor != after.Sensor || before.Key != after.Key ||
+		before.SKU != after.SKU || before.Forecast != after.Forecast
+	now := time.Now().Format(common.TimeFormat)
+	cleared := false
+	if moved || after.Low == nil {
+		cleared = engine.unwatch(id, common.LowAlarm, now) || cleared
+	}
+	if moved || after.High == nil {
+		cleared = engine.unwatch(id, common.HighAlarm, now) || cleared
+	}
+	if err := engine.saveRules(); err != nil {
+		return err
+	}
+	if cleared {
+		return engine.saveAlarms()
+	}
+	return nil
+}
+
+//RemoveRule removes the rule having id and clears its active alarms
+func (engine *Engine) RemoveRule(id int) error {
+	engine.mutex.Lock()
+	defer engine.events.Flush()
+	defer engine.mutex.Unlock()
+	if _, ok := engine.rules[id]; !ok {
+		return fmt.Errorf("No alarm rule with id %d", id)
+	}
+	delete(engine.rules, id)
+	now := time.Now().Format(common.TimeFormat)
+	for _, kind := range []string{common.LowAlarm, common.HighAlarm} {
+		engine.unwatch(id, kind, now)
+	}
+	if err := engine.saveRules(); err != nil {
+		return err
+	}
+	return engine.saveAlarms()
+}
+
+//unwatch stops following the threshold of kind of the rule having id. Its
+//active alarm is cleared at now. It returns true if an alarm was cleared
+func (engine *Engine) unwatch(id int, kind string, now string) bool {
+	w, ok := engine.watches[watchKey(id, kind)]
+	if !ok {
+		return false
+	}
+	delete(engine.watches, watchKey(id, kind))
+	alarm := engine.alarm(w.alarmID)
+	if alarm == nil {
+		return false
+	}
+	alarm.State = common.Cleared
+	alarm.Cleared = now
+	engine.emit(*alarm, now)
+	return true
+}
+
+//GetRule returns the rule having id
+func (engine *Engine) GetRule(id int) (*common.AlarmRule, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	rule, ok := engine.rules[id]
+	if !ok {
+		return nil, fmt.Errorf("No alarm rule with id %d", id)
+	}
+	return &rule, nil
+}
+
+//GetRules returns the alarm rules sorted by id
+func (engine *Engine) GetRules() []common.AlarmRule {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return engine.sortedRules()
+}
+
+//alarm returns the alarm having id, nil if it was dropped
+func (engine *Engine) alarm(id int) *common.Alarm {
+	for i := range engine.alarms {
+		if engine.alarms[i].ID == id {
+			return &engine.alarms[i]
+		}
+	}
+	return nil
+}
+
+//GetAlarm returns the alarm having id
+func (engine *Engine) GetAlarm(id int) (*common.Alarm, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	alarm := engine.alarm(id)
+	if alarm == nil {
+		return nil, fmt.Errorf("No alarm with id %d", id)
+	}
+	alarmCopy := *alarm
+	return &alarmCopy, nil
+}
+
+//GetAlarms returns the alarms having state, sorted by id. Active returns
+//the alarms raised or acknowledged and an empty state returns all the alarms
+func (engine *Engine) GetAlarms(state string) []common.Alarm {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	alarms := []common.Alarm{}
+	for _, alarm := range engine.alarms {
+		if state == "" || alarm.State == state || (state == Active && alarm.IsActive()) {
+			alarms = append(alarms, alarm)
+		}
+	}
+	return alarms
+}
+
+//Acknowledge marks the raised alarm having id as acknowledged. The alarm
+//stays active until its value gets back in range
+func (engine *Engine) Acknowledge(id int) (*common.Alarm, error) {
+	engine.mutex.Lock()
+	defer engine.events.Flush()
+	defer engine.mutex.Unlock()
+	alarm := engine.alarm(id)
+	if alarm == nil {
+		return nil, fmt.Errorf("No alarm with id %d", id)
+	}
+	if alarm.State != common.Raised {
+		return nil, fmt.Errorf("The alarm %d is %s, only raised alarms can be acknowledged", id, alarm.State)
+	}
+	alarm.State = common.Acknowledged
+	alarm.Acknowledged = time.Now().Format(common.TimeFormat)
+	engine.emit(*alarm, alarm.Acknowledged)
+	alarmCopy := *alarm
+	return &alarmCopy, engine.saveAlarms()
+}
+
+//value returns the value watched by rule in reading.
+//ok is false if reading does not have the value
+func (engine *Engine) value(rule common.AlarmRule, reading common.Reading) (value float64, ok bool) {
+	if rule.SKU != "" {
+		if engine.inventory == nil {
+			return 0, false
+		}
+		product, err := engine.inventory.GetProduct(rule.SKU)
+		if err != nil || product.Bus != reading.Bus || product.Sensor != reading.Sensor {
+			return 0, false
+		}
+		if rule.Forecast != "" {
+			if engine.forecast == nil {
+				return 0, false
+			}
+			value, err := engine.forecast(rule.SKU, rule.Forecast)
+			return value, err == nil
+		}
+		stock, err := inventory.StockFromReading(*product, reading)
+		if err != nil {
+			return 0, false
+		}
+		return float64(stock.Count), true
+	}
+	if rule.Bus != reading.Bus || rule.Sensor != reading.Sensor {
+		return 0, false
+	}
+	value, err := readgroups.CalculatedValue(&reading, rule.Key)
+	return value, err == nil
+}
+
+//check follows the threshold of kind of rule. beyond tells if the value read
+//is beyond the threshold and back if it is back in range, past the hysteresis.
+//It returns true if an alarm was raised or cleared
+func (engine *Engine) check(rule common.AlarmRule, kind string, threshold float64,
+	beyond bool, back bool, value float64, reading common.Reading) bool {
+	key := watchKey(rule.ID, kind)
+	w, ok := engine.watches[key]
+	if !ok {
+		w = &watch{}
+		engine.watches[key] = w
+	}
+	debounce := rule.Debounce
+	if debounce < 1 {
+		debounce = 1
+	}
+
+	if w.alarmID == 0 {
+		if !beyond {
+			w.count = 0
+			return false
+		}
+		if w.count++; w.count < debounce {
+			return false
+		}
+		alarm := common.Alarm{ID: engine.nextAlarmID, RuleID: rule.ID, Name: rule.Name,
+			Kind: kind, State: common.Raised, Bus: reading.Bus, Sensor: reading.Sensor,
+			Key: rule.Key, SKU: rule.SKU, Threshold: threshold, Value: value, Raised: reading.Time}
+		engine.nextAlarmID++
+		engine.alarms = append(engine.alarms, alarm)
+		engine.emit(alarm, reading.Time)
+		w.alarmID, w.count = alarm.ID, 0
+		log.Printf("Alarm %d raised: %s value %v is %s, threshold %v\n", alarm.ID, rule.Name, value, kind, threshold)
+		return true
+	}
+
+	if !back {
+		w.count = 0
+		return false
+	}
+	if w.count++; w.count < debounce {
+		return false
+	}
+	if alarm := engine.alarm(w.alarmID); alarm != nil {
+		alarm.State = common.Cleared
+		alarm.Cleared = reading.Time
+		engine.emit(*alarm, reading.Time)
+		log.Printf("Alarm %d cleared: %s value %v\n", alarm.ID, rule.Name, value)
+	}
+	w.alarmID, w.count = 0, 0
+	return true
+}
+
+//Update checks reading against the alarm rules watching its sensor.
+//It is meant to be called with every reading done
+func (engine *Engine) Update(reading common.Reading) {
+	reading.Bus = common.BusName(reading.Bus)
+	if reading.Time == "" {
+		reading.Time = time.Now().Format(common.TimeFormat)
+	}
+	engine.mutex.Lock()
+	defer engine.events.Flush()
+	defer engine.mutex.Unlock()
+	changed := false
+	for _, rule := range engine.sortedRules() {
+		value, ok := engine.value(rule, reading)
+		if !ok {
+			continue
+		}
+		if rule.Low != nil && engine.check(rule, common.LowAlarm, *rule.Low,
+			value < *rule.Low, value >= *rule.Low+rule.Hysteresis, value, reading) {
+			changed = true
+		}
+		if rule.High != nil && engine.check(rule, common.HighAlarm, *rule.High,
+			value > *rule.High, value <= *rule.High-rule.Hysteresis, value, reading) {
+			changed = true
+		}
+	}
+	if changed {
+		if err := engine.saveAlarms(); err != nil {
+			log.Printf("Error saving the alarms: %s\n", err.Error())
+		}
+	}
+}
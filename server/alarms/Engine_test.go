@@ -0,0 +1,240 @@
+package alarms_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/alarms"
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/internal/fixtures"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+func newEngineForTest(t *testing.T) (persistenceprovider.PersistenceProvider, *inventory.Inventory, *alarms.Engine) {
+	cp := fixtures.Scale(t)
+	pp := fixtures.PersistenceProvider(t)
+	inv := fixtures.Inventory(t, &cp, &pp)
+	engine, err := alarms.Engine{}.NewEngine(&pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when creating the alarm engine, got %s", err.Error())
+	}
+	return pp, inv, engine
+}
+
+func newReadingForTest(value float64, minute int) common.Reading {
+	reading := common.Reading{Sensor: 3, Type: common.Input, StartLocation: 100, Count: 1,
+		Time: time.Date(2016, 4, 3, 12, minute, 0, 0, time.UTC).Format(common.TimeFormat)}
+	reading.InitCalculatedValues()
+	reading.CalculatedValues["100"] = value
+	return reading
+}
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func TestAlarmHysteresisAndDebounce(t *testing.T) {
+	_, _, engine := newEngineForTest(t)
+	rule, err := engine.AddRule(common.AlarmRule{Name: "weight", Sensor: 3, Key: "100",
+		Low: float(100), High: float(1000), Hysteresis: 20, Debounce: 2})
+	if err != nil {
+		t.Fatalf("No error expected when adding a rule, got %s", err.Error())
+	}
+
+	values := []struct {
+		value  float64
+		states []string
+	}{
+		{500, nil},
+		{90, nil},
+		{500, nil},
+		{90, nil},
+		{80, []string{common.Raised}},
+		{110, []string{common.Raised}},
+		{130, []string{common.Raised}},
+		{90, []string{common.Raised}},
+		{125, []string{common.Raised}},
+		{121, []string{common.Cleared}},
+		{1100, []string{common.Cleared}},
+		{1200, []string{common.Cleared, common.Raised}},
+	}
+	for i, v := range values {
+		engine.Update(newReadingForTest(v.value, i))
+		alarmList := engine.GetAlarms("")
+		if len(alarmList) != len(v.states) {
+			t.Fatalf("Expected %v after reading %v, got %v", v.states, v.value, alarmList)
+		}
+		for j, state := range v.states {
+			if alarmList[j].State != state {
+				t.Fatalf("Expected %v after reading %v, got %v", v.states, v.value, alarmList)
+			}
+		}
+	}
+
+	alarmList := engine.GetAlarms("")
+	if alarmList[0].Kind != common.LowAlarm || alarmList[0].Value != 80 || alarmList[0].RuleID != rule.ID ||
+		alarmList[0].Raised != "2016-04-03T12:04:00" || alarmList[0].Cleared != "2016-04-03T12:09:00" {
+		t.Fatalf("Expected the low alarm raised at 12:04 and cleared at 12:09, got %v", alarmList[0])
+	}
+	if alarmList[1].Kind != common.HighAlarm || alarmList[1].Threshold != 1000 {
+		t.Fatalf("Expected the high alarm, got %v", alarmList[1])
+	}
+	if active := engine.GetAlarms(alarms.Active); len(active) != 1 || active[0].ID != alarmList[1].ID {
+		t.Fatalf("Expected only the high alarm to be active, got %v", active)
+	}
+}
+
+func TestAlarmAcknowledge(t *testing.T) {
+	pp, inv, engine := newEngineForTest(t)
+	var events []common.Event
+	engine.AddEventListener(func(event common.Event) {
+		events = append(events, event)
+	})
+	engine.AddRule(common.AlarmRule{Name: "weight", Sensor: 3, Key: "100", High: float(1000)})
+	engine.Update(newReadingForTest(1100, 0))
+
+	alarm, err := engine.Acknowledge(1)
+	if err != nil {
+		t.Fatalf("No error expected when acknowledging an alarm, got %s", err.Error())
+	}
+	if alarm.State != common.Acknowledged || alarm.Acknowledged == "" {
+		t.Fatalf("Expected the alarm to be acknowledged, got %v", alarm)
+	}
+	if _, err = engine.Acknowledge(1); err == nil {
+		t.Fatal("Expected error when acknowledging an alarm twice, got nil")
+	}
+	if len(events) != 2 || events[0].Type != common.AlarmRaisedEvent ||
+		events[0].Time != "2016-04-03T12:00:00" || events[1].Type != common.AlarmAcknowledgedEvent ||
+		events[1].Alarm.ID != 1 {
+		t.Fatalf("Expected the raised and acknowledged events, got %v", events)
+	}
+	if _, err = engine.Acknowledge(2); err == nil {
+		t.Fatal("Expected error when acknowledging a missing alarm, got nil")
+	}
+
+	loaded, err := alarms.Engine{}.NewEngine(&pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when loading the alarm engine, got %s", err.Error())
+	}
+	if len(loaded.GetRules()) != 1 || len(loaded.GetAlarms(common.Acknowledged)) != 1 {
+		t.Fatalf("Expected the rule and the alarm to be loaded, got %v, %v",
+			loaded.GetRules(), loaded.GetAlarms(""))
+	}
+	loaded.Update(newReadingForTest(900, 1))
+	if alarm, _ = loaded.GetAlarm(1); alarm.State != common.Cleared {
+		t.Fatalf("Expected the loaded alarm to be cleared, got %v", alarm)
+	}
+	loaded.Update(newReadingForTest(1100, 2))
+	if alarm, err = loaded.GetAlarm(2); err != nil || alarm.State != common.Raised {
+		t.Fatalf("Expected a new alarm with the next id, got %v, %v", alarm, err)
+	}
+}
+
+func TestAlarmChangeRule(t *testing.T) {
+	_, _, engine := newEngineForTest(t)
+	rule, _ := engine.AddRule(common.AlarmRule{Name: "weight", Sensor: 3, Key: "100",
+		Low: float(100), High: float(1000)})
+	engine.Update(newReadingForTest(50, 0))
+
+	//changing a threshold keeps the alarm
+	rule.Low = float(80)
+	if err := engine.ChangeRule(rule.ID, *rule); err != nil {
+		t.Fatalf("No error expected when changing a rule, got %s", err.Error())
+	}
+	if active := engine.GetAlarms(alarms.Active); len(active) != 1 || active[0].Kind != common.LowAlarm {
+		t.Fatalf("Expected the low alarm to stay active, got %v", active)
+	}
+
+	//removing the threshold clears its alarm
+	rule.Low = nil
+	engine.ChangeRule(rule.ID, *rule)
+	if active := engine.GetAlarms(alarms.Active); len(active) != 0 {
+		t.Fatalf("Expected the alarm of the removed threshold to be cleared, got %v", active)
+	}
+
+	//watching another value clears the alarms of the old one
+	engine.Update(newReadingForTest(1100, 1))
+	rule.Key = "100.net"
+	engine.ChangeRule(rule.ID, *rule)
+	if active := engine.GetAlarms(alarms.Active); len(active) != 0 {
+		t.Fatalf("Expected the alarm of the value no longer watched to be cleared, got %v", active)
+	}
+	engine.Update(newReadingForTest(1100, 2))
+	if alarmList := engine.GetAlarms(""); len(alarmList) != 2 {
+		t.Fatalf("Expected no alarm raised on the value no longer watched, got %v", alarmList)
+	}
+}
+
+func TestAlarmOnProductStock(t *testing.T) {
+	_, inv, engine := newEngineForTest(t)
+	fixtures.AddProducts(t, inv, fixtures.Toner("38A", 0))
+	if _, err := engine.AddRule(common.AlarmRule{Name: "toner", SKU: "38A", Low: float(2)}); err != nil {
+		t.Fatalf("No error expected when adding a product rule, got %s", err.Error())
+	}
+	engine.Update(newReadingForTest(2500, 0))
+	engine.Update(newReadingForTest(1500, 1))
+	alarmList := engine.GetAlarms(common.Raised)
+	if len(alarmList) != 1 || alarmList[0].SKU != "38A" || alarmList[0].Value != 1 ||
+		alarmList[0].Sensor != 3 {
+		t.Fatalf("Expected an alarm for 1 unit of 38A, got %v", alarmList)
+	}
+
+	if err := engine.RemoveRule(1); err != nil {
+		t.Fatalf("No error expected when removing a rule, got %s", err.Error())
+	}
+	if len(engine.GetAlarms(alarms.Active)) != 0 {
+		t.Fatalf("Expected the alarms of the removed rule to be cleared, got %v", engine.GetAlarms(""))
+	}
+}
+
+func TestAlarmOnProductForecast(t *testing.T) {
+	_, inv, engine := newEngineForTest(t)
+	fixtures.AddProducts(t, inv, fixtures.Toner("38A", 0))
+	days := 10.0
+	engine.SetForecast(func(sku string, value string) (float64, error) {
+		if sku != "38A" || value != common.DaysUntilEmpty {
+			t.Fatalf("Expected the days until 38A is empty to be asked, got %s of %s", value, sku)
+		}
+		return days, nil
+	})
+	_, err := engine.AddRule(common.AlarmRule{Name: "toner runs out", SKU: "38A",
+		Forecast: common.DaysUntilEmpty, Low: float(7)})
+	if err != nil {
+		t.Fatalf("No error expected when adding a forecast rule, got %s", err.Error())
+	}
+	engine.Update(newReadingForTest(5000, 0))
+	if len(engine.GetAlarms("")) != 0 {
+		t.Fatalf("Expected no alarm with 10 days left, got %v", engine.GetAlarms(""))
+	}
+	days = 5
+	engine.Update(newReadingForTest(4000, 1))
+	alarmList := engine.GetAlarms(common.Raised)
+	if len(alarmList) != 1 || alarmList[0].Value != 5 || alarmList[0].Threshold != 7 {
+		t.Fatalf("Expected an alarm for 5 days left, got %v", alarmList)
+	}
+}
+
+func TestAlarmRulesShouldFail(t *testing.T) {
+	_, _, engine := newEngineForTest(t)
+	invalid := []common.AlarmRule{
+		common.AlarmRule{Sensor: 3, Low: float(1)},
+		common.AlarmRule{Sensor: 3, Key: "100", SKU: "38A", Low: float(1)},
+		common.AlarmRule{Sensor: 3, Key: "100"},
+		common.AlarmRule{Sensor: 3, Key: "100", Low: float(10), High: float(5)},
+		common.AlarmRule{Sensor: 3, Key: "100", Low: float(1), Hysteresis: -1},
+		common.AlarmRule{SKU: "missing", Low: float(1)},
+		common.AlarmRule{Sensor: 3, Key: "100", Forecast: common.DaysUntilEmpty, Low: float(1)},
+	}
+	for _, rule := range invalid {
+		if _, err := engine.AddRule(rule); err == nil {
+			t.Fatalf("Expected error when adding %v, got nil", rule)
+		}
+	}
+	if err := engine.ChangeRule(1, common.AlarmRule{Sensor: 3, Key: "100", Low: float(1)}); err == nil {
+		t.Fatal("Expected error when changing a missing rule, got nil")
+	}
+	if err := engine.RemoveRule(1); err == nil {
+		t.Fatal("Expected error when removing a missing rule, got nil")
+	}
+}
@@ -0,0 +1,45 @@
+package common
+
+import "sync"
+
+//EventQueue keeps the event listeners of an alarm engine, an inventory, a
+//purchase order manager or a movement detector and the events queued for
+//them. The events are queued while their sender is locked and sent by
+//Flush once it is unlocked, so that the listeners can call the sender back
+type EventQueue struct {
+	listeners []EventListener
+	events    []Event
+	mutex     *sync.Mutex
+}
+
+//NewEventQueue returns an empty EventQueue
+func (EventQueue) NewEventQueue() *EventQueue {
+	return &EventQueue{mutex: &sync.Mutex{}}
+}
+
+//AddListener adds listener to the listeners told of the flushed events
+func (queue *EventQueue) AddListener(listener EventListener) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.listeners = append(queue.listeners, listener)
+}
+
+//Emit queues event until the next Flush
+func (queue *EventQueue) Emit(event Event) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.events = append(queue.events, event)
+}
+
+//Flush sends the queued events to the listeners, in the order they were queued
+func (queue *EventQueue) Flush() {
+	queue.mutex.Lock()
+	events, listeners := queue.events, queue.listeners
+	queue.events = nil
+	queue.mutex.Unlock()
+	for _, event := range events {
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+}
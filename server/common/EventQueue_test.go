@@ -0,0 +1,32 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+func TestEventQueueFlush(t *testing.T) {
+	queue := common.EventQueue{}.NewEventQueue()
+	var received []string
+	queue.AddListener(func(event common.Event) {
+		received = append(received, event.Type)
+		//a listener can queue more events, they are sent by the next flush
+		if event.Type == common.StockLowEvent {
+			queue.Emit(common.Event{Type: common.AlarmRaisedEvent})
+		}
+	})
+	queue.Emit(common.Event{Type: common.StockChangedEvent})
+	queue.Emit(common.Event{Type: common.StockLowEvent})
+	if len(received) != 0 {
+		t.Fatalf("Expected no events sent before the flush, got %v", received)
+	}
+	queue.Flush()
+	if len(received) != 2 || received[0] != common.StockChangedEvent || received[1] != common.StockLowEvent {
+		t.Fatalf("Expected the events in the order they were queued, got %v", received)
+	}
+	queue.Flush()
+	if len(received) != 3 || received[2] != common.AlarmRaisedEvent {
+		t.Fatalf("Expected the event queued by the listener, got %v", received)
+	}
+}
@@ -1,6 +1,14 @@
 package common
 
-//A sensor has an address and several registers
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+//A sensor is found on a bus and has an address on that bus.
+//It has several registers
 //each register has a type and a location.
 //A reading is done by specifying a sensor address,
 //the type of reading (which implies the type of registers)
@@ -22,14 +30,157 @@ const (
 	Float32 = "float32"
 	Uint32  = "uint32"
 	Int32   = "int32"
+	Int16   = "int16"
+	Uint16  = "uint16"
+	Int64   = "int64"
+	Uint64  = "uint64"
+	Float64 = "float64"
+	//BCD is a number kept with one decimal digit in every 4 bits
+	BCD = "bcd"
+	//Bitfield gives the state of every bit of the registers
+	Bitfield = "bitfield"
+	//String is ASCII text kept with 2 characters in every register
+	String = "string"
+	//Hundredths is the weight sent by the sensors as an integer part
+	//and a register holding the two decimals
+	Hundredths = "hundredths"
+	//Timestamp is the time of the reading as kept by the sensor RTC,
+	//in 6 registers: year, month, day, hour, minute and second
+	Timestamp = "timestamp"
+	//byte orders of the values kept in several registers.
+	//A is the most significant byte, ABCD means big endian
+	//with the high word first
+	ABCD = "ABCD"
+	CDAB = "CDAB"
+	BADC = "BADC"
+	DCBA = "DCBA"
+	//bus transports
+	RTU        = "rtu"
+	ASCII      = "ascii"
+	TCP        = "tcp"
+	RTUOverTCP = "rtuovertcp"
+	//DefaultBus is the bus used when none is specified
+	DefaultBus = "default"
+	//alarm kinds
+	LowAlarm  = "low"
+	HighAlarm = "high"
+	//forecast values watched by the alarm rules
+	ForecastRate   = "rate"
+	DaysUntilEmpty = "daysUntilEmpty"
+	DaysUntilMin   = "daysUntilMin"
+	//alarm states
+	Raised       = "raised"
+	Acknowledged = "acknowledged"
+	Cleared      = "cleared"
+	//event types
+	AlarmRaisedEvent       = "alarm.raised"
+	AlarmAcknowledgedEvent = "alarm.acknowledged"
+	AlarmClearedEvent      = "alarm.cleared"
+	StockChangedEvent      = "stock.changed"
+	StockLowEvent          = "stock.low"
+	OrderDraftedEvent      = "order.drafted"
+	OrderApprovedEvent     = "order.approved"
+	OrderSentEvent         = "order.sent"
+	OrderReceivedEvent     = "order.received"
+	OrderCancelledEvent    = "order.cancelled"
+	RefillEvent            = "movement.refill"
+	RemovalEvent           = "movement.removal"
+	//purchase order states
+	Draft     = "draft"
+	Approved  = "approved"
+	Sent      = "sent"
+	Received  = "received"
+	Cancelled = "cancelled"
+	//movement types
+	Refill  = "refill"
+	Removal = "removal"
+)
+
+//Constants used when commissioning a new sensor. A new sensor answers
+//at NewSensorAddress until the server writes its address in
+//the holding register AddressRegister
+const (
+	NewSensorAddress uint8  = 100
+	AddressRegister  uint16 = 10
 )
 
-//Sensor represents a sensor with several configured registers
+//BusConfig describes how the server reaches the sensors of a modbus line.
+//Address is the serial port for rtu and ascii and host:port for
+//tcp and rtuovertcp. The serial settings are only used by rtu and ascii
+type BusConfig struct {
+	Name      string        `json:"name"`
+	Transport string        `json:"transport"`
+	Address   string        `json:"address"`
+	Timeout   time.Duration `json:"timeout,omitempty"`
+	SerialConfig
+}
+
+//SerialConfig is the struct holding the configuration for the serial port.
+//Delay is the silence kept on the line between two requests
+type SerialConfig struct {
+	BaudRate int           `json:"baudRate,omitempty"`
+	DataBits int           `json:"dataBits,omitempty"`
+	Parity   string        `json:"parity,omitempty"`
+	StopBits int           `json:"stopBits,omitempty"`
+	Delay    time.Duration `json:"delay,omitempty"`
+}
+
+//IsSerial returns true if the transport of the bus uses a serial port
+func (busConfig BusConfig) IsSerial() bool {
+	return busConfig.Transport == RTU || busConfig.Transport == ASCII
+}
+
+//IsByteOrderValid checks if the byte order is one of the known ones
+func IsByteOrderValid(byteOrder string) bool {
+	return byteOrder == ABCD || byteOrder == CDAB ||
+		byteOrder == BADC || byteOrder == DCBA
+}
+
+//IsTransportValid checks if the transport is one of the known ones
+func IsTransportValid(transport string) bool {
+	return transport == RTU || transport == ASCII ||
+		transport == TCP || transport == RTUOverTCP
+}
+
+//BusName returns the name of the bus or DefaultBus if no name is set
+func BusName(bus string) string {
+	if bus == "" {
+		return DefaultBus
+	}
+	return bus
+}
+
+//SensorKey returns the key identifying the sensor having
+//address on bus
+func SensorKey(bus string, address uint8) string {
+	return BusName(bus) + ":" + strconv.Itoa(int(address))
+}
+
+//Sensor represents a sensor with several configured registers.
+//Tares keeps every tare set on the read groups of the sensor, ordered by
+//the time since they are used
 type Sensor struct {
+	Bus         string      `json:"bus,omitempty"`
 	Address     uint8       `json:"address"` //485 address
 	Description string      `json:"description,omitempty"`
 	Registers   []Register  `json:"registers"`
 	ReadGroups  []ReadGroup `json:"readGroups"`
+	Tares       []Tare      `json:"tares,omitempty"`
+}
+
+//Tare is the weight of the container put on the sensor, in the unit of
+//the read group starting at StartLocation. It is subtracted from the
+//values read since Since (in TimeFormat) until the next tare of the read group
+type Tare struct {
+	StartLocation uint16  `json:"startLocation"`
+	Value         float64 `json:"value"`
+	Since         string  `json:"since"`
+	Description   string  `json:"description,omitempty"`
+}
+
+//Key returns the key identifying the sensor
+func (sensor Sensor) Key() string {
+	return SensorKey(sensor.Bus, sensor.Address)
 }
 
 //Register represents a register (coil, holding, input, input discrete)
@@ -39,16 +190,56 @@ type Register struct {
 	Type     string `json:"type"`
 }
 
+//CanWrite checks that every location written, from startLocation to
+//startLocation+count-1, is configured on the sensor as a register of
+//registerType. Only holding registers and coils can be written
+func (sensor Sensor) CanWrite(registerType string, startLocation uint16, count uint16) error {
+	if registerType != Holding && registerType != Coil {
+		return fmt.Errorf("Registers of type %s can not be written", registerType)
+	}
+	if count == 0 {
+		return errors.New("Nothing to write")
+	}
+	configured := make(map[uint16]bool)
+	for _, register := range sensor.Registers {
+		if register.Type == registerType {
+			configured[register.Location] = true
+		}
+	}
+	for i := uint16(0); i < count; i++ {
+		if !configured[startLocation+i] {
+			return fmt.Errorf("The sensor %d has no %s register at location %d",
+				sensor.Address, registerType, startLocation+i)
+		}
+	}
+	return nil
+}
+
+//Write represents a write of Values in the holding registers
+//or coils of a sensor. Coils are written as 0 or 1
+type Write struct {
+	Bus           string   `json:"bus,omitempty"`
+	Sensor        uint8    `json:"sensor"`
+	Type          string   `json:"type"`
+	StartLocation uint16   `json:"startLocation"`
+	Values        []uint16 `json:"values"`
+}
+
 //Reading represents a reading from a Sensor
-//and the representation of its values
+//and the representation of its values. Time is the time the server
+//received the reading and SensorTime the time reported by the sensor, if any
 type Reading struct {
+	Bus              string                 `json:"bus,omitempty"`
 	Sensor           uint8                  `json:"sensor"`
 	Type             string                 `json:"type"`
 	StartLocation    uint16                 `json:"startLocation"`
 	Count            uint16                 `json:"count"`
 	ReadValues       []uint16               `json:"readValues"`
 	Time             string                 `json:"time"`
+	SensorTime       string                 `json:"sensorTime,omitempty"`
 	CalculatedValues map[string]interface{} `json:"calculatedValues"`
+	CalculateErrors  map[string]string      `json:"calculateErrors,omitempty"`
+	Units            map[string]string      `json:"units,omitempty"`
 }
 
 //InitCalculatedValues initiates the map that will hold the calculated values
@@ -57,18 +248,229 @@ func (reading *Reading) InitCalculatedValues() {
 	reading.CalculatedValues = make(map[string]interface{})
 }
 
+//SetCalculateError records the error that happened while calculating
+//the value of the read group starting at startLocation
+func (reading *Reading) SetCalculateError(startLocation uint16, err error) {
+	if reading.CalculateErrors == nil {
+		reading.CalculateErrors = make(map[string]string)
+	}
+	reading.CalculateErrors[strconv.Itoa(int(startLocation))] = err.Error()
+}
+
+//SetUnit records the unit of the value calculated by
+//the read group starting at startLocation
+func (reading *Reading) SetUnit(startLocation uint16, unit string) {
+	if reading.Units == nil {
+		reading.Units = make(map[string]string)
+	}
+	reading.Units[strconv.Itoa(int(startLocation))] = unit
+}
+
 //ReadGroup uses the values of a group of registers
-//to calculate a resultant value
+//to calculate a resultant value. The value is calculated by the
+//ReadGroupWorker registered for ResultType. ByteOrder is used by the
+//values kept in several registers, empty means the default of ResultType.
+//Length is the number of registers used by the result types having a
+//variable length (bcd, bitfield and string).
+//The calculated value is first mapped through the Calibration points (if any),
+//then multiplied by Scale (if not 0), Offset is added and it is rounded to
+//Precision decimals (if set). Unit is the engineering unit of the resulting value.
+//A change of the value of at least MinStep that stays stable for Settle
+//readings (3 if 0) is logged as a refill or a removal
 type ReadGroup struct {
-	SensorAddress   uint8  `json:"sensorAddress"`
-	StartLocation   uint16 `json:"startLocation"`
-	ResultType      string `json:"resultType"`
-	ReadGroupWorker `json:"-"`
+	SensorAddress uint8              `json:"sensorAddress"`
+	StartLocation uint16             `json:"startLocation"`
+	ResultType    string             `json:"resultType"`
+	ByteOrder     string             `json:"byteOrder,omitempty"`
+	Length        uint16             `json:"length,omitempty"`
+	Scale         float64            `json:"scale,omitempty"`
+	Offset        float64            `json:"offset,omitempty"`
+	Precision     *int               `json:"precision,omitempty"`
+	Unit          string             `json:"unit,omitempty"`
+	Calibration   []CalibrationPoint `json:"calibration,omitempty"`
+	MinStep       float64            `json:"minStep,omitempty"`
+	Settle        int                `json:"settle,omitempty"`
+}
+
+//CalibrationPoint maps the Raw value calculated by a read group
+//to the known Value measured when calibrating
+type CalibrationPoint struct {
+	Raw   float64 `json:"raw"`
+	Value float64 `json:"value"`
+}
+
+//Key returns the key of the value calculated by the read group
+//in Reading.CalculatedValues
+func (rg ReadGroup) Key() string {
+	return strconv.Itoa(int(rg.StartLocation))
+}
+
+//NetKey returns the key of the net value (the value without the tare)
+//calculated by the read group in Reading.CalculatedValues
+func (rg ReadGroup) NetKey() string {
+	return rg.Key() + ".net"
+}
+
+//Product is an item kept in stock on a sensor. Its weight is calculated by
+//the read group starting at StartLocation on the sensor. UnitWeight is the
+//weight of one unit of product and Tare the weight of the container holding
+//the units, both in Unit or in the unit of the read group if Unit is not
+//set. MinStock is the count of units under which the stock is low
+type Product struct {
+	SKU           string  `json:"sku"`
+	Name          string  `json:"name"`
+	UnitWeight    float64 `json:"unitWeight"`
+	Unit          string  `json:"unit,omitempty"`
+	Tare          float64 `json:"tare,omitempty"`
+	MinStock      int     `json:"minStock,omitempty"`
+	Bus           string  `json:"bus,omitempty"`
+	Sensor        uint8   `json:"sensor"`
+	StartLocation uint16  `json:"startLocation"`
+}
+
+//Stock is the quantity of a product found in a reading. Weight is the
+//net weight of the product and Count the number of units in that weight
+type Stock struct {
+	SKU      string  `json:"sku"`
+	Name     string  `json:"name"`
+	Weight   float64 `json:"weight"`
+	Unit     string  `json:"unit,omitempty"`
+	Count    int     `json:"count"`
+	MinStock int     `json:"minStock,omitempty"`
+	Low      bool    `json:"low"`
+	Time     string  `json:"time"`
+}
+
+//AlarmRule watches a value against its Low and High thresholds. The value is
+//either the calculated value having Key in the readings of Sensor on Bus or,
+//if SKU is set, the count of units in stock of the product. If Forecast is
+//also set, the value is the forecast value (ForecastRate, DaysUntilEmpty or
+//DaysUntilMin) of the product instead of its stock. An alarm is raised
+//when the value stays beyond a threshold for Debounce readings (at least one)
+//and it is cleared when the value gets back over Low+Hysteresis or under
+//High-Hysteresis for Debounce readings
+type AlarmRule struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Bus        string   `json:"bus,omitempty"`
+	Sensor     uint8    `json:"sensor,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	SKU        string   `json:"sku,omitempty"`
+	Forecast   string   `json:"forecast,omitempty"`
+	Low        *float64 `json:"low,omitempty"`
+	High       *float64 `json:"high,omitempty"`
+	Hysteresis float64  `json:"hysteresis,omitempty"`
+	Debounce   int      `json:"debounce,omitempty"`
+}
+
+//Alarm is raised by an AlarmRule when its value goes beyond the threshold of
+//Kind (low or high). State is raised, acknowledged or cleared and the times
+//of the state changes are in TimeFormat
+type Alarm struct {
+	ID           int     `json:"id"`
+	RuleID       int     `json:"ruleId"`
+	Name         string  `json:"name"`
+	Kind         string  `json:"kind"`
+	State        string  `json:"state"`
+	Bus          string  `json:"bus,omitempty"`
+	Sensor       uint8   `json:"sensor,omitempty"`
+	Key          string  `json:"key,omitempty"`
+	SKU          string  `json:"sku,omitempty"`
+	Threshold    float64 `json:"threshold"`
+	Value        float64 `json:"value"`
+	Raised       string  `json:"raised"`
+	Acknowledged string  `json:"acknowledged,omitempty"`
+	Cleared      string  `json:"cleared,omitempty"`
 }
 
+//IsActive returns true if the alarm is not cleared yet
+func (alarm Alarm) IsActive() bool {
+	return alarm.State == Raised || alarm.State == Acknowledged
+}
+
+//Supplier delivers the Products in LeadTime days from the order
+type Supplier struct {
+	ID       int               `json:"id"`
+	Name     string            `json:"name"`
+	Email    string            `json:"email,omitempty"`
+	LeadTime float64           `json:"leadTime"`
+	Products []SupplierProduct `json:"products"`
+}
+
+//SupplierProduct is a product delivered by a supplier. The product is
+//ordered in multiples of ReorderQuantity units
+type SupplierProduct struct {
+	SKU             string `json:"sku"`
+	ReorderQuantity int    `json:"reorderQuantity"`
+}
+
+//PurchaseOrder orders Quantity units of the product having SKU from a
+//supplier. State goes from draft to approved, sent and received, or to
+//cancelled. Received is the count of units received so far and the
+//times of the state changes are in TimeFormat
+type PurchaseOrder struct {
+	ID         int    `json:"id"`
+	SupplierID int    `json:"supplierId"`
+	Supplier   string `json:"supplier"`
+	SKU        string `json:"sku"`
+	Quantity   int    `json:"quantity"`
+	Received   int    `json:"received"`
+	State      string `json:"state"`
+	Reason     string `json:"reason,omitempty"`
+	Created    string `json:"created"`
+	Approved   string `json:"approved,omitempty"`
+	Sent       string `json:"sent,omitempty"`
+	Closed     string `json:"closed,omitempty"`
+}
+
+//IsOpen returns true if the order was not received or cancelled yet
+func (order PurchaseOrder) IsOpen() bool {
+	return order.State == Draft || order.State == Approved || order.State == Sent
+}
+
+//Movement is a step change of the value calculated by a read group, a
+//refill if the value went up or a removal if it went down. Delta is the
+//change of the value from Before to After, in Unit. If the read group holds
+//a product, SKU is set and Quantity is the count of units moved
+type Movement struct {
+	ID       int     `json:"id"`
+	Type     string  `json:"type"`
+	Bus      string  `json:"bus"`
+	Sensor   uint8   `json:"sensor"`
+	Key      string  `json:"key"`
+	SKU      string  `json:"sku,omitempty"`
+	Delta    float64 `json:"delta"`
+	Quantity int     `json:"quantity,omitempty"`
+	Before   float64 `json:"before"`
+	After    float64 `json:"after"`
+	Unit     string  `json:"unit,omitempty"`
+	Time     string  `json:"time"`
+}
+
+//Event is sent to the notification channels when an alarm changes its
+//state, when the stock of a product changes, when a purchase order
+//changes its state or when a movement is detected. Alarm is set for the
+//alarm events, Stock and Previous (the stock before the change) for the
+//stock events, Order for the order events and Movement for the movement events
+type Event struct {
+	Type     string         `json:"type"`
+	Time     string         `json:"time"`
+	Alarm    *Alarm         `json:"alarm,omitempty"`
+	Stock    *Stock         `json:"stock,omitempty"`
+	Previous *Stock         `json:"previous,omitempty"`
+	Order    *PurchaseOrder `json:"order,omitempty"`
+	Movement *Movement      `json:"movement,omitempty"`
+}
+
+//EventListener is called with the events of an alarm engine, an inventory,
+//a purchase order manager or a movement detector
+type EventListener func(Event)
+
 //ReadGroupWorker defines the methods needed to
-//initialize a ReadGroup and obtain the value defined by it
+//initialize a ReadGroup and obtain the value defined by it.
+//RegisterCount is the number of registers used to calculate the value
 type ReadGroupWorker interface {
+	NewReadGroup(uint8, uint16) (ReadGroupWorker, error)
 	Calculate(*Reading) (interface{}, error)
-	NewReadGroup(uint8, uint16) (*ReadGroup, error)
+	RegisterCount() uint16
 }
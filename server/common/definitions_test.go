@@ -0,0 +1,34 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+func TestSensorCanWrite(t *testing.T) {
+	sensor := common.Sensor{Address: 1, Registers: []common.Register{
+		common.Register{Location: 10, Type: common.Holding},
+		common.Register{Location: 11, Type: common.Holding},
+		common.Register{Location: 100, Type: common.Input},
+		common.Register{Location: 1, Type: common.Coil}}}
+
+	if err := sensor.CanWrite(common.Holding, 10, 2); err != nil {
+		t.Fatalf("No error expected when writing the configured holding registers, got %s", err.Error())
+	}
+	if err := sensor.CanWrite(common.Coil, 1, 1); err != nil {
+		t.Fatalf("No error expected when writing the configured coil, got %s", err.Error())
+	}
+	if err := sensor.CanWrite(common.Holding, 10, 3); err == nil {
+		t.Fatal("Expected error when writing past the configured registers, got nil")
+	}
+	if err := sensor.CanWrite(common.Input, 100, 1); err == nil {
+		t.Fatal("Expected error when writing an input register, got nil")
+	}
+	if err := sensor.CanWrite(common.Coil, 10, 1); err == nil {
+		t.Fatal("Expected error when writing a holding register as a coil, got nil")
+	}
+	if err := sensor.CanWrite(common.Holding, 10, 0); err == nil {
+		t.Fatal("Expected error when writing nothing, got nil")
+	}
+}
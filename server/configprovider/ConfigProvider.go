@@ -1,19 +1,107 @@
 package configprovider
 
-import "github.com/adiclepcea/SensInventory/server/common"
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
 
 //ConfigProvider is a prototype for a configuration manager
 type ConfigProvider interface {
 	NewConfigProvider(params ...string) (ConfigProvider, error)
 	SetAddressLimits(minAddress uint8, maxAddress uint8) error
-	IsSensorAddressTaken(address uint8) (bool, error)
+	GetAddressLimits() (minAddress uint8, maxAddress uint8)
+	IsSensorAddressTaken(bus string, address uint8) (bool, error)
 	IsSensorValid(sensor common.Sensor) error
 	AddSensor(sensor common.Sensor) error
-	RemoveSensorByAddress(address uint8) error
+	RemoveSensorByAddress(bus string, address uint8) error
 	RemoveSensor(sensor common.Sensor) error
-	GetSensorByAddress(address uint8) (*common.Sensor, error)
-	ChangeSensorAddress(addressBefore uint8, addressAfter uint8) error
-	ChangeSensor(address uint8, after common.Sensor) error
+	GetSensorByAddress(bus string, address uint8) (*common.Sensor, error)
+	ChangeSensorAddress(bus string, addressBefore uint8, addressAfter uint8) error
+	ChangeSensor(bus string, address uint8, after common.Sensor) error
+	SetReadGroupCalibration(bus string, address uint8, startLocation uint16, calibration []common.CalibrationPoint) (*common.ReadGroup, error)
+	AddTare(bus string, address uint8, tare common.Tare) (*common.Tare, error)
 	GetSensors() map[string]common.Sensor
+	GetBuses() map[string]common.BusConfig
+	GetBus(name string) (*common.BusConfig, error)
+	SetBus(busConfig common.BusConfig) error
+	RemoveBus(name string) error
 	//SetTimers([]common.IntervalTimer)
 }
+
+//isBusConfigValid checks the transport and, for the serial transports,
+//the serial port settings of busConfig
+func isBusConfigValid(busConfig common.BusConfig) error {
+	var err error
+	if busConfig.Name == "" {
+		err = errors.New("The bus must have a name")
+	} else if !common.IsTransportValid(busConfig.Transport) {
+		err = fmt.Errorf("Transport %s unknown", busConfig.Transport)
+	} else if busConfig.Address == "" {
+		err = errors.New("The bus must have an address")
+	} else if busConfig.Timeout < 0 || busConfig.Delay < 0 {
+		err = errors.New("The timeout and the delay of the bus can not be negative")
+	} else if busConfig.IsSerial() {
+		err = isSerialConfigValid(busConfig.SerialConfig)
+	}
+	if err != nil {
+		log.Println(err.Error())
+	}
+	return err
+}
+
+//isSerialConfigValid checks the serial port settings. Zero values are
+//accepted as they mean the default will be used
+func isSerialConfigValid(serialConfig common.SerialConfig) error {
+	if serialConfig.BaudRate < 0 {
+		return fmt.Errorf("Baud rate %d is not valid", serialConfig.BaudRate)
+	}
+	if serialConfig.DataBits != 0 && (serialConfig.DataBits < 5 || serialConfig.DataBits > 8) {
+		return fmt.Errorf("Data bits must be between 5 and 8, got %d", serialConfig.DataBits)
+	}
+	if serialConfig.Parity != "" && serialConfig.Parity != "N" &&
+		serialConfig.Parity != "E" && serialConfig.Parity != "O" {
+		return fmt.Errorf("Parity must be N, E or O, got %s", serialConfig.Parity)
+	}
+	if serialConfig.StopBits != 0 && serialConfig.StopBits != 1 && serialConfig.StopBits != 2 {
+		return fmt.Errorf("Stop bits must be 1 or 2, got %d", serialConfig.StopBits)
+	}
+	return nil
+}
+
+//keySensorsByBus rebuilds the map of sensors so that every sensor has a bus
+//and is keyed by bus and address. Configurations saved before the sensors
+//had a bus are keyed by address only
+func keySensorsByBus(sensors map[string]common.Sensor) map[string]common.Sensor {
+	rez := make(map[string]common.Sensor)
+	for _, sensor := range sensors {
+		sensor.Bus = common.BusName(sensor.Bus)
+		rez[sensor.Key()] = sensor
+	}
+	return rez
+}
+
+//copySensor returns a copy of sensor not sharing its registers, read groups
+//and tares, so that the copy can be changed while the sensor is read
+func copySensor(sensor common.Sensor) *common.Sensor {
+	sensor.Registers = append([]common.Register(nil), sensor.Registers...)
+	sensor.ReadGroups = append([]common.ReadGroup(nil), sensor.ReadGroups...)
+	if sensor.Tares != nil {
+		sensor.Tares = append([]common.Tare{}, sensor.Tares...)
+	}
+	return &sensor
+}
+
+//readGroupIndex returns the index of the read group of sensor starting at startLocation
+func readGroupIndex(sensor common.Sensor, startLocation uint16) (int, error) {
+	for i, rg := range sensor.ReadGroups {
+		if rg.StartLocation == startLocation {
+			return i, nil
+		}
+	}
+	err := fmt.Errorf("The sensor %d has no read group starting at %d", sensor.Address, startLocation)
+	log.Println(err.Error())
+	return 0, err
+}
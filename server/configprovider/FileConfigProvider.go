@@ -6,33 +6,35 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"sync"
 
 	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
 )
 
 const defaultFileName = "./config.json"
 
-//TODO Add mutex or a channel so that just one thread will write or read to
-//the file at a time
-
-//FileConfigProvider contains the configuration for the server
+//FileConfigProvider contains the configuration for the server.
+//It can be used by several goroutines at once
 type FileConfigProvider struct {
-	Sensors        map[string]common.Sensor `json:"Sensors"`
-	MinAddress     uint8                    `json:"minAddress"`
-	MaxAddress     uint8                    `json:"maxAddress"`
-	FileConfigName string                   `json:"-"`
+	Sensors        map[string]common.Sensor    `json:"Sensors"`
+	MinAddress     uint8                       `json:"minAddress"`
+	MaxAddress     uint8                       `json:"maxAddress"`
+	Buses          map[string]common.BusConfig `json:"buses,omitempty"`
+	FileConfigName string                      `json:"-"`
+	mutex          *sync.RWMutex
 	ConfigProvider
 }
 
 //NewConfigProvider creates a new ConfigProvider
 func (FileConfigProvider) NewConfigProvider(params ...string) (ConfigProvider, error) {
-	c := FileConfigProvider{FileConfigName: defaultFileName}
+	c := FileConfigProvider{FileConfigName: defaultFileName, mutex: &sync.RWMutex{}}
 	if len(params) == 1 {
 		c.FileConfigName = params[0]
 	}
 
 	c.Sensors = make(map[string]common.Sensor)
+	c.Buses = make(map[string]common.BusConfig)
 
 	_, err := c.LoadConfig()
 
@@ -40,12 +42,18 @@ func (FileConfigProvider) NewConfigProvider(params ...string) (ConfigProvider, e
 		log.Printf(err.Error())
 		return nil, err
 	}
+	c.Sensors = keySensorsByBus(c.Sensors)
+	if c.Buses == nil {
+		c.Buses = make(map[string]common.BusConfig)
+	}
 
 	return &c, nil
 }
 
 //LoadConfig loads the configuration from the file
 func (configProvider *FileConfigProvider) LoadConfig() (bool, error) {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
 	if _, err := os.Stat(configProvider.FileConfigName); err != nil {
 		log.Println("Config file not found. Creating a new one")
 		return false, nil
@@ -73,6 +81,13 @@ func (configProvider *FileConfigProvider) LoadConfig() (bool, error) {
 
 //Save saves the configuration into the config file
 func (configProvider *FileConfigProvider) Save() error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	return configProvider.save()
+}
+
+//save saves the configuration. It is called with the configuration locked
+func (configProvider *FileConfigProvider) save() error {
 	configFile, err := os.Create(configProvider.FileConfigName)
 	if err != nil {
 		return err
@@ -89,15 +104,31 @@ func (configProvider *FileConfigProvider) Save() error {
 
 //SetAddressLimits adds the minimum and maximum limits for the sensor addreses
 func (configProvider *FileConfigProvider) SetAddressLimits(minAddress uint8, maxAddress uint8) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
 	configProvider.MinAddress = minAddress
 	configProvider.MaxAddress = maxAddress
-	return configProvider.Save()
+	return configProvider.save()
+}
+
+//GetAddressLimits returns the minimum and maximum limits for the sensor addresses
+func (configProvider *FileConfigProvider) GetAddressLimits() (uint8, uint8) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.MinAddress, configProvider.MaxAddress
 }
 
 //IsSensorAddressTaken checks to see if there is already a slave with
-//the passed address defined
-func (configProvider *FileConfigProvider) IsSensorAddressTaken(address uint8) (bool, error) {
-	if _, ok := configProvider.Sensors[strconv.Itoa(int(address))]; ok {
+//the passed address defined on the bus
+func (configProvider *FileConfigProvider) IsSensorAddressTaken(bus string, address uint8) (bool, error) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.isSensorAddressTaken(bus, address)
+}
+
+//isSensorAddressTaken does the work of IsSensorAddressTaken with the configuration locked
+func (configProvider *FileConfigProvider) isSensorAddressTaken(bus string, address uint8) (bool, error) {
+	if _, ok := configProvider.Sensors[common.SensorKey(bus, address)]; ok {
 		return true, nil
 	}
 
@@ -106,6 +137,13 @@ func (configProvider *FileConfigProvider) IsSensorAddressTaken(address uint8) (b
 
 //IsSensorValid checks to see if the sensor passed in is valid
 func (configProvider *FileConfigProvider) IsSensorValid(sensor common.Sensor) error {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.isSensorValid(sensor)
+}
+
+//isSensorValid does the work of IsSensorValid with the configuration locked
+func (configProvider *FileConfigProvider) isSensorValid(sensor common.Sensor) error {
 	if sensor.Address < configProvider.MinAddress || sensor.Address > configProvider.MaxAddress {
 		err := fmt.Errorf("The sensor adresses must be between %d and %d", configProvider.MinAddress, configProvider.MaxAddress)
 		log.Println(err.Error())
@@ -118,45 +156,75 @@ func (configProvider *FileConfigProvider) IsSensorValid(sensor common.Sensor) er
 		return err
 	}
 
+	if _, ok := configProvider.Buses[common.BusName(sensor.Bus)]; !ok &&
+		common.BusName(sensor.Bus) != common.DefaultBus {
+		err := fmt.Errorf("The bus %s is not configured", sensor.Bus)
+		log.Println(err.Error())
+		return err
+	}
+
+	if err := readgroups.ValidateReadGroups(sensor); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
 	return nil
 }
 
 //AddSensor adds a new sensor that the server should interrogate
 func (configProvider *FileConfigProvider) AddSensor(sensor common.Sensor) error {
-	if err := configProvider.IsSensorValid(sensor); err != nil {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	return configProvider.addSensor(sensor)
+}
+
+//addSensor does the work of AddSensor with the configuration locked
+func (configProvider *FileConfigProvider) addSensor(sensor common.Sensor) error {
+	if err := configProvider.isSensorValid(sensor); err != nil {
 		log.Println((err).Error())
 		return err
 	}
-	taken, err := configProvider.IsSensorAddressTaken(sensor.Address)
+	sensor.Bus = common.BusName(sensor.Bus)
+	taken, err := configProvider.isSensorAddressTaken(sensor.Bus, sensor.Address)
 	if err != nil {
 		return err
 	}
 	if taken {
-		err := fmt.Errorf("AddSensor. A sensor with address %d has already been registered", sensor.Address)
+		err := fmt.Errorf("AddSensor. A sensor with address %d has already been registered on bus %s",
+			sensor.Address, sensor.Bus)
 		log.Println(err.Error())
 		return err
 	}
 
-	configProvider.Sensors[strconv.Itoa(int(sensor.Address))] = sensor
-	return configProvider.Save()
+	stored := copySensor(sensor)
+	readgroups.SortTares(stored.Tares)
+	configProvider.Sensors[sensor.Key()] = *stored
+	return configProvider.save()
 }
 
-//RemoveSensorByAddress removes the sensor having the specified address
+//RemoveSensorByAddress removes the sensor having the specified address on bus
 //from the collection of sensors that the server interrogates
-func (configProvider *FileConfigProvider) RemoveSensorByAddress(address uint8) error {
-	taken, err := configProvider.IsSensorAddressTaken(address)
+func (configProvider *FileConfigProvider) RemoveSensorByAddress(bus string, address uint8) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	return configProvider.removeSensorByAddress(bus, address)
+}
+
+//removeSensorByAddress does the work of RemoveSensorByAddress with the configuration locked
+func (configProvider *FileConfigProvider) removeSensorByAddress(bus string, address uint8) error {
+	taken, err := configProvider.isSensorAddressTaken(bus, address)
 	if err != nil {
 		return err
 	}
 	if !taken {
-		err := fmt.Errorf("No sensor with %d address is registered", address)
+		err := fmt.Errorf("No sensor with address %d is registered on bus %s", address, common.BusName(bus))
 		log.Println(err.Error())
 		return err
 	}
 
-	delete(configProvider.Sensors, strconv.Itoa(int(address)))
+	delete(configProvider.Sensors, common.SensorKey(bus, address))
 
-	return configProvider.Save()
+	return configProvider.save()
 
 }
 
@@ -164,32 +232,41 @@ func (configProvider *FileConfigProvider) RemoveSensorByAddress(address uint8) e
 //the server interrogates
 func (configProvider *FileConfigProvider) RemoveSensor(sensor common.Sensor) error {
 
-	return configProvider.RemoveSensorByAddress(sensor.Address)
+	return configProvider.RemoveSensorByAddress(sensor.Bus, sensor.Address)
+
+}
 
+//GetSensorByAddress returns the sensor with the given address on bus
+func (configProvider *FileConfigProvider) GetSensorByAddress(bus string, address uint8) (*common.Sensor, error) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.sensorByAddress(bus, address)
 }
 
-//GetSensorByAddress returns the sensor with the given address
-func (configProvider *FileConfigProvider) GetSensorByAddress(address uint8) (*common.Sensor, error) {
+//sensorByAddress does the work of GetSensorByAddress with the configuration locked
+func (configProvider *FileConfigProvider) sensorByAddress(bus string, address uint8) (*common.Sensor, error) {
 	var sensor common.Sensor
 	var ok bool
 
-	if sensor, ok = configProvider.Sensors[strconv.Itoa(int(address))]; !ok {
-		err := fmt.Errorf("No sensor with address %d is registered", address)
+	if sensor, ok = configProvider.Sensors[common.SensorKey(bus, address)]; !ok {
+		err := fmt.Errorf("No sensor with address %d is registered on bus %s", address, common.BusName(bus))
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	return &sensor, nil
+	return copySensor(sensor), nil
 }
 
 //ChangeSensorAddress changes the address of the sensor that currently has
-//address "addressBefore" with the "addressAfter"
-func (configProvider *FileConfigProvider) ChangeSensorAddress(addressBefore uint8, addressAfter uint8) error {
-	sensorBefore, err := configProvider.GetSensorByAddress(addressBefore)
+//address "addressBefore" on bus with the "addressAfter"
+func (configProvider *FileConfigProvider) ChangeSensorAddress(bus string, addressBefore uint8, addressAfter uint8) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	sensorBefore, err := configProvider.sensorByAddress(bus, addressBefore)
 	if err != nil {
 		return err
 	}
-	taken, err := configProvider.IsSensorAddressTaken(addressAfter)
+	taken, err := configProvider.isSensorAddressTaken(bus, addressAfter)
 	if err != nil {
 		return err
 	}
@@ -199,40 +276,151 @@ func (configProvider *FileConfigProvider) ChangeSensorAddress(addressBefore uint
 		return err
 	}
 
-	if err := configProvider.RemoveSensorByAddress(sensorBefore.Address); err != nil {
+	if err := configProvider.removeSensorByAddress(sensorBefore.Bus, sensorBefore.Address); err != nil {
 		return err
 	}
 
 	sensorBefore.Address = addressAfter
 
-	return configProvider.AddSensor(*sensorBefore)
+	return configProvider.addSensor(*sensorBefore)
 
 }
 
-//ChangeSensor changes the sensor having address "address" to be similar with
-//the sensor "after"
-func (configProvider *FileConfigProvider) ChangeSensor(address uint8, after common.Sensor) error {
+//ChangeSensor changes the sensor having address "address" on bus to be similar with
+//the sensor "after". The tares of the sensor are kept if "after" has none
+//and are sorted by time otherwise
+func (configProvider *FileConfigProvider) ChangeSensor(bus string, address uint8, after common.Sensor) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
 	var sensorBefore *common.Sensor
 	var err error
-	if sensorBefore, err = configProvider.GetSensorByAddress(address); err != nil {
+	if sensorBefore, err = configProvider.sensorByAddress(bus, address); err != nil {
 		return err
 	}
 
-	if err = configProvider.IsSensorValid(after); err != nil {
+	after.Bus = sensorBefore.Bus
+	if err = configProvider.isSensorValid(after); err != nil {
 		return err
 	}
 
-	//TODO - check for validity of ReadGroups
 	sensorBefore.Description = after.Description
 	sensorBefore.Registers = after.Registers
 	sensorBefore.ReadGroups = after.ReadGroups
-	configProvider.Sensors[strconv.Itoa(int(sensorBefore.Address))] = *sensorBefore
+	if after.Tares != nil {
+		sensorBefore.Tares = after.Tares
+	}
+	stored := copySensor(*sensorBefore)
+	readgroups.SortTares(stored.Tares)
+	configProvider.Sensors[sensorBefore.Key()] = *stored
+
+	return configProvider.save()
+
+}
 
-	return configProvider.Save()
+//SetReadGroupCalibration sets the calibration points of the read group starting
+//at startLocation on the sensor having address on bus and returns the read group
+func (configProvider *FileConfigProvider) SetReadGroupCalibration(bus string, address uint8, startLocation uint16, calibration []common.CalibrationPoint) (*common.ReadGroup, error) {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	sensor, err := configProvider.sensorByAddress(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	i, err := readGroupIndex(*sensor, startLocation)
+	if err != nil {
+		return nil, err
+	}
+	sensor.ReadGroups[i].Calibration = calibration
+	if err = configProvider.isSensorValid(*sensor); err != nil {
+		return nil, err
+	}
+	configProvider.Sensors[sensor.Key()] = *sensor
+	rg := sensor.ReadGroups[i]
+	return &rg, configProvider.save()
+}
 
+//AddTare adds tare to the tares of the sensor having address on bus and
+//returns the tare used at tare.Since. If tare.Since is not set, the tare
+//is used from now on
+func (configProvider *FileConfigProvider) AddTare(bus string, address uint8, tare common.Tare) (*common.Tare, error) {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	sensor, err := configProvider.sensorByAddress(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	if err = readgroups.AddTare(sensor, tare); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	configProvider.Sensors[sensor.Key()] = *sensor
+	return readgroups.TareAt(*copySensor(*sensor), tare.StartLocation, tare.Since), configProvider.save()
 }
 
-//GetSensors returns a map of the sensor addresses mapped to the sensors themselves
+//GetSensors returns a copy of the map of the sensor addresses mapped to the sensors themselves
 func (configProvider *FileConfigProvider) GetSensors() map[string]common.Sensor {
-	return configProvider.Sensors
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	sensors := make(map[string]common.Sensor)
+	for key, sensor := range configProvider.Sensors {
+		sensors[key] = *copySensor(sensor)
+	}
+	return sensors
+}
+
+//GetBuses returns a copy of the map of the bus names mapped to the bus configurations
+func (configProvider *FileConfigProvider) GetBuses() map[string]common.BusConfig {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	buses := make(map[string]common.BusConfig)
+	for name, busConfig := range configProvider.Buses {
+		buses[name] = busConfig
+	}
+	return buses
+}
+
+//GetBus returns the configuration of the bus having the name "name"
+func (configProvider *FileConfigProvider) GetBus(name string) (*common.BusConfig, error) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	busConfig, ok := configProvider.Buses[name]
+	if !ok {
+		err := fmt.Errorf("No bus with name %s is configured", name)
+		log.Println(err.Error())
+		return nil, err
+	}
+	return &busConfig, nil
+}
+
+//SetBus adds the bus or replaces the configuration of the bus
+//having the same name
+func (configProvider *FileConfigProvider) SetBus(busConfig common.BusConfig) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	if err := isBusConfigValid(busConfig); err != nil {
+		return err
+	}
+	configProvider.Buses[busConfig.Name] = busConfig
+	return configProvider.save()
+}
+
+//RemoveBus removes the bus having the name "name". A bus can only be
+//removed if no sensor is registered on it
+func (configProvider *FileConfigProvider) RemoveBus(name string) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	if _, ok := configProvider.Buses[name]; !ok {
+		err := fmt.Errorf("No bus with name %s is configured", name)
+		log.Println(err.Error())
+		return err
+	}
+	for _, sensor := range configProvider.Sensors {
+		if sensor.Bus == name {
+			err := fmt.Errorf("The bus %s still has sensor %d registered", name, sensor.Address)
+			log.Println(err.Error())
+			return err
+		}
+	}
+	delete(configProvider.Buses, name)
+	return configProvider.save()
 }
@@ -3,6 +3,7 @@ package configprovider_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"reflect"
 
@@ -38,7 +39,7 @@ func TestLoadConfigShouldFail(t *testing.T) {
 	file, err = os.Create(invalidFile)
 	file.WriteString("Invalid json {")
 	if err != nil {
-		t.Skipf("Could not create an empty file", err.Error())
+		t.Skipf("Could not create an empty file: %s", err.Error())
 	}
 	defer os.Remove(invalidFile)
 	file.Close()
@@ -151,13 +152,14 @@ func TestFileAddSensorShouldOk(t *testing.T) {
 		t.FailNow()
 	}
 
-	sensorBack, err := conf.GetSensorByAddress(sensor1.Address)
+	sensorBack, err := conf.GetSensorByAddress(common.DefaultBus, sensor1.Address)
 	if err != nil {
 		t.Error("Expected", nil, "from GetSensorByAddress with param",
 			sensor1.Address, "got", err)
 		t.FailNow()
 	}
 
+	sensor1.Bus = common.DefaultBus
 	if !reflect.DeepEqual(sensor1, *sensorBack) {
 		t.Error("Expected", sensor1.Address, ",", sensor1.Description, ",",
 			sensor1.Registers, "got", sensorBack.Address, ",",
@@ -174,7 +176,7 @@ func TestFileGetSensorByAddressShouldFail(t *testing.T) {
 	defer deleteTestConfig(testConfigFileName)
 	conf.SetAddressLimits(1, 32)
 
-	_, err = conf.GetSensorByAddress(1)
+	_, err = conf.GetSensorByAddress(common.DefaultBus, 1)
 
 	if err == nil {
 		t.Error("Expected", "not nil", "got", err)
@@ -201,11 +203,12 @@ func TestFileGetSensorByAddressShouldOk(t *testing.T) {
 		t.FailNow()
 	}
 
-	sensorBack, err := conf.GetSensorByAddress(sensor.Address)
+	sensorBack, err := conf.GetSensorByAddress(common.DefaultBus, sensor.Address)
 	if err != nil {
 		t.Error("Expected ", nil, "got", err)
 		t.FailNow()
 	}
+	sensor.Bus = common.DefaultBus
 	if !reflect.DeepEqual(sensor, *sensorBack) {
 		t.Error("Expected", sensor, "got", sensorBack)
 		t.Fail()
@@ -220,7 +223,7 @@ func TestFileRemoveSensorByAddressShouldFail(t *testing.T) {
 	defer deleteTestConfig(testConfigFileName)
 	conf.SetAddressLimits(1, 32)
 
-	err = conf.RemoveSensorByAddress(1)
+	err = conf.RemoveSensorByAddress(common.DefaultBus, 1)
 	if err == nil {
 		t.Error("Expected", "not nil", "got", err)
 		t.Fail()
@@ -240,7 +243,7 @@ func TestFileRemoveSensorByAddressShouldOk(t *testing.T) {
 		Name: "test ReadValue", Location: 100, Type: common.Input}}
 
 	conf.AddSensor(sensor)
-	err = conf.RemoveSensorByAddress(sensor.Address)
+	err = conf.RemoveSensorByAddress(common.DefaultBus, sensor.Address)
 	if err != nil {
 		t.Error("Expected", "nil", "got", err)
 		t.Fail()
@@ -305,7 +308,7 @@ func TestFileChangeSensorAddressShouldOk(t *testing.T) {
 	if err != nil {
 		t.Fatalf("No error expected when adding a sensor, got %s", err.Error())
 	}
-	err = conf.ChangeSensorAddress(1, 3)
+	err = conf.ChangeSensorAddress(common.DefaultBus, 1, 3)
 
 	if err != nil {
 		t.Error("When changing to an address unallocated expected", "no error", "got", err)
@@ -328,7 +331,7 @@ func TestFileFileChangeSensorAddressShouldFail(t *testing.T) {
 	sensor2.Registers = []common.Register{common.Register{
 		Name: "test2 ReadValue", Location: 100, Type: common.Input}}
 
-	err = conf.ChangeSensorAddress(1, 2)
+	err = conf.ChangeSensorAddress(common.DefaultBus, 1, 2)
 
 	if err == nil {
 		t.Error("When no sensor added expected", "nil", "got", err)
@@ -337,7 +340,7 @@ func TestFileFileChangeSensorAddressShouldFail(t *testing.T) {
 
 	conf.AddSensor(sensor1)
 	conf.AddSensor(sensor2)
-	err = conf.ChangeSensorAddress(1, 2)
+	err = conf.ChangeSensorAddress(common.DefaultBus, 1, 2)
 
 	if err == nil {
 		t.Error("When address already exists expected", "not nil", "got", err)
@@ -360,7 +363,7 @@ func TestFileChangeSensorShouldFail(t *testing.T) {
 
 	sensor := common.Sensor{Address: 1, Description: "Test"}
 
-	err = conf.ChangeSensor(1, sensor)
+	err = conf.ChangeSensor(common.DefaultBus, 1, sensor)
 
 	if err == nil {
 		t.Error("Expected", "not nil", "got", err)
@@ -391,14 +394,14 @@ func TestFileChangeSensorShouldOk(t *testing.T) {
 		Registers: []common.Register{common.Register{
 			Name: "test ReadValue", Location: 100, Type: common.Holding}}}
 
-	err = conf.ChangeSensor(sensor.Address, sensor2)
+	err = conf.ChangeSensor(common.DefaultBus, sensor.Address, sensor2)
 
 	if err != nil {
 		t.Error("Expected", "nil", "got", err)
 		t.FailNow()
 	}
 
-	sensor1, _ := conf.GetSensorByAddress(sensor.Address)
+	sensor1, _ := conf.GetSensorByAddress(common.DefaultBus, sensor.Address)
 
 	if sensor1.Description != sensor2.Description || !reflect.DeepEqual(sensor1.Registers, sensor2.Registers) {
 		t.Error("Expected", sensor2, "got", *sensor1)
@@ -433,14 +436,14 @@ func TestFileGetSensors(t *testing.T) {
 		t.Fatalf("Should have 2 sensors, got: %d", len(sensors))
 	}
 
-	val, ok := sensors["1"]
+	val, ok := sensors[common.SensorKey(common.DefaultBus, 1)]
 	if !ok {
 		t.Fatal("Should have sensor with address 1, got:nil")
 	}
 	if val.Address != 1 {
 		t.Fatalf("Sensor shoudl have address 1, got:%d", val.Address)
 	}
-	val, ok = sensors["2"]
+	val, ok = sensors[common.SensorKey(common.DefaultBus, 2)]
 	if !ok {
 		t.Fatal("Should have sensor with address 2, got:nil")
 	}
@@ -448,3 +451,59 @@ func TestFileGetSensors(t *testing.T) {
 		t.Fatalf("Sensor shoudl have address 2, got:%d", val.Address)
 	}
 }
+
+func TestFileSetBus(t *testing.T) {
+	conf, err := configprovider.FileConfigProvider{}.NewConfigProvider(testConfigFileName)
+	if err != nil {
+		t.Fatalf("There should be no error when creating a FileConfigProvider, got %s", err.Error())
+	}
+	defer deleteTestConfig(testConfigFileName)
+
+	if len(conf.GetBuses()) != 0 {
+		t.Fatal("Expected no bus configuration on a new config, got", conf.GetBuses())
+	}
+
+	err = conf.SetBus(common.BusConfig{Name: "line1", Transport: common.RTU, Address: "/dev/ttyUSB0",
+		SerialConfig: common.SerialConfig{Parity: "X"}})
+	if err == nil {
+		t.Fatal("Expected error when setting an invalid parity, got nil")
+	}
+
+	busConfig := common.BusConfig{Name: "line1", Transport: common.RTU, Address: "/dev/ttyUSB0",
+		Timeout: time.Second, SerialConfig: common.SerialConfig{BaudRate: 9600,
+			DataBits: 8, Parity: "E", StopBits: 1, Delay: 10 * time.Millisecond}}
+	if err = conf.SetBus(busConfig); err != nil {
+		t.Fatalf("No error expected when setting a valid bus configuration, got %s", err.Error())
+	}
+
+	conf2, err := configprovider.FileConfigProvider{}.NewConfigProvider(testConfigFileName)
+	if err != nil {
+		t.Fatalf("There should be no error when reloading a FileConfigProvider, got %s", err.Error())
+	}
+	busBack, err := conf2.GetBus("line1")
+	if err != nil || !reflect.DeepEqual(*busBack, busConfig) {
+		t.Fatalf("Expected %v after reload, got %v", busConfig, busBack)
+	}
+}
+
+func TestFileLoadConfigWithoutBuses(t *testing.T) {
+	file, err := os.Create(testConfigFileName)
+	if err != nil {
+		t.Skipf("Could not create the file: %s", err.Error())
+	}
+	defer deleteTestConfig(testConfigFileName)
+	file.WriteString(`{"Sensors":{"1":{"address":1,"description":"old","registers":[{"location":10,"type":"holding"}]}},"minAddress":0,"maxAddress":30}`)
+	file.Close()
+
+	conf, err := configprovider.FileConfigProvider{}.NewConfigProvider(testConfigFileName)
+	if err != nil {
+		t.Fatalf("There should be no error when loading an old config, got %s", err.Error())
+	}
+	sensor, err := conf.GetSensorByAddress(common.DefaultBus, 1)
+	if err != nil {
+		t.Fatalf("Expected the old sensor to be on the default bus, got %s", err.Error())
+	}
+	if sensor.Bus != common.DefaultBus || sensor.Description != "old" {
+		t.Fatalf("Expected the old sensor on the default bus, got %v", sensor)
+	}
+}
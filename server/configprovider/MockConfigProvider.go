@@ -4,38 +4,59 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"sync"
 
 	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
 )
 
-//MockConfigProvider contains the configuration for the server
+//MockConfigProvider contains the configuration for the server.
+//It can be used by several goroutines at once
 type MockConfigProvider struct {
 	Sensors    map[string]common.Sensor
 	MinAddress uint8
 	MaxAddress uint8
+	Buses      map[string]common.BusConfig
+	mutex      *sync.RWMutex
 	ConfigProvider
 }
 
 //NewConfigProvider creates a new ConfigProvider
 func (MockConfigProvider) NewConfigProvider(params ...string) (ConfigProvider, error) {
-	c := MockConfigProvider{}
+	c := MockConfigProvider{mutex: &sync.RWMutex{}}
 
 	c.Sensors = make(map[string]common.Sensor)
+	c.Buses = make(map[string]common.BusConfig)
 	return &c, nil
 }
 
 //SetAddressLimits adds the minimum and maximum limits for the sensor addreses
 func (configProvider *MockConfigProvider) SetAddressLimits(minAddress uint8, maxAddress uint8) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
 	configProvider.MinAddress = minAddress
 	configProvider.MaxAddress = maxAddress
 	return nil
 }
 
+//GetAddressLimits returns the minimum and maximum limits for the sensor addresses
+func (configProvider *MockConfigProvider) GetAddressLimits() (uint8, uint8) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.MinAddress, configProvider.MaxAddress
+}
+
 //IsSensorAddressTaken checks to see if there is already a slave with
-//the passed address defined
-func (configProvider *MockConfigProvider) IsSensorAddressTaken(address uint8) (bool, error) {
-	if _, ok := configProvider.Sensors[strconv.Itoa(int(address))]; ok {
+//the passed address defined on the bus
+func (configProvider *MockConfigProvider) IsSensorAddressTaken(bus string, address uint8) (bool, error) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.isSensorAddressTaken(bus, address)
+}
+
+//isSensorAddressTaken does the work of IsSensorAddressTaken with the configuration locked
+func (configProvider *MockConfigProvider) isSensorAddressTaken(bus string, address uint8) (bool, error) {
+	if _, ok := configProvider.Sensors[common.SensorKey(bus, address)]; ok {
 		return true, nil
 	}
 
@@ -44,6 +65,13 @@ func (configProvider *MockConfigProvider) IsSensorAddressTaken(address uint8) (b
 
 //IsSensorValid checks to see if the sensot passed in is valid
 func (configProvider *MockConfigProvider) IsSensorValid(sensor common.Sensor) error {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.isSensorValid(sensor)
+}
+
+//isSensorValid does the work of IsSensorValid with the configuration locked
+func (configProvider *MockConfigProvider) isSensorValid(sensor common.Sensor) error {
 	if sensor.Address < configProvider.MinAddress || sensor.Address > configProvider.MaxAddress {
 		err := fmt.Errorf("The sensor adresses must be between %d and %d", configProvider.MinAddress, configProvider.MaxAddress)
 		log.Println(err.Error())
@@ -56,44 +84,74 @@ func (configProvider *MockConfigProvider) IsSensorValid(sensor common.Sensor) er
 		return err
 	}
 
+	if _, ok := configProvider.Buses[common.BusName(sensor.Bus)]; !ok &&
+		common.BusName(sensor.Bus) != common.DefaultBus {
+		err := fmt.Errorf("The bus %s is not configured", sensor.Bus)
+		log.Println(err.Error())
+		return err
+	}
+
+	if err := readgroups.ValidateReadGroups(sensor); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
 	return nil
 }
 
 //AddSensor adds a new sensor that the server should interrogate
 func (configProvider *MockConfigProvider) AddSensor(sensor common.Sensor) error {
-	if err := configProvider.IsSensorValid(sensor); err != nil {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	return configProvider.addSensor(sensor)
+}
+
+//addSensor does the work of AddSensor with the configuration locked
+func (configProvider *MockConfigProvider) addSensor(sensor common.Sensor) error {
+	if err := configProvider.isSensorValid(sensor); err != nil {
 		log.Println((err).Error())
 		return err
 	}
-	taken, err := configProvider.IsSensorAddressTaken(sensor.Address)
+	sensor.Bus = common.BusName(sensor.Bus)
+	taken, err := configProvider.isSensorAddressTaken(sensor.Bus, sensor.Address)
 	if err != nil {
 		return err
 	}
 	if taken {
-		err := fmt.Errorf("AddSensor. A sensor with address %d has already been registered", sensor.Address)
+		err := fmt.Errorf("AddSensor. A sensor with address %d has already been registered on bus %s",
+			sensor.Address, sensor.Bus)
 		log.Println(err.Error())
 		return err
 	}
 
-	configProvider.Sensors[strconv.Itoa(int(sensor.Address))] = sensor
+	stored := copySensor(sensor)
+	readgroups.SortTares(stored.Tares)
+	configProvider.Sensors[sensor.Key()] = *stored
 
 	return nil
 }
 
-//RemoveSensorByAddress removes the sensor having the specified address
+//RemoveSensorByAddress removes the sensor having the specified address on bus
 //from the collection of sensors that the server interrogates
-func (configProvider *MockConfigProvider) RemoveSensorByAddress(address uint8) error {
-	taken, err := configProvider.IsSensorAddressTaken(address)
+func (configProvider *MockConfigProvider) RemoveSensorByAddress(bus string, address uint8) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	return configProvider.removeSensorByAddress(bus, address)
+}
+
+//removeSensorByAddress does the work of RemoveSensorByAddress with the configuration locked
+func (configProvider *MockConfigProvider) removeSensorByAddress(bus string, address uint8) error {
+	taken, err := configProvider.isSensorAddressTaken(bus, address)
 	if err != nil {
 		return err
 	}
 	if !taken {
-		err := fmt.Errorf("No sensor with address %d is registered", address)
+		err := fmt.Errorf("No sensor with address %d is registered on bus %s", address, common.BusName(bus))
 		log.Println(err.Error())
 		return err
 	}
 
-	delete(configProvider.Sensors, strconv.Itoa(int(address)))
+	delete(configProvider.Sensors, common.SensorKey(bus, address))
 
 	return nil
 }
@@ -102,32 +160,41 @@ func (configProvider *MockConfigProvider) RemoveSensorByAddress(address uint8) e
 //the server interrogates
 func (configProvider *MockConfigProvider) RemoveSensor(sensor common.Sensor) error {
 
-	return configProvider.RemoveSensorByAddress(sensor.Address)
+	return configProvider.RemoveSensorByAddress(sensor.Bus, sensor.Address)
+
+}
 
+//GetSensorByAddress returns the sensor with the given address on bus
+func (configProvider *MockConfigProvider) GetSensorByAddress(bus string, address uint8) (*common.Sensor, error) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	return configProvider.sensorByAddress(bus, address)
 }
 
-//GetSensorByAddress returns the sensor with the given address
-func (configProvider *MockConfigProvider) GetSensorByAddress(address uint8) (*common.Sensor, error) {
+//sensorByAddress does the work of GetSensorByAddress with the configuration locked
+func (configProvider *MockConfigProvider) sensorByAddress(bus string, address uint8) (*common.Sensor, error) {
 	var sensor common.Sensor
 	var ok bool
 
-	if sensor, ok = configProvider.Sensors[strconv.Itoa(int(address))]; !ok {
-		err := fmt.Errorf("Getting sensor. No sensor with address %d is registered", address)
+	if sensor, ok = configProvider.Sensors[common.SensorKey(bus, address)]; !ok {
+		err := fmt.Errorf("Getting sensor. No sensor with address %d is registered on bus %s", address, common.BusName(bus))
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	return &sensor, nil
+	return copySensor(sensor), nil
 }
 
 //ChangeSensorAddress changes the address of the sensor that currently has
-//address "addressBefore" with the "addressAfter"
-func (configProvider *MockConfigProvider) ChangeSensorAddress(addressBefore uint8, addressAfter uint8) error {
-	sensorBefore, err := configProvider.GetSensorByAddress(addressBefore)
+//address "addressBefore" on bus with the "addressAfter"
+func (configProvider *MockConfigProvider) ChangeSensorAddress(bus string, addressBefore uint8, addressAfter uint8) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	sensorBefore, err := configProvider.sensorByAddress(bus, addressBefore)
 	if err != nil {
 		return err
 	}
-	taken, err := configProvider.IsSensorAddressTaken(addressAfter)
+	taken, err := configProvider.isSensorAddressTaken(bus, addressAfter)
 	if err != nil {
 		return err
 	}
@@ -137,39 +204,150 @@ func (configProvider *MockConfigProvider) ChangeSensorAddress(addressBefore uint
 		return err
 	}
 
-	if err := configProvider.RemoveSensorByAddress(sensorBefore.Address); err != nil {
+	if err := configProvider.removeSensorByAddress(sensorBefore.Bus, sensorBefore.Address); err != nil {
 		return err
 	}
 
 	sensorBefore.Address = addressAfter
 
-	return configProvider.AddSensor(*sensorBefore)
+	return configProvider.addSensor(*sensorBefore)
 
 }
 
-//ChangeSensor changes the sensor having address "address" to be similar with
-//the sensor "after"
-func (configProvider *MockConfigProvider) ChangeSensor(address uint8, after common.Sensor) error {
+//ChangeSensor changes the sensor having address "address" on bus to be similar with
+//the sensor "after". The tares of the sensor are kept if "after" has none
+//and are sorted by time otherwise
+func (configProvider *MockConfigProvider) ChangeSensor(bus string, address uint8, after common.Sensor) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
 	var sensorBefore *common.Sensor
 	var err error
-	if sensorBefore, err = configProvider.GetSensorByAddress(address); err != nil {
+	if sensorBefore, err = configProvider.sensorByAddress(bus, address); err != nil {
 		return err
 	}
 
-	if err = configProvider.IsSensorValid(after); err != nil {
+	after.Bus = sensorBefore.Bus
+	if err = configProvider.isSensorValid(after); err != nil {
 		return err
 	}
-	//TODO - check for validity of ReadGroups
 	sensorBefore.Description = after.Description
 	sensorBefore.Registers = after.Registers
 	sensorBefore.ReadGroups = after.ReadGroups
-	configProvider.Sensors[strconv.Itoa(int(sensorBefore.Address))] = *sensorBefore
+	if after.Tares != nil {
+		sensorBefore.Tares = after.Tares
+	}
+	stored := copySensor(*sensorBefore)
+	readgroups.SortTares(stored.Tares)
+	configProvider.Sensors[sensorBefore.Key()] = *stored
 
 	return nil
 
 }
 
-//GetSensors returns a map of the sensor addresses mapped to the sensors themselves
+//SetReadGroupCalibration sets the calibration points of the read group starting
+//at startLocation on the sensor having address on bus and returns the read group
+func (configProvider *MockConfigProvider) SetReadGroupCalibration(bus string, address uint8, startLocation uint16, calibration []common.CalibrationPoint) (*common.ReadGroup, error) {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	sensor, err := configProvider.sensorByAddress(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	i, err := readGroupIndex(*sensor, startLocation)
+	if err != nil {
+		return nil, err
+	}
+	sensor.ReadGroups[i].Calibration = calibration
+	if err = configProvider.isSensorValid(*sensor); err != nil {
+		return nil, err
+	}
+	configProvider.Sensors[sensor.Key()] = *sensor
+	rg := sensor.ReadGroups[i]
+	return &rg, nil
+}
+
+//AddTare adds tare to the tares of the sensor having address on bus and
+//returns the tare used at tare.Since. If tare.Since is not set, the tare
+//is used from now on
+func (configProvider *MockConfigProvider) AddTare(bus string, address uint8, tare common.Tare) (*common.Tare, error) {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	sensor, err := configProvider.sensorByAddress(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	if err = readgroups.AddTare(sensor, tare); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	configProvider.Sensors[sensor.Key()] = *sensor
+	return readgroups.TareAt(*copySensor(*sensor), tare.StartLocation, tare.Since), nil
+}
+
+//GetSensors returns a copy of the map of the sensor addresses mapped to the sensors themselves
 func (configProvider *MockConfigProvider) GetSensors() map[string]common.Sensor {
-	return configProvider.Sensors
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	sensors := make(map[string]common.Sensor)
+	for key, sensor := range configProvider.Sensors {
+		sensors[key] = *copySensor(sensor)
+	}
+	return sensors
+}
+
+//GetBuses returns a copy of the map of the bus names mapped to the bus configurations
+func (configProvider *MockConfigProvider) GetBuses() map[string]common.BusConfig {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	buses := make(map[string]common.BusConfig)
+	for name, busConfig := range configProvider.Buses {
+		buses[name] = busConfig
+	}
+	return buses
+}
+
+//GetBus returns the configuration of the bus having the name "name"
+func (configProvider *MockConfigProvider) GetBus(name string) (*common.BusConfig, error) {
+	configProvider.mutex.RLock()
+	defer configProvider.mutex.RUnlock()
+	busConfig, ok := configProvider.Buses[name]
+	if !ok {
+		err := fmt.Errorf("No bus with name %s is configured", name)
+		log.Println(err.Error())
+		return nil, err
+	}
+	return &busConfig, nil
+}
+
+//SetBus adds the bus or replaces the configuration of the bus
+//having the same name
+func (configProvider *MockConfigProvider) SetBus(busConfig common.BusConfig) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	if err := isBusConfigValid(busConfig); err != nil {
+		return err
+	}
+	configProvider.Buses[busConfig.Name] = busConfig
+	return nil
+}
+
+//RemoveBus removes the bus having the name "name". A bus can only be
+//removed if no sensor is registered on it
+func (configProvider *MockConfigProvider) RemoveBus(name string) error {
+	configProvider.mutex.Lock()
+	defer configProvider.mutex.Unlock()
+	if _, ok := configProvider.Buses[name]; !ok {
+		err := fmt.Errorf("No bus with name %s is configured", name)
+		log.Println(err.Error())
+		return err
+	}
+	for _, sensor := range configProvider.Sensors {
+		if sensor.Bus == name {
+			err := fmt.Errorf("The bus %s still has sensor %d registered", name, sensor.Address)
+			log.Println(err.Error())
+			return err
+		}
+	}
+	delete(configProvider.Buses, name)
+	return nil
 }
@@ -1,12 +1,16 @@
 package configprovider_test
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"reflect"
 
 	"github.com/adiclepcea/SensInventory/server/common"
 	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
 )
 
 func TestMockAddSensorWithInvalidAddressShoudlFail(t *testing.T) {
@@ -78,13 +82,14 @@ func TestMockAddSensorShouldOk(t *testing.T) {
 		t.FailNow()
 	}
 
-	sensorBack, err := conf.GetSensorByAddress(sensor1.Address)
+	sensorBack, err := conf.GetSensorByAddress(common.DefaultBus, sensor1.Address)
 	if err != nil {
 		t.Error("Expected", nil, "from GetSensorByAddress with param",
 			sensor1.Address, "got", err)
 		t.FailNow()
 	}
 
+	sensor1.Bus = common.DefaultBus
 	if !reflect.DeepEqual(sensor1, *sensorBack) {
 		t.Error("Expected", sensor1.Address, ",", sensor1.Description, ",",
 			sensor1.Registers, "got", sensorBack.Address, ",",
@@ -97,7 +102,7 @@ func TestMockGetSensorByAddressShouldFail(t *testing.T) {
 	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
 	conf.SetAddressLimits(1, 32)
 
-	_, err := conf.GetSensorByAddress(1)
+	_, err := conf.GetSensorByAddress(common.DefaultBus, 1)
 
 	if err == nil {
 		t.Error("Expected", "not nil", "got", err)
@@ -120,11 +125,12 @@ func TestMockGetSensorByAddressShouldOk(t *testing.T) {
 		t.FailNow()
 	}
 
-	sensorBack, err := conf.GetSensorByAddress(sensor.Address)
+	sensorBack, err := conf.GetSensorByAddress(common.DefaultBus, sensor.Address)
 	if err != nil {
 		t.Error("Expected ", nil, "got", err)
 		t.FailNow()
 	}
+	sensor.Bus = common.DefaultBus
 	if !reflect.DeepEqual(sensor, *sensorBack) {
 		t.Error("Expected", sensor, "got", sensorBack)
 		t.Fail()
@@ -135,7 +141,7 @@ func TestMockRemoveSensorByAddressShouldFail(t *testing.T) {
 	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
 	conf.SetAddressLimits(1, 32)
 
-	err := conf.RemoveSensorByAddress(1)
+	err := conf.RemoveSensorByAddress(common.DefaultBus, 1)
 	if err == nil {
 		t.Error("Expected", "not nil", "got", err)
 		t.Fail()
@@ -151,7 +157,7 @@ func TestMockRemoveSensorByAddressShouldOk(t *testing.T) {
 		Name: "test ReadValue", Location: 100, Type: common.Input}}
 
 	conf.AddSensor(sensor)
-	err := conf.RemoveSensorByAddress(sensor.Address)
+	err := conf.RemoveSensorByAddress(common.DefaultBus, sensor.Address)
 	if err != nil {
 		t.Error("Expected", "nil", "got", err)
 		t.Fail()
@@ -203,7 +209,7 @@ func TestMockChangeSensorAddressShouldOk(t *testing.T) {
 	if err != nil {
 		t.Fatalf("No error expected when adding a sensor, got %s", err.Error())
 	}
-	err = conf.ChangeSensorAddress(1, 3)
+	err = conf.ChangeSensorAddress(common.DefaultBus, 1, 3)
 
 	if err != nil {
 		t.Error("When changing to an address unallocated expected", "no error", "got", err)
@@ -221,7 +227,7 @@ func TestMockChangeSensorAddressShouldFail(t *testing.T) {
 	sensor2.Registers = []common.Register{common.Register{
 		Name: "test2 ReadValue", Location: 100, Type: common.Input}}
 
-	err := conf.ChangeSensorAddress(1, 2)
+	err := conf.ChangeSensorAddress(common.DefaultBus, 1, 2)
 
 	if err == nil {
 		t.Error("When no sensor added expected", "nil", "got", err)
@@ -230,7 +236,7 @@ func TestMockChangeSensorAddressShouldFail(t *testing.T) {
 
 	conf.AddSensor(sensor1)
 	conf.AddSensor(sensor2)
-	err = conf.ChangeSensorAddress(1, 2)
+	err = conf.ChangeSensorAddress(common.DefaultBus, 1, 2)
 
 	if err == nil {
 		t.Error("When address already exists expected", "not nil", "got", err)
@@ -249,7 +255,7 @@ func TestMockChangeSensorShouldFail(t *testing.T) {
 
 	sensor := common.Sensor{Address: 1, Description: "Test"}
 
-	err := conf.ChangeSensor(1, sensor)
+	err := conf.ChangeSensor(common.DefaultBus, 1, sensor)
 
 	if err == nil {
 		t.Error("Expected", "not nil", "got", err)
@@ -276,20 +282,46 @@ func TestMockChangeSensorShouldOk(t *testing.T) {
 		Registers: []common.Register{common.Register{
 			Name: "test ReadValue", Location: 100, Type: common.Holding}}}
 
-	err = conf.ChangeSensor(sensor.Address, sensor2)
+	err = conf.ChangeSensor(common.DefaultBus, sensor.Address, sensor2)
 
 	if err != nil {
 		t.Error("Expected", "nil", "got", err)
 		t.FailNow()
 	}
 
-	sensor1, _ := conf.GetSensorByAddress(sensor.Address)
+	sensor1, _ := conf.GetSensorByAddress(common.DefaultBus, sensor.Address)
 
 	if sensor1.Description != sensor2.Description || !reflect.DeepEqual(sensor1.Registers, sensor2.Registers) {
 		t.Error("Expected", sensor2, "got", *sensor1)
 	}
 }
 
+func TestMockChangeSensorShouldSortTares(t *testing.T) {
+	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	conf.SetAddressLimits(1, 32)
+	sensor := common.Sensor{Address: 3, Description: "Scale",
+		Registers:  []common.Register{common.Register{Location: 100, Type: common.Input}},
+		ReadGroups: []common.ReadGroup{common.ReadGroup{StartLocation: 100, ResultType: common.Uint16}}}
+	if err := conf.AddSensor(sensor); err != nil {
+		t.Fatalf("No error expected when adding the sensor, got %s", err.Error())
+	}
+
+	sensor.Tares = []common.Tare{
+		common.Tare{StartLocation: 100, Value: 12.5, Since: "2016-05-04T00:00:00"},
+		common.Tare{StartLocation: 100, Value: 10, Since: "2016-05-01T00:00:00"},
+	}
+	if err := conf.ChangeSensor(common.DefaultBus, 3, sensor); err != nil {
+		t.Fatalf("No error expected when changing the sensor, got %s", err.Error())
+	}
+	changed, _ := conf.GetSensorByAddress(common.DefaultBus, 3)
+	if tare := readgroups.TareAt(*changed, 100, "2016-05-02T00:00:00"); tare == nil || tare.Value != 10 {
+		t.Fatalf("Expected the tares to be sorted by time, got %v", changed.Tares)
+	}
+	if tare := readgroups.TareAt(*changed, 100, ""); tare == nil || tare.Value != 12.5 {
+		t.Fatalf("Expected the latest tare to be the last, got %v", changed.Tares)
+	}
+}
+
 func TestMockGetSensors(t *testing.T) {
 	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
 	conf.SetAddressLimits(1, 32)
@@ -315,14 +347,14 @@ func TestMockGetSensors(t *testing.T) {
 		t.Fatalf("Should have 2 sensors, got: %d", len(sensors))
 	}
 
-	val, ok := sensors["1"]
+	val, ok := sensors[common.SensorKey(common.DefaultBus, 1)]
 	if !ok {
 		t.Fatal("Should have sensor with address 1, got:nil")
 	}
 	if val.Address != 1 {
 		t.Fatalf("Sensor shoudl have address 1, got:%d", val.Address)
 	}
-	val, ok = sensors["2"]
+	val, ok = sensors[common.SensorKey(common.DefaultBus, 2)]
 	if !ok {
 		t.Fatal("Should have sensor with address 2, got:nil")
 	}
@@ -330,3 +362,185 @@ func TestMockGetSensors(t *testing.T) {
 		t.Fatalf("Sensor shoudl have address 2, got:%d", val.Address)
 	}
 }
+
+func TestMockSetBus(t *testing.T) {
+	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+
+	invalid := []common.BusConfig{
+		common.BusConfig{Transport: common.TCP, Address: "127.0.0.1:502"},
+		common.BusConfig{Name: "line1", Transport: "udp", Address: "127.0.0.1:502"},
+		common.BusConfig{Name: "line1", Transport: common.TCP},
+		common.BusConfig{Name: "line1", Transport: common.RTU, Address: "/dev/ttyUSB0",
+			SerialConfig: common.SerialConfig{StopBits: 3}},
+		common.BusConfig{Name: "line1", Transport: common.ASCII, Address: "/dev/ttyUSB0",
+			SerialConfig: common.SerialConfig{DataBits: 9}},
+	}
+	for _, busConfig := range invalid {
+		if err := conf.SetBus(busConfig); err == nil {
+			t.Fatalf("Expected error when setting %v, got nil", busConfig)
+		}
+	}
+
+	busConfig := common.BusConfig{Name: "line1", Transport: common.TCP, Address: "127.0.0.1:502"}
+	if err := conf.SetBus(busConfig); err != nil {
+		t.Fatalf("No error expected when setting a valid bus configuration, got %s", err.Error())
+	}
+	busBack, err := conf.GetBus("line1")
+	if err != nil || !reflect.DeepEqual(*busBack, busConfig) {
+		t.Fatalf("Expected %v, got %v", busConfig, busBack)
+	}
+	if _, err = conf.GetBus("line2"); err == nil {
+		t.Fatal("Expected error when getting a bus that is not configured, got nil")
+	}
+}
+
+func TestMockSensorsOnSeveralBuses(t *testing.T) {
+	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	conf.SetAddressLimits(1, 32)
+
+	sensor := common.Sensor{Bus: "line2", Address: 1, Description: "Line 2"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "weight", Location: 100, Type: common.Input}}
+	if err := conf.AddSensor(sensor); err == nil {
+		t.Fatal("Expected error when adding a sensor on a bus that is not configured, got nil")
+	}
+
+	conf.SetBus(common.BusConfig{Name: "line2", Transport: common.TCP, Address: "127.0.0.1:502"})
+	if err := conf.AddSensor(sensor); err != nil {
+		t.Fatalf("No error expected when adding a sensor on a configured bus, got %s", err.Error())
+	}
+	sensorDefault := sensor
+	sensorDefault.Bus = ""
+	sensorDefault.Description = "Default"
+	if err := conf.AddSensor(sensorDefault); err != nil {
+		t.Fatalf("No error expected when adding the same address on another bus, got %s", err.Error())
+	}
+
+	sensorBack, err := conf.GetSensorByAddress("line2", 1)
+	if err != nil || sensorBack.Description != "Line 2" {
+		t.Fatalf("Expected the sensor from line2, got %v, %v", sensorBack, err)
+	}
+	sensorBack, err = conf.GetSensorByAddress(common.DefaultBus, 1)
+	if err != nil || sensorBack.Description != "Default" || sensorBack.Bus != common.DefaultBus {
+		t.Fatalf("Expected the sensor from the default bus, got %v, %v", sensorBack, err)
+	}
+
+	if err = conf.RemoveBus("line2"); err == nil {
+		t.Fatal("Expected error when removing a bus that still has sensors, got nil")
+	}
+	if err = conf.RemoveSensorByAddress("line2", 1); err != nil {
+		t.Fatalf("No error expected when removing the sensor, got %s", err.Error())
+	}
+	if err = conf.RemoveBus("line2"); err != nil {
+		t.Fatalf("No error expected when removing an empty bus, got %s", err.Error())
+	}
+	if taken, _ := conf.IsSensorAddressTaken(common.DefaultBus, 1); !taken {
+		t.Fatal("Expected the sensor on the default bus to be kept")
+	}
+}
+
+func TestMockAddSensorUnknownReadGroupShouldFail(t *testing.T) {
+	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	conf.SetAddressLimits(1, 32)
+
+	sensor := common.Sensor{Address: 1, Description: "test"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "weight", Location: 100, Type: common.Input}}
+	sensor.ReadGroups = []common.ReadGroup{common.ReadGroup{
+		StartLocation: 100, ResultType: "unknown"}}
+	if err := conf.AddSensor(sensor); err == nil {
+		t.Fatal("Expected error when adding a sensor with an unknown read group, got nil")
+	}
+
+	sensor.ReadGroups[0].ResultType = common.Hundredths
+	if err := conf.AddSensor(sensor); err != nil {
+		t.Fatalf("No error expected when adding a sensor with a known read group, got %s", err.Error())
+	}
+}
+
+func TestMockConcurrentChanges(t *testing.T) {
+	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	conf.SetAddressLimits(1, 32)
+	sensor := common.Sensor{Address: 3, Description: "Scale",
+		Registers:  []common.Register{common.Register{Location: 100, Type: common.Input}},
+		ReadGroups: []common.ReadGroup{common.ReadGroup{StartLocation: 100, ResultType: common.Hundredths}}}
+	if err := conf.AddSensor(sensor); err != nil {
+		t.Fatalf("No error expected when adding the sensor, got %s", err.Error())
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				changed, err := conf.GetSensorByAddress(common.DefaultBus, 3)
+				if err != nil {
+					t.Errorf("No error expected when getting the sensor, got %s", err.Error())
+					return
+				}
+				//the copy is changed as a change of the sensor through the API does
+				changed.Registers[0].Name = fmt.Sprintf("weight %d", i*100+j)
+				conf.ChangeSensor(common.DefaultBus, 3, *changed)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for _, s := range conf.GetSensors() {
+					if len(s.ReadGroups) != 1 {
+						t.Errorf("Expected one read group, got %v", s.ReadGroups)
+					}
+				}
+				conf.IsSensorAddressTaken(common.DefaultBus, 3)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMockAddTareAndCalibrationConcurrently(t *testing.T) {
+	conf, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	conf.SetAddressLimits(1, 32)
+	sensor := common.Sensor{Address: 3, Description: "Scale",
+		Registers: []common.Register{common.Register{Location: 100, Type: common.Input}},
+		ReadGroups: []common.ReadGroup{common.ReadGroup{StartLocation: 100, ResultType: common.Uint16},
+			common.ReadGroup{StartLocation: 101, ResultType: common.Uint16}}}
+	if err := conf.AddSensor(sensor); err != nil {
+		t.Fatalf("No error expected when adding the sensor, got %s", err.Error())
+	}
+
+	since := time.Date(2016, 4, 4, 10, 0, 0, 0, time.UTC)
+	calibration := []common.CalibrationPoint{common.CalibrationPoint{Raw: 0, Value: 0},
+		common.CalibrationPoint{Raw: 10, Value: 20}}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			tare := common.Tare{StartLocation: 100, Value: float64(i),
+				Since: since.Add(time.Duration(i) * time.Second).Format(common.TimeFormat)}
+			if _, err := conf.AddTare(common.DefaultBus, 3, tare); err != nil {
+				t.Errorf("No error expected when adding a tare, got %s", err.Error())
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := conf.SetReadGroupCalibration(common.DefaultBus, 3, 101, calibration); err != nil {
+				t.Errorf("No error expected when calibrating, got %s", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, _ := conf.GetSensorByAddress(common.DefaultBus, 3)
+	if len(stored.Tares) != 20 {
+		t.Fatalf("Expected the 20 tares to be kept, got %v", stored.Tares)
+	}
+	if !reflect.DeepEqual(stored.ReadGroups[1].Calibration, calibration) {
+		t.Fatalf("Expected the calibration to be kept, got %v", stored.ReadGroups[1].Calibration)
+	}
+	if _, err := conf.SetReadGroupCalibration(common.DefaultBus, 3, 102, calibration); err == nil {
+		t.Fatal("Expected error when calibrating a read group that is not configured, got nil")
+	}
+}
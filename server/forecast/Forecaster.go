@@ -0,0 +1,333 @@
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+//the methods used to calculate the consumption rate
+const (
+	//Smoothing smooths exponentially the rates between consecutive readings
+	Smoothing = "smoothing"
+	//Regression fits a line through the readings between two refills
+	Regression = "regression"
+)
+
+const (
+	//history is how far back the readings are used
+	history = 30 * 24 * time.Hour
+	//alpha is the smoothing factor of the rates, the weight of the newest rate
+	alpha = 0.3
+	//refillUnits is the increase in units between two readings
+	//that is taken as a refill of the stock
+	refillUnits = 0.5
+)
+
+//Forecast is the consumption rate of a product and the projection of its
+//stock. Rate is in units used per day. DaysUntilEmpty and DaysUntilMin
+//(the days until the stock gets down to the minimum stock) are not set if
+//nothing is used. Empty and MinReached are their dates in TimeFormat
+type Forecast struct {
+	SKU            string   `json:"sku"`
+	Method         string   `json:"method"`
+	Rate           float64  `json:"rate"`
+	Count          int      `json:"count"`
+	MinStock       int      `json:"minStock,omitempty"`
+	DaysUntilEmpty *float64 `json:"daysUntilEmpty,omitempty"`
+	Empty          string   `json:"empty,omitempty"`
+	DaysUntilMin   *float64 `json:"daysUntilMin,omitempty"`
+	MinReached     string   `json:"minReached,omitempty"`
+	Samples        int      `json:"samples"`
+	Since          string   `json:"since"`
+	Time           string   `json:"time"`
+}
+
+//point is the stock of a product, in units, at a time
+type point struct {
+	at    time.Time
+	units float64
+	count int
+}
+
+//series keeps the stock of a product read from the read group it is bound to
+type series struct {
+	bus           string
+	sensor        uint8
+	startLocation uint16
+	points        []point
+}
+
+//byTime sorts the readings by their time
+type byTime []common.Reading
+
+func (readings byTime) Len() int           { return len(readings) }
+func (readings byTime) Swap(i, j int)      { readings[i], readings[j] = readings[j], readings[i] }
+func (readings byTime) Less(i, j int) bool { return readings[i].Time < readings[j].Time }
+
+//Forecaster calculates the consumption rate of the products and projects
+//when their stock runs out. The stock of the last 30 days is loaded from
+//the readings saved in the persistence provider the first time a product
+//is needed and it is kept up to date with the readings received through Update
+type Forecaster struct {
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	inventory           *inventory.Inventory
+	series              map[string]*series
+	mutex               *sync.Mutex
+}
+
+//NewForecaster returns a Forecaster of the products of inv
+//using the readings saved in pp
+func (Forecaster) NewForecaster(pp *persistenceprovider.PersistenceProvider, inv *inventory.Inventory) *Forecaster {
+	return &Forecaster{persistenceProvider: pp, inventory: inv,
+		series: make(map[string]*series), mutex: &sync.Mutex{}}
+}
+
+//IsMethodValid checks that method is a known forecasting method.
+//An empty method is the default, Regression
+func IsMethodValid(method string) error {
+	if method != "" && method != Smoothing && method != Regression {
+		return fmt.Errorf("Unknown forecasting method %s, use %s or %s", method, Smoothing, Regression)
+	}
+	return nil
+}
+
+//add appends the stock of product in reading to s. The readings older
+//than the last one kept are dropped, as are the points older than history
+func (s *series) add(product common.Product, reading common.Reading) {
+	stock, err := inventory.StockFromReading(product, reading)
+	if err != nil {
+		return
+	}
+	at, err := time.ParseInLocation(common.TimeFormat, stock.Time, time.Local)
+	if err != nil || (len(s.points) > 0 && !at.After(s.points[len(s.points)-1].at)) {
+		return
+	}
+	unitWeight, err := inventory.ConvertWeight(product, product.UnitWeight, stock.Unit)
+	if err != nil {
+		return
+	}
+	s.points = append(s.points, point{at: at, units: stock.Weight / unitWeight, count: stock.Count})
+	for len(s.points) > 0 && s.points[0].at.Before(at.Add(-history)) {
+		s.points = s.points[1:]
+	}
+}
+
+//seriesOf returns the series of product, loading it from the
+//persistence provider if it is not loaded yet or if the product
+//was bound to another read group
+func (forecaster *Forecaster) seriesOf(product common.Product) (*series, error) {
+	s, ok := forecaster.series[product.SKU]
+	if ok && s.bus == product.Bus && s.sensor == product.Sensor && s.startLocation == product.StartLocation {
+		return s, nil
+	}
+	now := time.Now()
+	readings, err := (*forecaster.persistenceProvider).GetSensorReadingsInPeriod(
+		product.Bus, product.Sensor, now.Add(-history), now)
+	if err != nil {
+		return nil, err
+	}
+	s = &series{bus: product.Bus, sensor: product.Sensor, startLocation: product.StartLocation}
+	sort.Sort(byTime(readings))
+	for _, reading := range readings {
+		s.add(product, reading)
+	}
+	forecaster.series[product.SKU] = s
+	return s, nil
+}
+
+//Update adds the stock of the products bound to the sensor of reading
+//to their series. It is meant to be called with every reading done
+func (forecaster *Forecaster) Update(reading common.Reading) {
+	reading.Bus = common.BusName(reading.Bus)
+	forecaster.mutex.Lock()
+	defer forecaster.mutex.Unlock()
+	for _, product := range forecaster.inventory.GetProducts() {
+		if product.Bus != reading.Bus || product.Sensor != reading.Sensor {
+			continue
+		}
+		s, err := forecaster.seriesOf(product)
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		s.add(product, reading)
+	}
+}
+
+//segments splits points at the refills of the stock
+func segments(points []point) [][]point {
+	var result [][]point
+	start := 0
+	for i := 1; i < len(points); i++ {
+		if points[i].units-points[i-1].units >= refillUnits {
+			result = append(result, points[start:i])
+			start = i
+		}
+	}
+	if start < len(points) {
+		result = append(result, points[start:])
+	}
+	return result
+}
+
+func days(from time.Time, to time.Time) float64 {
+	return to.Sub(from).Hours() / 24
+}
+
+//regressionRate fits a line through the points of every segment
+//and returns the average of their slopes, weighted by the
+//duration of the segments
+func regressionRate(points []point) (float64, bool) {
+	used, total := 0.0, 0.0
+	for _, segment := range segments(points) {
+		if len(segment) < 2 {
+			continue
+		}
+		n := float64(len(segment))
+		var sumX, sumY, sumXY, sumXX float64
+		for _, p := range segment {
+			x := days(segment[0].at, p.at)
+			sumX += x
+			sumY += p.units
+			sumXY += x * p.units
+			sumXX += x * x
+		}
+		denominator := n*sumXX - sumX*sumX
+		if denominator == 0 {
+			continue
+		}
+		slope := (n*sumXY - sumX*sumY) / denominator
+		duration := days(segment[0].at, segment[len(segment)-1].at)
+		used += -slope * duration
+		total += duration
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return used / total, true
+}
+
+//smoothingRate smooths exponentially the rates between the consecutive
+//points of every segment
+func smoothingRate(points []point) (float64, bool) {
+	rate, found := 0.0, false
+	for _, segment := range segments(points) {
+		for i := 1; i < len(segment); i++ {
+			elapsed := days(segment[i-1].at, segment[i].at)
+			if elapsed <= 0 {
+				continue
+			}
+			current := (segment[i-1].units - segment[i].units) / elapsed
+			if !found {
+				rate, found = current, true
+				continue
+			}
+			rate = alpha*current + (1-alpha)*rate
+		}
+	}
+	return rate, found
+}
+
+//GetForecast returns the forecast of the product having sku calculated
+//with method, Regression if empty
+func (forecaster *Forecaster) GetForecast(sku string, method string) (*Forecast, error) {
+	if err := IsMethodValid(method); err != nil {
+		return nil, err
+	}
+	if method == "" {
+		method = Regression
+	}
+	product, err := forecaster.inventory.GetProduct(sku)
+	if err != nil {
+		return nil, err
+	}
+	forecaster.mutex.Lock()
+	defer forecaster.mutex.Unlock()
+	s, err := forecaster.seriesOf(*product)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.points) == 0 {
+		return nil, fmt.Errorf("No stock of product %s read in the last %d days", sku, int(history.Hours()/24))
+	}
+	rate, ok := regressionRate(s.points)
+	if method == Smoothing {
+		rate, ok = smoothingRate(s.points)
+	}
+	if !ok {
+		return nil, fmt.Errorf("Not enough readings of product %s to forecast", sku)
+	}
+	rate = math.Max(rate, 0)
+	last := s.points[len(s.points)-1]
+	forecast := &Forecast{SKU: sku, Method: method, Rate: rate, Count: last.count,
+		MinStock: product.MinStock, Samples: len(s.points),
+		Since: s.points[0].at.Format(common.TimeFormat), Time: last.at.Format(common.TimeFormat)}
+	if rate > 0 {
+		untilEmpty := float64(last.count) / rate
+		untilMin := math.Max(float64(last.count-product.MinStock), 0) / rate
+		forecast.DaysUntilEmpty, forecast.DaysUntilMin = &untilEmpty, &untilMin
+		forecast.Empty = last.at.Add(time.Duration(untilEmpty * 24 * float64(time.Hour))).Format(common.TimeFormat)
+		forecast.MinReached = last.at.Add(time.Duration(untilMin * 24 * float64(time.Hour))).Format(common.TimeFormat)
+	}
+	return forecast, nil
+}
+
+//GetForecasts returns the forecasts of the products that can be forecast,
+//sorted by SKU
+func (forecaster *Forecaster) GetForecasts(method string) ([]Forecast, error) {
+	if err := IsMethodValid(method); err != nil {
+		return nil, err
+	}
+	forecasts := []Forecast{}
+	for _, product := range forecaster.inventory.GetProducts() {
+		if forecast, err := forecaster.GetForecast(product.SKU, method); err == nil {
+			forecasts = append(forecasts, *forecast)
+		}
+	}
+	return forecasts, nil
+}
+
+//DailyDemand returns the consumption rate of the product having sku, in
+//units per day, calculated by regression. It can be used as the demand
+//of the purchase orders
+func (forecaster *Forecaster) DailyDemand(sku string) (float64, error) {
+	forecast, err := forecaster.GetForecast(sku, Regression)
+	if err != nil {
+		return 0, err
+	}
+	return forecast.Rate, nil
+}
+
+//Value returns the value of the forecast of the product having sku used
+//by the alarm rules: common.ForecastRate, common.DaysUntilEmpty or
+//common.DaysUntilMin. The days are not available while nothing is used
+func (forecaster *Forecaster) Value(sku string, value string) (float64, error) {
+	forecast, err := forecaster.GetForecast(sku, Regression)
+	if err != nil {
+		return 0, err
+	}
+	switch value {
+	case common.ForecastRate:
+		return forecast.Rate, nil
+	case common.DaysUntilEmpty:
+		if forecast.DaysUntilEmpty != nil {
+			return *forecast.DaysUntilEmpty, nil
+		}
+	case common.DaysUntilMin:
+		if forecast.DaysUntilMin != nil {
+			return *forecast.DaysUntilMin, nil
+		}
+	default:
+		return 0, fmt.Errorf("Unknown forecast value %s", value)
+	}
+	return 0, errors.New("Nothing is used from the stock of product " + sku)
+}
@@ -0,0 +1,115 @@
+package forecast_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/forecast"
+	"github.com/adiclepcea/SensInventory/server/internal/fixtures"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+func newForecasterForTest(t *testing.T) (persistenceprovider.PersistenceProvider, *forecast.Forecaster) {
+	cp := fixtures.Scale(t)
+	pp := fixtures.PersistenceProvider(t)
+	toner := fixtures.Toner("38A", 2)
+	toner.UnitWeight, toner.Unit = 1, "kg"
+	inv := fixtures.Inventory(t, &cp, &pp, toner)
+	return pp, forecast.Forecaster{}.NewForecaster(&pp, inv)
+}
+
+func newStockReadingForTest(units float64, at time.Time) common.Reading {
+	reading := common.Reading{Bus: common.DefaultBus, Sensor: 3, Type: common.Input,
+		StartLocation: 100, Count: 1, Time: at.Format(common.TimeFormat)}
+	reading.InitCalculatedValues()
+	reading.CalculatedValues["100"] = units * 1000
+	reading.SetUnit(100, "g")
+	return reading
+}
+
+func near(value float64, expected float64) bool {
+	return math.Abs(value-expected) < 1e-6
+}
+
+func TestForecastIgnoresRefills(t *testing.T) {
+	pp, forecaster := newForecasterForTest(t)
+	start := time.Now().Add(-10 * 24 * time.Hour)
+	//2 units a day, refilled from 12 to 30 on the fifth day
+	for day, units := range []float64{20, 18, 16, 14, 12, 30, 28, 26, 24, 22} {
+		pp.SaveSensorReading(newStockReadingForTest(units, start.Add(time.Duration(day)*24*time.Hour)))
+	}
+	forecaster.Update(newStockReadingForTest(20, start.Add(10*24*time.Hour)))
+
+	for _, method := range []string{forecast.Regression, forecast.Smoothing} {
+		result, err := forecaster.GetForecast("38A", method)
+		if err != nil {
+			t.Fatalf("No error expected when forecasting with %s, got %s", method, err.Error())
+		}
+		if !near(result.Rate, 2) || result.Count != 20 || result.Samples != 11 {
+			t.Fatalf("Expected 2 units a day from 11 samples with %s, got %v", method, result)
+		}
+		if result.DaysUntilEmpty == nil || !near(*result.DaysUntilEmpty, 10) ||
+			result.DaysUntilMin == nil || !near(*result.DaysUntilMin, 9) {
+			t.Fatalf("Expected 10 days until empty and 9 until the minimum, got %v", result)
+		}
+		empty := start.Add(20 * 24 * time.Hour).Format(common.TimeFormat)
+		if result.Empty != empty {
+			t.Fatalf("Expected to be empty at %s, got %s", empty, result.Empty)
+		}
+	}
+
+	if value, err := forecaster.Value("38A", common.DaysUntilEmpty); err != nil || !near(value, 10) {
+		t.Fatalf("Expected 10 days until empty, got %v, %v", value, err)
+	}
+	if demand, err := forecaster.DailyDemand("38A"); err != nil || !near(demand, 2) {
+		t.Fatalf("Expected a demand of 2 units a day, got %v, %v", demand, err)
+	}
+	forecasts, err := forecaster.GetForecasts("")
+	if err != nil || len(forecasts) != 1 || forecasts[0].Method != forecast.Regression {
+		t.Fatalf("Expected the regression forecast of 38A, got %v, %v", forecasts, err)
+	}
+}
+
+func TestForecastMethods(t *testing.T) {
+	_, forecaster := newForecasterForTest(t)
+	start := time.Now().Add(-3 * 24 * time.Hour)
+	for day, units := range []float64{10, 9, 6} {
+		forecaster.Update(newStockReadingForTest(units, start.Add(time.Duration(day)*24*time.Hour)))
+	}
+
+	//the rates are 1 and 3 units a day, smoothed to 0.3*3+0.7*1
+	result, err := forecaster.GetForecast("38A", forecast.Smoothing)
+	if err != nil || !near(result.Rate, 1.6) {
+		t.Fatalf("Expected 1.6 units a day by smoothing, got %v, %v", result, err)
+	}
+	result, err = forecaster.GetForecast("38A", forecast.Regression)
+	if err != nil || !near(result.Rate, 2) {
+		t.Fatalf("Expected 2 units a day by regression, got %v, %v", result, err)
+	}
+}
+
+func TestForecastShouldFail(t *testing.T) {
+	_, forecaster := newForecasterForTest(t)
+	if _, err := forecaster.GetForecast("38A", "guess"); err == nil {
+		t.Fatal("Expected error when forecasting with an unknown method, got nil")
+	}
+	if _, err := forecaster.GetForecast("12A", ""); err == nil {
+		t.Fatal("Expected error when forecasting a missing product, got nil")
+	}
+	if _, err := forecaster.GetForecast("38A", ""); err == nil {
+		t.Fatal("Expected error when forecasting without readings, got nil")
+	}
+
+	now := time.Now()
+	forecaster.Update(newStockReadingForTest(5, now.Add(-time.Hour)))
+	forecaster.Update(newStockReadingForTest(5, now))
+	result, err := forecaster.GetForecast("38A", "")
+	if err != nil || result.Rate != 0 || result.DaysUntilEmpty != nil {
+		t.Fatalf("Expected no consumption and no days until empty, got %v, %v", result, err)
+	}
+	if _, err = forecaster.Value("38A", common.DaysUntilEmpty); err == nil {
+		t.Fatal("Expected error when nothing is used, got nil")
+	}
+}
@@ -0,0 +1,78 @@
+//Package fixtures builds the scale, the persistence provider and the
+//products used by the tests of the stock related packages
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+//Sensor is the address of the scale on the default bus
+const Sensor = 3
+
+//StartLocation is the start location of the read group weighing the products
+const StartLocation = 100
+
+//Scale returns a mock configuration provider having the scale at Sensor.
+//The scale has readGroups or, if none are given, an Uint16 read group
+//at StartLocation
+func Scale(t testing.TB, readGroups ...common.ReadGroup) configprovider.ConfigProvider {
+	if len(readGroups) == 0 {
+		readGroups = []common.ReadGroup{common.ReadGroup{StartLocation: StartLocation, ResultType: common.Uint16}}
+	}
+	cp, err := configprovider.MockConfigProvider{}.NewConfigProvider()
+	if err != nil {
+		t.Fatalf("No error expected when creating the configuration provider, got %s", err.Error())
+	}
+	if err = cp.SetAddressLimits(1, 32); err != nil {
+		t.Fatalf("No error expected when setting the address limits, got %s", err.Error())
+	}
+	err = cp.AddSensor(common.Sensor{Address: Sensor,
+		Registers:  []common.Register{common.Register{Location: StartLocation, Type: common.Input}},
+		ReadGroups: readGroups})
+	if err != nil {
+		t.Fatalf("No error expected when adding the scale, got %s", err.Error())
+	}
+	return cp
+}
+
+//PersistenceProvider returns an empty mock persistence provider
+func PersistenceProvider(t testing.TB) persistenceprovider.PersistenceProvider {
+	pp, err := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	if err != nil {
+		t.Fatalf("No error expected when creating the persistence provider, got %s", err.Error())
+	}
+	return pp
+}
+
+//Toner returns the toner having sku weighed by the scale. One toner
+//weighs 1000 (in the unit of the read group) and the stock is low
+//under minStock toners
+func Toner(sku string, minStock int) common.Product {
+	return common.Product{SKU: sku, Name: "toner " + sku, UnitWeight: 1000, MinStock: minStock,
+		Sensor: Sensor, StartLocation: StartLocation}
+}
+
+//Inventory returns an inventory on cp and pp holding products
+func Inventory(t testing.TB, cp *configprovider.ConfigProvider, pp *persistenceprovider.PersistenceProvider,
+	products ...common.Product) *inventory.Inventory {
+	inv, err := inventory.Inventory{}.NewInventory(cp, pp)
+	if err != nil {
+		t.Fatalf("No error expected when creating the inventory, got %s", err.Error())
+	}
+	AddProducts(t, inv, products...)
+	return inv
+}
+
+//AddProducts adds products to inv
+func AddProducts(t testing.TB, inv *inventory.Inventory, products ...common.Product) {
+	for _, product := range products {
+		if err := inv.AddProduct(product); err != nil {
+			t.Fatalf("No error expected when adding product %s, got %s", product.SKU, err.Error())
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+//productsItem is the name of the item holding the products
+//in the persistence provider
+const productsItem = "products"
+
+//lookBack is how far back the last reading of a product is
+//looked for in the persistence provider
+const lookBack = 24 * time.Hour
+
+//bySKU sorts the products by their SKU
+type bySKU []common.Product
+
+func (products bySKU) Len() int           { return len(products) }
+func (products bySKU) Swap(i, j int)      { products[i], products[j] = products[j], products[i] }
+func (products bySKU) Less(i, j int) bool { return products[i].SKU < products[j].SKU }
+
+//Inventory keeps the products bound to the read groups of the sensors and
+//calculates their stock from the readings. The products are saved in the
+//persistence provider and the stock is updated with every reading received
+//through Update. The event listeners are told when the stock changes
+type Inventory struct {
+	configProvider      *configprovider.ConfigProvider
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	products            map[string]common.Product
+	stocks              map[string]common.Stock
+	events              *common.EventQueue
+	mutex               *sync.RWMutex
+}
+
+//NewInventory returns an Inventory checking the products against the
+//sensors of cp and keeping them in pp. The products already saved in pp are loaded
+func (Inventory) NewInventory(cp *configprovider.ConfigProvider, pp *persistenceprovider.PersistenceProvider) (*Inventory, error) {
+	inventory := &Inventory{configProvider: cp, persistenceProvider: pp,
+		products: make(map[string]common.Product),
+		stocks:   make(map[string]common.Stock),
+		events:   common.EventQueue{}.NewEventQueue(),
+		mutex:    &sync.RWMutex{}}
+	if err := inventory.load(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return inventory, nil
+}
+
+//load reads the products saved in the persistence provider
+func (inventory *Inventory) load() error {
+	var products []common.Product
+	err := persistenceprovider.ReadItemInto(*inventory.persistenceProvider, productsItem, &products)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		inventory.products[product.SKU] = product
+	}
+	return nil
+}
+
+//save writes the products in the persistence provider
+func (inventory *Inventory) save() error {
+	return (*inventory.persistenceProvider).SaveItem(productsItem, inventory.sortedProducts())
+}
+
+func (inventory *Inventory) sortedProducts() []common.Product {
+	products := make([]common.Product, 0, len(inventory.products))
+	for _, product := range inventory.products {
+		products = append(products, product)
+	}
+	sort.Sort(bySKU(products))
+	return products
+}
+
+//IsProductValid checks that product has a SKU and a unit weight and that it
+//is bound to a read group configured on a sensor
+func (inventory *Inventory) IsProductValid(product common.Product) error {
+	if product.SKU == "" {
+		return errors.New("The product must have a SKU")
+	}
+	if product.UnitWeight <= 0 {
+		return fmt.Errorf("The unit weight of product %s must be greater than 0", product.SKU)
+	}
+	if product.Tare < 0 || product.MinStock < 0 {
+		return fmt.Errorf("The tare and the minimum stock of product %s can not be negative", product.SKU)
+	}
+	if product.Unit != "" && !readgroups.IsUnitKnown(product.Unit) {
+		return fmt.Errorf("Unit %s of product %s unknown", product.Unit, product.SKU)
+	}
+	sensor, err := (*inventory.configProvider).GetSensorByAddress(product.Bus, product.Sensor)
+	if err != nil {
+		return err
+	}
+	for _, rg := range sensor.ReadGroups {
+		if rg.StartLocation == product.StartLocation {
+			_, err = ConvertWeight(product, product.UnitWeight, rg.Unit)
+			return err
+		}
+	}
+	return fmt.Errorf("The sensor %d has no read group starting at %d", product.Sensor, product.StartLocation)
+}
+
+//AddProduct adds a new product to the inventory
+func (inventory *Inventory) AddProduct(product common.Product) error {
+	product.Bus = common.BusName(product.Bus)
+	if err := inventory.IsProductValid(product); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	if _, ok := inventory.products[product.SKU]; ok {
+		err := fmt.Errorf("A product with SKU %s already exists", product.SKU)
+		log.Println(err.Error())
+		return err
+	}
+	inventory.products[product.SKU] = product
+	return inventory.save()
+}
+
+//ChangeProduct changes the product having sku to be similar with after.
+//The SKU can not be changed
+func (inventory *Inventory) ChangeProduct(sku string, after common.Product) error {
+	after.SKU = sku
+	after.Bus = common.BusName(after.Bus)
+	if err := inventory.IsProductValid(after); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	before, ok := inventory.products[sku]
+	if !ok {
+		return fmt.Errorf("No product with SKU %s", sku)
+	}
+	if before.Bus != after.Bus || before.Sensor != after.Sensor || before.StartLocation != after.StartLocation {
+		delete(inventory.stocks, sku)
+	}
+	inventory.products[sku] = after
+	return inventory.save()
+}
+
+//RemoveProduct removes the product having sku from the inventory
+func (inventory *Inventory) RemoveProduct(sku string) error {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	if _, ok := inventory.products[sku]; !ok {
+		return fmt.Errorf("No product with SKU %s", sku)
+	}
+	delete(inventory.products, sku)
+	delete(inventory.stocks, sku)
+	return inventory.save()
+}
+
+//GetProduct returns the product having sku
+func (inventory *Inventory) GetProduct(sku string) (*common.Product, error) {
+	inventory.mutex.RLock()
+	defer inventory.mutex.RUnlock()
+	product, ok := inventory.products[sku]
+	if !ok {
+		return nil, fmt.Errorf("No product with SKU %s", sku)
+	}
+	return &product, nil
+}
+
+//GetProducts returns the products sorted by SKU
+func (inventory *Inventory) GetProducts() []common.Product {
+	inventory.mutex.RLock()
+	defer inventory.mutex.RUnlock()
+	return inventory.sortedProducts()
+}
+
+//ConvertWeight converts weight from the unit of product to unit. The
+//weight is returned unchanged if the product or unit has no unit set
+func ConvertWeight(product common.Product, weight float64, unit string) (float64, error) {
+	if product.Unit == "" || unit == "" || product.Unit == unit {
+		return weight, nil
+	}
+	converted, err := readgroups.ConvertUnit(weight, product.Unit, unit)
+	if err != nil {
+		return 0, fmt.Errorf("Could not convert the weight of product %s: %s", product.SKU, err.Error())
+	}
+	return converted, nil
+}
+
+//StockFromReading calculates the stock of product from reading. The
+//container tare of the product is subtracted from the net value of the
+//read group (the value itself if the read group has no tare). The weight
+//of the stock is in the unit of the reading
+func StockFromReading(product common.Product, reading common.Reading) (*common.Stock, error) {
+	rg := common.ReadGroup{StartLocation: product.StartLocation}
+	key := rg.NetKey()
+	if _, ok := reading.CalculatedValues[key]; !ok {
+		key = rg.Key()
+	}
+	weight, err := readgroups.CalculatedValue(&reading, key)
+	if err != nil {
+		return nil, err
+	}
+	unit := reading.Units[key]
+	tare, err := ConvertWeight(product, product.Tare, unit)
+	if err != nil {
+		return nil, err
+	}
+	unitWeight, err := ConvertWeight(product, product.UnitWeight, unit)
+	if err != nil {
+		return nil, err
+	}
+	weight -= tare
+	count := 0
+	if weight > 0 {
+		//the small tolerance keeps exact multiples from being rounded down
+		count = int(math.Floor(weight/unitWeight + 1e-9))
+	}
+	return &common.Stock{SKU: product.SKU, Name: product.Name, Weight: weight,
+		Unit: unit, Count: count, MinStock: product.MinStock,
+		Low: count < product.MinStock, Time: reading.Time}, nil
+}
+
+//AddEventListener adds listener to the listeners told when the stock
+//of a product changes its count of units or gets low
+func (inventory *Inventory) AddEventListener(listener common.EventListener) {
+	inventory.events.AddListener(listener)
+}
+
+//stockEvents returns the events of the stock of a product changing
+//from previous to stock
+func stockEvents(previous common.Stock, stock common.Stock) []common.Event {
+	var events []common.Event
+	if stock.Count != previous.Count {
+		events = append(events, common.Event{Type: common.StockChangedEvent, Time: stock.Time,
+			Stock: &stock, Previous: &previous})
+	}
+	if stock.Low && !previous.Low {
+		events = append(events, common.Event{Type: common.StockLowEvent, Time: stock.Time,
+			Stock: &stock, Previous: &previous})
+	}
+	return events
+}
+
+//Update calculates the stock of the products bound to the sensor of
+//reading. It is meant to be called with every reading done.
+//The first stock of a product after the start sends no events
+func (inventory *Inventory) Update(reading common.Reading) {
+	reading.Bus = common.BusName(reading.Bus)
+	inventory.mutex.Lock()
+	for sku, product := range inventory.products {
+		if product.Bus != reading.Bus || product.Sensor != reading.Sensor {
+			continue
+		}
+		if stock, err := StockFromReading(product, reading); err == nil {
+			if previous, ok := inventory.stocks[sku]; ok {
+				for _, event := range stockEvents(previous, *stock) {
+					inventory.events.Emit(event)
+				}
+			}
+			inventory.stocks[sku] = *stock
+		}
+	}
+	inventory.mutex.Unlock()
+	inventory.events.Flush()
+}
+
+//lastStock looks for the stock of product in the readings
+//saved in the persistence provider during the last day
+func (inventory *Inventory) lastStock(product common.Product) (*common.Stock, error) {
+	now := time.Now()
+	readings, err := (*inventory.persistenceProvider).GetSensorReadingsInPeriod(
+		product.Bus, product.Sensor, now.Add(-lookBack), now)
+	if err != nil {
+		return nil, err
+	}
+	var last *common.Stock
+	for _, reading := range readings {
+		if stock, err := StockFromReading(product, reading); err == nil &&
+			(last == nil || stock.Time >= last.Time) {
+			last = stock
+		}
+	}
+	if last == nil {
+		return nil, fmt.Errorf("No reading of product %s since %s", product.SKU,
+			now.Add(-lookBack).Format(common.TimeFormat))
+	}
+	return last, nil
+}
+
+//GetStock returns the current stock of the product having sku
+func (inventory *Inventory) GetStock(sku string) (*common.Stock, error) {
+	inventory.mutex.RLock()
+	product, ok := inventory.products[sku]
+	stock, found := inventory.stocks[sku]
+	inventory.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("No product with SKU %s", sku)
+	}
+	if found {
+		return &stock, nil
+	}
+	return inventory.lastStock(product)
+}
+
+//GetStocks returns the current stock of every product having a reading.
+//The stocks are sorted by SKU
+func (inventory *Inventory) GetStocks() []common.Stock {
+	stocks := []common.Stock{}
+	for _, product := range inventory.GetProducts() {
+		if stock, err := inventory.GetStock(product.SKU); err == nil {
+			stocks = append(stocks, *stock)
+		}
+	}
+	return stocks
+}
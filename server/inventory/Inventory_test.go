@@ -0,0 +1,160 @@
+package inventory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/internal/fixtures"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+func newInventoryForTest(t *testing.T) (persistenceprovider.PersistenceProvider, *inventory.Inventory) {
+	cp := fixtures.Scale(t, common.ReadGroup{StartLocation: 100, ResultType: common.Uint16, Unit: "g"})
+	pp := fixtures.PersistenceProvider(t)
+	return pp, fixtures.Inventory(t, &cp, &pp)
+}
+
+func newReadingForTest(gross float64, net interface{}) common.Reading {
+	reading := common.Reading{Bus: common.DefaultBus, Sensor: 3, Type: common.Input,
+		StartLocation: 100, Count: 1, Time: time.Now().Format(common.TimeFormat)}
+	reading.InitCalculatedValues()
+	reading.CalculatedValues["100"] = gross
+	reading.SetUnit(100, "g")
+	if net != nil {
+		reading.CalculatedValues["100.net"] = net
+		reading.Units["100.net"] = "g"
+	}
+	return reading
+}
+
+func TestProductsShouldOk(t *testing.T) {
+	pp, inv := newInventoryForTest(t)
+	toner := common.Product{SKU: "38A", Name: "toner 38A", UnitWeight: 1200, Tare: 300,
+		MinStock: 3, Sensor: 3, StartLocation: 100}
+	if err := inv.AddProduct(toner); err != nil {
+		t.Fatalf("No error expected when adding a product, got %s", err.Error())
+	}
+	toner.MinStock = 2
+	if err := inv.ChangeProduct("38A", toner); err != nil {
+		t.Fatalf("No error expected when changing a product, got %s", err.Error())
+	}
+	if err := inv.AddProduct(common.Product{SKU: "12A", UnitWeight: 900, Sensor: 3, StartLocation: 100}); err != nil {
+		t.Fatalf("No error expected when adding a product, got %s", err.Error())
+	}
+	products := inv.GetProducts()
+	if len(products) != 2 || products[0].SKU != "12A" || products[1].MinStock != 2 {
+		t.Fatalf("Expected the products sorted by SKU, got %v", products)
+	}
+
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(1, 32)
+	loaded, err := inventory.Inventory{}.NewInventory(&cp, &pp)
+	if err != nil {
+		t.Fatalf("No error expected when loading the inventory, got %s", err.Error())
+	}
+	if product, err := loaded.GetProduct("38A"); err != nil || product.Bus != common.DefaultBus ||
+		product.MinStock != 2 {
+		t.Fatalf("Expected the product to be loaded, got %v, %v", product, err)
+	}
+
+	if err = inv.RemoveProduct("12A"); err != nil {
+		t.Fatalf("No error expected when removing a product, got %s", err.Error())
+	}
+	if _, err = inv.GetProduct("12A"); err == nil {
+		t.Fatal("Expected error when getting a removed product, got nil")
+	}
+}
+
+func TestProductsShouldFail(t *testing.T) {
+	_, inv := newInventoryForTest(t)
+	invalid := []common.Product{
+		common.Product{UnitWeight: 1, Sensor: 3, StartLocation: 100},
+		common.Product{SKU: "a", Sensor: 3, StartLocation: 100},
+		common.Product{SKU: "a", UnitWeight: 1, Tare: -1, Sensor: 3, StartLocation: 100},
+		common.Product{SKU: "a", UnitWeight: 1, Sensor: 4, StartLocation: 100},
+		common.Product{SKU: "a", UnitWeight: 1, Sensor: 3, StartLocation: 101},
+		common.Product{SKU: "a", UnitWeight: 1, Unit: "oz", Sensor: 3, StartLocation: 100},
+		common.Product{SKU: "a", UnitWeight: 1, Unit: "l", Sensor: 3, StartLocation: 100},
+	}
+	for _, product := range invalid {
+		if err := inv.AddProduct(product); err == nil {
+			t.Fatalf("Expected error when adding %v, got nil", product)
+		}
+	}
+	product := common.Product{SKU: "a", UnitWeight: 1, Sensor: 3, StartLocation: 100}
+	fixtures.AddProducts(t, inv, product)
+	if err := inv.AddProduct(product); err == nil {
+		t.Fatal("Expected error when adding a product twice, got nil")
+	}
+	if err := inv.ChangeProduct("b", product); err == nil {
+		t.Fatal("Expected error when changing a missing product, got nil")
+	}
+	if err := inv.RemoveProduct("b"); err == nil {
+		t.Fatal("Expected error when removing a missing product, got nil")
+	}
+	if _, err := inv.GetStock("a"); err == nil {
+		t.Fatal("Expected error when getting the stock of a product never read, got nil")
+	}
+}
+
+func TestStockShouldOk(t *testing.T) {
+	pp, inv := newInventoryForTest(t)
+	fixtures.AddProducts(t, inv, common.Product{SKU: "38A", Name: "toner 38A", UnitWeight: 1200, Tare: 300,
+		MinStock: 3, Sensor: 3, StartLocation: 100})
+
+	pp.SaveSensorReading(newReadingForTest(4100, nil))
+	stock, err := inv.GetStock("38A")
+	if err != nil {
+		t.Fatalf("No error expected when getting the stock from the saved readings, got %s", err.Error())
+	}
+	if stock.Weight != 3800 || stock.Count != 3 || stock.Low || stock.Unit != "g" {
+		t.Fatalf("Expected 3 units weighing 3800 g, got %v", stock)
+	}
+
+	var events []common.Event
+	inv.AddEventListener(func(event common.Event) {
+		events = append(events, event)
+	})
+	inv.Update(newReadingForTest(5000, 4100.0))
+	if len(events) != 0 {
+		t.Fatalf("Expected no events for the first stock, got %v", events)
+	}
+	inv.Update(newReadingForTest(5000, 2700.0))
+	if len(events) != 2 || events[0].Type != common.StockChangedEvent || events[0].Previous.Count != 3 ||
+		events[1].Type != common.StockLowEvent || events[1].Stock.Count != 2 {
+		t.Fatalf("Expected the stock changed and stock low events, got %v", events)
+	}
+	stock, _ = inv.GetStock("38A")
+	if stock.Weight != 2400 || stock.Count != 2 || !stock.Low {
+		t.Fatalf("Expected 2 units from the net weight, under the minimum stock, got %v", stock)
+	}
+
+	inv.Update(newReadingForTest(100, nil))
+	stocks := inv.GetStocks()
+	if len(stocks) != 1 || stocks[0].Count != 0 || stocks[0].Weight != -200 {
+		t.Fatalf("Expected no units when the weight is under the tare, got %v", stocks)
+	}
+}
+
+func TestStockInProductUnit(t *testing.T) {
+	_, inv := newInventoryForTest(t)
+	if err := inv.AddProduct(common.Product{SKU: "38A", UnitWeight: 1.2, Tare: 0.3, Unit: "kg",
+		MinStock: 3, Sensor: 3, StartLocation: 100}); err != nil {
+		t.Fatalf("No error expected when adding a product weighed in kg, got %s", err.Error())
+	}
+	inv.Update(newReadingForTest(4100, nil))
+	stock, err := inv.GetStock("38A")
+	if err != nil || stock.Weight != 3800 || stock.Count != 3 || stock.Unit != "g" {
+		t.Fatalf("Expected 3 units weighing 3800 g, got %v, %v", stock, err)
+	}
+
+	product, _ := inv.GetProduct("38A")
+	reading := newReadingForTest(4100, nil)
+	reading.Units["100"] = "ml"
+	if _, err = inventory.StockFromReading(*product, reading); err == nil {
+		t.Fatal("Expected error when the reading is not a weight, got nil")
+	}
+}
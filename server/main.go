@@ -2,14 +2,23 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/adiclepcea/SensInventory/server/alarms"
 	"github.com/adiclepcea/SensInventory/server/common"
 	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/forecast"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/movements"
+	"github.com/adiclepcea/SensInventory/server/notifications"
+	"github.com/adiclepcea/SensInventory/server/orders"
 	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
 	"github.com/adiclepcea/SensInventory/server/readingprovider"
 	"github.com/julienschmidt/httprouter"
 )
@@ -22,8 +31,17 @@ type ErrorMessage struct {
 
 var configProvider configprovider.ConfigProvider
 var persistenceProvider persistenceprovider.PersistenceProvider
-var readingProvider readingprovider.ReadingProvider
 var scheduleProvider *readingprovider.ScheduleProvider
+var commissioner *readingprovider.Commissioner
+var calibrator *readingprovider.Calibrator
+var tarer *readingprovider.Tarer
+var stockInventory *inventory.Inventory
+var alarmEngine *alarms.Engine
+var webhookNotifier *notifications.WebhookNotifier
+var emailNotifier *notifications.EmailNotifier
+var orderManager *orders.Manager
+var forecaster *forecast.Forecaster
+var movementDetector *movements.Detector
 
 func initialize() {
 	var err error
@@ -42,10 +60,63 @@ func initialize() {
 
 	//For now the ModBUSReadingProvider is the only one
 	//This was the purpose anyway
-	readingProvider = readingprovider.ModBUSReadingProvider{}.NewReadingProvider(&configProvider)
+	//The default bus is always available, the others must be configured
+	readingProviders := []readingprovider.ReadingProvider{
+		readingprovider.ModBUSReadingProvider{}.NewReadingProvider(&configProvider, common.DefaultBus)}
+	for name := range configProvider.GetBuses() {
+		if name != common.DefaultBus {
+			readingProviders = append(readingProviders,
+				readingprovider.ModBUSReadingProvider{}.NewReadingProvider(&configProvider, name))
+		}
+	}
 
-	scheduleProvider = readingprovider.ScheduleProvider{}.NewScheduleProvider(readingProvider, &persistenceProvider)
+	scheduleProvider = readingprovider.ScheduleProvider{}.NewScheduleProvider(&configProvider, &persistenceProvider, readingProviders...)
+	if err = scheduleProvider.Load(); err != nil {
+		log.Printf("Error loading the schedule: %s\n", err.Error())
+	}
 	scheduleProvider.Start()
+	commissioner = readingprovider.Commissioner{}.NewCommissioner(&configProvider, scheduleProvider)
+	calibrator = readingprovider.Calibrator{}.NewCalibrator(&configProvider, scheduleProvider)
+	tarer = readingprovider.Tarer{}.NewTarer(&configProvider, scheduleProvider)
+	stockInventory, err = inventory.Inventory{}.NewInventory(&configProvider, &persistenceProvider)
+	if err != nil {
+		log.Fatalf("Error initializing the inventory: %s\n", err.Error())
+	}
+	//the forecasts are updated first, the stock events and the alarms use them
+	forecaster = forecast.Forecaster{}.NewForecaster(&persistenceProvider, stockInventory)
+	scheduleProvider.AddReadingListener(forecaster.Update)
+	scheduleProvider.AddReadingListener(stockInventory.Update)
+	alarmEngine, err = alarms.Engine{}.NewEngine(&persistenceProvider, stockInventory)
+	if err != nil {
+		log.Fatalf("Error initializing the alarm engine: %s\n", err.Error())
+	}
+	alarmEngine.SetForecast(forecaster.Value)
+	scheduleProvider.AddReadingListener(alarmEngine.Update)
+	webhookNotifier, err = notifications.WebhookNotifier{}.NewWebhookNotifier(&persistenceProvider)
+	if err != nil {
+		log.Fatalf("Error initializing the webhooks: %s\n", err.Error())
+	}
+	alarmEngine.AddEventListener(webhookNotifier.Notify)
+	stockInventory.AddEventListener(webhookNotifier.Notify)
+	emailNotifier, err = notifications.EmailNotifier{}.NewEmailNotifier(&persistenceProvider, stockInventory)
+	if err != nil {
+		log.Fatalf("Error initializing the email notifications: %s\n", err.Error())
+	}
+	alarmEngine.AddEventListener(emailNotifier.Notify)
+	stockInventory.AddEventListener(emailNotifier.Notify)
+	orderManager, err = orders.Manager{}.NewManager(&persistenceProvider, stockInventory)
+	if err != nil {
+		log.Fatalf("Error initializing the purchase orders: %s\n", err.Error())
+	}
+	orderManager.SetDemand(forecaster.DailyDemand)
+	stockInventory.AddEventListener(orderManager.Update)
+	orderManager.AddEventListener(webhookNotifier.Notify)
+	movementDetector, err = movements.Detector{}.NewDetector(&configProvider, &persistenceProvider, stockInventory)
+	if err != nil {
+		log.Fatalf("Error initializing the movement detection: %s\n", err.Error())
+	}
+	scheduleProvider.AddReadingListener(movementDetector.Update)
+	movementDetector.AddEventListener(webhookNotifier.Notify)
 
 }
 
@@ -82,20 +153,30 @@ func loadSchedule(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	err := scheduleProvider.Load()
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write(errorToJSONByteArray("could not save schedule", err))
+		w.Write(errorToJSONByteArray("could not load schedule", err))
 		return
 	}
 	returnSuccess(w)
 }
 
 func getTimers(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	it := scheduleProvider.Timers
-
 	encoder := json.NewEncoder(w)
-	if it == nil {
-		encoder.Encode(map[string]interface{}{})
+	encoder.Encode(scheduleProvider.GetTimers())
+}
+
+func getTimer(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "timer")
+	if !ok {
+		return
+	}
+	it, err := scheduleProvider.GetTimer(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get timer", err))
 		return
 	}
+	encoder := json.NewEncoder(w)
 	encoder.Encode(it)
 }
 
@@ -127,7 +208,7 @@ func addTimer(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		w.Write(errorToJSONByteArray("no valid timer received", err))
 		return
 	}
-	log.Printf("Adding timer for sensor %d\n", it.SensorAddress)
+	log.Printf("Adding timer for sensor %d on bus %s\n", it.SensorAddress, common.BusName(it.Bus))
 
 	err = scheduleProvider.AddTimer(*it)
 
@@ -147,11 +228,80 @@ func getTimerFromBody(r *http.Request) (*readingprovider.IntervalTimer, error) {
 	if err != nil {
 		return nil, err
 	}
+	//the timer has either an interval or a cron schedule
+	if err = it.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &it, nil
 
 }
 
+func changeTimer(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "timer")
+	if !ok {
+		return
+	}
+	it, err := getTimerFromBody(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid timer received", err))
+		return
+	}
+	if err = scheduleProvider.ChangeTimer(id, *it); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not change timer", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+//pauseOrResumeTimer calls change with the id of the timer in the url
+func pauseOrResumeTimer(w http.ResponseWriter, p httprouter.Params, action string, change func(id int) error) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "timer")
+	if !ok {
+		return
+	}
+	if err := change(id); err != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not "+action+" timer", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func pauseTimer(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	pauseOrResumeTimer(w, p, "pause", scheduleProvider.PauseTimer)
+}
+
+func resumeTimer(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	pauseOrResumeTimer(w, p, "resume", scheduleProvider.ResumeTimer)
+}
+
+//runTimer reads what the timer reads right away and returns the reading
+func runTimer(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "timer")
+	if !ok {
+		return
+	}
+	if _, err := scheduleProvider.GetTimer(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not run timer", err))
+		return
+	}
+	reading, err := scheduleProvider.RunTimer(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not run timer", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(reading)
+}
+
 func getSensors(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	sensors := configProvider.GetSensors()
 	rez := make(map[string]string)
@@ -168,13 +318,14 @@ func getSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	var sensor *common.Sensor
 
 	w.Header().Add("Content-Type", "application/json")
+	bus := p.ByName("bus")
 	sensorString := p.ByName("sensor")
 
 	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
 		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
 		return
 	}
-	sensor, err = configProvider.GetSensorByAddress(uint8(sensorAddress))
+	sensor, err = configProvider.GetSensorByAddress(bus, uint8(sensorAddress))
 
 	if err != nil {
 		w.Write(errorToJSONByteArray("could not get sensor", err))
@@ -198,14 +349,8 @@ func getSensorFromBody(r *http.Request) (*common.Sensor, error) {
 		}
 	}
 
-	if sensor.ReadGroups != nil {
-		for _, rg := range sensor.ReadGroups {
-			if rg.ResultType != common.Float32 &&
-				rg.ResultType != common.Int32 &&
-				rg.ResultType != common.Uint32 {
-				return nil, fmt.Errorf("Type %s unknown", rg.ResultType)
-			}
-		}
+	if err = readgroups.ValidateReadGroups(sensor); err != nil {
+		return nil, err
 	}
 
 	return &sensor, nil
@@ -220,7 +365,7 @@ func addSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		w.Write(errorToJSONByteArray("no valid sensor received", err))
 		return
 	}
-	log.Printf("Adding sensor %d\n", sensor.Address)
+	log.Printf("Adding sensor %d on bus %s\n", sensor.Address, common.BusName(sensor.Bus))
 	err = configProvider.AddSensor(*sensor)
 	if err != nil {
 		w.WriteHeader(http.StatusConflict)
@@ -235,14 +380,15 @@ func deleteSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	var err error
 	var sensorAddress int
 	w.Header().Add("Content-Type", "application/json")
+	bus := p.ByName("bus")
 	sensorString := p.ByName("sensor")
 	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
 		return
 	}
-	log.Printf("Deleting sensor %d\n", sensorAddress)
-	err = configProvider.RemoveSensorByAddress(uint8(sensorAddress))
+	log.Printf("Deleting sensor %d on bus %s\n", sensorAddress, bus)
+	err = configProvider.RemoveSensorByAddress(bus, uint8(sensorAddress))
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		w.Write(errorToJSONByteArray("could not delete sensor", err))
@@ -255,13 +401,14 @@ func changeSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	var sensorAddress int
 	var sensor *common.Sensor
 	w.Header().Add("Content-Type", "application/json")
+	bus := p.ByName("bus")
 	sensorString := p.ByName("sensor")
 	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
 		return
 	}
-	log.Printf("Changing sensor %d\n", sensorAddress)
+	log.Printf("Changing sensor %d on bus %s\n", sensorAddress, bus)
 	sensor, err = getSensorFromBody(r)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -269,7 +416,7 @@ func changeSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
-	err = configProvider.ChangeSensor(uint8(sensorAddress), *sensor)
+	err = configProvider.ChangeSensor(bus, uint8(sensorAddress), *sensor)
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -290,67 +437,1185 @@ func isTypeOk(typeString string) bool {
 	return true
 }
 
-func readSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	//TODO -- see if it is not better to put everything into
-	//a scheduler that will read automatically and store it in
-	//the persistenceprovider
-	var sensorAddress int
-	var startLocation int
-	var length int
-	var err error
-	sensorString := p.ByName("sensor")
-	typeString := p.ByName("type")
-	startString := p.ByName("start")
-	lengthString := p.ByName("length")
+func getBuses(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	buses := configProvider.GetBuses()
+	rez := make(map[string]common.BusConfig)
+	for name := range buses {
+		if busConfig, err := scheduleProvider.GetBusConfig(name); err == nil {
+			rez[name] = *busConfig
+		}
+	}
+	if busConfig, err := scheduleProvider.GetBusConfig(common.DefaultBus); err == nil {
+		rez[common.DefaultBus] = *busConfig
+	}
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(rez)
+}
 
-	if !isTypeOk(typeString) {
+func getBus(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	busConfig, err := scheduleProvider.GetBusConfig(p.ByName("bus"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get bus", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(busConfig)
+}
+
+func getBusFromBody(r *http.Request) (*common.BusConfig, error) {
+	decoder := json.NewDecoder(r.Body)
+	var busConfig common.BusConfig
+	err := decoder.Decode(&busConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &busConfig, nil
+}
+
+func addBus(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	busConfig, err := getBusFromBody(r)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write(errorToJSONByteArray("could not read sensor", fmt.Errorf("register type %s unknown", typeString)))
+		w.Write(errorToJSONByteArray("no valid bus configuration received", err))
 		return
 	}
-	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
+	if _, err = scheduleProvider.GetBusConfig(busConfig.Name); err == nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not add bus",
+			fmt.Errorf("the bus %s already exists", busConfig.Name)))
+		return
+	}
+	log.Printf("Adding bus %s, %s on %s\n", busConfig.Name, busConfig.Transport, busConfig.Address)
+	if err = configProvider.SetBus(*busConfig); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		w.Write(errorToJSONByteArray("could not add bus", err))
 		return
 	}
-	if startLocation, err = strconv.Atoi(startString); err != nil {
+	rp := readingprovider.ModBUSReadingProvider{}.NewReadingProvider(&configProvider, busConfig.Name)
+	if err = scheduleProvider.AddReadingProvider(rp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not open bus", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	returnSuccess(w)
+}
+
+func changeBus(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	busConfig, err := getBusFromBody(r)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write(errorToJSONByteArray("could not convert to valid start location", err))
+		w.Write(errorToJSONByteArray("no valid bus configuration received", err))
 		return
 	}
-	if length, err = strconv.Atoi(lengthString); err != nil {
+	busConfig.Name = p.ByName("bus")
+	if _, err = scheduleProvider.GetBusConfig(busConfig.Name); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not change bus", err))
+		return
+	}
+	log.Printf("Changing bus %s to %s on %s\n", busConfig.Name, busConfig.Transport, busConfig.Address)
+	if err = configProvider.SetBus(*busConfig); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write(errorToJSONByteArray("could not convert to valid length", err))
+		w.Write(errorToJSONByteArray("could not change the bus configuration", err))
+		return
+	}
+	if err = scheduleProvider.SetBusConfig(*busConfig); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not reopen the bus", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func deleteBus(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	name := p.ByName("bus")
+	if name == common.DefaultBus {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not delete bus",
+			fmt.Errorf("the bus %s can not be deleted", name)))
+		return
+	}
+	busConfig, err := configProvider.GetBus(name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not delete bus", err))
+		return
+	}
+	log.Printf("Deleting bus %s\n", name)
+	if err = configProvider.RemoveBus(name); err != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not delete bus", err))
+		return
+	}
+	if err = scheduleProvider.RemoveReadingProvider(name); err != nil {
+		configProvider.SetBus(*busConfig)
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not delete bus", err))
 		return
 	}
-	log.Printf("Reading sensor %d, type %s, start %d, length %d ",
-		sensorAddress, typeString, startLocation, length)
-	err = scheduleProvider.Read(uint8(sensorAddress), typeString, uint16(startLocation), uint16(length), true, nil)
+	returnSuccess(w)
+}
+
+//commissionSensor gives an address to the new sensor waiting on the bus.
+//The body is optional and holds the sensor description, the desired
+//address and the registers
+func commissionSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	sensor := &common.Sensor{}
+	if r.ContentLength != 0 {
+		var err error
+		if sensor, err = getSensorFromBody(r); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errorToJSONByteArray("no valid sensor received", err))
+			return
+		}
+	}
+	sensor.Bus = p.ByName("bus")
+	log.Printf("Commissioning a new sensor on bus %s\n", sensor.Bus)
+	sensor, err := commissioner.Commission(*sensor)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(errorToJSONByteArray("could not read sensor", err))
+		w.Write(errorToJSONByteArray("could not commission sensor", err))
 		return
 	}
+	w.WriteHeader(http.StatusCreated)
 	encoder := json.NewEncoder(w)
-	encoder.Encode(map[string]string{"Status": "OK"})
+	encoder.Encode(sensor)
+}
+
+//startCalibration starts the calibration of a read group. The body
+//holds the bus, the sensor and the start location of the read group
+func startCalibration(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	request := struct {
+		Bus           string `json:"bus"`
+		Sensor        uint8  `json:"sensor"`
+		StartLocation uint16 `json:"startLocation"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid calibration received", err))
+		return
+	}
+	log.Printf("Starting the calibration of read group %d on bus %s, sensor %d\n",
+		request.StartLocation, request.Bus, request.Sensor)
+	session, err := calibrator.Start(request.Bus, request.Sensor, request.StartLocation)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not start calibration", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(session)
+}
+
+func getCalibration(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "calibration")
+	if !ok {
+		return
+	}
+	session, err := calibrator.GetSession(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get calibration", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(session)
+}
+
+//addCalibrationPoint reads the sensor and pairs the raw value with the
+//known value from the body, e.g. {"value": 500}
+func addCalibrationPoint(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "calibration")
+	if !ok {
+		return
+	}
+	request := struct {
+		Value *float64 `json:"value"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err == nil && request.Value == nil {
+		err = errors.New("The known value is missing")
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid calibration point received", err))
+		return
+	}
+	point, err := calibrator.AddPoint(id, *request.Value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not add calibration point", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(point)
+}
+
+func commitCalibration(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "calibration")
+	if !ok {
+		return
+	}
+	rg, err := calibrator.Commit(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not commit calibration", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(rg)
+}
+
+func cancelCalibration(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "calibration")
+	if !ok {
+		return
+	}
+	if err := calibrator.Cancel(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not cancel calibration", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func getTares(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	sensorAddress, err := strconv.Atoi(p.ByName("sensor"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		return
+	}
+	sensor, err := configProvider.GetSensorByAddress(p.ByName("bus"), uint8(sensorAddress))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get sensor", err))
+		return
+	}
+	tares := sensor.Tares
+	if tares == nil {
+		tares = []common.Tare{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(tares)
+}
+
+//getTareFromRequest returns the address of the sensor from the url and
+//the tare from the body. On error the response is written and ok is false
+func getTareFromRequest(w http.ResponseWriter, r *http.Request, p httprouter.Params) (address uint8, tare common.Tare, ok bool) {
+	sensorAddress, err := strconv.Atoi(p.ByName("sensor"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		return 0, tare, false
+	}
+	if err = json.NewDecoder(r.Body).Decode(&tare); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid tare received", err))
+		return 0, tare, false
+	}
+	return uint8(sensorAddress), tare, true
+}
+
+//addTare sets the tare of a read group of the sensor. The body holds the
+//start location of the read group and the tare value. The time since
+//the tare is used is optional and defaults to now
+func addTare(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	address, tare, ok := getTareFromRequest(w, r, p)
+	if !ok {
+		return
+	}
+	newTare, err := tarer.SetTare(p.ByName("bus"), address, tare)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not set tare", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newTare)
+}
+
+//tareNow reads a read group of the sensor and uses the value as the tare
+//from now on. The body holds the start location of the read group
+//and an optional description
+func tareNow(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	address, tare, ok := getTareFromRequest(w, r, p)
+	if !ok {
+		return
+	}
+	log.Printf("Taring read group %d on bus %s, sensor %d\n", tare.StartLocation, p.ByName("bus"), address)
+	newTare, err := tarer.TareNow(p.ByName("bus"), address, tare.StartLocation, tare.Description)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not tare sensor", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newTare)
+}
+
+func getProducts(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(stockInventory.GetProducts())
+}
+
+func getProduct(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	product, err := stockInventory.GetProduct(p.ByName("sku"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get product", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(product)
+}
+
+func getProductFromBody(r *http.Request) (*common.Product, error) {
+	product := common.Product{}
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func addProduct(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	product, err := getProductFromBody(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid product received", err))
+		return
+	}
+	if err = stockInventory.AddProduct(*product); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not add product", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	returnSuccess(w)
+}
+
+func changeProduct(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	product, err := getProductFromBody(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid product received", err))
+		return
+	}
+	if err = stockInventory.ChangeProduct(p.ByName("sku"), *product); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not change product", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func deleteProduct(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	if err := stockInventory.RemoveProduct(p.ByName("sku")); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not delete product", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func getStocks(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(stockInventory.GetStocks())
+}
+
+func getStock(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	stock, err := stockInventory.GetStock(p.ByName("sku"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get stock", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(stock)
+}
+
+func getAlarmRules(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(alarmEngine.GetRules())
+}
+
+//getIDFromURL returns the integer id found in the url parameter name.
+//On error the response is written and ok is false
+func getIDFromURL(w http.ResponseWriter, p httprouter.Params, name string) (int, bool) {
+	id, err := strconv.Atoi(p.ByName(name))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid "+name+" id", err))
+		return 0, false
+	}
+	return id, true
+}
+
+func getAlarmRule(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "rule")
+	if !ok {
+		return
+	}
+	rule, err := alarmEngine.GetRule(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get alarm rule", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(rule)
+}
+
+func addAlarmRule(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	rule := common.AlarmRule{}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid alarm rule received", err))
+		return
+	}
+	newRule, err := alarmEngine.AddRule(rule)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not add alarm rule", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newRule)
+}
+
+func changeAlarmRule(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "rule")
+	if !ok {
+		return
+	}
+	rule := common.AlarmRule{}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid alarm rule received", err))
+		return
+	}
+	if err := alarmEngine.ChangeRule(id, rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not change alarm rule", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func deleteAlarmRule(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "rule")
+	if !ok {
+		return
+	}
+	if err := alarmEngine.RemoveRule(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not delete alarm rule", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+//getAlarms returns the alarm history. The optional query parameter
+//state filters the alarms: raised, acknowledged, cleared or active
+func getAlarms(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(alarmEngine.GetAlarms(r.URL.Query().Get("state")))
+}
+
+func getAlarm(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "alarm")
+	if !ok {
+		return
+	}
+	alarm, err := alarmEngine.GetAlarm(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get alarm", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(alarm)
+}
+
+func acknowledgeAlarm(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "alarm")
+	if !ok {
+		return
+	}
+	alarm, err := alarmEngine.Acknowledge(id)
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not acknowledge alarm", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(alarm)
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(webhookNotifier.GetWebhooks())
+}
+
+func getWebhook(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "webhook")
+	if !ok {
+		return
+	}
+	webhook, err := webhookNotifier.GetWebhook(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get webhook", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(webhook)
+}
+
+func addWebhook(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	webhook := notifications.Webhook{}
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid webhook received", err))
+		return
+	}
+	newWebhook, err := webhookNotifier.AddWebhook(webhook)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not add webhook", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newWebhook)
+}
+
+func changeWebhook(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "webhook")
+	if !ok {
+		return
+	}
+	webhook := notifications.Webhook{}
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid webhook received", err))
+		return
+	}
+	if err := webhookNotifier.ChangeWebhook(id, webhook); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not change webhook", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "webhook")
+	if !ok {
+		return
+	}
+	if err := webhookNotifier.RemoveWebhook(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not delete webhook", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func getDeadLetters(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "webhook")
+	if !ok {
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(webhookNotifier.GetDeadLetters(id))
+}
+
+func getEmailConfig(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	config, err := emailNotifier.GetConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get email configuration", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(config)
+}
+
+func setEmailConfig(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	config := notifications.EmailConfig{}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid email configuration received", err))
+		return
+	}
+	if err := emailNotifier.SetConfig(config); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not set email configuration", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func getEmailSubscriptions(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(emailNotifier.GetSubscriptions())
+}
+
+func addEmailSubscription(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	subscription := notifications.Subscription{}
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid subscription received", err))
+		return
+	}
+	newSubscription, err := emailNotifier.Subscribe(subscription)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not add subscription", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newSubscription)
+}
+
+func deleteEmailSubscription(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "subscription")
+	if !ok {
+		return
+	}
+	if err := emailNotifier.Unsubscribe(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not delete subscription", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func getSuppliers(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(orderManager.GetSuppliers())
+}
+
+func getSupplier(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "supplier")
+	if !ok {
+		return
+	}
+	supplier, err := orderManager.GetSupplier(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get supplier", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(supplier)
+}
+
+func addSupplier(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	supplier := common.Supplier{}
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid supplier received", err))
+		return
+	}
+	newSupplier, err := orderManager.AddSupplier(supplier)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not add supplier", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newSupplier)
+}
+
+func changeSupplier(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "supplier")
+	if !ok {
+		return
+	}
+	supplier := common.Supplier{}
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid supplier received", err))
+		return
+	}
+	if err := orderManager.ChangeSupplier(id, supplier); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not change supplier", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func deleteSupplier(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "supplier")
+	if !ok {
+		return
+	}
+	if err := orderManager.RemoveSupplier(id); err != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not delete supplier", err))
+		return
+	}
+	returnSuccess(w)
+}
+
+func getOrders(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(orderManager.GetOrders(r.URL.Query().Get("state")))
+}
+
+func getOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "order")
+	if !ok {
+		return
+	}
+	order, err := orderManager.GetOrder(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get purchase order", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(order)
+}
+
+func addOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	order := common.PurchaseOrder{}
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid purchase order received", err))
+		return
+	}
+	newOrder, err := orderManager.AddOrder(order.SupplierID, order.SKU, order.Quantity)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not add purchase order", err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(newOrder)
+}
+
+//changeOrder calls change with the id of the order in the url
+//and returns the order changed
+func changeOrder(w http.ResponseWriter, p httprouter.Params, action string,
+	change func(id int) (*common.PurchaseOrder, error)) {
+	w.Header().Add("Content-Type", "application/json")
+	id, ok := getIDFromURL(w, p, "order")
+	if !ok {
+		return
+	}
+	order, err := change(id)
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errorToJSONByteArray("could not "+action+" purchase order", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(order)
+}
+
+func approveOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	changeOrder(w, p, "approve", orderManager.Approve)
+}
+
+func sendOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	changeOrder(w, p, "send", orderManager.Send)
+}
+
+func cancelOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	changeOrder(w, p, "cancel", orderManager.Cancel)
+}
+
+//receiveOrder receives the quantity in the body, or all
+//the units still expected if there is no body
+func receiveOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	received := struct {
+		Quantity int `json:"quantity"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errorToJSONByteArray("no valid quantity received", err))
+			return
+		}
+	}
+	changeOrder(w, p, "receive", func(id int) (*common.PurchaseOrder, error) {
+		return orderManager.Receive(id, received.Quantity)
+	})
+}
+
+func getExpectedStock(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	expected, err := orderManager.ExpectedStock(p.ByName("sku"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get expected stock", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(expected)
+}
+
+func getForecasts(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	forecasts, err := forecaster.GetForecasts(r.URL.Query().Get("method"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not get forecasts", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(forecasts)
+}
+
+func getForecast(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	method := r.URL.Query().Get("method")
+	if err := forecast.IsMethodValid(method); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not get forecast", err))
+		return
+	}
+	result, err := forecaster.GetForecast(p.ByName("sku"), method)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get forecast", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(result)
+}
+
+func getMovements(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.Encode(movementDetector.GetMovements("", 0, "", r.URL.Query().Get("type")))
+}
+
+func getSensorMovements(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	sensorAddress, err := strconv.Atoi(p.ByName("sensor"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		return
+	}
+	if _, err = configProvider.GetSensorByAddress(p.ByName("bus"), uint8(sensorAddress)); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get sensor", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(movementDetector.GetMovements(p.ByName("bus"), uint8(sensorAddress), "",
+		r.URL.Query().Get("type")))
+}
+
+func getProductMovements(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Add("Content-Type", "application/json")
+	if _, err := stockInventory.GetProduct(p.ByName("sku")); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get product", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(movementDetector.GetMovements("", 0, p.ByName("sku"), r.URL.Query().Get("type")))
+}
+
+func readSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//TODO -- see if it is not better to put everything into
+	//a scheduler that will read automatically and store it in
+	//the persistenceprovider
+	var sensorAddress int
+	var startLocation int
+	var length int
+	var err error
+	bus := p.ByName("bus")
+	sensorString := p.ByName("sensor")
+	typeString := p.ByName("type")
+	startString := p.ByName("start")
+	lengthString := p.ByName("length")
+
+	if !isTypeOk(typeString) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not read sensor", fmt.Errorf("register type %s unknown", typeString)))
+		return
+	}
+	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		return
+	}
+	if startLocation, err = strconv.Atoi(startString); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid start location", err))
+		return
+	}
+	if length, err = strconv.Atoi(lengthString); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid length", err))
+		return
+	}
+	log.Printf("Reading bus %s, sensor %d, type %s, start %d, length %d ",
+		bus, sensorAddress, typeString, startLocation, length)
+	err = scheduleProvider.Read(bus, uint8(sensorAddress), typeString, uint16(startLocation), uint16(length), true, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not read sensor", err))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(map[string]string{"Status": "OK"})
+}
+
+//getTimeFromQuery returns the time found in the query parameter
+//name or def if the parameter is missing
+func getTimeFromQuery(r *http.Request, name string, def time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseInLocation(common.TimeFormat, value, time.Local)
+}
+
+//getReadings returns the readings of the sensor between the start and end
+//query parameters (the last day by default). If the unit parameter is given,
+//the calculated values are converted to that unit when possible
+func getReadings(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var sensorAddress int
+	var err error
+	w.Header().Add("Content-Type", "application/json")
+	bus := p.ByName("bus")
+	sensorString := p.ByName("sensor")
+
+	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		return
+	}
+	end, err := getTimeFromQuery(r, "end", time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid end time", err))
+		return
+	}
+	start, err := getTimeFromQuery(r, "start", end.Add(-24*time.Hour))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid start time", err))
+		return
+	}
+	unit := r.URL.Query().Get("unit")
+	if unit != "" && !readgroups.IsUnitKnown(unit) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert readings", fmt.Errorf("unit %s unknown", unit)))
+		return
+	}
+	readings, err := persistenceProvider.GetSensorReadingsInPeriod(bus, uint8(sensorAddress), start, end)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not get readings", err))
+		return
+	}
+	if unit != "" {
+		for i := range readings {
+			if err = readgroups.ConvertReading(&readings[i], unit); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(errorToJSONByteArray("could not convert readings", err))
+				return
+			}
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.Encode(readings)
+}
+
+//writeSensor writes the values from the body in the holding registers or
+//the coils of the sensor. Only the configured registers can be written
+func writeSensor(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var sensorAddress int
+	var err error
+	var write common.Write
+	w.Header().Add("Content-Type", "application/json")
+	bus := p.ByName("bus")
+	sensorString := p.ByName("sensor")
+
+	if sensorAddress, err = strconv.Atoi(sensorString); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not convert to valid sensor address", err))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err = decoder.Decode(&write); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("no valid write received", err))
+		return
+	}
+	write.Bus = bus
+	write.Sensor = uint8(sensorAddress)
+	sensor, err := configProvider.GetSensorByAddress(bus, write.Sensor)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errorToJSONByteArray("could not get sensor", err))
+		return
+	}
+	if err = sensor.CanWrite(write.Type, write.StartLocation, uint16(len(write.Values))); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorToJSONByteArray("could not write sensor", err))
+		return
+	}
+	log.Printf("Writing bus %s, sensor %d, type %s, start %d, values %v",
+		bus, sensorAddress, write.Type, write.StartLocation, write.Values)
+	if err = scheduleProvider.Write(write); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errorToJSONByteArray("could not write sensor", err))
+		return
+	}
+	returnSuccess(w)
 }
 
 func main() {
 	initialize()
 	mux := httprouter.New()
 	mux.ServeFiles("/static/*filepath", http.Dir("static"))
-	mux.GET("/sensors/:sensor", getSensor)
+	mux.GET("/sensors/:bus/:sensor", getSensor)
 	mux.POST("/sensors", addSensor)
-	mux.DELETE("/sensors/:sensor", deleteSensor)
-	mux.PUT("/sensors/:sensor", changeSensor)
+	mux.DELETE("/sensors/:bus/:sensor", deleteSensor)
+	mux.PUT("/sensors/:bus/:sensor", changeSensor)
 	mux.GET("/sensors", getSensors)
+	mux.GET("/buses", getBuses)
+	mux.GET("/buses/:bus", getBus)
+	mux.POST("/buses", addBus)
+	mux.PUT("/buses/:bus", changeBus)
+	mux.DELETE("/buses/:bus", deleteBus)
+	mux.GET("/sensors/:bus/:sensor/tares", getTares)
+	mux.POST("/sensors/:bus/:sensor/tares", addTare)
+	mux.POST("/sensors/:bus/:sensor/tares/now", tareNow)
+	mux.GET("/sensors/:bus/:sensor/movements", getSensorMovements)
+	mux.POST("/buses/:bus/commission", commissionSensor)
+	mux.GET("/products", getProducts)
+	mux.GET("/products/:sku", getProduct)
+	mux.POST("/products", addProduct)
+	mux.PUT("/products/:sku", changeProduct)
+	mux.DELETE("/products/:sku", deleteProduct)
+	mux.GET("/products/:sku/movements", getProductMovements)
+	mux.GET("/movements", getMovements)
+	mux.GET("/stock", getStocks)
+	mux.GET("/stock/:sku", getStock)
+	mux.GET("/stock/:sku/expected", getExpectedStock)
+	mux.GET("/forecasts", getForecasts)
+	mux.GET("/forecasts/:sku", getForecast)
+	mux.GET("/alarmrules", getAlarmRules)
+	mux.GET("/alarmrules/:rule", getAlarmRule)
+	mux.POST("/alarmrules", addAlarmRule)
+	mux.PUT("/alarmrules/:rule", changeAlarmRule)
+	mux.DELETE("/alarmrules/:rule", deleteAlarmRule)
+	mux.GET("/alarms", getAlarms)
+	mux.GET("/alarms/:alarm", getAlarm)
+	mux.PUT("/alarms/:alarm/acknowledge", acknowledgeAlarm)
+	mux.GET("/webhooks", getWebhooks)
+	mux.GET("/webhooks/:webhook", getWebhook)
+	mux.POST("/webhooks", addWebhook)
+	mux.PUT("/webhooks/:webhook", changeWebhook)
+	mux.DELETE("/webhooks/:webhook", deleteWebhook)
+	mux.GET("/webhooks/:webhook/deadletters", getDeadLetters)
+	mux.GET("/email/config", getEmailConfig)
+	mux.PUT("/email/config", setEmailConfig)
+	mux.GET("/email/subscriptions", getEmailSubscriptions)
+	mux.POST("/email/subscriptions", addEmailSubscription)
+	mux.DELETE("/email/subscriptions/:subscription", deleteEmailSubscription)
+	mux.GET("/suppliers", getSuppliers)
+	mux.GET("/suppliers/:supplier", getSupplier)
+	mux.POST("/suppliers", addSupplier)
+	mux.PUT("/suppliers/:supplier", changeSupplier)
+	mux.DELETE("/suppliers/:supplier", deleteSupplier)
+	mux.GET("/orders", getOrders)
+	mux.GET("/orders/:order", getOrder)
+	mux.POST("/orders", addOrder)
+	mux.PUT("/orders/:order/approve", approveOrder)
+	mux.PUT("/orders/:order/send", sendOrder)
+	mux.PUT("/orders/:order/receive", receiveOrder)
+	mux.PUT("/orders/:order/cancel", cancelOrder)
+	mux.POST("/calibrations", startCalibration)
+	mux.GET("/calibrations/:calibration", getCalibration)
+	mux.POST("/calibrations/:calibration/points", addCalibrationPoint)
+	mux.PUT("/calibrations/:calibration/commit", commitCalibration)
+	mux.DELETE("/calibrations/:calibration", cancelCalibration)
 	mux.POST("/schedule/timers", addTimer)
 	mux.DELETE("/schedule/timers/:timer", deleteTimer)
+	mux.PUT("/schedule/timers/:timer", changeTimer)
+	mux.PUT("/schedule/timers/:timer/pause", pauseTimer)
+	mux.PUT("/schedule/timers/:timer/resume", resumeTimer)
+	mux.PUT("/schedule/timers/:timer/run", runTimer)
 	mux.GET("/schedule/timers", getTimers)
+	mux.GET("/schedule/timers/:timer", getTimer)
 	mux.PUT("/schedule/save", saveSchedule)
 	mux.PUT("/schedule/load", loadSchedule)
 
-	mux.GET("/read/:sensor/:type/:start/:length", readSensor)
+	mux.GET("/read/:bus/:sensor/:type/:start/:length", readSensor)
+	mux.POST("/write/:bus/:sensor", writeSensor)
+	mux.GET("/readings/:bus/:sensor", getReadings)
 
 	server := &http.Server{
 		Addr:    "0.0.0.0:8080",
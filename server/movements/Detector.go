@@ -0,0 +1,269 @@
+package movements
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+//movementsItem is the name of the item holding the movements
+//in the persistence provider
+const movementsItem = "movements"
+
+//maxMovements is the number of movements kept. When there are more,
+//the oldest ones are dropped
+const maxMovements = 1000
+
+//defaultSettle is the number of readings a new value must stay stable
+//for when the read group does not set it
+const defaultSettle = 3
+
+//stream follows the value calculated by a read group. baseline is the
+//stable value and pending the readings away from it. tare is the tare
+//subtracted from the net values followed
+type stream struct {
+	baseline float64
+	started  bool
+	pending  []float64
+	tare     float64
+}
+
+//Detector looks for step changes in the values calculated by the read
+//groups and logs them as refills or removals. The read groups holding a
+//product use half of its unit weight as their minimum step if they have
+//none, the other read groups are only followed if they have a minimum step.
+//The movements are saved in the persistence provider and the event
+//listeners are told of every movement
+type Detector struct {
+	configProvider      *configprovider.ConfigProvider
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	inventory           *inventory.Inventory
+	streams             map[string]*stream
+	movements           []common.Movement
+	nextID              int
+	events              *common.EventQueue
+	mutex               *sync.Mutex
+}
+
+//NewDetector returns a Detector of the movements on the sensors of cp,
+//keeping them in pp. The products are taken from inv, which can be nil.
+//The movements already saved in pp are loaded
+func (Detector) NewDetector(cp *configprovider.ConfigProvider, pp *persistenceprovider.PersistenceProvider,
+	inv *inventory.Inventory) (*Detector, error) {
+	detector := &Detector{configProvider: cp, persistenceProvider: pp, inventory: inv,
+		streams: make(map[string]*stream), nextID: 1, events: common.EventQueue{}.NewEventQueue(),
+		mutex: &sync.Mutex{}}
+	if err := detector.load(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return detector, nil
+}
+
+//load reads the movements saved in the persistence provider
+func (detector *Detector) load() error {
+	err := persistenceprovider.ReadItemInto(*detector.persistenceProvider, movementsItem, &detector.movements)
+	if err != nil {
+		return err
+	}
+	for _, movement := range detector.movements {
+		if movement.ID >= detector.nextID {
+			detector.nextID = movement.ID + 1
+		}
+	}
+	return nil
+}
+
+//save drops the oldest movements above maxMovements and saves the movements
+func (detector *Detector) save() error {
+	if len(detector.movements) > maxMovements {
+		detector.movements = detector.movements[len(detector.movements)-maxMovements:]
+	}
+	return (*detector.persistenceProvider).SaveItem(movementsItem, detector.movements)
+}
+
+//AddEventListener adds listener to the listeners told of every movement
+func (detector *Detector) AddEventListener(listener common.EventListener) {
+	detector.events.AddListener(listener)
+}
+
+//retare moves the values of s to the new tare, so that a tare
+//change is not taken for a step of the net value
+func (s *stream) retare(tare float64) {
+	if s.started && tare != s.tare {
+		s.baseline += s.tare - tare
+		for i := range s.pending {
+			s.pending[i] += s.tare - tare
+		}
+	}
+	s.tare = tare
+}
+
+//step adds value to s and returns the stable values before and after a
+//step of at least minStep. A new value is stable once settle readings
+//stay within half of minStep from each other
+func (s *stream) step(value float64, minStep float64, settle int) (before float64, after float64, ok bool) {
+	if !s.started {
+		s.baseline, s.started = value, true
+		return 0, 0, false
+	}
+	if math.Abs(value-s.baseline) < minStep {
+		//the noise and the slow changes move the baseline
+		s.baseline, s.pending = value, nil
+		return 0, 0, false
+	}
+	s.pending = append(s.pending, value)
+	if len(s.pending) > settle {
+		s.pending = s.pending[len(s.pending)-settle:]
+	}
+	if len(s.pending) < settle {
+		return 0, 0, false
+	}
+	low, high, sum := s.pending[0], s.pending[0], 0.0
+	for _, v := range s.pending {
+		low, high, sum = math.Min(low, v), math.Max(high, v), sum+v
+	}
+	if high-low >= minStep/2 {
+		return 0, 0, false
+	}
+	before, after = s.baseline, sum/float64(len(s.pending))
+	s.baseline, s.pending = after, nil
+	return before, after, math.Abs(after-before) >= minStep
+}
+
+//products returns the products held by the read group starting
+//at startLocation on the sensor of reading
+func (detector *Detector) products(reading common.Reading, startLocation uint16) []common.Product {
+	var products []common.Product
+	if detector.inventory == nil {
+		return products
+	}
+	for _, product := range detector.inventory.GetProducts() {
+		if product.Bus == reading.Bus && product.Sensor == reading.Sensor && product.StartLocation == startLocation {
+			products = append(products, product)
+		}
+	}
+	return products
+}
+
+//add logs the movement of the value having key in reading from before to
+//after. There is one movement for every product held by the read group
+func (detector *Detector) add(reading common.Reading, key string, before float64, after float64,
+	products []common.Product) {
+	movement := common.Movement{Type: common.Refill, Bus: reading.Bus, Sensor: reading.Sensor,
+		Key: key, Delta: after - before, Before: before, After: after,
+		Unit: reading.Units[key], Time: reading.Time}
+	eventType := common.RefillEvent
+	if movement.Delta < 0 {
+		movement.Type, eventType = common.Removal, common.RemovalEvent
+	}
+	if len(products) == 0 {
+		products = []common.Product{common.Product{}}
+	}
+	for _, product := range products {
+		movement.ID = detector.nextID
+		detector.nextID++
+		movement.SKU = product.SKU
+		movement.Quantity = 0
+		if unitWeight, err := inventory.ConvertWeight(product, product.UnitWeight, movement.Unit); err == nil &&
+			unitWeight > 0 {
+			movement.Quantity = int(math.Floor(math.Abs(movement.Delta)/unitWeight + 0.5))
+		}
+		detector.movements = append(detector.movements, movement)
+		movementCopy := movement
+		detector.events.Emit(common.Event{Type: eventType, Time: reading.Time,
+			Movement: &movementCopy})
+		log.Printf("Movement %d: %s of %v %s on sensor %d, bus %s, key %s\n", movement.ID,
+			movement.Type, math.Abs(movement.Delta), movement.Unit, movement.Sensor, movement.Bus, key)
+	}
+}
+
+//Update looks for step changes in the values calculated by the read groups
+//of reading. It is meant to be called with every reading done
+func (detector *Detector) Update(reading common.Reading) {
+	reading.Bus = common.BusName(reading.Bus)
+	if detector.configProvider == nil || *detector.configProvider == nil {
+		return
+	}
+	sensor, err := (*detector.configProvider).GetSensorByAddress(reading.Bus, reading.Sensor)
+	if err != nil {
+		return
+	}
+	detector.mutex.Lock()
+	defer detector.events.Flush()
+	defer detector.mutex.Unlock()
+	changed := false
+	for _, rg := range sensor.ReadGroups {
+		key := rg.NetKey()
+		if _, ok := reading.CalculatedValues[key]; !ok {
+			key = rg.Key()
+		}
+		value, err := readgroups.CalculatedValue(&reading, key)
+		if err != nil {
+			continue
+		}
+		products := detector.products(reading, rg.StartLocation)
+		minStep := rg.MinStep
+		for _, product := range products {
+			unitWeight, err := inventory.ConvertWeight(product, product.UnitWeight, reading.Units[key])
+			if err != nil {
+				continue
+			}
+			if rg.MinStep == 0 && (minStep == 0 || unitWeight/2 < minStep) {
+				minStep = unitWeight / 2
+			}
+		}
+		if minStep <= 0 {
+			continue
+		}
+		settle := rg.Settle
+		if settle < 1 {
+			settle = defaultSettle
+		}
+		streamKey := common.SensorKey(reading.Bus, reading.Sensor) + ":" + key
+		s, ok := detector.streams[streamKey]
+		if !ok {
+			s = &stream{}
+			detector.streams[streamKey] = s
+		}
+		if key == rg.NetKey() {
+			tare := 0.0
+			if t := readgroups.TareAt(*sensor, rg.StartLocation, reading.Time); t != nil {
+				tare = t.Value
+			}
+			s.retare(tare)
+		}
+		if before, after, found := s.step(value, minStep, settle); found {
+			detector.add(reading, key, before, after, products)
+			changed = true
+		}
+	}
+	if changed {
+		if err := detector.save(); err != nil {
+			log.Printf("Error saving the movements: %s\n", err.Error())
+		}
+	}
+}
+
+//GetMovements returns the movements of the sensor having address on bus
+//(all the sensors if address is 0), of the product having sku (all if empty)
+//and of movementType (all if empty), sorted by id
+func (detector *Detector) GetMovements(bus string, address uint8, sku string, movementType string) []common.Movement {
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+	movements := []common.Movement{}
+	for _, movement := range detector.movements {
+		if (address == 0 || (movement.Bus == common.BusName(bus) && movement.Sensor == address)) &&
+			(sku == "" || movement.SKU == sku) &&
+			(movementType == "" || movement.Type == movementType) {
+			movements = append(movements, movement)
+		}
+	}
+	return movements
+}
@@ -0,0 +1,144 @@
+package movements_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/internal/fixtures"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/movements"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func newDetectorForTest(t *testing.T) (configprovider.ConfigProvider, persistenceprovider.PersistenceProvider,
+	*inventory.Inventory, *movements.Detector) {
+	cp := fixtures.Scale(t,
+		common.ReadGroup{StartLocation: 100, ResultType: common.Uint16, Unit: "g"},
+		common.ReadGroup{StartLocation: 200, ResultType: common.Uint16, Unit: "l", MinStep: 10, Settle: 2},
+		common.ReadGroup{StartLocation: 300, ResultType: common.Uint16})
+	pp := fixtures.PersistenceProvider(t)
+	toner := fixtures.Toner("38A", 0)
+	toner.UnitWeight, toner.Unit = 1, "kg"
+	inv := fixtures.Inventory(t, &cp, &pp, toner)
+	detector, err := movements.Detector{}.NewDetector(&cp, &pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when creating the detector, got %s", err.Error())
+	}
+	return cp, pp, inv, detector
+}
+
+func newReadingForTest(minute int, weight float64, volume float64) common.Reading {
+	reading := common.Reading{Sensor: 3, Type: common.Input, StartLocation: 100, Count: 1,
+		Time: time.Date(2016, 4, 3, 12, minute, 0, 0, time.UTC).Format(common.TimeFormat)}
+	reading.InitCalculatedValues()
+	reading.CalculatedValues["100"] = weight
+	reading.CalculatedValues["200"] = volume
+	reading.CalculatedValues["300"] = volume * 1000
+	reading.Units = map[string]string{"100": "g", "200": "l"}
+	return reading
+}
+
+func TestMovementsShouldBeDetected(t *testing.T) {
+	cp, pp, inv, detector := newDetectorForTest(t)
+	var events []common.Event
+	detector.AddEventListener(func(event common.Event) {
+		events = append(events, event)
+	})
+
+	readings := []struct {
+		weight float64
+		volume float64
+	}{
+		{5000, 100}, {5010, 101}, {4990, 99},
+		//a single spike is noise
+		{9000, 100}, {5000, 100},
+		//toner added, the first readings are still moving
+		{7000, 130}, {8010, 130}, {8000, 131}, {7990, 131},
+		{8000, 130},
+		//two units taken
+		{6000, 130}, {6010, 130}, {6000, 130},
+	}
+	for minute, r := range readings {
+		detector.Update(newReadingForTest(minute, r.weight, r.volume))
+	}
+
+	toner := detector.GetMovements("", 0, "38A", "")
+	if len(toner) != 2 {
+		t.Fatalf("Expected two movements of 38A, got %v", toner)
+	}
+	if toner[0].Type != common.Refill || toner[0].Quantity != 3 || toner[0].Before != 5000 ||
+		toner[0].After != 8000 || toner[0].Unit != "g" || toner[0].Time != newReadingForTest(8, 0, 0).Time {
+		t.Fatalf("Expected a refill of 3 units from 5000 to 8000 g at minute 8, got %v", toner[0])
+	}
+	if toner[1].Type != common.Removal || toner[1].Quantity != 2 || math.Abs(toner[1].Delta+1996.67) > 0.01 {
+		t.Fatalf("Expected a removal of 2 units, got %v", toner[1])
+	}
+
+	volume := detector.GetMovements("", 3, "", common.Refill)
+	//the volume settles after 2 readings, before the toner
+	if len(volume) != 2 || volume[0].Key != "200" || volume[0].SKU != "" || volume[0].Quantity != 0 ||
+		volume[0].Before != 100 || volume[0].After != 130 || volume[1].SKU != "38A" {
+		t.Fatalf("Expected a refill of 30 l and the toner refill, got %v", volume)
+	}
+	if len(detector.GetMovements("line1", 3, "", "")) != 0 {
+		t.Fatal("Expected no movements on bus line1")
+	}
+	if len(events) != 3 || events[0].Type != common.RefillEvent || events[2].Type != common.RemovalEvent ||
+		events[2].Movement.SKU != "38A" {
+		t.Fatalf("Expected the events of the movements, got %v", events)
+	}
+
+	loaded, err := movements.Detector{}.NewDetector(&cp, &pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when loading the detector, got %s", err.Error())
+	}
+	if len(loaded.GetMovements("", 0, "", "")) != 3 {
+		t.Fatalf("Expected the movements to be loaded, got %v", loaded.GetMovements("", 0, "", ""))
+	}
+}
+
+func TestTareChangeIsNoMovement(t *testing.T) {
+	cp, _, _, detector := newDetectorForTest(t)
+	sensor, _ := cp.GetSensorByAddress(common.DefaultBus, 3)
+	for _, tare := range []common.Tare{
+		common.Tare{StartLocation: 100, Value: 1000, Since: newReadingForTest(0, 0, 0).Time},
+		common.Tare{StartLocation: 100, Value: 3000, Since: newReadingForTest(5, 0, 0).Time}} {
+		if err := readgroups.AddTare(sensor, tare); err != nil {
+			t.Fatalf("No error expected when adding a tare, got %s", err.Error())
+		}
+	}
+	if err := cp.ChangeSensor(common.DefaultBus, 3, *sensor); err != nil {
+		t.Fatalf("No error expected when changing the sensor, got %s", err.Error())
+	}
+
+	//the gross weight stays the same while the tare changes at minute 5
+	for minute, gross := range []float64{6000, 6000, 6000, 6000, 6000, 6000, 6000, 6000, 6000, 8000, 8000, 8000} {
+		reading := newReadingForTest(minute, gross, 100)
+		tare := 1000.0
+		if minute >= 5 {
+			tare = 3000
+		}
+		reading.CalculatedValues["100.net"] = gross - tare
+		reading.Units["100.net"] = "g"
+		detector.Update(reading)
+	}
+	toner := detector.GetMovements("", 0, "38A", "")
+	if len(toner) != 1 || toner[0].Key != "100.net" || toner[0].Type != common.Refill ||
+		toner[0].Before != 3000 || toner[0].After != 5000 {
+		t.Fatalf("Expected only the refill after the tare change, got %v", toner)
+	}
+}
+
+func TestMovementSettingsShouldFail(t *testing.T) {
+	for _, rg := range []common.ReadGroup{
+		common.ReadGroup{StartLocation: 100, ResultType: common.Uint16, MinStep: -1},
+		common.ReadGroup{StartLocation: 100, ResultType: common.Uint16, Settle: -1}} {
+		if err := readgroups.ValidateReadGroups(common.Sensor{ReadGroups: []common.ReadGroup{rg}}); err == nil {
+			t.Fatalf("Expected error when validating %v, got nil", rg)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+//names of the items holding the email configuration and the
+//subscriptions in the persistence provider
+const (
+	emailConfigItem   = "emailConfig"
+	subscriptionsItem = "emailSubscriptions"
+)
+
+//the templates used when the email configuration has none
+const (
+	defaultSubject = `{{if .Stock.Low}}Low stock{{else}}Stock{{end}}: {{.Product.Name}} ({{.SKU}})`
+	defaultBody    = `{{.Product.Name}} ({{.SKU}}): {{.Stock.Count}} units in stock, minimum {{.Product.MinStock}}.
+Trend: {{.Trend}} ({{.Change}} units since the previous reading).
+{{if .Event.Alarm}}Alarm {{.Event.Alarm.Name}} is {{.Event.Alarm.State}}, value {{.Event.Alarm.Value}}.
+{{end}}Time: {{.Event.Time}}
+`
+)
+
+//trends of the stock
+const (
+	TrendDown   = "down"
+	TrendUp     = "up"
+	TrendSteady = "steady"
+)
+
+//EmailConfig is the SMTP server the emails are sent through. With StartTLS
+//the connection is upgraded to TLS before authenticating. Username and
+//Password are used for PLAIN authentication if set. Subject and Body are
+//text/template templates executed with the EmailData
+type EmailConfig struct {
+	Host               string `json:"host"`
+	Port               int    `json:"port"`
+	Username           string `json:"username,omitempty"`
+	Password           string `json:"password,omitempty"`
+	From               string `json:"from"`
+	StartTLS           bool   `json:"startTLS,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	Subject            string `json:"subject,omitempty"`
+	Body               string `json:"body,omitempty"`
+}
+
+//Subscription sends to Email the events having one of the Events types
+//(stock.low if empty) about the products having one of the SKUs
+//(all the products if empty)
+type Subscription struct {
+	ID     int      `json:"id"`
+	Email  string   `json:"email"`
+	SKUs   []string `json:"skus,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+//EmailData is the data the subject and the body templates are executed with.
+//Change is the change of the units in stock since the previous reading
+//and Trend tells if the stock goes down, up or stays steady
+type EmailData struct {
+	Event    common.Event
+	SKU      string
+	Product  common.Product
+	Stock    common.Stock
+	Previous common.Stock
+	Change   int
+	Trend    string
+}
+
+//bySubscriptionID sorts the subscriptions by their id
+type bySubscriptionID []Subscription
+
+func (subs bySubscriptionID) Len() int           { return len(subs) }
+func (subs bySubscriptionID) Swap(i, j int)      { subs[i], subs[j] = subs[j], subs[i] }
+func (subs bySubscriptionID) Less(i, j int) bool { return subs[i].ID < subs[j].ID }
+
+//EmailNotifier sends emails about the products to the subscribed recipients.
+//The emails are sent in the background, Wait waits for them. The
+//configuration and the subscriptions are saved in the persistence provider
+type EmailNotifier struct {
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	inventory           *inventory.Inventory
+	config              *EmailConfig
+	subscriptions       map[int]Subscription
+	nextID              int
+	mutex               *sync.Mutex
+	pending             *sync.WaitGroup
+}
+
+//NewEmailNotifier returns an EmailNotifier keeping its configuration in pp
+//and taking the products from inv. The configuration and the subscriptions
+//already saved in pp are loaded
+func (EmailNotifier) NewEmailNotifier(pp *persistenceprovider.PersistenceProvider, inv *inventory.Inventory) (*EmailNotifier, error) {
+	notifier := &EmailNotifier{persistenceProvider: pp, inventory: inv,
+		subscriptions: make(map[int]Subscription), nextID: 1,
+		mutex: &sync.Mutex{}, pending: &sync.WaitGroup{}}
+	var config EmailConfig
+	if err := persistenceprovider.ReadItemInto(*pp, emailConfigItem, &config); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	if config.Host != "" {
+		notifier.config = &config
+	}
+	var subscriptions []Subscription
+	if err := persistenceprovider.ReadItemInto(*pp, subscriptionsItem, &subscriptions); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	for _, subscription := range subscriptions {
+		notifier.subscriptions[subscription.ID] = subscription
+		if subscription.ID >= notifier.nextID {
+			notifier.nextID = subscription.ID + 1
+		}
+	}
+	return notifier, nil
+}
+
+//IsEmailConfigValid checks that config has a server, a sender
+//and templates that can be parsed
+func IsEmailConfigValid(config EmailConfig) error {
+	if config.Host == "" || config.Port <= 0 {
+		return errors.New("The email configuration must have the host and the port of the SMTP server")
+	}
+	if config.From == "" {
+		return errors.New("The email configuration must have a sender")
+	}
+	if _, err := template.New("subject").Parse(config.Subject); err != nil {
+		return fmt.Errorf("Invalid subject template: %s", err.Error())
+	}
+	if _, err := template.New("body").Parse(config.Body); err != nil {
+		return fmt.Errorf("Invalid body template: %s", err.Error())
+	}
+	return nil
+}
+
+//SetConfig sets the SMTP server the emails are sent through.
+//The password is kept if config has none
+func (notifier *EmailNotifier) SetConfig(config EmailConfig) error {
+	if err := IsEmailConfigValid(config); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if config.Password == "" && notifier.config != nil && notifier.config.Username == config.Username {
+		config.Password = notifier.config.Password
+	}
+	notifier.config = &config
+	return (*notifier.persistenceProvider).SaveItem(emailConfigItem, config)
+}
+
+//GetConfig returns the email configuration, without the password
+func (notifier *EmailNotifier) GetConfig() (*EmailConfig, error) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if notifier.config == nil {
+		return nil, errors.New("The email notifications are not configured")
+	}
+	config := *notifier.config
+	config.Password = ""
+	return &config, nil
+}
+
+//Subscribe adds subscription and returns it with its new id
+func (notifier *EmailNotifier) Subscribe(subscription Subscription) (*Subscription, error) {
+	if !strings.Contains(subscription.Email, "@") {
+		err := fmt.Errorf("Invalid email address %s", subscription.Email)
+		log.Println(err.Error())
+		return nil, err
+	}
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	subscription.ID = notifier.nextID
+	notifier.nextID++
+	notifier.subscriptions[subscription.ID] = subscription
+	return &subscription, notifier.saveSubscriptions()
+}
+
+//Unsubscribe removes the subscription having id
+func (notifier *EmailNotifier) Unsubscribe(id int) error {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if _, ok := notifier.subscriptions[id]; !ok {
+		return fmt.Errorf("No subscription with id %d", id)
+	}
+	delete(notifier.subscriptions, id)
+	return notifier.saveSubscriptions()
+}
+
+//GetSubscriptions returns the subscriptions sorted by id
+func (notifier *EmailNotifier) GetSubscriptions() []Subscription {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	return notifier.sortedSubscriptions()
+}
+
+func (notifier *EmailNotifier) sortedSubscriptions() []Subscription {
+	subscriptions := make([]Subscription, 0, len(notifier.subscriptions))
+	for _, subscription := range notifier.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Sort(bySubscriptionID(subscriptions))
+	return subscriptions
+}
+
+func (notifier *EmailNotifier) saveSubscriptions() error {
+	return (*notifier.persistenceProvider).SaveItem(subscriptionsItem, notifier.sortedSubscriptions())
+}
+
+//wants returns true if subscription is sent the events of eventType about sku
+func (subscription Subscription) wants(eventType string, sku string) bool {
+	wanted := false
+	if len(subscription.Events) == 0 {
+		wanted = eventType == common.StockLowEvent
+	}
+	for _, event := range subscription.Events {
+		wanted = wanted || event == eventType
+	}
+	if !wanted || len(subscription.SKUs) == 0 {
+		return wanted
+	}
+	for _, subscribed := range subscription.SKUs {
+		if subscribed == sku {
+			return true
+		}
+	}
+	return false
+}
+
+//emailData returns the data of the templates for event
+func (notifier *EmailNotifier) emailData(event common.Event) EmailData {
+	data := EmailData{Event: event, Trend: TrendSteady}
+	if event.Stock != nil {
+		data.SKU = event.Stock.SKU
+		data.Stock = *event.Stock
+	}
+	if event.Alarm != nil {
+		data.SKU = event.Alarm.SKU
+	}
+	if event.Previous != nil {
+		data.Previous = *event.Previous
+		data.Change = data.Stock.Count - data.Previous.Count
+	}
+	if data.Change < 0 {
+		data.Trend = TrendDown
+	} else if data.Change > 0 {
+		data.Trend = TrendUp
+	}
+	if notifier.inventory != nil && data.SKU != "" {
+		if product, err := notifier.inventory.GetProduct(data.SKU); err == nil {
+			data.Product = *product
+		}
+		if event.Stock == nil {
+			if stock, err := notifier.inventory.GetStock(data.SKU); err == nil {
+				data.Stock = *stock
+			}
+		}
+	}
+	return data
+}
+
+//Notify emails event to the subscribed recipients. Only the events
+//about products are sent. The emails are sent in the background
+func (notifier *EmailNotifier) Notify(event common.Event) {
+	data := notifier.emailData(event)
+	if data.SKU == "" {
+		return
+	}
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if notifier.config == nil {
+		return
+	}
+	var recipients []string
+	for _, subscription := range notifier.sortedSubscriptions() {
+		if subscription.wants(event.Type, data.SKU) {
+			recipients = append(recipients, subscription.Email)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	config := *notifier.config
+	notifier.pending.Add(1)
+	go func() {
+		defer notifier.pending.Done()
+		for _, recipient := range recipients {
+			if err := sendEmail(config, recipient, data); err != nil {
+				log.Printf("Error emailing %s to %s: %s\n", event.Type, recipient, err.Error())
+			}
+		}
+	}()
+}
+
+//Wait waits for the emails in progress to be sent
+func (notifier *EmailNotifier) Wait() {
+	notifier.pending.Wait()
+}
+
+//executeEmail executes the template text, or defaultText if empty, with data
+func executeEmail(name string, text string, defaultText string, data EmailData) (string, error) {
+	if text == "" {
+		text = defaultText
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err = tmpl.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+//sendEmail sends the email about data to recipient through the SMTP server of config
+func sendEmail(config EmailConfig, recipient string, data EmailData) error {
+	subject, err := executeEmail("subject", config.Subject, defaultSubject, data)
+	if err != nil {
+		return err
+	}
+	body, err := executeEmail("body", config.Body, defaultBody, data)
+	if err != nil {
+		return err
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", recipient)
+	fmt.Fprintf(&message, "Subject: %s\r\n", strings.Replace(subject, "\n", " ", -1))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	client, err := smtp.Dial(net.JoinHostPort(config.Host, strconv.Itoa(config.Port)))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if config.StartTLS {
+		err = client.StartTLS(&tls.Config{ServerName: config.Host, InsecureSkipVerify: config.InsecureSkipVerify})
+		if err != nil {
+			return err
+		}
+	}
+	if config.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(config.From); err != nil {
+		return err
+	}
+	if err = client.Rcpt(recipient); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message.Bytes()); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,127 @@
+package notifications_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/internal/fixtures"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/notifications"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+func newEmailNotifierForTest(t *testing.T) (persistenceprovider.PersistenceProvider, *inventory.Inventory, *notifications.EmailNotifier) {
+	cp := fixtures.Scale(t)
+	pp := fixtures.PersistenceProvider(t)
+	inv := fixtures.Inventory(t, &cp, &pp, fixtures.Toner("38A", 3), fixtures.Toner("12A", 3))
+	notifier, err := notifications.EmailNotifier{}.NewEmailNotifier(&pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when creating the email notifier, got %s", err.Error())
+	}
+	return pp, inv, notifier
+}
+
+func newStockEventForTest(sku string, previous int, count int) common.Event {
+	return common.Event{Type: common.StockLowEvent, Time: "2016-04-03T12:10:50",
+		Stock:    &common.Stock{SKU: sku, Count: count, MinStock: 3, Low: count < 3},
+		Previous: &common.Stock{SKU: sku, Count: previous, MinStock: 3, Low: previous < 3}}
+}
+
+func TestEmailShouldOk(t *testing.T) {
+	server := newTestSMTPServer(t)
+	defer server.Close()
+	pp, inv, notifier := newEmailNotifierForTest(t)
+
+	err := notifier.SetConfig(notifications.EmailConfig{Host: server.Host(), Port: server.Port(),
+		From: "inventory@example.com", StartTLS: true, InsecureSkipVerify: true,
+		Username: "inventory", Password: "secret"})
+	if err != nil {
+		t.Fatalf("No error expected when configuring the emails, got %s", err.Error())
+	}
+	notifier.Subscribe(notifications.Subscription{Email: "it@example.com", SKUs: []string{"38A"}})
+	notifier.Subscribe(notifications.Subscription{Email: "all@example.com"})
+	notifier.Subscribe(notifications.Subscription{Email: "changes@example.com",
+		Events: []string{common.StockChangedEvent}})
+
+	notifier.Notify(newStockEventForTest("38A", 4, 2))
+	notifier.Wait()
+	mails := server.Mails()
+	if len(mails) != 2 || mails[0].to[0] != "it@example.com" || mails[1].to[0] != "all@example.com" {
+		t.Fatalf("Expected the emails to it@ and all@, got %v", mails)
+	}
+	if !mails[0].tls || mails[0].auth != "\x00inventory\x00secret" || mails[0].from != "inventory@example.com" {
+		t.Fatalf("Expected the email to be sent over TLS with PLAIN authentication, got %v", mails[0])
+	}
+	for _, expected := range []string{"Subject: Low stock: toner 38A (38A)", "To: it@example.com",
+		"toner 38A (38A): 2 units in stock, minimum 3.", "Trend: down (-2 units"} {
+		if !strings.Contains(mails[0].data, expected) {
+			t.Fatalf("Expected the email to contain %q, got %s", expected, mails[0].data)
+		}
+	}
+
+	notifier.Notify(newStockEventForTest("12A", 4, 2))
+	notifier.Wait()
+	if mails = server.Mails(); len(mails) != 3 || mails[2].to[0] != "all@example.com" {
+		t.Fatalf("Expected only all@ to get the email about 12A, got %v", mails)
+	}
+
+	loaded, err := notifications.EmailNotifier{}.NewEmailNotifier(&pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when loading the email notifier, got %s", err.Error())
+	}
+	config, err := loaded.GetConfig()
+	if err != nil || config.Host != server.Host() || config.Password != "" {
+		t.Fatalf("Expected the configuration to be loaded without the password, got %v, %v", config, err)
+	}
+	if len(loaded.GetSubscriptions()) != 3 {
+		t.Fatalf("Expected the subscriptions to be loaded, got %v", loaded.GetSubscriptions())
+	}
+}
+
+func TestEmailTemplates(t *testing.T) {
+	server := newTestSMTPServer(t)
+	defer server.Close()
+	_, _, notifier := newEmailNotifierForTest(t)
+	notifier.SetConfig(notifications.EmailConfig{Host: server.Host(), Port: server.Port(),
+		From: "inventory@example.com", Subject: "{{.SKU}} {{.Trend}}",
+		Body: "{{.Product.Name}} was {{.Previous.Count}}, is {{.Stock.Count}}"})
+	notifier.Subscribe(notifications.Subscription{Email: "it@example.com",
+		Events: []string{common.StockChangedEvent}})
+
+	event := newStockEventForTest("38A", 1, 5)
+	event.Type = common.StockChangedEvent
+	notifier.Notify(event)
+	notifier.Wait()
+	mails := server.Mails()
+	if len(mails) != 1 || mails[0].tls || mails[0].auth != "" {
+		t.Fatalf("Expected one email without TLS and authentication, got %v", mails)
+	}
+	if !strings.Contains(mails[0].data, "Subject: 38A up\r\n") ||
+		!strings.Contains(mails[0].data, "toner 38A was 1, is 5") {
+		t.Fatalf("Expected the templated email, got %s", mails[0].data)
+	}
+}
+
+func TestEmailShouldFail(t *testing.T) {
+	_, _, notifier := newEmailNotifierForTest(t)
+	if _, err := notifier.GetConfig(); err == nil {
+		t.Fatal("Expected error when getting a missing configuration, got nil")
+	}
+	invalid := []notifications.EmailConfig{
+		notifications.EmailConfig{Port: 25, From: "a@b"},
+		notifications.EmailConfig{Host: "localhost", Port: 25},
+		notifications.EmailConfig{Host: "localhost", Port: 25, From: "a@b", Subject: "{{.SKU"},
+	}
+	for _, config := range invalid {
+		if err := notifier.SetConfig(config); err == nil {
+			t.Fatalf("Expected error when setting %v, got nil", config)
+		}
+	}
+	if _, err := notifier.Subscribe(notifications.Subscription{Email: "nobody"}); err == nil {
+		t.Fatal("Expected error when subscribing an invalid address, got nil")
+	}
+	if err := notifier.Unsubscribe(1); err == nil {
+		t.Fatal("Expected error when unsubscribing a missing subscription, got nil")
+	}
+}
@@ -0,0 +1,168 @@
+package notifications_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//mail is an email received by the test SMTP server
+type mail struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+//testSMTPServer is an in-process SMTP server stand-in listening on a local
+//TCP port. It offers STARTTLS with a self signed certificate and PLAIN
+//authentication and records the emails received
+type testSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	mutex     sync.Mutex
+	mails     []mail
+}
+
+func newTestSMTPServer(t *testing.T) *testSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not start the test SMTP server: %s", err.Error())
+	}
+	server := &testSMTPServer{listener: listener, tlsConfig: newTLSConfigForTest(t)}
+	go server.serve()
+	return server
+}
+
+//newTLSConfigForTest returns a TLS config with a self signed certificate for 127.0.0.1
+func newTLSConfigForTest(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the key: %s", err.Error())
+	}
+	template := x509.Certificate{SerialNumber: big.NewInt(1),
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create the certificate: %s", err.Error())
+	}
+	return &tls.Config{Certificates: []tls.Certificate{tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func (server *testSMTPServer) Host() string {
+	host, _, _ := net.SplitHostPort(server.listener.Addr().String())
+	return host
+}
+
+func (server *testSMTPServer) Port() int {
+	return server.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (server *testSMTPServer) Close() {
+	server.listener.Close()
+}
+
+func (server *testSMTPServer) Mails() []mail {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]mail{}, server.mails...)
+}
+
+func (server *testSMTPServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handle(conn)
+	}
+}
+
+func (server *testSMTPServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	current := mail{}
+	reply("220 test SMTP server")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			if current.tls {
+				reply("250-test\r\n250 AUTH PLAIN")
+			} else {
+				reply("250-test\r\n250-STARTTLS\r\n250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, server.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			reader = bufio.NewReader(conn)
+			current.tls = true
+		case "AUTH":
+			parts := strings.Fields(line)
+			if len(parts) == 3 {
+				credentials, _ := base64.StdEncoding.DecodeString(parts[2])
+				current.auth = string(credentials)
+			}
+			reply("235 authenticated")
+		case "MAIL":
+			current.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 ok")
+		case "RCPT":
+			current.to = append(current.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 ok")
+		case "DATA":
+			reply("354 send the data")
+			var data []string
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data = append(data, dataLine)
+			}
+			current.data = strings.Join(data, "")
+			server.mutex.Lock()
+			server.mails = append(server.mails, current)
+			server.mutex.Unlock()
+			current = mail{tls: current.tls}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
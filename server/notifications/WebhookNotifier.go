@@ -0,0 +1,436 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+//names of the items holding the webhooks and the dead letters in the persistence provider
+const (
+	webhooksItem    = "webhooks"
+	deadLettersItem = "webhookDeadLetters"
+)
+
+//defaults of the webhooks
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	maxDeadLetters = 1000
+)
+
+//SignatureHeader holds the hex HMAC-SHA256 of the body, as sha256=<hex>,
+//when the webhook has a secret
+const SignatureHeader = "X-SensInventory-Signature"
+
+//EventHeader holds the type of the event sent
+const EventHeader = "X-SensInventory-Event"
+
+//Webhook is an http request sent for the events having one of the Events
+//types (all the events if empty). URL and Body are text/template templates
+//executed with the common.Event. The body defaults to the event as json.
+//A failed request is retried Retries times, waiting Backoff before the
+//first retry and doubling the wait after each one. ClearSecret removes
+//the secret when the webhook is changed, it is not kept
+type Webhook struct {
+	ID          int               `json:"id"`
+	Name        string            `json:"name"`
+	Events      []string          `json:"events,omitempty"`
+	Method      string            `json:"method,omitempty"`
+	URL         string            `json:"url"`
+	Body        string            `json:"body,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Secret      string            `json:"secret,omitempty"`
+	ClearSecret bool              `json:"clearSecret,omitempty"`
+	Retries     *int              `json:"retries,omitempty"`
+	Backoff     *time.Duration    `json:"backoff,omitempty"`
+}
+
+//DeadLetter is a webhook request that failed after all its retries
+type DeadLetter struct {
+	WebhookID int          `json:"webhookId"`
+	Event     common.Event `json:"event"`
+	URL       string       `json:"url"`
+	Body      string       `json:"body"`
+	Attempts  int          `json:"attempts"`
+	Error     string       `json:"error"`
+	Time      string       `json:"time"`
+}
+
+//byWebhookID sorts the webhooks by their id
+type byWebhookID []Webhook
+
+func (webhooks byWebhookID) Len() int           { return len(webhooks) }
+func (webhooks byWebhookID) Swap(i, j int)      { webhooks[i], webhooks[j] = webhooks[j], webhooks[i] }
+func (webhooks byWebhookID) Less(i, j int) bool { return webhooks[i].ID < webhooks[j].ID }
+
+//templateFuncs are the functions available in the templates.
+//json writes a value as json and query escapes a value for the url
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"query": url.QueryEscape,
+}
+
+//webhookContext is the context of the requests of a webhook,
+//cancelled when the webhook is removed
+type webhookContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+//WebhookNotifier sends the events to the webhooks. The requests are sent in
+//the background, Wait waits for them. The webhooks and the dead letters are
+//saved in the persistence provider
+type WebhookNotifier struct {
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	webhooks            map[int]Webhook
+	contexts            map[int]webhookContext
+	deadLetters         []DeadLetter
+	nextID              int
+	client              *http.Client
+	mutex               *sync.Mutex
+	pending             *sync.WaitGroup
+}
+
+//NewWebhookNotifier returns a WebhookNotifier keeping its webhooks in pp.
+//The webhooks and the dead letters already saved in pp are loaded
+func (WebhookNotifier) NewWebhookNotifier(pp *persistenceprovider.PersistenceProvider) (*WebhookNotifier, error) {
+	notifier := &WebhookNotifier{persistenceProvider: pp, webhooks: make(map[int]Webhook),
+		contexts: make(map[int]webhookContext), nextID: 1, client: &http.Client{Timeout: 10 * time.Second},
+		mutex: &sync.Mutex{}, pending: &sync.WaitGroup{}}
+	var webhooks []Webhook
+	if err := persistenceprovider.ReadItemInto(*pp, webhooksItem, &webhooks); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		notifier.webhooks[webhook.ID] = webhook
+		if webhook.ID >= notifier.nextID {
+			notifier.nextID = webhook.ID + 1
+		}
+	}
+	if err := persistenceprovider.ReadItemInto(*pp, deadLettersItem, &notifier.deadLetters); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return notifier, nil
+}
+
+func (notifier *WebhookNotifier) saveWebhooks() error {
+	return (*notifier.persistenceProvider).SaveItem(webhooksItem, notifier.sortedWebhooks())
+}
+
+func (notifier *WebhookNotifier) sortedWebhooks() []Webhook {
+	webhooks := make([]Webhook, 0, len(notifier.webhooks))
+	for _, webhook := range notifier.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Sort(byWebhookID(webhooks))
+	return webhooks
+}
+
+//IsWebhookValid checks that the templates of webhook can be parsed
+//and that its method and retries are valid
+func IsWebhookValid(webhook Webhook) error {
+	if webhook.URL == "" {
+		return errors.New("The webhook must have an url")
+	}
+	if _, err := template.New("url").Funcs(templateFuncs).Parse(webhook.URL); err != nil {
+		return fmt.Errorf("Invalid url template: %s", err.Error())
+	}
+	if _, err := template.New("body").Funcs(templateFuncs).Parse(webhook.Body); err != nil {
+		return fmt.Errorf("Invalid body template: %s", err.Error())
+	}
+	switch webhook.Method {
+	case "", "GET", "POST", "PUT":
+	default:
+		return fmt.Errorf("Method %s not supported, expected GET, POST or PUT", webhook.Method)
+	}
+	if (webhook.Retries != nil && *webhook.Retries < 0) || (webhook.Backoff != nil && *webhook.Backoff < 0) {
+		return errors.New("The retries and the backoff of the webhook can not be negative")
+	}
+	return nil
+}
+
+//withoutSecret returns webhook with its secret hidden
+func withoutSecret(webhook Webhook) Webhook {
+	webhook.Secret = ""
+	return webhook
+}
+
+//AddWebhook adds webhook and returns it with its new id
+func (notifier *WebhookNotifier) AddWebhook(webhook Webhook) (*Webhook, error) {
+	if err := IsWebhookValid(webhook); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	webhook.ClearSecret = false
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	webhook.ID = notifier.nextID
+	notifier.nextID++
+	notifier.webhooks[webhook.ID] = webhook
+	webhook = withoutSecret(webhook)
+	return &webhook, notifier.saveWebhooks()
+}
+
+//ChangeWebhook changes the webhook having id to be similar with after.
+//The secret is kept if after has none, unless after.ClearSecret is set
+func (notifier *WebhookNotifier) ChangeWebhook(id int, after Webhook) error {
+	after.ID = id
+	if err := IsWebhookValid(after); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	before, ok := notifier.webhooks[id]
+	if !ok {
+		return fmt.Errorf("No webhook with id %d", id)
+	}
+	if after.ClearSecret {
+		after.Secret, after.ClearSecret = "", false
+	} else if after.Secret == "" {
+		after.Secret = before.Secret
+	}
+	notifier.webhooks[id] = after
+	return notifier.saveWebhooks()
+}
+
+//RemoveWebhook removes the webhook having id. Its requests in
+//progress are cancelled and their retries stop
+func (notifier *WebhookNotifier) RemoveWebhook(id int) error {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if _, ok := notifier.webhooks[id]; !ok {
+		return fmt.Errorf("No webhook with id %d", id)
+	}
+	delete(notifier.webhooks, id)
+	if wc, ok := notifier.contexts[id]; ok {
+		wc.cancel()
+		delete(notifier.contexts, id)
+	}
+	return notifier.saveWebhooks()
+}
+
+//GetWebhook returns the webhook having id, without its secret
+func (notifier *WebhookNotifier) GetWebhook(id int) (*Webhook, error) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	webhook, ok := notifier.webhooks[id]
+	if !ok {
+		return nil, fmt.Errorf("No webhook with id %d", id)
+	}
+	webhook = withoutSecret(webhook)
+	return &webhook, nil
+}
+
+//GetWebhooks returns the webhooks sorted by id, without their secrets
+func (notifier *WebhookNotifier) GetWebhooks() []Webhook {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	webhooks := notifier.sortedWebhooks()
+	for i := range webhooks {
+		webhooks[i] = withoutSecret(webhooks[i])
+	}
+	return webhooks
+}
+
+//GetDeadLetters returns the requests of the webhook having id that failed
+//after all their retries, the oldest first
+func (notifier *WebhookNotifier) GetDeadLetters(id int) []DeadLetter {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	deadLetters := []DeadLetter{}
+	for _, deadLetter := range notifier.deadLetters {
+		if deadLetter.WebhookID == id {
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+	return deadLetters
+}
+
+//wants returns true if webhook is sent for events of eventType
+func (webhook Webhook) wants(eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, wanted := range webhook.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+//execute executes the template text with event
+func execute(name string, text string, event common.Event) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err = tmpl.Execute(&buffer, event); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+//Sign returns the hex HMAC-SHA256 of body using secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//contextOf returns the context of the requests of the webhook having id
+func (notifier *WebhookNotifier) contextOf(id int) context.Context {
+	wc, ok := notifier.contexts[id]
+	if !ok {
+		wc.ctx, wc.cancel = context.WithCancel(context.Background())
+		notifier.contexts[id] = wc
+	}
+	return wc.ctx
+}
+
+//Notify sends event to the webhooks wanting it. The requests
+//are sent in the background
+func (notifier *WebhookNotifier) Notify(event common.Event) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	for _, webhook := range notifier.sortedWebhooks() {
+		if webhook.wants(event.Type) {
+			notifier.pending.Add(1)
+			go func(ctx context.Context, webhook Webhook) {
+				defer notifier.pending.Done()
+				notifier.deliver(ctx, webhook, event)
+			}(notifier.contextOf(webhook.ID), webhook)
+		}
+	}
+}
+
+//Wait waits for the requests in progress to be sent or dead lettered
+func (notifier *WebhookNotifier) Wait() {
+	notifier.pending.Wait()
+}
+
+//send makes one request of webhook, cancelled with ctx
+func (notifier *WebhookNotifier) send(ctx context.Context, webhook Webhook, address string, body string,
+	eventType string) error {
+	method := webhook.Method
+	if method == "" {
+		method = "POST"
+	}
+	var reader io.Reader
+	if method != "GET" {
+		reader = strings.NewReader(body)
+	}
+	request, err := http.NewRequest(method, address, reader)
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	if method != "GET" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range webhook.Headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set(EventHeader, eventType)
+	if webhook.Secret != "" {
+		request.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, []byte(body)))
+	}
+	response, err := notifier.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("The webhook answered %s", response.Status)
+	}
+	return nil
+}
+
+//deliver sends event to webhook, retrying with backoff. The request
+//is dead lettered if it fails after all the retries. The retries stop
+//when ctx is cancelled, the request is then dropped
+func (notifier *WebhookNotifier) deliver(ctx context.Context, webhook Webhook, event common.Event) {
+	retries, backoff := defaultRetries, defaultBackoff
+	if webhook.Retries != nil {
+		retries = *webhook.Retries
+	}
+	if webhook.Backoff != nil {
+		backoff = *webhook.Backoff
+	}
+
+	address, err := execute("url", webhook.URL, event)
+	body := ""
+	if err == nil {
+		if webhook.Body == "" {
+			var data []byte
+			data, err = json.Marshal(event)
+			body = string(data)
+		} else {
+			body, err = execute("body", webhook.Body, event)
+		}
+	}
+	attempts := 0
+	if err == nil {
+		for attempts < retries+1 {
+			if attempts > 0 {
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+				}
+				backoff *= 2
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			attempts++
+			if err = notifier.send(ctx, webhook, address, body, event.Type); err == nil {
+				return
+			}
+			log.Printf("Webhook %d attempt %d failed: %s\n", webhook.ID, attempts, err.Error())
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("Webhook %d removed, event %s dropped\n", webhook.ID, event.Type)
+		return
+	}
+
+	log.Printf("Webhook %d dead lettered for event %s: %s\n", webhook.ID, event.Type, err.Error())
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	notifier.deadLetters = append(notifier.deadLetters, DeadLetter{WebhookID: webhook.ID,
+		Event: event, URL: address, Body: body, Attempts: attempts, Error: err.Error(),
+		Time: time.Now().Format(common.TimeFormat)})
+	if len(notifier.deadLetters) > maxDeadLetters {
+		notifier.deadLetters = notifier.deadLetters[len(notifier.deadLetters)-maxDeadLetters:]
+	}
+	if err = (*notifier.persistenceProvider).SaveItem(deadLettersItem, notifier.deadLetters); err != nil {
+		log.Printf("Error saving the dead letters: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,253 @@
+package notifications_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/notifications"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+//received is a request received by the test server
+type received struct {
+	method  string
+	path    string
+	query   string
+	body    string
+	headers http.Header
+}
+
+//newServerForTest returns a test server answering the first failures
+//requests with 500 and recording the requests
+func newServerForTest(failures int) (*httptest.Server, func() []received) {
+	var mutex sync.Mutex
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, received{method: r.Method, path: r.URL.Path,
+			query: r.URL.RawQuery, body: string(body), headers: r.Header})
+		if len(requests) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	return server, func() []received {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]received{}, requests...)
+	}
+}
+
+func newNotifierForTest(t *testing.T) (persistenceprovider.PersistenceProvider, *notifications.WebhookNotifier) {
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	notifier, err := notifications.WebhookNotifier{}.NewWebhookNotifier(&pp)
+	if err != nil {
+		t.Fatalf("No error expected when creating the notifier, got %s", err.Error())
+	}
+	return pp, notifier
+}
+
+func newAlarmEventForTest() common.Event {
+	return common.Event{Type: common.AlarmRaisedEvent, Time: "2016-04-03T12:10:50",
+		Alarm: &common.Alarm{ID: 7, Name: "toner 38A", Kind: common.LowAlarm, State: common.Raised,
+			SKU: "38A", Value: 1, Threshold: 2}}
+}
+
+func TestWebhookShouldOk(t *testing.T) {
+	server, requests := newServerForTest(0)
+	defer server.Close()
+	_, notifier := newNotifierForTest(t)
+
+	_, err := notifier.AddWebhook(notifications.Webhook{Name: "alarms",
+		Events:  []string{common.AlarmRaisedEvent},
+		URL:     server.URL + "/alarm/{{.Alarm.ID}}?name={{query .Alarm.Name}}",
+		Body:    `{"text":"{{.Alarm.SKU}} is {{.Alarm.Kind}}: {{.Alarm.Value}}","alarm":{{json .Alarm}}}`,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Secret:  "secret"})
+	if err != nil {
+		t.Fatalf("No error expected when adding a webhook, got %s", err.Error())
+	}
+	notifier.AddWebhook(notifications.Webhook{Name: "stock", Events: []string{common.StockChangedEvent},
+		URL: server.URL + "/stock"})
+
+	notifier.Notify(newAlarmEventForTest())
+	notifier.Wait()
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("Expected one request, got %v", got)
+	}
+	request := got[0]
+	if request.method != "POST" || request.path != "/alarm/7" || request.query != "name=toner+38A" {
+		t.Fatalf("Expected POST /alarm/7?name=toner+38A, got %s %s?%s", request.method, request.path, request.query)
+	}
+	body := struct {
+		Text  string       `json:"text"`
+		Alarm common.Alarm `json:"alarm"`
+	}{}
+	if err = json.Unmarshal([]byte(request.body), &body); err != nil {
+		t.Fatalf("Expected a json body, got %s: %s", request.body, err.Error())
+	}
+	if body.Text != "38A is low: 1" || body.Alarm.ID != 7 {
+		t.Fatalf("Expected the templated body, got %s", request.body)
+	}
+	if request.headers.Get("Authorization") != "Bearer token" ||
+		request.headers.Get(notifications.EventHeader) != common.AlarmRaisedEvent {
+		t.Fatalf("Expected the custom and the event headers, got %v", request.headers)
+	}
+	if request.headers.Get(notifications.SignatureHeader) != "sha256="+notifications.Sign("secret", []byte(request.body)) {
+		t.Fatalf("Expected the body to be signed, got %v", request.headers.Get(notifications.SignatureHeader))
+	}
+
+	for _, webhook := range notifier.GetWebhooks() {
+		if webhook.Secret != "" {
+			t.Fatal("Expected the secrets to be hidden")
+		}
+	}
+}
+
+func TestWebhookDefaultBody(t *testing.T) {
+	server, requests := newServerForTest(0)
+	defer server.Close()
+	_, notifier := newNotifierForTest(t)
+	notifier.AddWebhook(notifications.Webhook{URL: server.URL})
+
+	stock := common.Stock{SKU: "38A", Count: 2}
+	notifier.Notify(common.Event{Type: common.StockChangedEvent, Stock: &stock})
+	notifier.Wait()
+	got := requests()
+	event := common.Event{}
+	if len(got) != 1 || json.Unmarshal([]byte(got[0].body), &event) != nil ||
+		event.Stock == nil || event.Stock.Count != 2 {
+		t.Fatalf("Expected the event as json, got %v", got)
+	}
+}
+
+func TestWebhookRetryAndDeadLetter(t *testing.T) {
+	server, requests := newServerForTest(2)
+	defer server.Close()
+	pp, notifier := newNotifierForTest(t)
+
+	retries := 2
+	backoff := 20 * time.Millisecond
+	webhook, _ := notifier.AddWebhook(notifications.Webhook{URL: server.URL,
+		Retries: &retries, Backoff: &backoff})
+	start := time.Now()
+	notifier.Notify(newAlarmEventForTest())
+	notifier.Wait()
+	if len(requests()) != 3 {
+		t.Fatalf("Expected the request to succeed at the third attempt, got %d attempts", len(requests()))
+	}
+	if time.Since(start) < 3*backoff {
+		t.Fatalf("Expected to wait %v then %v between attempts, waited %v", backoff, 2*backoff, time.Since(start))
+	}
+	if len(notifier.GetDeadLetters(webhook.ID)) != 0 {
+		t.Fatalf("Expected no dead letters, got %v", notifier.GetDeadLetters(webhook.ID))
+	}
+
+	retries = 1
+	notifier.ChangeWebhook(webhook.ID, notifications.Webhook{URL: "http://127.0.0.1:1/unreachable",
+		Retries: &retries, Backoff: &backoff})
+	notifier.Notify(newAlarmEventForTest())
+	notifier.Wait()
+	deadLetters := notifier.GetDeadLetters(webhook.ID)
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 2 || deadLetters[0].Event.Alarm.ID != 7 ||
+		deadLetters[0].Error == "" {
+		t.Fatalf("Expected one dead letter after 2 attempts, got %v", deadLetters)
+	}
+
+	loaded, err := notifications.WebhookNotifier{}.NewWebhookNotifier(&pp)
+	if err != nil {
+		t.Fatalf("No error expected when loading the notifier, got %s", err.Error())
+	}
+	if len(loaded.GetWebhooks()) != 1 || len(loaded.GetDeadLetters(webhook.ID)) != 1 {
+		t.Fatalf("Expected the webhook and the dead letter to be loaded, got %v, %v",
+			loaded.GetWebhooks(), loaded.GetDeadLetters(webhook.ID))
+	}
+}
+
+func TestWebhookClearSecret(t *testing.T) {
+	server, requests := newServerForTest(0)
+	defer server.Close()
+	_, notifier := newNotifierForTest(t)
+	webhook, _ := notifier.AddWebhook(notifications.Webhook{URL: server.URL, Secret: "secret"})
+
+	notifier.ChangeWebhook(webhook.ID, notifications.Webhook{Name: "renamed", URL: server.URL})
+	notifier.Notify(newAlarmEventForTest())
+	notifier.Wait()
+	if got := requests(); len(got) != 1 || got[0].headers.Get(notifications.SignatureHeader) == "" {
+		t.Fatalf("Expected the secret to be kept when changed without one, got %v", got)
+	}
+
+	notifier.ChangeWebhook(webhook.ID, notifications.Webhook{URL: server.URL, ClearSecret: true})
+	notifier.Notify(newAlarmEventForTest())
+	notifier.Wait()
+	if got := requests(); len(got) != 2 || got[1].headers.Get(notifications.SignatureHeader) != "" {
+		t.Fatalf("Expected the request not to be signed once the secret is cleared, got %v", got)
+	}
+	if changed, _ := notifier.GetWebhook(webhook.ID); changed.ClearSecret {
+		t.Fatal("Expected ClearSecret not to be kept")
+	}
+}
+
+func TestWebhookRemoveStopsRetries(t *testing.T) {
+	server, requests := newServerForTest(100)
+	defer server.Close()
+	_, notifier := newNotifierForTest(t)
+	retries := 5
+	backoff := time.Hour
+	webhook, _ := notifier.AddWebhook(notifications.Webhook{URL: server.URL,
+		Retries: &retries, Backoff: &backoff})
+
+	notifier.Notify(newAlarmEventForTest())
+	for len(requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := notifier.RemoveWebhook(webhook.ID); err != nil {
+		t.Fatalf("No error expected when removing the webhook, got %s", err.Error())
+	}
+	done := make(chan struct{})
+	go func() {
+		notifier.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the retries to stop once the webhook is removed")
+	}
+	if len(requests()) != 1 || len(notifier.GetDeadLetters(webhook.ID)) != 0 {
+		t.Fatalf("Expected one attempt and no dead letter, got %v, %v",
+			requests(), notifier.GetDeadLetters(webhook.ID))
+	}
+}
+
+func TestWebhookShouldFail(t *testing.T) {
+	_, notifier := newNotifierForTest(t)
+	retries := -1
+	invalid := []notifications.Webhook{
+		notifications.Webhook{},
+		notifications.Webhook{URL: "http://localhost/{{.Alarm"},
+		notifications.Webhook{URL: "http://localhost", Body: "{{json}"},
+		notifications.Webhook{URL: "http://localhost", Method: "DELETE"},
+		notifications.Webhook{URL: "http://localhost", Retries: &retries},
+	}
+	for _, webhook := range invalid {
+		if _, err := notifier.AddWebhook(webhook); err == nil {
+			t.Fatalf("Expected error when adding %v, got nil", webhook)
+		}
+	}
+	if err := notifier.ChangeWebhook(1, notifications.Webhook{URL: "http://localhost"}); err == nil {
+		t.Fatal("Expected error when changing a missing webhook, got nil")
+	}
+	if err := notifier.RemoveWebhook(1); err == nil {
+		t.Fatal("Expected error when removing a missing webhook, got nil")
+	}
+}
@@ -0,0 +1,544 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+//names of the items holding the suppliers and the purchase
+//orders in the persistence provider
+const (
+	suppliersItem = "suppliers"
+	ordersItem    = "purchaseOrders"
+)
+
+//usageWindow is how far back the units taken from the stock
+//are counted to find the daily demand of a product
+const usageWindow = 30 * 24 * time.Hour
+
+//DemandFunc returns the count of units of the product having sku
+//used in a day
+type DemandFunc func(sku string) (float64, error)
+
+//Expected is the stock of a product together with the units ordered
+//and not received yet. Expected is Count plus OnOrder
+type Expected struct {
+	SKU      string `json:"sku"`
+	Count    int    `json:"count"`
+	OnOrder  int    `json:"onOrder"`
+	Expected int    `json:"expected"`
+}
+
+//usage is a count of units taken from the stock at a time
+type usage struct {
+	at    time.Time
+	units int
+}
+
+//bySupplierID sorts the suppliers by their id
+type bySupplierID []common.Supplier
+
+func (suppliers bySupplierID) Len() int           { return len(suppliers) }
+func (suppliers bySupplierID) Swap(i, j int)      { suppliers[i], suppliers[j] = suppliers[j], suppliers[i] }
+func (suppliers bySupplierID) Less(i, j int) bool { return suppliers[i].ID < suppliers[j].ID }
+
+//Manager keeps the suppliers and the purchase orders of the products.
+//With every stock change received through Update it checks the projected
+//stock of the product (the stock plus the units on open orders) and drafts
+//a purchase order when it falls below the demand during the lead time of
+//the supplier. The suppliers and the orders are saved in the persistence
+//provider. The event listeners are told of every order state change
+type Manager struct {
+	persistenceProvider *persistenceprovider.PersistenceProvider
+	inventory           *inventory.Inventory
+	suppliers           map[int]common.Supplier
+	orders              []common.PurchaseOrder
+	usages              map[string][]usage
+	firstSeen           map[string]time.Time
+	demand              DemandFunc
+	nextSupplierID      int
+	nextOrderID         int
+	events              *common.EventQueue
+	mutex               *sync.Mutex
+}
+
+//NewManager returns a Manager keeping its suppliers and orders in pp and
+//taking the products and their stock from inv. The suppliers and the
+//orders already saved in pp are loaded
+func (Manager) NewManager(pp *persistenceprovider.PersistenceProvider, inv *inventory.Inventory) (*Manager, error) {
+	manager := &Manager{persistenceProvider: pp, inventory: inv,
+		suppliers: make(map[int]common.Supplier),
+		usages:    make(map[string][]usage),
+		firstSeen: make(map[string]time.Time),
+		events:    common.EventQueue{}.NewEventQueue(),
+		mutex:     &sync.Mutex{}, nextSupplierID: 1, nextOrderID: 1}
+	if err := manager.load(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return manager, nil
+}
+
+//load reads the suppliers and the orders saved in the persistence provider
+func (manager *Manager) load() error {
+	var suppliers []common.Supplier
+	if err := persistenceprovider.ReadItemInto(*manager.persistenceProvider, suppliersItem, &suppliers); err != nil {
+		return err
+	}
+	for _, supplier := range suppliers {
+		manager.suppliers[supplier.ID] = supplier
+		if supplier.ID >= manager.nextSupplierID {
+			manager.nextSupplierID = supplier.ID + 1
+		}
+	}
+	if err := persistenceprovider.ReadItemInto(*manager.persistenceProvider, ordersItem, &manager.orders); err != nil {
+		return err
+	}
+	for _, order := range manager.orders {
+		if order.ID >= manager.nextOrderID {
+			manager.nextOrderID = order.ID + 1
+		}
+	}
+	return nil
+}
+
+func (manager *Manager) saveSuppliers() error {
+	return (*manager.persistenceProvider).SaveItem(suppliersItem, manager.sortedSuppliers())
+}
+
+func (manager *Manager) saveOrders() error {
+	return (*manager.persistenceProvider).SaveItem(ordersItem, manager.orders)
+}
+
+func (manager *Manager) sortedSuppliers() []common.Supplier {
+	suppliers := make([]common.Supplier, 0, len(manager.suppliers))
+	for _, supplier := range manager.suppliers {
+		suppliers = append(suppliers, supplier)
+	}
+	sort.Sort(bySupplierID(suppliers))
+	return suppliers
+}
+
+//AddEventListener adds listener to the listeners told
+//when a purchase order changes its state
+func (manager *Manager) AddEventListener(listener common.EventListener) {
+	manager.events.AddListener(listener)
+}
+
+//SetDemand replaces the daily demand calculated from the stock
+//changes received through Update with demand. While demand returns
+//an error the products are reordered under their minimum stock
+func (manager *Manager) SetDemand(demand DemandFunc) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.demand = demand
+}
+
+//emit queues the event of order changing to its current state.
+//The events are sent once the manager is unlocked
+func (manager *Manager) emit(order common.PurchaseOrder, at string) {
+	eventTypes := map[string]string{common.Draft: common.OrderDraftedEvent,
+		common.Approved: common.OrderApprovedEvent, common.Sent: common.OrderSentEvent,
+		common.Received: common.OrderReceivedEvent, common.Cancelled: common.OrderCancelledEvent}
+	manager.events.Emit(common.Event{Type: eventTypes[order.State],
+		Time: at, Order: &order})
+}
+
+//IsSupplierValid checks that supplier has a name, a lead time and
+//reorder quantities for products known by the inventory
+func (manager *Manager) IsSupplierValid(supplier common.Supplier) error {
+	if supplier.Name == "" {
+		return errors.New("The supplier must have a name")
+	}
+	if supplier.LeadTime < 0 {
+		return fmt.Errorf("The lead time of supplier %s can not be negative", supplier.Name)
+	}
+	skus := make(map[string]bool)
+	for _, product := range supplier.Products {
+		if product.ReorderQuantity <= 0 {
+			return fmt.Errorf("The reorder quantity of product %s must be greater than 0", product.SKU)
+		}
+		if skus[product.SKU] {
+			return fmt.Errorf("The product %s is listed twice", product.SKU)
+		}
+		skus[product.SKU] = true
+		if _, err := manager.inventory.GetProduct(product.SKU); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//AddSupplier adds supplier and returns it with its new id
+func (manager *Manager) AddSupplier(supplier common.Supplier) (*common.Supplier, error) {
+	if err := manager.IsSupplierValid(supplier); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	supplier.ID = manager.nextSupplierID
+	manager.nextSupplierID++
+	manager.suppliers[supplier.ID] = supplier
+	return &supplier, manager.saveSuppliers()
+}
+
+//ChangeSupplier changes the supplier having id to be similar with after.
+//The orders already made to the supplier are kept
+func (manager *Manager) ChangeSupplier(id int, after common.Supplier) error {
+	after.ID = id
+	if err := manager.IsSupplierValid(after); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if _, ok := manager.suppliers[id]; !ok {
+		return fmt.Errorf("No supplier with id %d", id)
+	}
+	manager.suppliers[id] = after
+	return manager.saveSuppliers()
+}
+
+//RemoveSupplier removes the supplier having id. A supplier can
+//only be removed if it has no open orders
+func (manager *Manager) RemoveSupplier(id int) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if _, ok := manager.suppliers[id]; !ok {
+		return fmt.Errorf("No supplier with id %d", id)
+	}
+	for _, order := range manager.orders {
+		if order.SupplierID == id && order.IsOpen() {
+			return fmt.Errorf("The supplier %d still has the order %d open", id, order.ID)
+		}
+	}
+	delete(manager.suppliers, id)
+	return manager.saveSuppliers()
+}
+
+//GetSupplier returns the supplier having id
+func (manager *Manager) GetSupplier(id int) (*common.Supplier, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	supplier, ok := manager.suppliers[id]
+	if !ok {
+		return nil, fmt.Errorf("No supplier with id %d", id)
+	}
+	return &supplier, nil
+}
+
+//GetSuppliers returns the suppliers sorted by id
+func (manager *Manager) GetSuppliers() []common.Supplier {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.sortedSuppliers()
+}
+
+//order returns the order having id
+func (manager *Manager) order(id int) *common.PurchaseOrder {
+	for i := range manager.orders {
+		if manager.orders[i].ID == id {
+			return &manager.orders[i]
+		}
+	}
+	return nil
+}
+
+//GetOrder returns the purchase order having id
+func (manager *Manager) GetOrder(id int) (*common.PurchaseOrder, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	order := manager.order(id)
+	if order == nil {
+		return nil, fmt.Errorf("No purchase order with id %d", id)
+	}
+	orderCopy := *order
+	return &orderCopy, nil
+}
+
+//GetOrders returns the purchase orders having state, sorted by id.
+//An empty state returns all the orders
+func (manager *Manager) GetOrders(state string) []common.PurchaseOrder {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	orders := []common.PurchaseOrder{}
+	for _, order := range manager.orders {
+		if state == "" || order.State == state {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+//supplierOf returns the supplier of the product having sku with the
+//shortest lead time and the reorder quantity of the product
+func (manager *Manager) supplierOf(sku string) (*common.Supplier, int) {
+	var found *common.Supplier
+	quantity := 0
+	for _, supplier := range manager.sortedSuppliers() {
+		for _, product := range supplier.Products {
+			if product.SKU == sku && (found == nil || supplier.LeadTime < found.LeadTime) {
+				supplierCopy := supplier
+				found, quantity = &supplierCopy, product.ReorderQuantity
+			}
+		}
+	}
+	return found, quantity
+}
+
+//draft adds a draft order of quantity units of sku from supplier
+func (manager *Manager) draft(supplier common.Supplier, sku string, quantity int, reason string) common.PurchaseOrder {
+	now := time.Now().Format(common.TimeFormat)
+	order := common.PurchaseOrder{ID: manager.nextOrderID, SupplierID: supplier.ID,
+		Supplier: supplier.Name, SKU: sku, Quantity: quantity, State: common.Draft,
+		Reason: reason, Created: now}
+	manager.nextOrderID++
+	manager.orders = append(manager.orders, order)
+	manager.emit(order, now)
+	return order
+}
+
+//AddOrder adds a draft order of quantity units of the product having sku.
+//The supplier with the shortest lead time is used if supplierID is 0 and
+//the reorder quantity of the product if quantity is 0
+func (manager *Manager) AddOrder(supplierID int, sku string, quantity int) (*common.PurchaseOrder, error) {
+	if _, err := manager.inventory.GetProduct(sku); err != nil {
+		return nil, err
+	}
+	manager.mutex.Lock()
+	defer manager.events.Flush()
+	defer manager.mutex.Unlock()
+	supplier, reorderQuantity := manager.supplierOf(sku)
+	if supplierID != 0 {
+		supplier, reorderQuantity = nil, 0
+		if found, ok := manager.suppliers[supplierID]; ok {
+			for _, product := range found.Products {
+				if product.SKU == sku {
+					supplier, reorderQuantity = &found, product.ReorderQuantity
+				}
+			}
+		}
+	}
+	if supplier == nil {
+		return nil, fmt.Errorf("No supplier delivers the product %s", sku)
+	}
+	if quantity == 0 {
+		quantity = reorderQuantity
+	}
+	if quantity < 0 {
+		return nil, fmt.Errorf("The quantity ordered can not be negative")
+	}
+	order := manager.draft(*supplier, sku, quantity, "manual")
+	return &order, manager.saveOrders()
+}
+
+//change moves the order having id from one of the states in from to state
+func (manager *Manager) change(id int, state string, from ...string) (*common.PurchaseOrder, error) {
+	manager.mutex.Lock()
+	defer manager.events.Flush()
+	defer manager.mutex.Unlock()
+	order := manager.order(id)
+	if order == nil {
+		return nil, fmt.Errorf("No purchase order with id %d", id)
+	}
+	allowed := false
+	for _, fromState := range from {
+		allowed = allowed || order.State == fromState
+	}
+	if !allowed {
+		return nil, fmt.Errorf("The purchase order %d is %s, it can not be %s", id, order.State, state)
+	}
+	now := time.Now().Format(common.TimeFormat)
+	order.State = state
+	switch state {
+	case common.Approved:
+		order.Approved = now
+	case common.Sent:
+		order.Sent = now
+	default:
+		order.Closed = now
+	}
+	manager.emit(*order, now)
+	orderCopy := *order
+	return &orderCopy, manager.saveOrders()
+}
+
+//Approve approves the draft order having id
+func (manager *Manager) Approve(id int) (*common.PurchaseOrder, error) {
+	return manager.change(id, common.Approved, common.Draft)
+}
+
+//Send marks the approved order having id as sent to the supplier
+func (manager *Manager) Send(id int) (*common.PurchaseOrder, error) {
+	return manager.change(id, common.Sent, common.Approved)
+}
+
+//Cancel cancels the open order having id
+func (manager *Manager) Cancel(id int) (*common.PurchaseOrder, error) {
+	return manager.change(id, common.Cancelled, common.Draft, common.Approved, common.Sent)
+}
+
+//Receive adds quantity units to the units received on the sent order having
+//id. All the units still expected are received if quantity is 0. The order
+//is received once all its units are. The units received are no longer on
+//order, they are expected in the stock read by the sensors
+func (manager *Manager) Receive(id int, quantity int) (*common.PurchaseOrder, error) {
+	manager.mutex.Lock()
+	defer manager.events.Flush()
+	defer manager.mutex.Unlock()
+	order := manager.order(id)
+	if order == nil {
+		return nil, fmt.Errorf("No purchase order with id %d", id)
+	}
+	if order.State != common.Sent {
+		return nil, fmt.Errorf("The purchase order %d is %s, only sent orders can be received", id, order.State)
+	}
+	if quantity < 0 {
+		return nil, errors.New("The quantity received can not be negative")
+	}
+	if quantity == 0 || order.Received+quantity > order.Quantity {
+		quantity = order.Quantity - order.Received
+	}
+	order.Received += quantity
+	if order.Received == order.Quantity {
+		order.State = common.Received
+		order.Closed = time.Now().Format(common.TimeFormat)
+		manager.emit(*order, order.Closed)
+	}
+	orderCopy := *order
+	return &orderCopy, manager.saveOrders()
+}
+
+//onOrder returns the units of sku not received yet on the open orders.
+//The draft orders are counted only if withDrafts is true
+func (manager *Manager) onOrder(sku string, withDrafts bool) int {
+	units := 0
+	for _, order := range manager.orders {
+		if order.SKU == sku && order.IsOpen() && (withDrafts || order.State != common.Draft) {
+			units += order.Quantity - order.Received
+		}
+	}
+	return units
+}
+
+//ExpectedStock returns the stock of the product having sku together
+//with the units on the approved and sent orders
+func (manager *Manager) ExpectedStock(sku string) (*Expected, error) {
+	stock, err := manager.inventory.GetStock(sku)
+	if err != nil {
+		return nil, err
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	units := manager.onOrder(sku, false)
+	return &Expected{SKU: sku, Count: stock.Count, OnOrder: units, Expected: stock.Count + units}, nil
+}
+
+//DailyDemand returns the average count of units of the product having sku
+//taken from the stock in a day, over the stock changes received in the
+//last 30 days. The demand is spread over at least a day
+func (manager *Manager) DailyDemand(sku string) (float64, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.dailyDemand(sku)
+}
+
+func (manager *Manager) dailyDemand(sku string) (float64, error) {
+	usages := manager.usages[sku]
+	if len(usages) == 0 {
+		return 0, nil
+	}
+	last := usages[len(usages)-1].at
+	first := manager.firstSeen[sku]
+	if first.Before(last.Add(-usageWindow)) {
+		first = last.Add(-usageWindow)
+	}
+	units := 0
+	for _, usage := range usages {
+		units += usage.units
+	}
+	days := math.Max(last.Sub(first).Hours()/24, 1)
+	return float64(units) / days, nil
+}
+
+//record adds the units taken from the stock by event
+//and drops the usages older than usageWindow
+func (manager *Manager) record(event common.Event) {
+	sku := event.Stock.SKU
+	at, err := time.ParseInLocation(common.TimeFormat, event.Stock.Time, time.Local)
+	if err != nil {
+		return
+	}
+	if _, ok := manager.firstSeen[sku]; !ok {
+		manager.firstSeen[sku] = at
+		if previous, err := time.ParseInLocation(common.TimeFormat, event.Previous.Time, time.Local); err == nil {
+			manager.firstSeen[sku] = previous
+		}
+	}
+	if event.Previous.Count <= event.Stock.Count {
+		return
+	}
+	usages := append(manager.usages[sku], usage{at: at, units: event.Previous.Count - event.Stock.Count})
+	for len(usages) > 0 && usages[0].at.Before(at.Add(-usageWindow)) {
+		usages = usages[1:]
+	}
+	manager.usages[sku] = usages
+}
+
+//check drafts an order of the product of stock if its projected stock
+//(the stock plus the units on the open orders) is under the demand during
+//the lead time of its supplier plus the minimum stock of the product
+func (manager *Manager) check(stock common.Stock) {
+	supplier, reorderQuantity := manager.supplierOf(stock.SKU)
+	if supplier == nil {
+		return
+	}
+	demandFunc := manager.dailyDemand
+	if manager.demand != nil {
+		demandFunc = manager.demand
+	}
+	demand, err := demandFunc(stock.SKU)
+	if err != nil {
+		//without a demand the product is reordered under its minimum stock
+		log.Printf("Could not get the demand of product %s: %s\n", stock.SKU, err.Error())
+		demand = 0
+	}
+	leadTimeDemand := int(math.Ceil(demand*supplier.LeadTime-1e-9)) + stock.MinStock
+	projected := stock.Count + manager.onOrder(stock.SKU, true)
+	if projected >= leadTimeDemand {
+		return
+	}
+	missing := leadTimeDemand - projected
+	quantity := reorderQuantity * ((missing + reorderQuantity - 1) / reorderQuantity)
+	reason := fmt.Sprintf("projected stock %d under the lead time demand %d", projected, leadTimeDemand)
+	order := manager.draft(*supplier, stock.SKU, quantity, reason)
+	log.Printf("Purchase order %d drafted: %d units of %s from %s, %s\n",
+		order.ID, quantity, stock.SKU, supplier.Name, reason)
+	if err = manager.saveOrders(); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+//Update records the units taken from the stock and checks if the product
+//needs to be reordered. It is meant to be added to the event listeners of
+//the inventory, only the stock.changed events are used
+func (manager *Manager) Update(event common.Event) {
+	if event.Type != common.StockChangedEvent || event.Stock == nil || event.Previous == nil {
+		return
+	}
+	manager.mutex.Lock()
+	defer manager.events.Flush()
+	defer manager.mutex.Unlock()
+	manager.record(event)
+	manager.check(*event.Stock)
+}
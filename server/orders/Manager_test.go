@@ -0,0 +1,180 @@
+package orders_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/internal/fixtures"
+	"github.com/adiclepcea/SensInventory/server/inventory"
+	"github.com/adiclepcea/SensInventory/server/orders"
+	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+)
+
+func newManagerForTest(t *testing.T) (persistenceprovider.PersistenceProvider, *inventory.Inventory, *orders.Manager) {
+	cp := fixtures.Scale(t)
+	pp := fixtures.PersistenceProvider(t)
+	inv := fixtures.Inventory(t, &cp, &pp, fixtures.Toner("38A", 2))
+	manager, err := orders.Manager{}.NewManager(&pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when creating the order manager, got %s", err.Error())
+	}
+	inv.AddEventListener(manager.Update)
+	return pp, inv, manager
+}
+
+func newStockReadingForTest(count int, day int) common.Reading {
+	reading := common.Reading{Sensor: 3, Type: common.Input, StartLocation: 100, Count: 1,
+		Time: time.Date(2016, 4, day, 12, 0, 0, 0, time.UTC).Format(common.TimeFormat)}
+	reading.InitCalculatedValues()
+	reading.CalculatedValues["100"] = float64(count * 1000)
+	return reading
+}
+
+func TestReorderShouldDraftOrder(t *testing.T) {
+	pp, inv, manager := newManagerForTest(t)
+	var events []common.Event
+	manager.AddEventListener(func(event common.Event) {
+		events = append(events, event)
+	})
+	supplier, err := manager.AddSupplier(common.Supplier{Name: "toner shop", LeadTime: 3,
+		Products: []common.SupplierProduct{common.SupplierProduct{SKU: "38A", ReorderQuantity: 5}}})
+	if err != nil {
+		t.Fatalf("No error expected when adding a supplier, got %s", err.Error())
+	}
+
+	//2 units a day, the lead time demand is 2*3+2=8 units
+	for day, count := range []int{20, 18, 16, 14, 12, 10, 8} {
+		inv.Update(newStockReadingForTest(count, day+1))
+	}
+	if demand, _ := manager.DailyDemand("38A"); demand != 2 {
+		t.Fatalf("Expected a demand of 2 units a day, got %v", demand)
+	}
+	drafts := manager.GetOrders(common.Draft)
+	if len(drafts) != 0 {
+		t.Fatalf("Expected no order while the stock is over the lead time demand, got %v", drafts)
+	}
+
+	inv.Update(newStockReadingForTest(6, 8))
+	drafts = manager.GetOrders(common.Draft)
+	if len(drafts) != 1 || drafts[0].Quantity != 5 || drafts[0].SupplierID != supplier.ID ||
+		drafts[0].Supplier != "toner shop" {
+		t.Fatalf("Expected a draft order of 5 units from the toner shop, got %v", drafts)
+	}
+	if len(events) != 1 || events[0].Type != common.OrderDraftedEvent || events[0].Order.ID != drafts[0].ID {
+		t.Fatalf("Expected an order.drafted event, got %v", events)
+	}
+
+	//the draft counts in the projected stock: 5+5 >= ceil(2.14*3)+2
+	inv.Update(newStockReadingForTest(5, 8))
+	if drafts = manager.GetOrders(common.Draft); len(drafts) != 1 {
+		t.Fatalf("Expected the draft to keep the projected stock up, got %v", drafts)
+	}
+
+	id := drafts[0].ID
+	if _, err = manager.Send(id); err == nil {
+		t.Fatal("Expected error when sending a draft order, got nil")
+	}
+	if order, err := manager.Approve(id); err != nil || order.State != common.Approved || order.Approved == "" {
+		t.Fatalf("Expected the order to be approved, got %v, %v", order, err)
+	}
+	expected, err := manager.ExpectedStock("38A")
+	if err != nil || expected.Count != 5 || expected.OnOrder != 5 || expected.Expected != 10 {
+		t.Fatalf("Expected 5 units in stock and 5 on order, got %v, %v", expected, err)
+	}
+	if _, err = manager.Receive(id, 0); err == nil {
+		t.Fatal("Expected error when receiving an order not sent, got nil")
+	}
+	if order, err := manager.Send(id); err != nil || order.State != common.Sent {
+		t.Fatalf("Expected the order to be sent, got %v, %v", order, err)
+	}
+	if order, err := manager.Receive(id, 3); err != nil || order.State != common.Sent || order.Received != 3 {
+		t.Fatalf("Expected 3 units received and the order still sent, got %v, %v", order, err)
+	}
+	if expected, _ = manager.ExpectedStock("38A"); expected.OnOrder != 2 {
+		t.Fatalf("Expected 2 units still on order, got %v", expected)
+	}
+	if order, err := manager.Receive(id, 0); err != nil || order.State != common.Received ||
+		order.Received != 5 || order.Closed == "" {
+		t.Fatalf("Expected the order to be received, got %v, %v", order, err)
+	}
+	if expected, _ = manager.ExpectedStock("38A"); expected.OnOrder != 0 {
+		t.Fatalf("Expected nothing on order, got %v", expected)
+	}
+	types := []string{common.OrderDraftedEvent, common.OrderApprovedEvent, common.OrderSentEvent,
+		common.OrderReceivedEvent}
+	if len(events) != len(types) {
+		t.Fatalf("Expected the events %v, got %v", types, events)
+	}
+	for i, eventType := range types {
+		if events[i].Type != eventType {
+			t.Fatalf("Expected the events %v, got %v", types, events)
+		}
+	}
+
+	loaded, err := orders.Manager{}.NewManager(&pp, inv)
+	if err != nil {
+		t.Fatalf("No error expected when loading the order manager, got %s", err.Error())
+	}
+	if len(loaded.GetSuppliers()) != 1 || len(loaded.GetOrders(common.Received)) != 1 {
+		t.Fatalf("Expected the supplier and the order to be loaded, got %v, %v",
+			loaded.GetSuppliers(), loaded.GetOrders(""))
+	}
+	if order, err := loaded.AddOrder(0, "38A", 0); err != nil || order.ID != id+1 || order.Quantity != 5 {
+		t.Fatalf("Expected a new order with the next id and the reorder quantity, got %v, %v", order, err)
+	}
+}
+
+func TestReorderWithDemand(t *testing.T) {
+	_, inv, manager := newManagerForTest(t)
+	manager.AddSupplier(common.Supplier{Name: "slow", LeadTime: 10,
+		Products: []common.SupplierProduct{common.SupplierProduct{SKU: "38A", ReorderQuantity: 4}}})
+	fast, _ := manager.AddSupplier(common.Supplier{Name: "fast", LeadTime: 2,
+		Products: []common.SupplierProduct{common.SupplierProduct{SKU: "38A", ReorderQuantity: 4}}})
+	manager.SetDemand(func(sku string) (float64, error) {
+		return 5, nil
+	})
+
+	//5 units a day, the lead time demand is 5*2+2=12 units, 9 missing
+	inv.Update(newStockReadingForTest(4, 1))
+	inv.Update(newStockReadingForTest(3, 1))
+	drafts := manager.GetOrders(common.Draft)
+	if len(drafts) != 1 || drafts[0].SupplierID != fast.ID || drafts[0].Quantity != 12 {
+		t.Fatalf("Expected a draft of 12 units from the fast supplier, got %v", drafts)
+	}
+	if order, err := manager.Cancel(drafts[0].ID); err != nil || order.State != common.Cancelled {
+		t.Fatalf("Expected the order to be cancelled, got %v, %v", order, err)
+	}
+	if _, err := manager.Approve(drafts[0].ID); err == nil {
+		t.Fatal("Expected error when approving a cancelled order, got nil")
+	}
+}
+
+func TestSupplierShouldFail(t *testing.T) {
+	_, _, manager := newManagerForTest(t)
+	invalid := []common.Supplier{
+		common.Supplier{LeadTime: 1},
+		common.Supplier{Name: "shop", LeadTime: -1},
+		common.Supplier{Name: "shop", Products: []common.SupplierProduct{common.SupplierProduct{SKU: "38A"}}},
+		common.Supplier{Name: "shop", Products: []common.SupplierProduct{common.SupplierProduct{SKU: "12A", ReorderQuantity: 1}}},
+		common.Supplier{Name: "shop", Products: []common.SupplierProduct{
+			common.SupplierProduct{SKU: "38A", ReorderQuantity: 1}, common.SupplierProduct{SKU: "38A", ReorderQuantity: 2}}},
+	}
+	for _, supplier := range invalid {
+		if _, err := manager.AddSupplier(supplier); err == nil {
+			t.Fatalf("Expected error when adding %v, got nil", supplier)
+		}
+	}
+	if _, err := manager.AddOrder(0, "38A", 1); err == nil {
+		t.Fatal("Expected error when ordering a product without supplier, got nil")
+	}
+	supplier, _ := manager.AddSupplier(common.Supplier{Name: "shop",
+		Products: []common.SupplierProduct{common.SupplierProduct{SKU: "38A", ReorderQuantity: 1}}})
+	manager.AddOrder(supplier.ID, "38A", 3)
+	if err := manager.RemoveSupplier(supplier.ID); err == nil {
+		t.Fatal("Expected error when removing a supplier with open orders, got nil")
+	}
+	if err := manager.ChangeSupplier(supplier.ID+1, *supplier); err == nil {
+		t.Fatal("Expected error when changing a missing supplier, got nil")
+	}
+}
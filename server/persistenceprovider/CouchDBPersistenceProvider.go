@@ -3,6 +3,7 @@ package persistenceprovider
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -92,32 +93,80 @@ func (CouchDBPersistenceProvider) NewPersistenceProvider(params ...string) (Pers
 	if _, err := couchProvider.CreateDB(); err != nil {
 		return nil, err
 	}
+	if err := couchProvider.updateViews(); err != nil {
+		return nil, err
+	}
 
 	return &couchProvider, nil
 }
 
-func (couchProvider *CouchDBPersistenceProvider) createViews(views map[string]string) error {
-	viewCode := make(map[string]interface{})
+//sensViews are the views of the design document sens_views
+var sensViews = map[string]string{
+	"sensorTime": "function(doc){if(doc.Reading) emit([doc.Reading.bus||\"" +
+		common.DefaultBus + "\",doc.Reading.sensor,doc.Reading.time],null);}",
+	"byTime":     "function(doc){if(doc.Reading) emit(doc.Reading.time,null);}",
+	"itemByName": "function(doc){if(doc.Generic_Item) emit(doc.Generic_Item_Name,null);}",
+}
+
+//couchDBView is a view of a design document
+type couchDBView struct {
+	Map string `json:"map"`
+}
+
+//couchDBDesign is the design document holding the views
+type couchDBDesign struct {
+	couch.Doc
+	Language string                 `json:"language"`
+	Views    map[string]couchDBView `json:"views"`
+}
+
+//createViews saves the design document sens_views having views.
+//A design document already saved is replaced if rev is its revision
+func (couchProvider *CouchDBPersistenceProvider) createViews(views map[string]string, rev string) error {
+	view := couchDBDesign{Language: "javascript", Views: make(map[string]couchDBView)}
+	view.ID, view.Rev = "_design/sens_views", rev
 	for viewName, viewFunction := range views {
-		mapFunction := struct {
-			Map string `json:"map"`
-		}{viewFunction}
-		viewCode[viewName] = mapFunction
+		view.Views[viewName] = couchDBView{viewFunction}
 	}
 
-	view := make(map[string]interface{})
-	view["_id"] = "_design/sens_views"
-	view["language"] = "javascript"
-	view["views"] = viewCode
-
 	var response interface{}
 
-	_, err := couch.Do(couchProvider.CouchServer+"/"+couchProvider.CouchDatabase,
-		"POST", couchProvider.CouchCredentials, view, &response)
+	_, err := couch.Do(couchProvider.getBaseQueryString()+view.ID,
+		"PUT", couchProvider.CouchCredentials, view, &response)
 
 	return err
 }
 
+//updateViews replaces the design document sens_views of a database
+//created by an older version if its views are not the current ones.
+//The readings and the items are kept, CouchDB rebuilds the views
+func (couchProvider *CouchDBPersistenceProvider) updateViews() error {
+	var design couchDBDesign
+	resp, err := couch.Do(couchProvider.getBaseQueryString()+"_design/sens_views",
+		"GET", couchProvider.CouchCredentials, nil, &design)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return err
+	}
+	if sameViews(design.Views, sensViews) {
+		return nil
+	}
+	log.Printf("Updating the views of the database %s", couchProvider.CouchDatabase)
+	return couchProvider.createViews(sensViews, design.Rev)
+}
+
+//sameViews returns true if saved has exactly the map functions of views
+func sameViews(saved map[string]couchDBView, views map[string]string) bool {
+	if len(saved) != len(views) {
+		return false
+	}
+	for viewName, viewFunction := range views {
+		if view, ok := saved[viewName]; !ok || view.Map != viewFunction {
+			return false
+		}
+	}
+	return true
+}
+
 //CreateDB creates the database if it does not exist
 func (couchProvider *CouchDBPersistenceProvider) CreateDB() (*couch.Database, error) {
 	server := couch.NewServer(couchProvider.CouchServer, couchProvider.CouchCredentials)
@@ -129,11 +178,7 @@ func (couchProvider *CouchDBPersistenceProvider) CreateDB() (*couch.Database, er
 		if err := db.Create(); err != nil {
 			return nil, err
 		}
-		mapViews := make(map[string]string)
-		mapViews["sensorTime"] = "function(doc){if(doc.Reading) emit([doc.Reading.sensor,doc.Reading.time],null);}"
-		mapViews["byTime"] = "function(doc){if(doc.Reading) emit(doc.Reading.time,null);}"
-		mapViews["itemByName"] = "function(doc){if(doc.Generic_Item) emit(doc.Generic_Item_Name,null);}"
-		if err := couchProvider.createViews(mapViews); err != nil {
+		if err := couchProvider.createViews(sensViews, ""); err != nil {
 			couchProvider.DeleteDB()
 			return nil, err
 		}
@@ -163,6 +208,7 @@ func (couchProvider *CouchDBPersistenceProvider) SaveSensorReading(reading commo
 	if err != nil {
 		return err
 	}
+	reading.Bus = common.BusName(reading.Bus)
 	couchReading := &CouchDBReading{Reading: reading}
 
 	return db.Insert(couchReading)
@@ -182,16 +228,18 @@ func (couchProvider CouchDBPersistenceProvider) getBaseQueryString() string {
 	return server + database
 }
 
-func getViewQueryStringOneOnly(sensor string, timeIn time.Time) string {
+func getViewQueryStringOneOnly(bus string, sensor string, timeIn time.Time) string {
 	strTime := timeIn.Format(common.TimeFormat)
-	return fmt.Sprintf("%s[%s,\"%s\"]&include_docs=true", viewOneQueryPrefix, sensor, strTime)
+	return fmt.Sprintf("%s[\"%s\",%s,\"%s\"]&include_docs=true", viewOneQueryPrefix,
+		common.BusName(bus), sensor, strTime)
 }
 
-func getViewQueryStringSensorInPeriod(sensor string, startTime time.Time, endTime time.Time) string {
+func getViewQueryStringSensorInPeriod(bus string, sensor string, startTime time.Time, endTime time.Time) string {
 	strStartTime := startTime.Format(common.TimeFormat)
 	strEndTime := endTime.Format(common.TimeFormat)
-	return fmt.Sprintf("%s[%s,\"%s\"]&endkey=[%s,\"%s\"]&ascending=true&include_docs=true",
-		viewSensorInPeriodQueryPrefix, sensor, strStartTime, sensor, strEndTime)
+	bus = common.BusName(bus)
+	return fmt.Sprintf("%s[\"%s\",%s,\"%s\"]&endkey=[\"%s\",%s,\"%s\"]&ascending=true&include_docs=true",
+		viewSensorInPeriodQueryPrefix, bus, sensor, strStartTime, bus, sensor, strEndTime)
 }
 
 func getViewQueryStringInPeriod(startTime time.Time, endTime time.Time) string {
@@ -241,10 +289,10 @@ func (couchProvider *CouchDBPersistenceProvider) GetCouchDBItems(query string) (
 }
 
 //GetSensorReading returns the reading for the sensor with address
-//"sensorAddress" at the time "time"
-func (couchProvider *CouchDBPersistenceProvider) GetSensorReading(sensorAddress uint8, time time.Time) (*common.Reading, error) {
+//"sensorAddress" on "bus" at the time "time"
+func (couchProvider *CouchDBPersistenceProvider) GetSensorReading(bus string, sensorAddress uint8, time time.Time) (*common.Reading, error) {
 
-	query := getViewQueryStringOneOnly(strconv.Itoa(int(sensorAddress)), time)
+	query := getViewQueryStringOneOnly(bus, strconv.Itoa(int(sensorAddress)), time)
 
 	resp, err := couchProvider.GetCouchDBReadings(query)
 
@@ -257,15 +305,15 @@ func (couchProvider *CouchDBPersistenceProvider) GetSensorReading(sensorAddress
 	}
 
 	return &(*resp)[0].Reading, nil
-	// curl 'http://localhost:5984/sensinventory/_design/sens_views/_view/sensorTime?key=\[10,"2016-06-13%2023:28:48"\]&include_docs=true'
+	// curl 'http://localhost:5984/sensinventory/_design/sens_views/_view/sensorTime?key=\["default",10,"2016-06-13%2023:28:48"\]&include_docs=true'
 }
 
-//GetSensorReadingsInPeriod returns the readings for a sensor in a given period
+//GetSensorReadingsInPeriod returns the readings for a sensor on a bus in a given period
 func (couchProvider *CouchDBPersistenceProvider) GetSensorReadingsInPeriod(
-	sensorAddress uint8, startTime time.Time,
+	bus string, sensorAddress uint8, startTime time.Time,
 	endTime time.Time) ([]common.Reading, error) {
 
-	query := getViewQueryStringSensorInPeriod(strconv.Itoa(int(sensorAddress)), startTime, endTime)
+	query := getViewQueryStringSensorInPeriod(bus, strconv.Itoa(int(sensorAddress)), startTime, endTime)
 
 	resp, err := couchProvider.GetCouchDBReadings(query)
 	if err != nil {
@@ -285,12 +333,12 @@ func (couchProvider *CouchDBPersistenceProvider) GetSensorReadingsInPeriod(
 }
 
 //GetSensorReadingCountInPeriod returns the number of readings
-//for the given sensorAddress in the given period
+//for the given sensorAddress on bus in the given period
 func (couchProvider *CouchDBPersistenceProvider) GetSensorReadingCountInPeriod(
-	sensorAddress uint8, startTime time.Time,
+	bus string, sensorAddress uint8, startTime time.Time,
 	endTime time.Time) (uint, error) {
 
-	query := getViewQueryStringSensorInPeriod(strconv.Itoa(int(sensorAddress)), startTime, endTime)
+	query := getViewQueryStringSensorInPeriod(bus, strconv.Itoa(int(sensorAddress)), startTime, endTime)
 
 	resp, err := couchProvider.GetCouchDBReadings(query)
 
@@ -344,8 +392,8 @@ func (couchProvider *CouchDBPersistenceProvider) GetAllReadingsCountInPeriod(
 
 //DeleteSensorReading deletes the specified sensor Reading
 func (couchProvider *CouchDBPersistenceProvider) DeleteSensorReading(
-	sensorAddress uint8, time time.Time) error {
-	query := getViewQueryStringOneOnly(strconv.Itoa(int(sensorAddress)), time)
+	bus string, sensorAddress uint8, time time.Time) error {
+	query := getViewQueryStringOneOnly(bus, strconv.Itoa(int(sensorAddress)), time)
 
 	resp, err := couchProvider.GetCouchDBReadings(query)
 
@@ -368,11 +416,11 @@ func (couchProvider *CouchDBPersistenceProvider) DeleteSensorReading(
 }
 
 //DeleteSensorReadingsInPeriod deletes all the readings from the specified
-//sensor in the specified period of time
+//sensor on bus in the specified period of time
 func (couchProvider *CouchDBPersistenceProvider) DeleteSensorReadingsInPeriod(
-	sensorAddress uint8, startTime time.Time, endTime time.Time) error {
+	bus string, sensorAddress uint8, startTime time.Time, endTime time.Time) error {
 
-	query := getViewQueryStringSensorInPeriod(strconv.Itoa(int(sensorAddress)), startTime, endTime)
+	query := getViewQueryStringSensorInPeriod(bus, strconv.Itoa(int(sensorAddress)), startTime, endTime)
 
 	resp, err := couchProvider.GetCouchDBReadings(query)
 
@@ -438,7 +486,8 @@ func (couchProvider *CouchDBPersistenceProvider) DeleteAllReadingsInPeriod(
 	return nil
 }
 
-//SaveItem stores the json value of the object into the database
+//SaveItem stores the json value of the object into the database.
+//An item already saved with the same name is replaced
 func (couchProvider *CouchDBPersistenceProvider) SaveItem(name string, value interface{}) error {
 
 	server := couch.NewServer(couchProvider.CouchServer, couchProvider.CouchCredentials)
@@ -450,6 +499,16 @@ func (couchProvider *CouchDBPersistenceProvider) SaveItem(name string, value int
 	}
 
 	cdbItem := CouchDBItem{Name: name, Item: value}
+	rows, err := couchProvider.GetCouchDBItems("_design/sens_views/_view/itemByName?key=\"" + name + "\"&include_docs=true")
+	if err != nil {
+		return err
+	}
+	if rows != nil && len(*rows) > 0 {
+		if doc, ok := (*rows)[0].(map[string]interface{}); ok {
+			cdbItem.ID, _ = doc["_id"].(string)
+			cdbItem.Rev, _ = doc["_rev"].(string)
+		}
+	}
 	log.Printf("Saving in couchdb: %v\n", cdbItem)
 	return db.Insert(&cdbItem)
 
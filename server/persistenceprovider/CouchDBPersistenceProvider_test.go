@@ -12,6 +12,7 @@ import (
 	"github.com/adiclepcea/SensInventory/server/common"
 	pp "github.com/adiclepcea/SensInventory/server/persistenceprovider"
 	"github.com/adiclepcea/SensInventory/server/readgroups"
+	"github.com/patrickjuchli/couch"
 )
 
 var (
@@ -56,7 +57,6 @@ func initTest() {
 	reading1.InitCalculatedValues()
 
 	rg, _ := readgroups.ReadGroupFloat32{}.NewReadGroup(10, 0)
-	rg.ResultType = common.Float32
 	rg.Calculate(&reading1)
 
 	reading2.Type = common.Coil
@@ -163,6 +163,40 @@ func TestNewPersistenceProviderShouldFail(t *testing.T) {
 
 }
 
+func TestNewPersistenceProviderShouldUpdateViews(t *testing.T) {
+	cdbp, err := ConnectToCouch()
+	if err != nil {
+		t.Fatal("No error expected when connecting to couchdb, got ", err.Error())
+	}
+	defer cdbp.DeleteDB()
+
+	//the views saved before the readings had a bus
+	url := testServer + "/" + cdbp.CouchDatabase + "/_design/sens_views"
+	var design map[string]interface{}
+	if _, err = couch.Do(url, "GET", cdbp.CouchCredentials, nil, &design); err != nil {
+		t.Fatal("No error expected when reading the views, got ", err.Error())
+	}
+	design["views"] = map[string]interface{}{
+		"sensorTime": map[string]string{"map": "function(doc){if(doc.Reading) emit([doc.Reading.sensor,doc.Reading.time],null);}"},
+	}
+	var response interface{}
+	if _, err = couch.Do(url, "PUT", cdbp.CouchCredentials, design, &response); err != nil {
+		t.Fatal("No error expected when saving the old views, got ", err.Error())
+	}
+
+	if cdbp, err = ConnectToCouch(); err != nil {
+		t.Fatal("No error expected when connecting again to couchdb, got ", err.Error())
+	}
+	if err = cdbp.SaveSensorReading(reading1); err != nil {
+		t.Fatal("No error expected when saving a reading, got ", err.Error())
+	}
+	timeIn, _ := time.Parse(common.TimeFormat, reading1.Time)
+	reading, err := cdbp.GetSensorReading(reading1.Bus, reading1.Sensor, timeIn)
+	if err != nil || reading == nil {
+		t.Fatalf("Expected the reading to be found with the updated views, got %v, %v", reading, err)
+	}
+}
+
 func TestSaveSensorReadingShouldOK(t *testing.T) {
 	cdbp, err := ConnectToCouch()
 	if err != nil {
@@ -191,7 +225,7 @@ func TestGetSensorReading(t *testing.T) {
 		t.Fatal("No error expected when saving a reading, got ", err.Error())
 	}
 
-	reading, err := cdbp.GetSensorReading(reading1.Sensor, timeIn)
+	reading, err := cdbp.GetSensorReading(reading1.Bus, reading1.Sensor, timeIn)
 
 	if err != nil {
 		t.Fatalf("No error expected when retrieving a record. Got %s", err.Error())
@@ -231,8 +265,8 @@ func TestGetSensorReadingsInPeriod(t *testing.T) {
 		t.Fatal("No error expected when saving a reading, got ", err.Error())
 	}
 
-	readings, err := cdbp.GetSensorReadingsInPeriod(reading1.Sensor, startTime, endTime)
-	readingsIntermediary, err := cdbp.GetSensorReadingsInPeriod(reading1.Sensor, startTime, intermediaryTime)
+	readings, err := cdbp.GetSensorReadingsInPeriod(reading1.Bus, reading1.Sensor, startTime, endTime)
+	readingsIntermediary, err := cdbp.GetSensorReadingsInPeriod(reading1.Bus, reading1.Sensor, startTime, intermediaryTime)
 
 	if err != nil {
 		t.Fatalf("No error expected when retrieving records in a period. Got %s", err.Error())
@@ -278,8 +312,8 @@ func TestGetCountSensorReadingInPeriod(t *testing.T) {
 		t.Fatal("No error expected when saving a reading, got ", err.Error())
 	}
 
-	noOfReadings, err := cdbp.GetSensorReadingCountInPeriod(reading1.Sensor, startTime, endTime)
-	noOfReadingsIntermediary, err := cdbp.GetSensorReadingCountInPeriod(reading1.Sensor, startTime, intermediaryTime)
+	noOfReadings, err := cdbp.GetSensorReadingCountInPeriod(reading1.Bus, reading1.Sensor, startTime, endTime)
+	noOfReadingsIntermediary, err := cdbp.GetSensorReadingCountInPeriod(reading1.Bus, reading1.Sensor, startTime, intermediaryTime)
 
 	if err != nil {
 		t.Fatalf("No error expected when retrieving records in a period. Got %s", err.Error())
@@ -389,21 +423,21 @@ func TestDeleteSensorReading(t *testing.T) {
 		t.Fatal("No error expected when saving a reading, got ", err.Error())
 	}
 
-	err = cdbp.DeleteSensorReading(reading1.Sensor, startTime)
+	err = cdbp.DeleteSensorReading(reading1.Bus, reading1.Sensor, startTime)
 
 	if err != nil {
 		cdbp.DeleteDB()
 		t.Fatalf("No error expected while deleting an existing reading. Got", err.Error())
 	}
 
-	err = cdbp.DeleteSensorReading(reading1.Sensor, startTime)
+	err = cdbp.DeleteSensorReading(reading1.Bus, reading1.Sensor, startTime)
 	if err == nil {
 		cdbp.DeleteDB()
 		t.Fatalf("Error expected while deleting an inexistent reading. Got", err)
 	}
 
 	cdbp.CouchDatabase = "inexistent"
-	err = cdbp.DeleteSensorReading(reading2.Sensor, intermediaryTime)
+	err = cdbp.DeleteSensorReading(reading2.Bus, reading2.Sensor, intermediaryTime)
 	if err == nil {
 		t.Fatalf("Error expected while deleting a reading from an inexistent db. Got", err)
 	}
@@ -436,21 +470,21 @@ func TestDeleteSensorReadingsInPeriod(t *testing.T) {
 		t.Fatal("No error expected when saving a reading, got ", err.Error())
 	}
 
-	err = cdbp.DeleteSensorReadingsInPeriod(reading1.Sensor, startTime, endTime)
+	err = cdbp.DeleteSensorReadingsInPeriod(reading1.Bus, reading1.Sensor, startTime, endTime)
 
 	if err != nil {
 		cdbp.DeleteDB()
 		t.Fatalf("No error expected while deleting an existing reading. Got", err.Error())
 	}
 
-	err = cdbp.DeleteSensorReadingsInPeriod(reading1.Sensor, startTime, endTime)
+	err = cdbp.DeleteSensorReadingsInPeriod(reading1.Bus, reading1.Sensor, startTime, endTime)
 	if err == nil {
 		cdbp.DeleteDB()
 		t.Fatalf("Error expected while deleting an inexistent reading. Got", err)
 	}
 
 	cdbp.CouchDatabase = "inexistent"
-	err = cdbp.DeleteSensorReadingsInPeriod(reading3.Sensor, startTime, endTime)
+	err = cdbp.DeleteSensorReadingsInPeriod(reading3.Bus, reading3.Sensor, startTime, endTime)
 	if err == nil {
 		t.Fatalf("Error expected while deleting a reading from an inexistent db. Got", err)
 	}
@@ -535,6 +569,20 @@ func TestAddReadItem(t *testing.T) {
 		t.Fatalf("Expected %s, got %s when reading the test value", testValue.Value, val.Value)
 	}
 
+	testValue = tItem{Value: "item saved again"}
+	if err = cdbp.SaveItem(testName, testValue); err != nil {
+		t.Fatal("No error expected when saving an item again, got ", err.Error())
+	}
+	rez, err = cdbp.ReadItem(testName)
+	if err != nil {
+		t.Fatal("No error expected when reading an item saved again, got ", err.Error())
+	}
+	j, _ = json.Marshal(rez)
+	json.Unmarshal(j, &val)
+	if val.Value != testValue.Value {
+		t.Fatalf("Expected %s, got %s when reading the replaced value", testValue.Value, val.Value)
+	}
+
 	rez, err = cdbp.ReadItem("non_existent_item")
 	if err != nil {
 		t.Fatal("No error expected when reading an inexistent item, got ", err.Error())
@@ -3,6 +3,7 @@ package persistenceprovider
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/adiclepcea/SensInventory/server/common"
@@ -13,10 +14,12 @@ type timedReading struct {
 	ReadTime time.Time
 }
 
-//MockPersistenceProvider is a fake persistence provider
+//MockPersistenceProvider is a fake persistence provider.
+//It can be used by several goroutines at once
 type MockPersistenceProvider struct {
 	timedReadings []timedReading
 	items         map[string]interface{}
+	mutex         *sync.Mutex
 	PersistenceProvider
 }
 
@@ -24,11 +27,15 @@ type MockPersistenceProvider struct {
 func (MockPersistenceProvider) NewPersistenceProvider(params ...string) (PersistenceProvider, error) {
 	m := MockPersistenceProvider{}
 	m.items = make(map[string]interface{})
+	m.mutex = &sync.Mutex{}
 	return &m, nil
 }
 
 //SaveSensorReading - mocks saving a sensor
 func (mpp *MockPersistenceProvider) SaveSensorReading(reading common.Reading) error {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
+	reading.Bus = common.BusName(reading.Bus)
 	tempTime, _ := time.Parse(common.TimeFormat, reading.Time)
 	tr := timedReading{Reading: reading, ReadTime: tempTime}
 	log.Printf("Saving %d, %s\n", reading.Sensor, reading.Time)
@@ -36,11 +43,13 @@ func (mpp *MockPersistenceProvider) SaveSensorReading(reading common.Reading) er
 	return nil
 }
 
-//GetSensorReading returns the reading for sensor with sensorAddress at the exact time t
-func (mpp *MockPersistenceProvider) GetSensorReading(sensorAddress uint8, t time.Time) (*common.Reading, error) {
+//GetSensorReading returns the reading for sensor with sensorAddress on bus at the exact time t
+func (mpp *MockPersistenceProvider) GetSensorReading(bus string, sensorAddress uint8, t time.Time) (*common.Reading, error) {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	for _, tr := range mpp.timedReadings {
 		fmt.Printf("%v vs %v\n", tr.ReadTime, t)
-		if tr.ReadTime.Equal(t) && tr.Reading.Sensor == sensorAddress {
+		if tr.ReadTime.Equal(t) && tr.Reading.Sensor == sensorAddress && tr.Reading.Bus == common.BusName(bus) {
 			return &tr.Reading, nil
 		}
 	}
@@ -48,11 +57,13 @@ func (mpp *MockPersistenceProvider) GetSensorReading(sensorAddress uint8, t time
 }
 
 //GetSensorReadingsInPeriod returns all the readings for the sensor with address
-//sensorAddress in the period between start and end
-func (mpp *MockPersistenceProvider) GetSensorReadingsInPeriod(sensorAddress uint8, start time.Time, end time.Time) ([]common.Reading, error) {
+//sensorAddress on bus in the period between start and end
+func (mpp *MockPersistenceProvider) GetSensorReadingsInPeriod(bus string, sensorAddress uint8, start time.Time, end time.Time) ([]common.Reading, error) {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	readings := []common.Reading{}
 	for _, tr := range mpp.timedReadings {
-		if tr.ReadTime.Before(end) && tr.ReadTime.After(start) && tr.Reading.Sensor == sensorAddress {
+		if tr.ReadTime.Before(end) && tr.ReadTime.After(start) && tr.Reading.Sensor == sensorAddress && tr.Reading.Bus == common.BusName(bus) {
 			readings = append(readings, tr.Reading)
 		}
 	}
@@ -60,11 +71,13 @@ func (mpp *MockPersistenceProvider) GetSensorReadingsInPeriod(sensorAddress uint
 }
 
 //GetSensorReadingCountInPeriod returnns the number of readings for the sensor
-//with address sensorAddress between start and end time
-func (mpp *MockPersistenceProvider) GetSensorReadingCountInPeriod(sensorAddress uint8, start time.Time, end time.Time) (uint, error) {
+//with address sensorAddress on bus between start and end time
+func (mpp *MockPersistenceProvider) GetSensorReadingCountInPeriod(bus string, sensorAddress uint8, start time.Time, end time.Time) (uint, error) {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	count := 0
 	for _, tr := range mpp.timedReadings {
-		if tr.ReadTime.Before(end) && tr.ReadTime.After(start) && tr.Reading.Sensor == sensorAddress {
+		if tr.ReadTime.Before(end) && tr.ReadTime.After(start) && tr.Reading.Sensor == sensorAddress && tr.Reading.Bus == common.BusName(bus) {
 			count++
 		}
 	}
@@ -73,6 +86,8 @@ func (mpp *MockPersistenceProvider) GetSensorReadingCountInPeriod(sensorAddress
 
 //GetAllReadingsInPeriod returns all the readings in the period between start and end
 func (mpp *MockPersistenceProvider) GetAllReadingsInPeriod(start time.Time, end time.Time) (*[]common.Reading, error) {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	readings := []common.Reading{}
 	for _, tr := range mpp.timedReadings {
 		if tr.ReadTime.Before(end) && tr.ReadTime.After(start) {
@@ -84,6 +99,8 @@ func (mpp *MockPersistenceProvider) GetAllReadingsInPeriod(start time.Time, end
 
 //GetAllReadingsCountInPeriod returns the count all the readings in the period between start and end
 func (mpp *MockPersistenceProvider) GetAllReadingsCountInPeriod(start time.Time, end time.Time) (uint, error) {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	count := 0
 	for _, tr := range mpp.timedReadings {
 		if tr.ReadTime.Before(end) && tr.ReadTime.After(start) {
@@ -94,10 +111,12 @@ func (mpp *MockPersistenceProvider) GetAllReadingsCountInPeriod(start time.Time,
 }
 
 //DeleteSensorReading deletes the reading from the sensowith address sensorAddress
-//made at the t time
-func (mpp *MockPersistenceProvider) DeleteSensorReading(sensorAddress uint8, t time.Time) error {
+//on bus made at the t time
+func (mpp *MockPersistenceProvider) DeleteSensorReading(bus string, sensorAddress uint8, t time.Time) error {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	for i, tr := range mpp.timedReadings {
-		if tr.ReadTime.Equal(t) && tr.Reading.Sensor == sensorAddress {
+		if tr.ReadTime.Equal(t) && tr.Reading.Sensor == sensorAddress && tr.Reading.Bus == common.BusName(bus) {
 			mpp.timedReadings = append(mpp.timedReadings[:i], mpp.timedReadings[i+1:]...)
 			return nil
 		}
@@ -106,11 +125,13 @@ func (mpp *MockPersistenceProvider) DeleteSensorReading(sensorAddress uint8, t t
 }
 
 //DeleteSensorReadingsInPeriod deletes all the readings for the sensor with address
-//sensorAddress between start and end times
-func (mpp *MockPersistenceProvider) DeleteSensorReadingsInPeriod(sensorAddress uint8, start time.Time, end time.Time) error {
+//sensorAddress on bus between start and end times
+func (mpp *MockPersistenceProvider) DeleteSensorReadingsInPeriod(bus string, sensorAddress uint8, start time.Time, end time.Time) error {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	rez := mpp.timedReadings[:0]
 	for _, tr := range mpp.timedReadings {
-		if !(tr.ReadTime.Before(end) && tr.ReadTime.After(start) && tr.Reading.Sensor == sensorAddress) {
+		if !(tr.ReadTime.Before(end) && tr.ReadTime.After(start) && tr.Reading.Sensor == sensorAddress && tr.Reading.Bus == common.BusName(bus)) {
 			rez = append(rez, tr)
 		}
 	}
@@ -120,6 +141,8 @@ func (mpp *MockPersistenceProvider) DeleteSensorReadingsInPeriod(sensorAddress u
 
 //DeleteAllReadingsInPeriod deletes all reading between start and end times
 func (mpp *MockPersistenceProvider) DeleteAllReadingsInPeriod(start time.Time, end time.Time) error {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	rez := mpp.timedReadings[:0]
 	for _, tr := range mpp.timedReadings {
 		if !(tr.ReadTime.Before(end) && tr.ReadTime.After(start)) {
@@ -132,11 +155,15 @@ func (mpp *MockPersistenceProvider) DeleteAllReadingsInPeriod(start time.Time, e
 
 //SaveItem persists a generic item
 func (mpp *MockPersistenceProvider) SaveItem(name string, item interface{}) error {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	mpp.items[name] = item
 	return nil
 }
 
 //ReadItem return the item having the persisted name
 func (mpp *MockPersistenceProvider) ReadItem(name string) (interface{}, error) {
+	mpp.mutex.Lock()
+	defer mpp.mutex.Unlock()
 	return mpp.items[name], nil
 }
@@ -37,6 +37,29 @@ func TestMockAddReadItem(t *testing.T) {
 
 }
 
+func TestReadItemInto(t *testing.T) {
+	mp, _ := MockPersistenceProvider{}.NewPersistenceProvider()
+	//the item is saved as generic json, the way some persistence providers return it
+	mp.SaveItem("products", []interface{}{map[string]interface{}{"sku": "38A", "unitWeight": 1200}})
+
+	var products []common.Product
+	if err := ReadItemInto(mp, "products", &products); err != nil {
+		t.Fatalf("No error expected when reading the item, got %s", err.Error())
+	}
+	if len(products) != 1 || products[0].SKU != "38A" || products[0].UnitWeight != 1200 {
+		t.Fatalf("Expected the product to be decoded, got %v", products)
+	}
+
+	products = nil
+	if err := ReadItemInto(mp, "no such item", &products); err != nil || products != nil {
+		t.Fatalf("Expected nothing read for an item that does not exist, got %v, %v", products, err)
+	}
+	mp.SaveItem("invalid", "not a list")
+	if err := ReadItemInto(mp, "invalid", &products); err == nil {
+		t.Fatal("Expected error when the item can not be decoded, got nil")
+	}
+}
+
 func TestMockPersistenceProvider(t *testing.T) {
 	mp, _ := MockPersistenceProvider{}.NewPersistenceProvider()
 
@@ -51,12 +74,11 @@ func TestMockPersistenceProvider(t *testing.T) {
 	reading1.InitCalculatedValues()
 	tNow, _ := time.Parse(common.TimeFormat, reading1.Time)
 	rg, _ := readgroups.ReadGroupFloat32{}.NewReadGroup(10, 0)
-	rg.ResultType = common.Float32
 	rg.Calculate(&reading1)
 
 	mp.SaveSensorReading(reading1)
 
-	reading, _ := mp.GetSensorReading(10, tNow)
+	reading, _ := mp.GetSensorReading(common.DefaultBus, 10, tNow)
 
 	if reading == nil {
 		t.Fatal("Expected reading, got", reading)
@@ -66,18 +88,18 @@ func TestMockPersistenceProvider(t *testing.T) {
 		t.Fatal("Expected sensor address", reading1.Sensor, "got", reading.Sensor)
 	}
 
-	countReadings, _ := mp.GetSensorReadingCountInPeriod(reading.Sensor, tNow.Add(time.Second*1), tNow.Add(time.Second*2))
+	countReadings, _ := mp.GetSensorReadingCountInPeriod(reading.Bus, reading.Sensor, tNow.Add(time.Second*1), tNow.Add(time.Second*2))
 	if countReadings != 0 {
 		t.Fatal("Expected no reading in period, got ", countReadings, "readings")
 	}
 
-	readings, _ := mp.GetSensorReadingsInPeriod(reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
+	readings, _ := mp.GetSensorReadingsInPeriod(reading.Bus, reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
 	if len(readings) != 1 {
 		t.Fatal("Expected one reading in period, got ", len(readings), "readings")
 	}
 
-	mp.DeleteSensorReading(reading1.Sensor, tNow)
-	countReadings, _ = mp.GetSensorReadingCountInPeriod(reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
+	mp.DeleteSensorReading(reading1.Bus, reading1.Sensor, tNow)
+	countReadings, _ = mp.GetSensorReadingCountInPeriod(reading.Bus, reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
 
 	if countReadings != 0 {
 		t.Fatal("No reading expected after deletion, got", countReadings)
@@ -85,9 +107,9 @@ func TestMockPersistenceProvider(t *testing.T) {
 
 	mp.SaveSensorReading(reading1)
 
-	mp.DeleteSensorReadingsInPeriod(reading.Sensor, tNow.Add(time.Second*1), tNow.Add(time.Second*2))
+	mp.DeleteSensorReadingsInPeriod(reading.Bus, reading.Sensor, tNow.Add(time.Second*1), tNow.Add(time.Second*2))
 
-	countReadings, _ = mp.GetSensorReadingCountInPeriod(reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
+	countReadings, _ = mp.GetSensorReadingCountInPeriod(reading.Bus, reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
 
 	if countReadings != 1 {
 		t.Fatal("Expected 1 reading, got ", countReadings)
@@ -95,10 +117,40 @@ func TestMockPersistenceProvider(t *testing.T) {
 
 	mp.DeleteAllReadingsInPeriod(tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
 
-	countReadings, _ = mp.GetSensorReadingCountInPeriod(reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
+	countReadings, _ = mp.GetSensorReadingCountInPeriod(reading.Bus, reading.Sensor, tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
 
 	if countReadings != 0 {
 		t.Fatal("No reading expected after deleting all, got", countReadings)
 	}
 
 }
+
+func TestMockPersistenceProviderSeparatesBuses(t *testing.T) {
+	mp, _ := MockPersistenceProvider{}.NewPersistenceProvider()
+
+	now := time.Now()
+	tNow, _ := time.Parse(common.TimeFormat, now.Format(common.TimeFormat))
+	reading1 := common.Reading{Sensor: 10, Type: common.Holding, Count: 1,
+		ReadValues: []uint16{100}, Time: now.Format(common.TimeFormat)}
+	reading2 := reading1
+	reading2.Bus = "line2"
+	reading2.ReadValues = []uint16{200}
+
+	mp.SaveSensorReading(reading1)
+	mp.SaveSensorReading(reading2)
+
+	reading, _ := mp.GetSensorReading("line2", 10, tNow)
+	if reading == nil || reading.ReadValues[0] != 200 {
+		t.Fatal("Expected the reading from bus line2, got", reading)
+	}
+	reading, _ = mp.GetSensorReading(common.DefaultBus, 10, tNow)
+	if reading == nil || reading.ReadValues[0] != 100 {
+		t.Fatal("Expected the reading from the default bus, got", reading)
+	}
+
+	mp.DeleteSensorReading("line2", 10, tNow)
+	count, _ := mp.GetAllReadingsCountInPeriod(tNow.Add(time.Second*-1), tNow.Add(time.Second*2))
+	if count != 1 {
+		t.Fatal("Expected only the reading from bus line2 to be deleted, got", count, "readings left")
+	}
+}
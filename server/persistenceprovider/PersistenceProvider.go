@@ -1,6 +1,8 @@
 package persistenceprovider
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/adiclepcea/SensInventory/server/common"
@@ -11,14 +13,33 @@ import (
 type PersistenceProvider interface {
 	NewPersistenceProvider(params ...string) (PersistenceProvider, error)
 	SaveSensorReading(common.Reading) error
-	GetSensorReading(uint8, time.Time) (*common.Reading, error)
-	GetSensorReadingsInPeriod(uint8, time.Time, time.Time) ([]common.Reading, error)
-	GetSensorReadingCountInPeriod(uint8, time.Time, time.Time) (uint, error)
+	GetSensorReading(string, uint8, time.Time) (*common.Reading, error)
+	GetSensorReadingsInPeriod(string, uint8, time.Time, time.Time) ([]common.Reading, error)
+	GetSensorReadingCountInPeriod(string, uint8, time.Time, time.Time) (uint, error)
 	GetAllReadingsInPeriod(time.Time, time.Time) (*[]common.Reading, error)
 	GetAllReadingsCountInPeriod(time.Time, time.Time) (uint, error)
-	DeleteSensorReading(uint8, time.Time) error
-	DeleteSensorReadingsInPeriod(uint8, time.Time, time.Time) error
+	DeleteSensorReading(string, uint8, time.Time) error
+	DeleteSensorReadingsInPeriod(string, uint8, time.Time, time.Time) error
 	DeleteAllReadingsInPeriod(time.Time, time.Time) error
 	SaveItem(string, interface{}) error
 	ReadItem(string) (interface{}, error)
 }
+
+//ReadItemInto decodes the item having name from pp into value. The item
+//comes back as generic json from some persistence providers, so it is
+//encoded again and decoded into value. Value is left unchanged if there
+//is no item having name
+func ReadItemInto(pp PersistenceProvider, name string, value interface{}) error {
+	item, err := pp.ReadItem(name)
+	if err != nil || item == nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("Could not load %s: %s", name, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package readgroups
+
+import (
+	"fmt"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//byteOrderSetter is implemented by the workers calculating
+//a value kept in several registers
+type byteOrderSetter interface {
+	SetByteOrder(string) error
+}
+
+//checkByteOrder returns an error if byteOrder is not a known one
+func checkByteOrder(byteOrder string) error {
+	if !common.IsByteOrderValid(byteOrder) {
+		return fmt.Errorf("Byte order %s unknown", byteOrder)
+	}
+	return nil
+}
+
+//orderBytes returns the bytes of registers, sent in byteOrder,
+//as a big endian (ABCD) slice
+func orderBytes(registers []uint16, byteOrder string) []byte {
+	rez := make([]byte, len(registers)*2)
+	wordSwap := byteOrder == common.CDAB || byteOrder == common.DCBA
+	byteSwap := byteOrder == common.BADC || byteOrder == common.DCBA
+	for i, register := range registers {
+		poz := i
+		if wordSwap {
+			poz = len(registers) - 1 - i
+		}
+		high, low := byte(register>>8), byte(register)
+		if byteSwap {
+			high, low = low, high
+		}
+		rez[poz*2] = high
+		rez[poz*2+1] = low
+	}
+	return rez
+}
@@ -0,0 +1,99 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+var byteOrderTests = []struct {
+	resultType string
+	byteOrder  string
+	registers  []uint16
+	expected   interface{}
+}{
+	{common.Uint32, common.ABCD, []uint16{0x1122, 0x3344}, uint32(0x11223344)},
+	{common.Uint32, common.CDAB, []uint16{0x3344, 0x1122}, uint32(0x11223344)},
+	{common.Uint32, common.BADC, []uint16{0x2211, 0x4433}, uint32(0x11223344)},
+	{common.Uint32, common.DCBA, []uint16{0x4433, 0x2211}, uint32(0x11223344)},
+	{common.Uint32, "", []uint16{0x1122, 0x3344}, uint32(0x11223344)},
+	{common.Int32, common.ABCD, []uint16{0xF8A4, 0x32EB}, int32(-123456789)},
+	{common.Int32, common.CDAB, []uint16{0x32EB, 0xF8A4}, int32(-123456789)},
+	{common.Int32, common.BADC, []uint16{0xA4F8, 0xEB32}, int32(-123456789)},
+	{common.Int32, common.DCBA, []uint16{0xEB32, 0xA4F8}, int32(-123456789)},
+	{common.Int32, "", []uint16{0xF8A4, 0x32EB}, int32(-123456789)},
+	{common.Float32, common.ABCD, []uint16{0x47F1, 0x2000}, float32(123456)},
+	{common.Float32, common.CDAB, []uint16{0x2000, 0x47F1}, float32(123456)},
+	{common.Float32, common.BADC, []uint16{0xF147, 0x0020}, float32(123456)},
+	{common.Float32, common.DCBA, []uint16{0x0020, 0xF147}, float32(123456)},
+	{common.Float32, "", []uint16{0x0020, 0xF147}, float32(123456)},
+	{common.Float32, common.ABCD, []uint16{0xC2FF, 0x8000}, float32(-127.75)},
+	{common.Int16, common.ABCD, []uint16{0xFF85}, int16(-123)},
+	{common.Int16, common.CDAB, []uint16{0xFF85}, int16(-123)},
+	{common.Int16, common.BADC, []uint16{0x85FF}, int16(-123)},
+	{common.Int16, common.DCBA, []uint16{0x85FF}, int16(-123)},
+	{common.Uint16, common.ABCD, []uint16{0x1234}, uint16(0x1234)},
+	{common.Uint16, common.CDAB, []uint16{0x1234}, uint16(0x1234)},
+	{common.Uint16, common.BADC, []uint16{0x3412}, uint16(0x1234)},
+	{common.Uint16, common.DCBA, []uint16{0x3412}, uint16(0x1234)},
+	{common.Uint64, common.ABCD, []uint16{0x1122, 0x3344, 0x5566, 0x7788}, uint64(0x1122334455667788)},
+	{common.Uint64, common.CDAB, []uint16{0x7788, 0x5566, 0x3344, 0x1122}, uint64(0x1122334455667788)},
+	{common.Uint64, common.BADC, []uint16{0x2211, 0x4433, 0x6655, 0x8877}, uint64(0x1122334455667788)},
+	{common.Uint64, common.DCBA, []uint16{0x8877, 0x6655, 0x4433, 0x2211}, uint64(0x1122334455667788)},
+	{common.Int64, common.ABCD, []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFE}, int64(-2)},
+	{common.Int64, common.CDAB, []uint16{0xFFFE, 0xFFFF, 0xFFFF, 0xFFFF}, int64(-2)},
+	{common.Int64, common.BADC, []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFEFF}, int64(-2)},
+	{common.Int64, common.DCBA, []uint16{0xFEFF, 0xFFFF, 0xFFFF, 0xFFFF}, int64(-2)},
+	{common.Float64, common.ABCD, []uint16{0x40FE, 0x2400, 0x0000, 0x0000}, float64(123456)},
+	{common.Float64, common.CDAB, []uint16{0x0000, 0x0000, 0x2400, 0x40FE}, float64(123456)},
+	{common.Float64, common.BADC, []uint16{0xFE40, 0x0024, 0x0000, 0x0000}, float64(123456)},
+	{common.Float64, common.DCBA, []uint16{0x0000, 0x0000, 0x0024, 0xFE40}, float64(123456)},
+	{common.String, common.ABCD, []uint16{0x5331, 0x3233}, "S123"},
+	{common.String, common.BADC, []uint16{0x3153, 0x3332}, "S123"},
+}
+
+func TestCalculateByteOrders(t *testing.T) {
+	for _, test := range byteOrderTests {
+		rg := common.ReadGroup{SensorAddress: 1, StartLocation: 11,
+			ResultType: test.resultType, ByteOrder: test.byteOrder}
+		if test.resultType == common.String {
+			rg.Length = uint16(len(test.registers))
+		}
+		worker, err := readgroups.NewWorker(rg)
+		if err != nil {
+			t.Fatalf("No error expected when creating %s with byte order %s, got %s",
+				test.resultType, test.byteOrder, err.Error())
+		}
+		values := append([]uint16{0xFFFF}, test.registers...)
+		values = append(values, 0xFFFF)
+		reading := common.Reading{Sensor: 1, Type: common.Holding, StartLocation: 10,
+			Count: uint16(len(values)), ReadValues: values}
+		rez, err := worker.Calculate(&reading)
+		if err != nil {
+			t.Fatalf("No error expected when calculating %s with byte order %s, got %s",
+				test.resultType, test.byteOrder, err.Error())
+		}
+		if rez != test.expected {
+			t.Fatalf("Expected %v for %s with byte order %s from %04X, got %v",
+				test.expected, test.resultType, test.byteOrder, test.registers, rez)
+		}
+	}
+}
+
+func TestByteOrderShouldFail(t *testing.T) {
+	rgs := []common.ReadGroup{
+		common.ReadGroup{StartLocation: 10, ResultType: common.Uint32, ByteOrder: "ABDC"},
+		common.ReadGroup{StartLocation: 100, ResultType: common.Hundredths, ByteOrder: common.ABCD},
+		common.ReadGroup{StartLocation: 10, ResultType: common.BCD, ByteOrder: common.ABCD},
+		common.ReadGroup{StartLocation: 10, ResultType: common.String, ByteOrder: common.CDAB},
+	}
+	for _, rg := range rgs {
+		if _, err := readgroups.NewWorker(rg); err == nil {
+			t.Fatalf("Expected error when creating a worker for %v, got nil", rg)
+		}
+		if err := readgroups.ValidateReadGroups(common.Sensor{ReadGroups: []common.ReadGroup{rg}}); err == nil {
+			t.Fatalf("Expected error when validating %v, got nil", rg)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package readgroups
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//byRaw sorts the calibration points by their raw value
+type byRaw []common.CalibrationPoint
+
+func (points byRaw) Len() int           { return len(points) }
+func (points byRaw) Swap(i, j int)      { points[i], points[j] = points[j], points[i] }
+func (points byRaw) Less(i, j int) bool { return points[i].Raw < points[j].Raw }
+
+//ValidateCalibration checks that points has at least two points,
+//sorted by their raw values, without two points having the same raw value
+func ValidateCalibration(points []common.CalibrationPoint) error {
+	if len(points) < 2 {
+		return errors.New("A calibration needs at least two points")
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].Raw <= points[i-1].Raw {
+			return fmt.Errorf("The calibration points must be sorted by raw value, %v <= %v",
+				points[i].Raw, points[i-1].Raw)
+		}
+	}
+	return nil
+}
+
+//FitCalibration builds the piecewise linear calibration going through
+//points. The points having the same raw value are replaced by a point
+//having their average value
+func FitCalibration(points []common.CalibrationPoint) ([]common.CalibrationPoint, error) {
+	sorted := make([]common.CalibrationPoint, len(points))
+	copy(sorted, points)
+	sort.Stable(byRaw(sorted))
+
+	var rez []common.CalibrationPoint
+	for i := 0; i < len(sorted); {
+		j := i
+		sum := 0.0
+		for ; j < len(sorted) && sorted[j].Raw == sorted[i].Raw; j++ {
+			sum += sorted[j].Value
+		}
+		rez = append(rez, common.CalibrationPoint{Raw: sorted[i].Raw, Value: sum / float64(j-i)})
+		i = j
+	}
+	if err := ValidateCalibration(rez); err != nil {
+		return nil, err
+	}
+	return rez, nil
+}
+
+//calibrate maps raw through the calibration points. Between two points the
+//value is interpolated, outside the points the first or last segment is extended
+func calibrate(points []common.CalibrationPoint, raw float64) float64 {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Raw >= raw })
+	if i == 0 {
+		i = 1
+	} else if i == len(points) {
+		i = len(points) - 1
+	}
+	p1, p2 := points[i-1], points[i]
+	return p1.Value + (raw-p1.Raw)*(p2.Value-p1.Value)/(p2.Raw-p1.Raw)
+}
+
+//RawValue calculates the value of rg from reading without calibrating,
+//scaling or rounding it. This is the value used for the calibration points
+func RawValue(rg common.ReadGroup, reading *common.Reading) (float64, error) {
+	worker, err := NewWorker(rg)
+	if err != nil {
+		return 0, err
+	}
+	value, err := worker.Calculate(reading)
+	if err != nil {
+		return 0, err
+	}
+	return toFloat64(value)
+}
@@ -0,0 +1,85 @@
+package readgroups_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestFitCalibrationShouldOk(t *testing.T) {
+	points := []common.CalibrationPoint{
+		common.CalibrationPoint{Raw: 9000, Value: 1000},
+		common.CalibrationPoint{Raw: 1000, Value: 0},
+		common.CalibrationPoint{Raw: 5000, Value: 480},
+		common.CalibrationPoint{Raw: 5000, Value: 520},
+	}
+	fitted, err := readgroups.FitCalibration(points)
+	if err != nil {
+		t.Fatalf("No error expected when fitting the calibration, got %s", err.Error())
+	}
+	expected := []common.CalibrationPoint{
+		common.CalibrationPoint{Raw: 1000, Value: 0},
+		common.CalibrationPoint{Raw: 5000, Value: 500},
+		common.CalibrationPoint{Raw: 9000, Value: 1000},
+	}
+	if len(fitted) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fitted)
+	}
+	for i := range expected {
+		if fitted[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, fitted)
+		}
+	}
+}
+
+func TestFitCalibrationShouldFail(t *testing.T) {
+	points := []common.CalibrationPoint{
+		common.CalibrationPoint{Raw: 1000, Value: 0},
+		common.CalibrationPoint{Raw: 1000, Value: 10},
+	}
+	if _, err := readgroups.FitCalibration(points); err == nil {
+		t.Fatal("Expected error when fitting a single raw value, got nil")
+	}
+	if err := readgroups.ValidateCalibration([]common.CalibrationPoint{points[0], points[0]}); err == nil {
+		t.Fatal("Expected error when validating points having the same raw value, got nil")
+	}
+}
+
+var calibrationTests = []struct {
+	raw      uint16
+	expected float64
+}{
+	{1000, 0},
+	{3000, 250},
+	{5000, 500},
+	{7000, 750},
+	{9000, 1000},
+	{11000, 1250},
+	{0, -125},
+}
+
+func TestCalculateCalibrated(t *testing.T) {
+	precision := 1
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 10, ResultType: common.Uint16, Precision: &precision,
+			Unit: "g", Calibration: []common.CalibrationPoint{
+				common.CalibrationPoint{Raw: 1000, Value: 0},
+				common.CalibrationPoint{Raw: 5000, Value: 500},
+				common.CalibrationPoint{Raw: 9000, Value: 1000}}}}}
+	for _, test := range calibrationTests {
+		reading := common.Reading{Sensor: 1, Type: common.Input, StartLocation: 10, Count: 1,
+			ReadValues: []uint16{test.raw}}
+		readgroups.Calculate(sensor, &reading)
+		value, ok := reading.CalculatedValues["10"].(float64)
+		if !ok || math.Abs(value-test.expected) > 1e-9 {
+			t.Fatalf("Expected %v for %d, got %v", test.expected, test.raw, reading.CalculatedValues["10"])
+		}
+	}
+
+	sensor.ReadGroups[0].Calibration = sensor.ReadGroups[0].Calibration[:1]
+	if err := readgroups.ValidateReadGroups(sensor); err == nil {
+		t.Fatal("Expected error when validating a calibration with one point, got nil")
+	}
+}
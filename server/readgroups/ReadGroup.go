@@ -0,0 +1,107 @@
+package readgroups
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//lengthSetter is implemented by the workers calculating
+//a value kept in a configurable number of registers
+type lengthSetter interface {
+	SetLength(uint16) error
+}
+
+//readCount returns the number of registers found in reading.
+//This is reading.Count unless less values were read
+func readCount(reading *common.Reading) int {
+	if len(reading.ReadValues) < int(reading.Count) {
+		return len(reading.ReadValues)
+	}
+	return int(reading.Count)
+}
+
+//checkReading verifies that reading holds count holding or input
+//registers starting from startLocation
+func checkReading(reading *common.Reading, startLocation uint16, count uint16) error {
+	var err error
+	if reading.StartLocation > startLocation {
+		err = fmt.Errorf("Could not calculate the value, Reading startLocation (%d > %d)",
+			reading.StartLocation, startLocation)
+	} else if int(reading.StartLocation)+readCount(reading) < int(startLocation)+int(count) {
+		err = fmt.Errorf("Could not calculate the value, Reading startLocation + count (%d < %d)",
+			int(reading.StartLocation)+readCount(reading)-1, int(startLocation)+int(count)-1)
+	} else if reading.Type != common.Holding && reading.Type != common.Input {
+		err = fmt.Errorf("Reading type %s should be Holding or Input", reading.Type)
+	}
+	if err != nil {
+		log.Println(err.Error())
+	}
+	return err
+}
+
+//covers returns true if reading holds the count registers
+//starting from startLocation
+func covers(reading *common.Reading, startLocation uint16, count uint16) bool {
+	return reading.StartLocation <= startLocation &&
+		int(startLocation)+int(count) <= int(reading.StartLocation)+readCount(reading)
+}
+
+//registerBytes checks reading and returns the bytes of the count registers
+//starting from startLocation as a big endian (ABCD) slice
+func registerBytes(reading *common.Reading, startLocation uint16, count uint16, byteOrder string) ([]byte, error) {
+	if err := checkReading(reading, startLocation, count); err != nil {
+		return nil, err
+	}
+	poz := startLocation - reading.StartLocation
+	return orderBytes(reading.ReadValues[poz:poz+count], byteOrder), nil
+}
+
+//setCalculatedValue stores x as the value of the read group
+//found at startLocation
+func setCalculatedValue(reading *common.Reading, startLocation uint16, x interface{}) {
+	if reading.CalculatedValues == nil {
+		reading.InitCalculatedValues()
+	}
+	reading.CalculatedValues[fmt.Sprintf("%d", startLocation)] = x
+}
+
+//Calculate calculates the values of the read groups of sensor found in
+//reading and stores them in reading.CalculatedValues. The read groups
+//not covered by the registers of reading are skipped. The errors are
+//recorded in reading.CalculateErrors, the read values are kept.
+//If a tare is set for a read group, its net value is stored too
+func Calculate(sensor common.Sensor, reading *common.Reading) {
+	if reading.Type != common.Holding && reading.Type != common.Input {
+		return
+	}
+	if reading.CalculatedValues == nil {
+		reading.InitCalculatedValues()
+	}
+	for _, rg := range sensor.ReadGroups {
+		worker, err := NewWorker(rg)
+		if err != nil {
+			reading.SetCalculateError(rg.StartLocation, err)
+			continue
+		}
+		if !covers(reading, rg.StartLocation, worker.RegisterCount()) {
+			continue
+		}
+		if _, err = worker.Calculate(reading); err != nil {
+			reading.SetCalculateError(rg.StartLocation, err)
+			continue
+		}
+		if err = applyScale(rg, reading); err != nil {
+			reading.SetCalculateError(rg.StartLocation, err)
+			delete(reading.CalculatedValues, rg.Key())
+			continue
+		}
+		if rg.Unit != "" {
+			reading.SetUnit(rg.StartLocation, rg.Unit)
+		}
+		if err = applyTare(sensor, rg, reading); err != nil {
+			reading.SetCalculateError(rg.StartLocation, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package readgroups
+
+//this converts registers holding one decimal digit in every 4 bits
+//(binary coded decimal) to a number. 0x0123 0x4567 is 1234567
+import (
+	"fmt"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupBCD calculates a uint64 value from 1 to 4 holding or input
+//registers holding a binary coded decimal. The first register holds
+//the most significant digits
+type ReadGroupBCD struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupBCD using one register
+func (ReadGroupBCD) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgb := ReadGroupBCD{common.ReadGroup{}}
+	rgb.SensorAddress = sensorAddress
+	rgb.StartLocation = startLocation
+	rgb.ResultType = common.BCD
+	rgb.Length = 1
+	return &rgb, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupBCD
+func (rgb ReadGroupBCD) RegisterCount() uint16 {
+	return rgb.Length
+}
+
+//SetLength sets the number of registers holding the number.
+//Up to 4 registers (16 digits) can be used
+func (rgb *ReadGroupBCD) SetLength(length uint16) error {
+	if length < 1 || length > 4 {
+		return fmt.Errorf("The length of a bcd must be between 1 and 4, got %d", length)
+	}
+	rgb.Length = length
+	return nil
+}
+
+//Calculate performs the transformation between registries values and
+//the number they hold
+func (rgb ReadGroupBCD) Calculate(reading *common.Reading) (interface{}, error) {
+	b, err := registerBytes(reading, rgb.StartLocation, rgb.Length, common.ABCD)
+	if err != nil {
+		return nil, err
+	}
+	var x uint64
+	for _, digits := range b {
+		for _, digit := range []byte{digits >> 4, digits & 0x0F} {
+			if digit > 9 {
+				return nil, fmt.Errorf("Could not calculate the value, %X is not a decimal digit", digit)
+			}
+			x = x*10 + uint64(digit)
+		}
+	}
+	setCalculatedValue(reading, rgb.StartLocation, x)
+	return x, nil
+}
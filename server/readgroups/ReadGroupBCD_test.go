@@ -0,0 +1,45 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateBCDShouldOk(t *testing.T) {
+	rgb, err := readgroups.NewWorker(common.ReadGroup{StartLocation: 20,
+		ResultType: common.BCD, Length: 2})
+	if err != nil {
+		t.Fatalf("No error expected when creating a ReadGroupBCD, got %s", err.Error())
+	}
+	reading := common.Reading{Sensor: 1, Type: common.Input,
+		StartLocation: 20, Count: 2, ReadValues: []uint16{0x0123, 0x4567}}
+
+	rez, err := rgb.Calculate(&reading)
+	if err != nil {
+		t.Fatalf("No error expected, got %s", err.Error())
+	}
+	if rez != uint64(1234567) || reading.CalculatedValues["20"] != uint64(1234567) {
+		t.Fatal("The expected result should have been 1234567", "got", rez)
+	}
+}
+
+func TestCalculateBCDShouldFail(t *testing.T) {
+	rgb, _ := readgroups.NewWorker(common.ReadGroup{StartLocation: 20,
+		ResultType: common.BCD, Length: 2})
+
+	readings := []common.Reading{
+		common.Reading{Type: common.Input, StartLocation: 20, Count: 2, ReadValues: []uint16{0x012A, 0x4567}},
+		common.Reading{Type: common.Input, StartLocation: 20, Count: 1, ReadValues: []uint16{0x0123, 0x4567}},
+		common.Reading{Type: common.Input, StartLocation: 21, Count: 2, ReadValues: []uint16{0x0123, 0x4567}},
+	}
+	for _, reading := range readings {
+		if rez, err := rgb.Calculate(&reading); err == nil {
+			t.Fatalf("Expected error when calculating %v, got %v", reading, rez)
+		}
+	}
+	if _, err := readgroups.NewWorker(common.ReadGroup{ResultType: common.BCD, Length: 5}); err == nil {
+		t.Fatal("Expected error when creating a bcd longer than 4 registers, got nil")
+	}
+}
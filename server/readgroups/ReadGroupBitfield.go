@@ -0,0 +1,57 @@
+package readgroups
+
+//this gives the state of every bit of the registers.
+//Bit 0 is the least significant bit of the first register
+import (
+	"fmt"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupBitfield calculates the state of the bits from 1 or more
+//holding or input registers as a []bool having 16 values per register
+type ReadGroupBitfield struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupBitfield using one register
+func (ReadGroupBitfield) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgb := ReadGroupBitfield{common.ReadGroup{}}
+	rgb.SensorAddress = sensorAddress
+	rgb.StartLocation = startLocation
+	rgb.ResultType = common.Bitfield
+	rgb.Length = 1
+	return &rgb, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupBitfield
+func (rgb ReadGroupBitfield) RegisterCount() uint16 {
+	return rgb.Length
+}
+
+//SetLength sets the number of registers holding the bits
+func (rgb *ReadGroupBitfield) SetLength(length uint16) error {
+	if length < 1 {
+		return fmt.Errorf("The length of a bitfield must be at least 1, got %d", length)
+	}
+	rgb.Length = length
+	return nil
+}
+
+//Calculate performs the transformation between registries values and
+//the state of their bits
+func (rgb ReadGroupBitfield) Calculate(reading *common.Reading) (interface{}, error) {
+	if err := checkReading(reading, rgb.StartLocation, rgb.Length); err != nil {
+		return nil, err
+	}
+	poz := rgb.StartLocation - reading.StartLocation
+	x := make([]bool, 0, rgb.Length*16)
+	for _, register := range reading.ReadValues[poz : poz+rgb.Length] {
+		for i := uint(0); i < 16; i++ {
+			x = append(x, register&(1<<i) != 0)
+		}
+	}
+	setCalculatedValue(reading, rgb.StartLocation, x)
+	return x, nil
+}
@@ -0,0 +1,49 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateBitfieldShouldOk(t *testing.T) {
+	rgb, err := readgroups.NewWorker(common.ReadGroup{StartLocation: 30,
+		ResultType: common.Bitfield, Length: 2})
+	if err != nil {
+		t.Fatalf("No error expected when creating a ReadGroupBitfield, got %s", err.Error())
+	}
+	reading := common.Reading{Sensor: 1, Type: common.Holding,
+		StartLocation: 30, Count: 2, ReadValues: []uint16{0x8005, 0x0002}}
+
+	rez, err := rgb.Calculate(&reading)
+	if err != nil {
+		t.Fatalf("No error expected, got %s", err.Error())
+	}
+	bits := rez.([]bool)
+	if len(bits) != 32 {
+		t.Fatalf("Expected 32 bits, got %d", len(bits))
+	}
+	for i, bit := range bits {
+		expected := i == 0 || i == 2 || i == 15 || i == 17
+		if bit != expected {
+			t.Fatalf("Expected bit %d to be %t, got %v", i, expected, bits)
+		}
+	}
+}
+
+func TestCalculateBitfieldShouldFail(t *testing.T) {
+	rgb, _ := readgroups.NewWorker(common.ReadGroup{StartLocation: 30,
+		ResultType: common.Bitfield, Length: 2})
+
+	reading := common.Reading{Type: common.Holding, StartLocation: 30, Count: 1,
+		ReadValues: []uint16{0x8005}}
+	if rez, err := rgb.Calculate(&reading); err == nil {
+		t.Fatalf("Expected error when the reading is too short, got %v", rez)
+	}
+	reading = common.Reading{Type: common.Coil, StartLocation: 30, Count: 2,
+		ReadValues: []uint16{1, 0}}
+	if rez, err := rgb.Calculate(&reading); err == nil {
+		t.Fatalf("Expected error when calculating coils, got %v", rez)
+	}
+}
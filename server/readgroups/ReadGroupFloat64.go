@@ -0,0 +1,55 @@
+package readgroups
+
+//this follows the conversion rules according to IEEE 754
+//to convert between 8 bytes (64 bits) to a float64.
+//The registers are read in the ABCD order unless configured otherwise
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupFloat64 calculates a float64 value from 4 holding or input registers
+type ReadGroupFloat64 struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupFloat64
+func (ReadGroupFloat64) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgf64 := ReadGroupFloat64{common.ReadGroup{}}
+	rgf64.SensorAddress = sensorAddress
+	rgf64.StartLocation = startLocation
+	rgf64.ResultType = common.Float64
+	return &rgf64, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupFloat64
+func (rgf64 ReadGroupFloat64) RegisterCount() uint16 {
+	return 4
+}
+
+//SetByteOrder sets the order of the bytes in the registers
+func (rgf64 *ReadGroupFloat64) SetByteOrder(byteOrder string) error {
+	if err := checkByteOrder(byteOrder); err != nil {
+		return err
+	}
+	rgf64.ByteOrder = byteOrder
+	return nil
+}
+
+//Calculate performs the transformation between registries values and Float64
+func (rgf64 ReadGroupFloat64) Calculate(reading *common.Reading) (interface{}, error) {
+	byteOrder := rgf64.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	b, err := registerBytes(reading, rgf64.StartLocation, 4, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	x := math.Float64frombits(binary.BigEndian.Uint64(b))
+	setCalculatedValue(reading, rgf64.StartLocation, x)
+	return x, nil
+}
@@ -0,0 +1,52 @@
+package readgroups
+
+//this converts the weight sent by the sensors in two registers,
+//the integer part and the hundredths, to a float64.
+//23.56 is sent as 23 (0x17) and 56 (0x38)
+import (
+	"fmt"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupHundredths calculates a value having two decimals from
+//2 holding or input registers
+type ReadGroupHundredths struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupHundredths
+func (ReadGroupHundredths) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgh := ReadGroupHundredths{common.ReadGroup{}}
+	rgh.SensorAddress = sensorAddress
+	rgh.StartLocation = startLocation
+	rgh.ResultType = common.Hundredths
+	return &rgh, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupHundredths
+func (rgh ReadGroupHundredths) RegisterCount() uint16 {
+	return 2
+}
+
+//Calculate performs the transformation between registries values and
+//a value with two decimals
+func (rgh ReadGroupHundredths) Calculate(reading *common.Reading) (interface{}, error) {
+	if err := checkReading(reading, rgh.StartLocation, 2); err != nil {
+		return nil, err
+	}
+	poz := rgh.StartLocation - reading.StartLocation
+	integer := reading.ReadValues[poz]
+	hundredths := reading.ReadValues[poz+1]
+	if hundredths > 99 {
+		return nil, fmt.Errorf("Could not calculate the value, hundredths %d > 99", hundredths)
+	}
+	x := float64(integer) + float64(hundredths)/100
+
+	if reading.CalculatedValues == nil {
+		reading.InitCalculatedValues()
+	}
+	reading.CalculatedValues[fmt.Sprintf("%d", rgh.StartLocation)] = x
+	return x, nil
+}
@@ -0,0 +1,47 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateHundredthsShouldOk(t *testing.T) {
+	rgh, err := readgroups.ReadGroupHundredths{}.NewReadGroup(1, 100)
+	if err != nil {
+		t.Fatal("No error expected when creating a ReadGroupHundredths")
+	}
+
+	//the example from the sensors protocol
+	reading := common.Reading{Sensor: 1, Type: common.Input,
+		StartLocation: 100, Count: 8, ReadValues: []uint16{0x17, 0x38, 0x07E0, 4, 3, 12, 10, 50}}
+
+	rez, err := rgh.Calculate(&reading)
+	if err != nil {
+		t.Fatalf("No error expected, got %s", err.Error())
+	}
+	if rez != 23.56 {
+		t.Fatal("The expected result should have been 23.56", "got", rez)
+	}
+	if reading.CalculatedValues["100"] != 23.56 {
+		t.Fatal("The expected value stored in the reading should have been 23.56",
+			"got", reading.CalculatedValues["100"])
+	}
+}
+
+func TestCalculateHundredthsShouldFail(t *testing.T) {
+	rgh, _ := readgroups.ReadGroupHundredths{}.NewReadGroup(1, 100)
+
+	readings := []common.Reading{
+		common.Reading{Type: common.Input, StartLocation: 100, Count: 2, ReadValues: []uint16{23, 100}},
+		common.Reading{Type: common.Input, StartLocation: 100, Count: 1, ReadValues: []uint16{23}},
+		common.Reading{Type: common.Input, StartLocation: 101, Count: 2, ReadValues: []uint16{23, 56}},
+		common.Reading{Type: common.Coil, StartLocation: 100, Count: 2, ReadValues: []uint16{1, 0}},
+	}
+	for _, reading := range readings {
+		if rez, err := rgh.Calculate(&reading); err == nil {
+			t.Fatalf("Expected error when calculating %v, got %v", reading, rez)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package readgroups
+
+//this converts the value of a uint16 to a int16.
+//The registers are read in the ABCD order unless configured otherwise
+import (
+	"encoding/binary"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupInt16 calculates a int16 value from 1 holding or input register
+type ReadGroupInt16 struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupInt16
+func (ReadGroupInt16) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgi16 := ReadGroupInt16{common.ReadGroup{}}
+	rgi16.SensorAddress = sensorAddress
+	rgi16.StartLocation = startLocation
+	rgi16.ResultType = common.Int16
+	return &rgi16, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupInt16
+func (rgi16 ReadGroupInt16) RegisterCount() uint16 {
+	return 1
+}
+
+//SetByteOrder sets the order of the bytes in the registers
+func (rgi16 *ReadGroupInt16) SetByteOrder(byteOrder string) error {
+	if err := checkByteOrder(byteOrder); err != nil {
+		return err
+	}
+	rgi16.ByteOrder = byteOrder
+	return nil
+}
+
+//Calculate performs the transformation between registries values and Int16
+func (rgi16 ReadGroupInt16) Calculate(reading *common.Reading) (interface{}, error) {
+	byteOrder := rgi16.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	b, err := registerBytes(reading, rgi16.StartLocation, 1, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	x := int16(binary.BigEndian.Uint16(b))
+	setCalculatedValue(reading, rgi16.StartLocation, x)
+	return x, nil
+}
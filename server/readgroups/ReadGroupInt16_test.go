@@ -0,0 +1,46 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateInt16ShouldOk(t *testing.T) {
+	rg, err := readgroups.ReadGroupInt16{}.NewReadGroup(1, 10)
+	if err != nil {
+		t.Fatalf("No error expected when creating a ReadGroupInt16, got %s", err.Error())
+	}
+	reading := common.Reading{Sensor: 1, Type: common.Holding,
+		StartLocation: 10, Count: 1, ReadValues: []uint16{0xFFFF}}
+	rez, err := rg.Calculate(&reading)
+	if err != nil || rez != int16(-1) {
+		t.Fatalf("Expected %v, got %v, %v", int16(-1), rez, err)
+	}
+	if reading.CalculatedValues["10"] != int16(-1) {
+		t.Fatal("Expected the value to be stored in the reading, got", reading.CalculatedValues["10"])
+	}
+}
+
+func TestCalculateInt16ShouldReadingToShort(t *testing.T) {
+	rg, _ := readgroups.ReadGroupInt16{}.NewReadGroup(1, 10)
+	readings := []common.Reading{
+		//the reading ends before the read group
+		common.Reading{Sensor: 1, Type: common.Holding,
+			StartLocation: 9, Count: 1, ReadValues: []uint16{0xFFFF}},
+		//less values were read than the count of the reading
+		common.Reading{Sensor: 1, Type: common.Holding,
+			StartLocation: 10, Count: 1, ReadValues: []uint16{}},
+		common.Reading{Sensor: 1, Type: common.Holding, StartLocation: 10, Count: 1},
+	}
+	for _, reading := range readings {
+		rez, err := rg.Calculate(&reading)
+		if err == nil {
+			t.Fatal("Expected error because reading too short,", rez)
+		}
+		if rez != nil {
+			t.Fatal("Expected nil response, got", rez)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package readgroups
 
 //this follows converts the values of two uint16 to a int32
 import (
+	"encoding/binary"
 	"fmt"
 	"log"
 
@@ -15,7 +16,7 @@ type ReadGroupInt32 struct {
 
 //NewReadGroup initializes a ReadGroupInt32
 func (ReadGroupInt32) NewReadGroup(sensorAddress uint8,
-	startLocation uint16) (*ReadGroupInt32, error) {
+	startLocation uint16) (common.ReadGroupWorker, error) {
 	rgf32 := ReadGroupInt32{common.ReadGroup{}}
 	rgf32.SensorAddress = sensorAddress
 	rgf32.StartLocation = startLocation
@@ -23,38 +24,33 @@ func (ReadGroupInt32) NewReadGroup(sensorAddress uint8,
 	return &rgf32, nil
 }
 
-//Calculate performs the transformation between registries values and Uint32
-func (rgf32 ReadGroupInt32) Calculate(reading common.Reading) (interface{}, error) {
-	log.Printf("SensorAddress %d \n StartLocation %d\n", rgf32.SensorAddress, rgf32.StartLocation)
-	if reading.StartLocation > rgf32.StartLocation {
-		log.Printf("Reading start location (%d > %d)",
-			reading.StartLocation,
-			rgf32.StartLocation)
-		return nil, fmt.Errorf(
-			"Could not calculate the value, Reading startLocation (%d > %d)",
-			reading.StartLocation, rgf32.StartLocation)
-	}
+//RegisterCount returns the number of registers used by ReadGroupInt32
+func (rgf32 ReadGroupInt32) RegisterCount() uint16 {
+	return 2
+}
 
-	if reading.StartLocation+reading.Count-1 < rgf32.StartLocation+1 {
-		log.Printf("Reading end location (%d < %d)",
-			reading.StartLocation+reading.Count-1,
-			rgf32.StartLocation+1)
-		return nil, fmt.Errorf(
-			"Could not calculate the value, Reading startLocation + count (%d < %d)",
-			reading.StartLocation+reading.Count-1,
-			rgf32.StartLocation+1)
+//SetByteOrder sets the order of the bytes in the registers
+func (rgf32 *ReadGroupInt32) SetByteOrder(byteOrder string) error {
+	if err := checkByteOrder(byteOrder); err != nil {
+		return err
 	}
+	rgf32.ByteOrder = byteOrder
+	return nil
+}
 
-	if reading.Type != common.Holding && reading.Type != common.Input {
-		log.Printf("Reading type %s should be Holding or Input", reading.Type)
-		return nil, fmt.Errorf("Reading type %s should be Holding or Input", reading.Type)
+//Calculate performs the transformation between registries values and Uint32
+func (rgf32 ReadGroupInt32) Calculate(reading *common.Reading) (interface{}, error) {
+	log.Printf("SensorAddress %d \n StartLocation %d\n", rgf32.SensorAddress, rgf32.StartLocation)
+	if err := checkReading(reading, rgf32.StartLocation, 2); err != nil {
+		return nil, err
 	}
 
 	poz1 := rgf32.StartLocation - reading.StartLocation
-	var x int32
-	xa := uint32(reading.ReadValues[poz1])
-	xb := uint32(reading.ReadValues[poz1+1])
-	x = int32((xa << 16) + xb)
+	byteOrder := rgf32.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	x := int32(binary.BigEndian.Uint32(orderBytes(reading.ReadValues[poz1:poz1+2], byteOrder)))
 	if reading.CalculatedValues == nil {
 		reading.InitCalculatedValues()
 	}
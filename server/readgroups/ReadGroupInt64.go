@@ -0,0 +1,53 @@
+package readgroups
+
+//this converts the values of four uint16 to a int64.
+//The registers are read in the ABCD order unless configured otherwise
+import (
+	"encoding/binary"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupInt64 calculates a int64 value from 4 holding or input registers
+type ReadGroupInt64 struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupInt64
+func (ReadGroupInt64) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgi64 := ReadGroupInt64{common.ReadGroup{}}
+	rgi64.SensorAddress = sensorAddress
+	rgi64.StartLocation = startLocation
+	rgi64.ResultType = common.Int64
+	return &rgi64, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupInt64
+func (rgi64 ReadGroupInt64) RegisterCount() uint16 {
+	return 4
+}
+
+//SetByteOrder sets the order of the bytes in the registers
+func (rgi64 *ReadGroupInt64) SetByteOrder(byteOrder string) error {
+	if err := checkByteOrder(byteOrder); err != nil {
+		return err
+	}
+	rgi64.ByteOrder = byteOrder
+	return nil
+}
+
+//Calculate performs the transformation between registries values and Int64
+func (rgi64 ReadGroupInt64) Calculate(reading *common.Reading) (interface{}, error) {
+	byteOrder := rgi64.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	b, err := registerBytes(reading, rgi64.StartLocation, 4, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	x := int64(binary.BigEndian.Uint64(b))
+	setCalculatedValue(reading, rgi64.StartLocation, x)
+	return x, nil
+}
@@ -0,0 +1,73 @@
+package readgroups
+
+//this converts registers holding 2 ASCII characters each
+//to a string. The trailing spaces and NUL characters are removed
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupString calculates a string from 1 or more holding or input
+//registers. Each register holds 2 characters, the first in the high
+//byte unless the byte order is BADC
+type ReadGroupString struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupString using one register
+func (ReadGroupString) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgs := ReadGroupString{common.ReadGroup{}}
+	rgs.SensorAddress = sensorAddress
+	rgs.StartLocation = startLocation
+	rgs.ResultType = common.String
+	rgs.Length = 1
+	return &rgs, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupString
+func (rgs ReadGroupString) RegisterCount() uint16 {
+	return rgs.Length
+}
+
+//SetLength sets the number of registers holding the string
+func (rgs *ReadGroupString) SetLength(length uint16) error {
+	if length < 1 {
+		return fmt.Errorf("The length of a string must be at least 1, got %d", length)
+	}
+	rgs.Length = length
+	return nil
+}
+
+//SetByteOrder sets the order of the characters in the registers.
+//Only ABCD and BADC are accepted as the registers are read in order
+func (rgs *ReadGroupString) SetByteOrder(byteOrder string) error {
+	if byteOrder != common.ABCD && byteOrder != common.BADC {
+		return fmt.Errorf("Byte order %s can not be used for a string", byteOrder)
+	}
+	rgs.ByteOrder = byteOrder
+	return nil
+}
+
+//Calculate performs the transformation between registries values and
+//the text they hold
+func (rgs ReadGroupString) Calculate(reading *common.Reading) (interface{}, error) {
+	byteOrder := rgs.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	b, err := registerBytes(reading, rgs.StartLocation, rgs.Length, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range b {
+		if c > 0x7F {
+			return nil, fmt.Errorf("Could not calculate the value, %X is not an ASCII character", c)
+		}
+	}
+	x := strings.TrimRight(string(b), "\x00 ")
+	setCalculatedValue(reading, rgs.StartLocation, x)
+	return x, nil
+}
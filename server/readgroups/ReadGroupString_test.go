@@ -0,0 +1,45 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateStringShouldOk(t *testing.T) {
+	rgs, err := readgroups.NewWorker(common.ReadGroup{StartLocation: 40,
+		ResultType: common.String, Length: 4})
+	if err != nil {
+		t.Fatalf("No error expected when creating a ReadGroupString, got %s", err.Error())
+	}
+	//"SN-42" padded with NUL
+	reading := common.Reading{Sensor: 1, Type: common.Input,
+		StartLocation: 40, Count: 4, ReadValues: []uint16{0x534E, 0x2D34, 0x3200, 0x0000}}
+
+	rez, err := rgs.Calculate(&reading)
+	if err != nil {
+		t.Fatalf("No error expected, got %s", err.Error())
+	}
+	if rez != "SN-42" || reading.CalculatedValues["40"] != "SN-42" {
+		t.Fatal("The expected result should have been SN-42", "got", rez)
+	}
+}
+
+func TestCalculateStringShouldFail(t *testing.T) {
+	rgs, _ := readgroups.NewWorker(common.ReadGroup{StartLocation: 40,
+		ResultType: common.String, Length: 2})
+
+	readings := []common.Reading{
+		common.Reading{Type: common.Input, StartLocation: 40, Count: 2, ReadValues: []uint16{0x534E, 0xFF34}},
+		common.Reading{Type: common.Input, StartLocation: 40, Count: 1, ReadValues: []uint16{0x534E, 0x2D34}},
+	}
+	for _, reading := range readings {
+		if rez, err := rgs.Calculate(&reading); err == nil {
+			t.Fatalf("Expected error when calculating %v, got %v", reading, rez)
+		}
+	}
+	if _, err := readgroups.NewWorker(common.ReadGroup{ResultType: common.Int64, Length: 2}); err == nil {
+		t.Fatal("Expected error when setting the length of a fixed length type, got nil")
+	}
+}
@@ -0,0 +1,58 @@
+package readgroups
+
+//this converts the time kept by the sensor RTC in 6 registers
+//(year, month, day, hour, minute, second) to a time
+import (
+	"fmt"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupTimestamp calculates the time of a reading from
+//6 holding or input registers. The sensors have no time zone so
+//the time is considered to be in the time zone of the server
+type ReadGroupTimestamp struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupTimestamp
+func (ReadGroupTimestamp) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgt := ReadGroupTimestamp{common.ReadGroup{}}
+	rgt.SensorAddress = sensorAddress
+	rgt.StartLocation = startLocation
+	rgt.ResultType = common.Timestamp
+	return &rgt, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupTimestamp
+func (rgt ReadGroupTimestamp) RegisterCount() uint16 {
+	return 6
+}
+
+//Calculate performs the transformation between registries values and
+//a time formatted using common.TimeFormat. The time is also set as
+//the SensorTime of the reading
+func (rgt ReadGroupTimestamp) Calculate(reading *common.Reading) (interface{}, error) {
+	if err := checkReading(reading, rgt.StartLocation, 6); err != nil {
+		return nil, err
+	}
+	v := reading.ReadValues[rgt.StartLocation-reading.StartLocation:]
+	t := time.Date(int(v[0]), time.Month(v[1]), int(v[2]),
+		int(v[3]), int(v[4]), int(v[5]), 0, time.Local)
+	//time.Date normalizes the values out of range, so 2016-02-30 becomes
+	//2016-03-01. Such a time means the RTC of the sensor is not set
+	if t.Year() != int(v[0]) || t.Month() != time.Month(v[1]) || t.Day() != int(v[2]) ||
+		t.Hour() != int(v[3]) || t.Minute() != int(v[4]) || t.Second() != int(v[5]) {
+		return nil, fmt.Errorf("Could not calculate the value, %v is not a valid time", v[:6])
+	}
+	x := t.Format(common.TimeFormat)
+
+	if reading.CalculatedValues == nil {
+		reading.InitCalculatedValues()
+	}
+	reading.CalculatedValues[fmt.Sprintf("%d", rgt.StartLocation)] = x
+	reading.SensorTime = x
+	return x, nil
+}
@@ -0,0 +1,51 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateTimestampShouldOk(t *testing.T) {
+	rgt, err := readgroups.ReadGroupTimestamp{}.NewReadGroup(1, 102)
+	if err != nil {
+		t.Fatal("No error expected when creating a ReadGroupTimestamp")
+	}
+
+	//the example from the sensors protocol
+	reading := common.Reading{Sensor: 1, Type: common.Input,
+		StartLocation: 100, Count: 8, ReadValues: []uint16{0x17, 0x38, 0x07E0, 4, 3, 12, 10, 50}}
+
+	rez, err := rgt.Calculate(&reading)
+	if err != nil {
+		t.Fatalf("No error expected, got %s", err.Error())
+	}
+	if rez != "2016-04-03T12:10:50" {
+		t.Fatal("The expected result should have been 2016-04-03T12:10:50", "got", rez)
+	}
+	if reading.CalculatedValues["102"] != rez || reading.SensorTime != rez {
+		t.Fatal("Expected the time to be stored in the reading, got",
+			reading.CalculatedValues["102"], reading.SensorTime)
+	}
+}
+
+func TestCalculateTimestampShouldFail(t *testing.T) {
+	rgt, _ := readgroups.ReadGroupTimestamp{}.NewReadGroup(1, 102)
+
+	readings := []common.Reading{
+		common.Reading{Type: common.Input, StartLocation: 102, Count: 6, ReadValues: []uint16{2016, 2, 30, 12, 10, 50}},
+		common.Reading{Type: common.Input, StartLocation: 102, Count: 6, ReadValues: []uint16{2016, 4, 3, 24, 10, 50}},
+		common.Reading{Type: common.Input, StartLocation: 102, Count: 6, ReadValues: []uint16{0, 0, 0, 0, 0, 0}},
+		common.Reading{Type: common.Input, StartLocation: 100, Count: 7, ReadValues: []uint16{23, 56, 2016, 4, 3, 12, 10}},
+		common.Reading{Type: common.Coil, StartLocation: 102, Count: 6, ReadValues: []uint16{2016, 4, 3, 12, 10, 50}},
+	}
+	for _, reading := range readings {
+		if rez, err := rgt.Calculate(&reading); err == nil {
+			t.Fatalf("Expected error when calculating %v, got %v", reading, rez)
+		}
+		if reading.SensorTime != "" {
+			t.Fatalf("Expected no sensor time for %v, got %s", reading, reading.SensorTime)
+		}
+	}
+}
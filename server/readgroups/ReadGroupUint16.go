@@ -0,0 +1,53 @@
+package readgroups
+
+//this takes the value of a register as a uint16.
+//The registers are read in the ABCD order unless configured otherwise
+import (
+	"encoding/binary"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupUint16 calculates a uint16 value from 1 holding or input register
+type ReadGroupUint16 struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupUint16
+func (ReadGroupUint16) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgu16 := ReadGroupUint16{common.ReadGroup{}}
+	rgu16.SensorAddress = sensorAddress
+	rgu16.StartLocation = startLocation
+	rgu16.ResultType = common.Uint16
+	return &rgu16, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupUint16
+func (rgu16 ReadGroupUint16) RegisterCount() uint16 {
+	return 1
+}
+
+//SetByteOrder sets the order of the bytes in the registers
+func (rgu16 *ReadGroupUint16) SetByteOrder(byteOrder string) error {
+	if err := checkByteOrder(byteOrder); err != nil {
+		return err
+	}
+	rgu16.ByteOrder = byteOrder
+	return nil
+}
+
+//Calculate performs the transformation between registries values and Uint16
+func (rgu16 ReadGroupUint16) Calculate(reading *common.Reading) (interface{}, error) {
+	byteOrder := rgu16.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	b, err := registerBytes(reading, rgu16.StartLocation, 1, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	x := binary.BigEndian.Uint16(b)
+	setCalculatedValue(reading, rgu16.StartLocation, x)
+	return x, nil
+}
@@ -26,7 +26,7 @@ func TestCalculateUint32ShouldOk(t *testing.T) {
 	reading := common.Reading{Sensor: 1, Type: common.Holding,
 		StartLocation: 8, Count: 5, ReadValues: []uint16{0, 0, 0xEF11, 0xFFDD, 0}}
 	reading.InitCalculatedValues()
-	rez, err := rgf32.Calculate(reading)
+	rez, err := rgf32.Calculate(&reading)
 	if rez != uint32(0xEF11FFDD) {
 		t.Fatalf("The expected result should have been 0xEF11FFDD got %x", rez)
 	}
@@ -58,7 +58,7 @@ func TestCalculateUint32ShouldWrongRegister(t *testing.T) {
 	reading := common.Reading{Sensor: 1, Type: common.Coil,
 		StartLocation: 8, Count: 5, ReadValues: []uint16{0, 0, 0xFFFF, 0xFFFF, 0}}
 	reading.InitCalculatedValues()
-	rez, err := rgf32.Calculate(reading)
+	rez, err := rgf32.Calculate(&reading)
 	if err == nil {
 		t.Error("Expected an error stating wrong register type got nil")
 		t.FailNow()
@@ -92,7 +92,7 @@ func TestCalculateUint32ShouldLocationToHigh(t *testing.T) {
 	reading := common.Reading{Sensor: 1, Type: common.Holding,
 		StartLocation: 18, Count: 5, ReadValues: []uint16{0, 0, 0xEF11, 0xFFDD, 0}}
 	reading.InitCalculatedValues()
-	rez, err := rgf32.Calculate(reading)
+	rez, err := rgf32.Calculate(&reading)
 	if err == nil {
 		t.Fatal("Expected error because location to high but got nil,", rez)
 	}
@@ -119,7 +119,7 @@ func TestCalculateUint32ShouldReadingToShort(t *testing.T) {
 	reading := common.Reading{Sensor: 1, Type: common.Holding,
 		StartLocation: 6, Count: 5, ReadValues: []uint16{0, 0, 0xEF11, 0xFFDD, 0}}
 	reading.InitCalculatedValues()
-	rez, err := rgf32.Calculate(reading)
+	rez, err := rgf32.Calculate(&reading)
 	if err == nil {
 		t.Fatal("Expected error because reading too short,", rez)
 	}
@@ -0,0 +1,53 @@
+package readgroups
+
+//this converts the values of four uint16 to a uint64.
+//The registers are read in the ABCD order unless configured otherwise
+import (
+	"encoding/binary"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//ReadGroupUint64 calculates a uint64 value from 4 holding or input registers
+type ReadGroupUint64 struct {
+	common.ReadGroup
+}
+
+//NewReadGroup initializes a ReadGroupUint64
+func (ReadGroupUint64) NewReadGroup(sensorAddress uint8,
+	startLocation uint16) (common.ReadGroupWorker, error) {
+	rgu64 := ReadGroupUint64{common.ReadGroup{}}
+	rgu64.SensorAddress = sensorAddress
+	rgu64.StartLocation = startLocation
+	rgu64.ResultType = common.Uint64
+	return &rgu64, nil
+}
+
+//RegisterCount returns the number of registers used by ReadGroupUint64
+func (rgu64 ReadGroupUint64) RegisterCount() uint16 {
+	return 4
+}
+
+//SetByteOrder sets the order of the bytes in the registers
+func (rgu64 *ReadGroupUint64) SetByteOrder(byteOrder string) error {
+	if err := checkByteOrder(byteOrder); err != nil {
+		return err
+	}
+	rgu64.ByteOrder = byteOrder
+	return nil
+}
+
+//Calculate performs the transformation between registries values and Uint64
+func (rgu64 ReadGroupUint64) Calculate(reading *common.Reading) (interface{}, error) {
+	byteOrder := rgu64.ByteOrder
+	if byteOrder == "" {
+		byteOrder = common.ABCD
+	}
+	b, err := registerBytes(reading, rgu64.StartLocation, 4, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	x := binary.BigEndian.Uint64(b)
+	setCalculatedValue(reading, rgu64.StartLocation, x)
+	return x, nil
+}
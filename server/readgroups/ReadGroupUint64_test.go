@@ -0,0 +1,46 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateUint64ShouldOk(t *testing.T) {
+	rg, err := readgroups.ReadGroupUint64{}.NewReadGroup(1, 10)
+	if err != nil {
+		t.Fatalf("No error expected when creating a ReadGroupUint64, got %s", err.Error())
+	}
+	reading := common.Reading{Sensor: 1, Type: common.Holding,
+		StartLocation: 10, Count: 4, ReadValues: []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}}
+	rez, err := rg.Calculate(&reading)
+	if err != nil || rez != uint64(0xFFFFFFFFFFFFFFFF) {
+		t.Fatalf("Expected %v, got %v, %v", uint64(0xFFFFFFFFFFFFFFFF), rez, err)
+	}
+	if reading.CalculatedValues["10"] != uint64(0xFFFFFFFFFFFFFFFF) {
+		t.Fatal("Expected the value to be stored in the reading, got", reading.CalculatedValues["10"])
+	}
+}
+
+func TestCalculateUint64ShouldReadingToShort(t *testing.T) {
+	rg, _ := readgroups.ReadGroupUint64{}.NewReadGroup(1, 10)
+	readings := []common.Reading{
+		//the reading ends before the read group
+		common.Reading{Sensor: 1, Type: common.Holding,
+			StartLocation: 9, Count: 4, ReadValues: []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}},
+		//less values were read than the count of the reading
+		common.Reading{Sensor: 1, Type: common.Holding,
+			StartLocation: 10, Count: 4, ReadValues: []uint16{0xFFFF, 0xFFFF, 0xFFFF}},
+		common.Reading{Sensor: 1, Type: common.Holding, StartLocation: 10, Count: 4},
+	}
+	for _, reading := range readings {
+		rez, err := rg.Calculate(&reading)
+		if err == nil {
+			t.Fatal("Expected error because reading too short,", rez)
+		}
+		if rez != nil {
+			t.Fatal("Expected nil response, got", rez)
+		}
+	}
+}
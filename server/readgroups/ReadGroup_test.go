@@ -0,0 +1,67 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateReadingShouldOk(t *testing.T) {
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 100, ResultType: common.Hundredths},
+		common.ReadGroup{StartLocation: 102, ResultType: common.Timestamp},
+		common.ReadGroup{StartLocation: 106, ResultType: common.Uint32},
+		common.ReadGroup{StartLocation: 10, ResultType: common.Uint32},
+	}}
+	reading := common.Reading{Sensor: 1, Type: common.Input,
+		StartLocation: 100, Count: 8, ReadValues: []uint16{0x17, 0x38, 0x07E0, 4, 3, 12, 10, 50}}
+
+	readgroups.Calculate(sensor, &reading)
+	if reading.CalculatedValues["100"] != 23.56 {
+		t.Fatal("Expected 23.56 for the read group at 100, got", reading.CalculatedValues["100"])
+	}
+	if reading.CalculatedValues["102"] != "2016-04-03T12:10:50" {
+		t.Fatal("Expected 2016-04-03T12:10:50 for the read group at 102, got", reading.CalculatedValues["102"])
+	}
+	if reading.CalculatedValues["106"] != uint32(10<<16+50) {
+		t.Fatal("Expected", 10<<16+50, "for the read group at 106, got", reading.CalculatedValues["106"])
+	}
+	if len(reading.CalculatedValues) != 3 || len(reading.CalculateErrors) != 0 {
+		t.Fatalf("Expected the read group at 10 to be skipped, got %v, %v",
+			reading.CalculatedValues, reading.CalculateErrors)
+	}
+}
+
+func TestCalculateReadingShouldRecordErrors(t *testing.T) {
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 100, ResultType: common.Hundredths},
+		common.ReadGroup{StartLocation: 102, ResultType: common.Timestamp},
+		common.ReadGroup{StartLocation: 100, ResultType: "unknown"},
+	}}
+	values := []uint16{0x17, 0x38, 0, 0, 0, 0, 0, 0}
+	reading := common.Reading{Sensor: 1, Type: common.Input,
+		StartLocation: 100, Count: 8, ReadValues: values}
+
+	readgroups.Calculate(sensor, &reading)
+	if reading.CalculatedValues["100"] != 23.56 {
+		t.Fatal("Expected 23.56 for the read group at 100, got", reading.CalculatedValues["100"])
+	}
+	if reading.CalculateErrors["102"] == "" {
+		t.Fatal("Expected an error for the read group at 102, got", reading.CalculateErrors)
+	}
+	if reading.CalculateErrors["100"] == "" {
+		t.Fatal("Expected an error for the unknown read group, got", reading.CalculateErrors)
+	}
+	if len(reading.ReadValues) != len(values) {
+		t.Fatal("Expected the read values to be kept, got", reading.ReadValues)
+	}
+
+	coils := common.Reading{Sensor: 1, Type: common.Coil, StartLocation: 100, Count: 2,
+		ReadValues: []uint16{1, 0}}
+	readgroups.Calculate(sensor, &coils)
+	if len(coils.CalculatedValues) != 0 || len(coils.CalculateErrors) != 0 {
+		t.Fatalf("Expected nothing calculated for coils, got %v, %v",
+			coils.CalculatedValues, coils.CalculateErrors)
+	}
+}
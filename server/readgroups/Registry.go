@@ -0,0 +1,128 @@
+package readgroups
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//registry keeps the workers known for every result type.
+//Each worker is used as a prototype for NewReadGroup
+var registry = struct {
+	sync.RWMutex
+	workers map[string]common.ReadGroupWorker
+}{workers: make(map[string]common.ReadGroupWorker)}
+
+func init() {
+	Register(common.Float32, ReadGroupFloat32{})
+	Register(common.Int32, ReadGroupInt32{})
+	Register(common.Uint32, ReadGroupUint32{})
+	Register(common.Hundredths, ReadGroupHundredths{})
+	Register(common.Timestamp, ReadGroupTimestamp{})
+	Register(common.Int16, ReadGroupInt16{})
+	Register(common.Uint16, ReadGroupUint16{})
+	Register(common.Int64, ReadGroupInt64{})
+	Register(common.Uint64, ReadGroupUint64{})
+	Register(common.Float64, ReadGroupFloat64{})
+	Register(common.BCD, ReadGroupBCD{})
+	Register(common.Bitfield, ReadGroupBitfield{})
+	Register(common.String, ReadGroupString{})
+}
+
+//Register makes worker the one used for the read groups having
+//resultType. A result type can only be registered once
+func Register(resultType string, worker common.ReadGroupWorker) error {
+	if resultType == "" || worker == nil {
+		return fmt.Errorf("Both the result type and the worker are needed")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.workers[resultType]; ok {
+		return fmt.Errorf("Result type %s is already registered", resultType)
+	}
+	registry.workers[resultType] = worker
+	return nil
+}
+
+//IsResultTypeValid returns true if a worker is registered for resultType
+func IsResultTypeValid(resultType string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	_, ok := registry.workers[resultType]
+	return ok
+}
+
+//ResultTypes returns the registered result types, sorted
+func ResultTypes() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	rez := make([]string, 0, len(registry.workers))
+	for resultType := range registry.workers {
+		rez = append(rez, resultType)
+	}
+	sort.Strings(rez)
+	return rez
+}
+
+//NewWorker creates the worker that calculates the value of rg
+func NewWorker(rg common.ReadGroup) (common.ReadGroupWorker, error) {
+	registry.RLock()
+	worker, ok := registry.workers[rg.ResultType]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Result type %s unknown", rg.ResultType)
+	}
+	worker, err := worker.NewReadGroup(rg.SensorAddress, rg.StartLocation)
+	if err != nil {
+		return nil, err
+	}
+	if rg.ByteOrder != "" {
+		setter, ok := worker.(byteOrderSetter)
+		if !ok {
+			return nil, fmt.Errorf("Result type %s has no byte order", rg.ResultType)
+		}
+		if err = setter.SetByteOrder(rg.ByteOrder); err != nil {
+			return nil, err
+		}
+	}
+	if rg.Length != 0 {
+		setter, ok := worker.(lengthSetter)
+		if !ok {
+			return nil, fmt.Errorf("Result type %s has a fixed length", rg.ResultType)
+		}
+		if err = setter.SetLength(rg.Length); err != nil {
+			return nil, err
+		}
+	}
+	return worker, nil
+}
+
+//ValidateReadGroups checks that every read group of sensor
+//has a registered result type and can create its worker
+func ValidateReadGroups(sensor common.Sensor) error {
+	for _, rg := range sensor.ReadGroups {
+		if !IsResultTypeValid(rg.ResultType) {
+			return fmt.Errorf("Result type %s unknown, expected one of %v",
+				rg.ResultType, ResultTypes())
+		}
+		if _, err := NewWorker(rg); err != nil {
+			return err
+		}
+		if rg.Precision != nil && (*rg.Precision < 0 || *rg.Precision > maxPrecision) {
+			return fmt.Errorf("The precision must be between 0 and %d, got %d",
+				maxPrecision, *rg.Precision)
+		}
+		if len(rg.Calibration) != 0 {
+			if err := ValidateCalibration(rg.Calibration); err != nil {
+				return err
+			}
+		}
+		if rg.MinStep < 0 || rg.Settle < 0 {
+			return fmt.Errorf("The minimum step and the settle readings can not be negative, got %v and %d",
+				rg.MinStep, rg.Settle)
+		}
+	}
+	return ValidateTares(sensor)
+}
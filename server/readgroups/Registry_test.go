@@ -0,0 +1,76 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+//readGroupSum is a read group defined outside of the readgroups package
+type readGroupSum struct {
+	common.ReadGroup
+}
+
+func (readGroupSum) NewReadGroup(sensorAddress uint8, startLocation uint16) (common.ReadGroupWorker, error) {
+	return readGroupSum{common.ReadGroup{SensorAddress: sensorAddress,
+		StartLocation: startLocation, ResultType: "sum"}}, nil
+}
+
+func (rgs readGroupSum) RegisterCount() uint16 {
+	return 3
+}
+
+func (rgs readGroupSum) Calculate(reading *common.Reading) (interface{}, error) {
+	poz := rgs.StartLocation - reading.StartLocation
+	x := uint32(0)
+	for _, v := range reading.ReadValues[poz : poz+3] {
+		x += uint32(v)
+	}
+	reading.CalculatedValues["sum"] = x
+	return x, nil
+}
+
+func TestRegistryShouldHaveDefaultTypes(t *testing.T) {
+	for _, resultType := range []string{common.Float32, common.Int32, common.Uint32,
+		common.Hundredths, common.Timestamp, common.Int16, common.Uint16, common.Int64,
+		common.Uint64, common.Float64, common.BCD, common.Bitfield, common.String} {
+		if !readgroups.IsResultTypeValid(resultType) {
+			t.Fatalf("Expected %s to be registered", resultType)
+		}
+		worker, err := readgroups.NewWorker(common.ReadGroup{StartLocation: 10, ResultType: resultType})
+		if err != nil || worker == nil {
+			t.Fatalf("Expected a worker for %s, got %v, %v", resultType, worker, err)
+		}
+	}
+	if readgroups.IsResultTypeValid("unknown") {
+		t.Fatal("Expected unknown not to be registered")
+	}
+	if _, err := readgroups.NewWorker(common.ReadGroup{ResultType: "unknown"}); err == nil {
+		t.Fatal("Expected error when creating a worker for an unknown result type, got nil")
+	}
+	if err := readgroups.Register(common.Float32, readGroupSum{}); err == nil {
+		t.Fatal("Expected error when registering a result type twice, got nil")
+	}
+}
+
+func TestRegistryShouldAcceptNewTypes(t *testing.T) {
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 100, ResultType: "sum"}}}
+	if err := readgroups.ValidateReadGroups(sensor); err == nil {
+		t.Fatal("Expected error when validating a result type not registered, got nil")
+	}
+	if err := readgroups.Register("sum", readGroupSum{}); err != nil {
+		t.Fatalf("No error expected when registering a new result type, got %s", err.Error())
+	}
+	if err := readgroups.ValidateReadGroups(sensor); err != nil {
+		t.Fatalf("No error expected when validating a registered result type, got %s", err.Error())
+	}
+
+	reading := common.Reading{Sensor: 1, Type: common.Holding,
+		StartLocation: 100, Count: 3, ReadValues: []uint16{1, 2, 3}}
+	readgroups.Calculate(sensor, &reading)
+	if reading.CalculatedValues["sum"] != uint32(6) {
+		t.Fatal("Expected 6 calculated by the new read group, got", reading.CalculatedValues)
+	}
+}
@@ -0,0 +1,86 @@
+package readgroups
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//maxPrecision is the maximum number of decimals a value can be rounded to
+const maxPrecision = 10
+
+//isScaled returns true if the value of rg must be calibrated, scaled or rounded
+func isScaled(rg common.ReadGroup) bool {
+	return len(rg.Calibration) != 0 || rg.Scale != 0 || rg.Offset != 0 || rg.Precision != nil
+}
+
+//toFloat64 converts the numeric values calculated by the read groups
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("The value %v is not a number", value)
+}
+
+//CalculatedValue returns the numeric value calculated for
+//the key in reading.CalculatedValues
+func CalculatedValue(reading *common.Reading, key string) (float64, error) {
+	value, ok := reading.CalculatedValues[key]
+	if !ok {
+		if err, ok := reading.CalculateErrors[key]; ok {
+			return 0, fmt.Errorf("No value calculated for %s: %s", key, err)
+		}
+		return 0, fmt.Errorf("No value calculated for %s", key)
+	}
+	return toFloat64(value)
+}
+
+//round rounds value to precision decimals, halves away from zero
+func round(value float64, precision int) float64 {
+	p := math.Pow(10, float64(precision))
+	if value < 0 {
+		return -math.Floor(-value*p+0.5) / p
+	}
+	return math.Floor(value*p+0.5) / p
+}
+
+//applyScale calibrates the value calculated for rg, multiplies it by
+//the scale, adds the offset and rounds the result to the precision of rg.
+//The scaled value is a float64
+func applyScale(rg common.ReadGroup, reading *common.Reading) error {
+	if !isScaled(rg) {
+		return nil
+	}
+	value, err := toFloat64(reading.CalculatedValues[rg.Key()])
+	if err != nil {
+		return fmt.Errorf("Could not scale the value: %s", err.Error())
+	}
+	if len(rg.Calibration) != 0 {
+		value = calibrate(rg.Calibration, value)
+	}
+	if rg.Scale != 0 {
+		value *= rg.Scale
+	}
+	value += rg.Offset
+	if rg.Precision != nil {
+		value = round(value, *rg.Precision)
+	}
+	reading.CalculatedValues[rg.Key()] = value
+	return nil
+}
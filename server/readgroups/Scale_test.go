@@ -0,0 +1,57 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func TestCalculateScaleShouldOk(t *testing.T) {
+	precision := 2
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 10, ResultType: common.Int32,
+			Scale: 0.001, Offset: -1.5, Precision: &precision, Unit: "kg"},
+		common.ReadGroup{StartLocation: 12, ResultType: common.Uint16, Unit: "g"},
+		common.ReadGroup{StartLocation: 13, ResultType: common.Int16, Scale: -0.5},
+	}}
+	reading := common.Reading{Sensor: 1, Type: common.Holding, StartLocation: 10, Count: 4,
+		ReadValues: []uint16{0x0001, 0xE240, 250, 0xFFF6}}
+
+	readgroups.Calculate(sensor, &reading)
+	//123456 * 0.001 - 1.5 = 121.956
+	if reading.CalculatedValues["10"] != 121.96 || reading.Units["10"] != "kg" {
+		t.Fatalf("Expected 121.96 kg, got %v %s", reading.CalculatedValues["10"], reading.Units["10"])
+	}
+	if reading.CalculatedValues["12"] != uint16(250) || reading.Units["12"] != "g" {
+		t.Fatalf("Expected the unscaled value 250 g, got %v %s", reading.CalculatedValues["12"], reading.Units["12"])
+	}
+	if reading.CalculatedValues["13"] != 5.0 {
+		t.Fatalf("Expected 5, got %v", reading.CalculatedValues["13"])
+	}
+	if len(reading.CalculateErrors) != 0 {
+		t.Fatal("Expected no errors, got", reading.CalculateErrors)
+	}
+}
+
+func TestCalculateScaleShouldFail(t *testing.T) {
+	precision := 11
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 10, ResultType: common.String, Length: 1, Scale: 2},
+	}}
+	reading := common.Reading{Sensor: 1, Type: common.Holding, StartLocation: 10, Count: 1,
+		ReadValues: []uint16{0x4142}}
+	readgroups.Calculate(sensor, &reading)
+	if reading.CalculateErrors["10"] == "" {
+		t.Fatal("Expected an error when scaling a string, got", reading.CalculatedValues)
+	}
+	if _, ok := reading.CalculatedValues["10"]; ok {
+		t.Fatal("Expected the value that could not be scaled to be removed, got", reading.CalculatedValues)
+	}
+
+	sensor.ReadGroups = []common.ReadGroup{common.ReadGroup{StartLocation: 10,
+		ResultType: common.Int16, Precision: &precision}}
+	if err := readgroups.ValidateReadGroups(sensor); err == nil {
+		t.Fatal("Expected error when validating a precision of 11 decimals, got nil")
+	}
+}
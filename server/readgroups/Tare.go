@@ -0,0 +1,100 @@
+package readgroups
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//bySince sorts the tares by the time since they are used
+type bySince []common.Tare
+
+func (tares bySince) Len() int           { return len(tares) }
+func (tares bySince) Swap(i, j int)      { tares[i], tares[j] = tares[j], tares[i] }
+func (tares bySince) Less(i, j int) bool { return tares[i].Since < tares[j].Since }
+
+//ValidateTares checks that every tare of sensor is set on one of its
+//read groups and has a valid time
+func ValidateTares(sensor common.Sensor) error {
+	for _, tare := range sensor.Tares {
+		found := false
+		for _, rg := range sensor.ReadGroups {
+			if rg.StartLocation == tare.StartLocation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("The tare is set on read group %d that is not configured", tare.StartLocation)
+		}
+		if _, err := time.Parse(common.TimeFormat, tare.Since); err != nil {
+			return fmt.Errorf("Invalid time of the tare on read group %d: %s", tare.StartLocation, err.Error())
+		}
+	}
+	return nil
+}
+
+//SortTares sorts tares by the time since they are used, as TareAt expects.
+//Tares used since the same time keep their order
+func SortTares(tares []common.Tare) {
+	sort.Stable(bySince(tares))
+}
+
+//AddTare adds tare to the tares of sensor. If tare.Since is not set,
+//the tare is used from now on. The previous tares are kept so that the
+//values read before tare.Since keep their net values
+func AddTare(sensor *common.Sensor, tare common.Tare) error {
+	if tare.Since == "" {
+		tare.Since = time.Now().Format(common.TimeFormat)
+	}
+	tares := append(append([]common.Tare{}, sensor.Tares...), tare)
+	SortTares(tares)
+	withTare := *sensor
+	withTare.Tares = tares
+	if err := ValidateTares(withTare); err != nil {
+		return err
+	}
+	sensor.Tares = tares
+	return nil
+}
+
+//TareAt returns the tare of the read group starting at startLocation used
+//at the time at (in common.TimeFormat) or nil if no tare was set by then.
+//If at is empty, the last tare is returned
+func TareAt(sensor common.Sensor, startLocation uint16, at string) *common.Tare {
+	var rez *common.Tare
+	for i, tare := range sensor.Tares {
+		if tare.StartLocation != startLocation {
+			continue
+		}
+		if at != "" && tare.Since > at {
+			break
+		}
+		rez = &sensor.Tares[i]
+	}
+	return rez
+}
+
+//applyTare stores the net value of rg, the calculated value without the tare
+//used at the time of reading. The net value is rounded like the calculated value
+func applyTare(sensor common.Sensor, rg common.ReadGroup, reading *common.Reading) error {
+	tare := TareAt(sensor, rg.StartLocation, reading.Time)
+	if tare == nil {
+		return nil
+	}
+	value, err := toFloat64(reading.CalculatedValues[rg.Key()])
+	if err != nil {
+		return fmt.Errorf("Could not subtract the tare: %s", err.Error())
+	}
+	value -= tare.Value
+	if rg.Precision != nil {
+		value = round(value, *rg.Precision)
+	}
+	reading.CalculatedValues[rg.NetKey()] = value
+	if rg.Unit != "" {
+		reading.Units[rg.NetKey()] = rg.Unit
+	}
+	return nil
+}
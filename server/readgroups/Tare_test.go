@@ -0,0 +1,83 @@
+package readgroups_test
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+func newTaredSensorForTest(t *testing.T) common.Sensor {
+	precision := 2
+	sensor := common.Sensor{Address: 1, ReadGroups: []common.ReadGroup{
+		common.ReadGroup{StartLocation: 100, ResultType: common.Uint16, Scale: 0.01,
+			Precision: &precision, Unit: "kg"}}}
+	tares := []common.Tare{
+		common.Tare{StartLocation: 100, Value: 12.5, Since: "2016-05-01T00:00:00"},
+		common.Tare{StartLocation: 100, Value: 10, Since: "2016-04-01T00:00:00", Description: "empty barrel"},
+	}
+	for _, tare := range tares {
+		if err := readgroups.AddTare(&sensor, tare); err != nil {
+			t.Fatalf("No error expected when adding a tare, got %s", err.Error())
+		}
+	}
+	return sensor
+}
+
+func TestAddTareShouldOk(t *testing.T) {
+	sensor := newTaredSensorForTest(t)
+	if len(sensor.Tares) != 2 || sensor.Tares[0].Value != 10 || sensor.Tares[1].Value != 12.5 {
+		t.Fatalf("Expected the tares to be sorted by time, got %v", sensor.Tares)
+	}
+	if err := readgroups.AddTare(&sensor, common.Tare{StartLocation: 100, Value: 11}); err != nil {
+		t.Fatalf("No error expected when adding a tare from now on, got %s", err.Error())
+	}
+	if tare := readgroups.TareAt(sensor, 100, ""); tare == nil || tare.Value != 11 || tare.Since == "" {
+		t.Fatalf("Expected the tare added now to be the last, got %v", tare)
+	}
+	if err := readgroups.ValidateReadGroups(sensor); err != nil {
+		t.Fatalf("No error expected when validating the sensor, got %s", err.Error())
+	}
+}
+
+func TestAddTareShouldFail(t *testing.T) {
+	sensor := newTaredSensorForTest(t)
+	if err := readgroups.AddTare(&sensor, common.Tare{StartLocation: 102, Value: 1}); err == nil {
+		t.Fatal("Expected error when adding a tare to a missing read group, got nil")
+	}
+	if err := readgroups.AddTare(&sensor, common.Tare{StartLocation: 100, Since: "yesterday"}); err == nil {
+		t.Fatal("Expected error when adding a tare with an invalid time, got nil")
+	}
+	if len(sensor.Tares) != 2 {
+		t.Fatalf("Expected the tares not to change on error, got %v", sensor.Tares)
+	}
+}
+
+var tareTests = []struct {
+	time     string
+	expected interface{}
+}{
+	{"2016-03-15T10:00:00", nil},
+	{"2016-04-01T00:00:00", 40.0},
+	{"2016-04-20T10:00:00", 40.0},
+	{"2016-05-02T10:00:00", 37.5},
+}
+
+func TestCalculateNetValue(t *testing.T) {
+	sensor := newTaredSensorForTest(t)
+	for _, test := range tareTests {
+		reading := common.Reading{Sensor: 1, Type: common.Input, StartLocation: 100, Count: 1,
+			ReadValues: []uint16{5000}, Time: test.time}
+		readgroups.Calculate(sensor, &reading)
+		if reading.CalculatedValues["100"] != 50.0 {
+			t.Fatalf("Expected the gross value 50, got %v", reading.CalculatedValues["100"])
+		}
+		if reading.CalculatedValues["100.net"] != test.expected {
+			t.Fatalf("Expected the net value %v at %s, got %v", test.expected, test.time,
+				reading.CalculatedValues["100.net"])
+		}
+		if test.expected != nil && reading.Units["100.net"] != "kg" {
+			t.Fatalf("Expected the net value in kg, got %v", reading.Units)
+		}
+	}
+}
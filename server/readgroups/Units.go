@@ -0,0 +1,71 @@
+package readgroups
+
+import (
+	"fmt"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+//unit is an engineering unit that can be converted to the
+//other units of the same quantity
+type unit struct {
+	quantity string
+	//factor converts a value in this unit to the base unit of the quantity
+	factor float64
+}
+
+//units are the units known for conversion. The base
+//unit of the mass is the gram and of the volume the millilitre
+var units = map[string]unit{
+	"g":  unit{quantity: "mass", factor: 1},
+	"kg": unit{quantity: "mass", factor: 1000},
+	"lb": unit{quantity: "mass", factor: 453.59237},
+	"ml": unit{quantity: "volume", factor: 1},
+	"l":  unit{quantity: "volume", factor: 1000},
+}
+
+//IsUnitKnown returns true if values can be converted to and from unitName
+func IsUnitKnown(unitName string) bool {
+	_, ok := units[unitName]
+	return ok
+}
+
+//ConvertUnit converts value from the unit from to the unit to
+func ConvertUnit(value float64, from string, to string) (float64, error) {
+	fromUnit, ok := units[from]
+	if !ok {
+		return 0, fmt.Errorf("Unit %s unknown", from)
+	}
+	toUnit, ok := units[to]
+	if !ok {
+		return 0, fmt.Errorf("Unit %s unknown", to)
+	}
+	if fromUnit.quantity != toUnit.quantity {
+		return 0, fmt.Errorf("Can not convert %s (%s) to %s (%s)",
+			from, fromUnit.quantity, to, toUnit.quantity)
+	}
+	return value * fromUnit.factor / toUnit.factor, nil
+}
+
+//ConvertReading converts to the unit to the calculated values of reading
+//having a unit of the same quantity. The other values are not changed
+func ConvertReading(reading *common.Reading, to string) error {
+	if !IsUnitKnown(to) {
+		return fmt.Errorf("Unit %s unknown", to)
+	}
+	for key, from := range reading.Units {
+		if from == to || !IsUnitKnown(from) || units[from].quantity != units[to].quantity {
+			continue
+		}
+		value, err := toFloat64(reading.CalculatedValues[key])
+		if err != nil {
+			continue
+		}
+		if value, err = ConvertUnit(value, from, to); err != nil {
+			return err
+		}
+		reading.CalculatedValues[key] = value
+		reading.Units[key] = to
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package readgroups_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+var unitTests = []struct {
+	value    float64
+	from     string
+	to       string
+	expected float64
+}{
+	{1500, "g", "kg", 1.5},
+	{1.5, "kg", "g", 1500},
+	{1, "lb", "g", 453.59237},
+	{2, "kg", "lb", 4.40924524},
+	{250, "ml", "l", 0.25},
+	{0.25, "l", "ml", 250},
+	{3, "kg", "kg", 3},
+}
+
+func TestConvertUnitShouldOk(t *testing.T) {
+	for _, test := range unitTests {
+		rez, err := readgroups.ConvertUnit(test.value, test.from, test.to)
+		if err != nil {
+			t.Fatalf("No error expected when converting %s to %s, got %s", test.from, test.to, err.Error())
+		}
+		if math.Abs(rez-test.expected) > 1e-6 {
+			t.Fatalf("Expected %v %s for %v %s, got %v", test.expected, test.to, test.value, test.from, rez)
+		}
+	}
+}
+
+func TestConvertUnitShouldFail(t *testing.T) {
+	if _, err := readgroups.ConvertUnit(1, "kg", "l"); err == nil {
+		t.Fatal("Expected error when converting a mass to a volume, got nil")
+	}
+	if _, err := readgroups.ConvertUnit(1, "oz", "g"); err == nil {
+		t.Fatal("Expected error when converting an unknown unit, got nil")
+	}
+}
+
+func TestConvertReading(t *testing.T) {
+	reading := common.Reading{CalculatedValues: map[string]interface{}{
+		"10": 1.25, "12": uint16(500), "14": 2.0, "16": "text"},
+		Units: map[string]string{"10": "kg", "12": "g", "14": "l", "16": "kg"}}
+
+	if err := readgroups.ConvertReading(&reading, "g"); err != nil {
+		t.Fatalf("No error expected when converting to g, got %s", err.Error())
+	}
+	if reading.CalculatedValues["10"] != 1250.0 || reading.Units["10"] != "g" {
+		t.Fatalf("Expected 1250 g, got %v %s", reading.CalculatedValues["10"], reading.Units["10"])
+	}
+	if reading.CalculatedValues["12"] != uint16(500) || reading.Units["12"] != "g" {
+		t.Fatalf("Expected 500 g unchanged, got %v %s", reading.CalculatedValues["12"], reading.Units["12"])
+	}
+	if reading.CalculatedValues["14"] != 2.0 || reading.Units["14"] != "l" {
+		t.Fatalf("Expected the volume to be kept, got %v %s", reading.CalculatedValues["14"], reading.Units["14"])
+	}
+	if reading.CalculatedValues["16"] != "text" {
+		t.Fatalf("Expected the text to be kept, got %v", reading.CalculatedValues["16"])
+	}
+	if err := readgroups.ConvertReading(&reading, "stone"); err == nil {
+		t.Fatal("Expected error when converting to an unknown unit, got nil")
+	}
+}
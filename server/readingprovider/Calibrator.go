@@ -0,0 +1,161 @@
+package readingprovider
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+//CalibrationSession collects the calibration points of the read group
+//starting at StartLocation on a sensor. Every point pairs the raw value
+//read from the sensor with the known value put on it
+type CalibrationSession struct {
+	ID            int                       `json:"id"`
+	Bus           string                    `json:"bus"`
+	Sensor        uint8                     `json:"sensor"`
+	StartLocation uint16                    `json:"startLocation"`
+	Started       string                    `json:"started"`
+	Points        []common.CalibrationPoint `json:"points"`
+}
+
+//Calibrator keeps the calibration sessions in progress. The raw values are
+//read through the buses of the schedule provider and the fitted calibration
+//is saved on the read group of the sensor in the config provider
+type Calibrator struct {
+	configProvider *configprovider.ConfigProvider
+	schProvider    *ScheduleProvider
+	sessions       map[int]*CalibrationSession
+	nextID         int
+	mutex          *sync.Mutex
+}
+
+//NewCalibrator returns a Calibrator that reads the sensors through
+//schProvider and saves the calibrations in cp
+func (Calibrator) NewCalibrator(cp *configprovider.ConfigProvider, schProvider *ScheduleProvider) *Calibrator {
+	return &Calibrator{configProvider: cp, schProvider: schProvider,
+		sessions: make(map[int]*CalibrationSession), nextID: 1, mutex: &sync.Mutex{}}
+}
+
+//readGroup returns the sensor having address on bus and
+//its read group starting at startLocation
+func (calibrator *Calibrator) readGroup(bus string, address uint8, startLocation uint16) (*common.Sensor, int, error) {
+	sensor, err := (*calibrator.configProvider).GetSensorByAddress(bus, address)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, rg := range sensor.ReadGroups {
+		if rg.StartLocation == startLocation {
+			return sensor, i, nil
+		}
+	}
+	err = fmt.Errorf("The sensor %d has no read group starting at %d", address, startLocation)
+	log.Println(err.Error())
+	return nil, 0, err
+}
+
+//Start begins a new calibration of the read group starting at
+//startLocation on the sensor having address on bus
+func (calibrator *Calibrator) Start(bus string, address uint8, startLocation uint16) (*CalibrationSession, error) {
+	bus = common.BusName(bus)
+	sensor, i, err := calibrator.readGroup(bus, address, startLocation)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = readgroups.NewWorker(sensor.ReadGroups[i]); err != nil {
+		return nil, err
+	}
+
+	calibrator.mutex.Lock()
+	defer calibrator.mutex.Unlock()
+	session := &CalibrationSession{ID: calibrator.nextID, Bus: bus, Sensor: address,
+		StartLocation: startLocation, Started: time.Now().Format(common.TimeFormat),
+		Points: []common.CalibrationPoint{}}
+	calibrator.sessions[session.ID] = session
+	calibrator.nextID++
+	return session, nil
+}
+
+//GetSession returns a copy of the calibration session having the id
+func (calibrator *Calibrator) GetSession(id int) (*CalibrationSession, error) {
+	calibrator.mutex.Lock()
+	defer calibrator.mutex.Unlock()
+	session, ok := calibrator.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("No calibration session with id %d", id)
+	}
+	sessionCopy := *session
+	sessionCopy.Points = append([]common.CalibrationPoint{}, session.Points...)
+	return &sessionCopy, nil
+}
+
+//AddPoint reads the raw value of the read group being calibrated and
+//records it as corresponding to value
+func (calibrator *Calibrator) AddPoint(id int, value float64) (*common.CalibrationPoint, error) {
+	session, err := calibrator.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	sensor, i, err := calibrator.readGroup(session.Bus, session.Sensor, session.StartLocation)
+	if err != nil {
+		return nil, err
+	}
+	reading, err := calibrator.schProvider.ReadReadGroup(session.Bus, session.Sensor, session.StartLocation)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readgroups.RawValue(sensor.ReadGroups[i], reading)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	point := common.CalibrationPoint{Raw: raw, Value: value}
+	calibrator.mutex.Lock()
+	defer calibrator.mutex.Unlock()
+	if current, ok := calibrator.sessions[id]; ok {
+		current.Points = append(current.Points, point)
+		return &point, nil
+	}
+	return nil, fmt.Errorf("No calibration session with id %d", id)
+}
+
+//Commit fits the calibration through the points of the session, saves it
+//on the read group of the sensor and ends the session
+func (calibrator *Calibrator) Commit(id int) (*common.ReadGroup, error) {
+	session, err := calibrator.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	points, err := readgroups.FitCalibration(session.Points)
+	if err != nil {
+		return nil, err
+	}
+	rg, err := (*calibrator.configProvider).SetReadGroupCalibration(session.Bus, session.Sensor,
+		session.StartLocation, points)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Calibrated read group %d of sensor %d on bus %s with %d points\n",
+		session.StartLocation, session.Sensor, session.Bus, len(points))
+
+	calibrator.mutex.Lock()
+	delete(calibrator.sessions, id)
+	calibrator.mutex.Unlock()
+	return rg, nil
+}
+
+//Cancel ends the calibration session having the id without saving it
+func (calibrator *Calibrator) Cancel(id int) error {
+	calibrator.mutex.Lock()
+	defer calibrator.mutex.Unlock()
+	if _, ok := calibrator.sessions[id]; !ok {
+		return fmt.Errorf("No calibration session with id %d", id)
+	}
+	delete(calibrator.sessions, id)
+	return nil
+}
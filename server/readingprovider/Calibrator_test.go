@@ -0,0 +1,108 @@
+package readingprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+)
+
+func newCalibratorForTest(t *testing.T, slave *testSlave) (configprovider.ConfigProvider, *Calibrator) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(1, 32)
+	err := cp.SetBus(common.BusConfig{Name: "line1", Transport: common.TCP,
+		Address: slave.Address(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("No error expected when setting the bus config, got %s", err.Error())
+	}
+	err = cp.AddSensor(common.Sensor{Bus: "line1", Address: 3,
+		Registers: []common.Register{common.Register{Location: 100, Type: common.Input}},
+		ReadGroups: []common.ReadGroup{
+			common.ReadGroup{StartLocation: 100, ResultType: common.Uint16, Unit: "g"}}})
+	if err != nil {
+		t.Fatalf("No error expected when adding the sensor, got %s", err.Error())
+	}
+	rp := ModBUSReadingProvider{}.NewReadingProvider(&cp, "line1")
+	schProvider := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
+	return cp, Calibrator{}.NewCalibrator(&cp, schProvider)
+}
+
+func TestCalibrationShouldOk(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+
+	cp, calibrator := newCalibratorForTest(t, slave)
+	session, err := calibrator.Start("line1", 3, 100)
+	if err != nil {
+		t.Fatalf("No error expected when starting the calibration, got %s", err.Error())
+	}
+
+	points := []common.CalibrationPoint{
+		common.CalibrationPoint{Raw: 1000, Value: 0},
+		common.CalibrationPoint{Raw: 5000, Value: 500},
+		common.CalibrationPoint{Raw: 9000, Value: 1000}}
+	for _, point := range points {
+		slave.SetInput(3, 100, uint16(point.Raw))
+		added, err := calibrator.AddPoint(session.ID, point.Value)
+		if err != nil {
+			t.Fatalf("No error expected when adding a point, got %s", err.Error())
+		}
+		if *added != point {
+			t.Fatalf("Expected %v, got %v", point, *added)
+		}
+	}
+
+	rg, err := calibrator.Commit(session.ID)
+	if err != nil {
+		t.Fatalf("No error expected when committing the calibration, got %s", err.Error())
+	}
+	if len(rg.Calibration) != 3 {
+		t.Fatalf("Expected 3 calibration points, got %v", rg.Calibration)
+	}
+	sensor, _ := cp.GetSensorByAddress("line1", 3)
+	if len(sensor.ReadGroups[0].Calibration) != 3 {
+		t.Fatalf("Expected the calibration to be saved, got %v", sensor.ReadGroups[0])
+	}
+	if _, err = calibrator.GetSession(session.ID); err == nil {
+		t.Fatal("Expected the session to end after commit")
+	}
+
+	slave.SetInput(3, 100, 7000)
+	reading, err := calibrator.schProvider.ReadReadGroup("line1", 3, 100)
+	if err != nil {
+		t.Fatalf("No error expected when reading, got %s", err.Error())
+	}
+	if reading.CalculatedValues["100"] != 750.0 {
+		t.Fatalf("Expected the calibrated value 750, got %v", reading.CalculatedValues["100"])
+	}
+}
+
+func TestCalibrationShouldFail(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+
+	_, calibrator := newCalibratorForTest(t, slave)
+	if _, err := calibrator.Start("line1", 3, 101); err == nil {
+		t.Fatal("Expected error when calibrating a missing read group, got nil")
+	}
+	if _, err := calibrator.Start("line1", 4, 100); err == nil {
+		t.Fatal("Expected error when calibrating a missing sensor, got nil")
+	}
+	if _, err := calibrator.AddPoint(10, 1); err == nil {
+		t.Fatal("Expected error when adding a point to a missing session, got nil")
+	}
+
+	session, _ := calibrator.Start("line1", 3, 100)
+	slave.SetInput(3, 100, 1000)
+	calibrator.AddPoint(session.ID, 0)
+	if _, err := calibrator.Commit(session.ID); err == nil {
+		t.Fatal("Expected error when committing a single point, got nil")
+	}
+	if err := calibrator.Cancel(session.ID); err != nil {
+		t.Fatalf("No error expected when canceling the session, got %s", err.Error())
+	}
+	if err := calibrator.Cancel(session.ID); err == nil {
+		t.Fatal("Expected error when canceling a missing session, got nil")
+	}
+}
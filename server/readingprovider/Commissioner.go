@@ -0,0 +1,110 @@
+package readingprovider
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+)
+
+//Commissioner gives an address to the new sensors found on a bus.
+//A new sensor answers at common.NewSensorAddress until the server writes
+//its address in the holding register common.AddressRegister
+type Commissioner struct {
+	configProvider *configprovider.ConfigProvider
+	schProvider    *ScheduleProvider
+}
+
+//NewCommissioner returns a Commissioner that registers the sensors in cp
+//and talks to them through the buses of schProvider
+func (Commissioner) NewCommissioner(cp *configprovider.ConfigProvider, schProvider *ScheduleProvider) *Commissioner {
+	return &Commissioner{configProvider: cp, schProvider: schProvider}
+}
+
+//NextFreeAddress returns the lowest address on bus that is inside the
+//address limits of the config provider and is not taken by a sensor
+func (commissioner *Commissioner) NextFreeAddress(bus string) (uint8, error) {
+	minAddress, maxAddress := (*commissioner.configProvider).GetAddressLimits()
+	if minAddress == 0 {
+		minAddress = 1
+	}
+	for address := int(minAddress); address <= int(maxAddress); address++ {
+		if uint8(address) == common.NewSensorAddress {
+			continue
+		}
+		taken, err := (*commissioner.configProvider).IsSensorAddressTaken(bus, uint8(address))
+		if err != nil {
+			return 0, err
+		}
+		if !taken {
+			return uint8(address), nil
+		}
+	}
+	return 0, fmt.Errorf("No free address between %d and %d on bus %s",
+		minAddress, maxAddress, common.BusName(bus))
+}
+
+//Commission looks for a new sensor on sensor.Bus, writes its new address and
+//verifies it by reading it back from the sensor. The sensor is then
+//registered in the config provider. If sensor.Address is 0 the next free
+//address is used. If sensor has no registers, the address register and the
+//two weight registers are configured
+func (commissioner *Commissioner) Commission(sensor common.Sensor) (*common.Sensor, error) {
+	var err error
+	sensor.Bus = common.BusName(sensor.Bus)
+	if sensor.Address == 0 {
+		if sensor.Address, err = commissioner.NextFreeAddress(sensor.Bus); err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+	} else if sensor.Address == common.NewSensorAddress {
+		return nil, fmt.Errorf("The address %d is reserved for new sensors", common.NewSensorAddress)
+	}
+	if len(sensor.Registers) == 0 {
+		sensor.Registers = []common.Register{
+			common.Register{Name: "address", Location: common.AddressRegister, Type: common.Holding},
+			common.Register{Name: "weight", Location: 100, Type: common.Input},
+			common.Register{Name: "weight decimals", Location: 101, Type: common.Input}}
+	}
+	if err = (*commissioner.configProvider).IsSensorValid(sensor); err != nil {
+		return nil, err
+	}
+	taken, err := (*commissioner.configProvider).IsSensorAddressTaken(sensor.Bus, sensor.Address)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("The address %d is already taken on bus %s", sensor.Address, sensor.Bus)
+	}
+
+	err = commissioner.schProvider.useBus(sensor.Bus, func(readingProvider ReadingProvider) error {
+		_, err := readingProvider.GetReading(common.NewSensorAddress, common.Holding, common.AddressRegister, 1)
+		if err != nil {
+			return fmt.Errorf("No new sensor answers at address %d on bus %s: %s",
+				common.NewSensorAddress, sensor.Bus, err.Error())
+		}
+		err = readingProvider.WriteRegister(common.NewSensorAddress, common.AddressRegister, uint16(sensor.Address))
+		if err != nil {
+			return fmt.Errorf("Could not write address %d to the new sensor: %s", sensor.Address, err.Error())
+		}
+		reading, err := readingProvider.GetReading(sensor.Address, common.Holding, common.AddressRegister, 1)
+		if err != nil {
+			return fmt.Errorf("The sensor does not answer at address %d: %s", sensor.Address, err.Error())
+		}
+		if len(reading.ReadValues) != 1 || reading.ReadValues[0] != uint16(sensor.Address) {
+			return fmt.Errorf("The sensor at address %d reports address %v", sensor.Address, reading.ReadValues)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	log.Printf("Commissioned sensor %d on bus %s\n", sensor.Address, sensor.Bus)
+	if err = (*commissioner.configProvider).AddSensor(sensor); err != nil {
+		return nil, err
+	}
+	return &sensor, nil
+}
@@ -0,0 +1,88 @@
+package readingprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+)
+
+func newCommissionerForTest(t *testing.T, slave *testSlave) (configprovider.ConfigProvider, *Commissioner) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(1, 32)
+	err := cp.SetBus(common.BusConfig{Name: "line1", Transport: common.RTUOverTCP,
+		Address: slave.Address(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("No error expected when setting the bus config, got %s", err.Error())
+	}
+	rp := ModBUSReadingProvider{}.NewReadingProvider(&cp, "line1")
+	schProvider := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
+	return cp, Commissioner{}.NewCommissioner(&cp, schProvider)
+}
+
+func TestCommissionShouldOk(t *testing.T) {
+	slave := newTestSlave(t, true)
+	defer slave.Close()
+	slave.SetHolding(common.NewSensorAddress, common.AddressRegister, uint16(common.NewSensorAddress))
+	slave.SetAddressRegister(common.AddressRegister)
+
+	cp, commissioner := newCommissionerForTest(t, slave)
+	cp.AddSensor(common.Sensor{Bus: "line1", Address: 1, Registers: []common.Register{
+		common.Register{Location: 100, Type: common.Input}}})
+
+	sensor, err := commissioner.Commission(common.Sensor{Bus: "line1", Description: "new scale"})
+	if err != nil {
+		t.Fatalf("No error expected when commissioning a new sensor, got %s", err.Error())
+	}
+	if sensor.Address != 2 {
+		t.Fatalf("Expected the first free address 2, got %d", sensor.Address)
+	}
+	if slave.Holding(2, common.AddressRegister) != 2 {
+		t.Fatalf("Expected the sensor to have address 2 in register %d, got %d",
+			common.AddressRegister, slave.Holding(2, common.AddressRegister))
+	}
+	sensorBack, err := cp.GetSensorByAddress("line1", 2)
+	if err != nil || sensorBack.Description != "new scale" || len(sensorBack.Registers) == 0 {
+		t.Fatalf("Expected the sensor to be registered with the default registers, got %v, %v", sensorBack, err)
+	}
+
+	if _, err = commissioner.Commission(common.Sensor{Bus: "line1"}); err == nil {
+		t.Fatal("Expected error when no new sensor answers at address 100, got nil")
+	}
+	if taken, _ := cp.IsSensorAddressTaken("line1", 3); taken {
+		t.Fatal("Expected no sensor to be registered when commissioning fails")
+	}
+}
+
+func TestCommissionShouldFail(t *testing.T) {
+	slave := newTestSlave(t, true)
+	defer slave.Close()
+	slave.SetHolding(common.NewSensorAddress, common.AddressRegister, uint16(common.NewSensorAddress))
+
+	cp, commissioner := newCommissionerForTest(t, slave)
+	cp.AddSensor(common.Sensor{Bus: "line1", Address: 5, Registers: []common.Register{
+		common.Register{Location: 100, Type: common.Input}}})
+
+	if _, err := commissioner.Commission(common.Sensor{Bus: "line1", Address: 5}); err == nil {
+		t.Fatal("Expected error when commissioning on an address already taken, got nil")
+	}
+	if _, err := commissioner.Commission(common.Sensor{Bus: "line1", Address: 40}); err == nil {
+		t.Fatal("Expected error when commissioning outside the address limits, got nil")
+	}
+	if _, err := commissioner.Commission(common.Sensor{Bus: "line2"}); err == nil {
+		t.Fatal("Expected error when commissioning on an unknown bus, got nil")
+	}
+	//the slave keeps answering at 100, so the address read back is wrong
+	if _, err := commissioner.Commission(common.Sensor{Bus: "line1", Address: 6}); err == nil {
+		t.Fatal("Expected error when the new address can not be verified, got nil")
+	}
+	if taken, _ := cp.IsSensorAddressTaken("line1", 6); taken {
+		t.Fatal("Expected no sensor to be registered when the verification fails")
+	}
+
+	cp.SetAddressLimits(5, 5)
+	if _, err := commissioner.NextFreeAddress("line1"); err == nil {
+		t.Fatal("Expected error when there is no free address, got nil")
+	}
+}
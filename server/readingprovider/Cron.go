@@ -0,0 +1,209 @@
+package readingprovider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//maxCronYears is how far ahead the next run of a cron schedule is looked for
+const maxCronYears = 5
+
+//cronField is the range of the values of a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	cronField{"minute", 0, 59},
+	cronField{"hour", 0, 23},
+	cronField{"day of month", 1, 31},
+	cronField{"month", 1, 12},
+	cronField{"day of week", 0, 7},
+}
+
+//cronDescriptors are the shortcuts accepted instead of the five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+//cronExpression keeps the values matched by every field of a cron
+//expression as bits. As in cron, when both the day of month and the day
+//of week are restricted a day matching either of them is matched
+type cronExpression struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+//CronSchedule is one or more cron expressions separated by ";" evaluated
+//in a time zone. The next run is the earliest run of the expressions
+type CronSchedule struct {
+	expressions []cronExpression
+	location    *time.Location
+}
+
+//ParseCron parses spec, one or more cron expressions separated by ";",
+//to be evaluated in the time zone having name timezone (the local one if
+//empty). Every expression has the five fields minute, hour, day of month,
+//month and day of week. A field is *, a value, a range a-b or a list of
+//them separated by commas, each optionally followed by /step. The
+//descriptors @hourly, @daily, @weekly, @monthly and @yearly are also accepted
+func ParseCron(spec string, timezone string) (*CronSchedule, error) {
+	schedule := &CronSchedule{location: time.Local}
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown time zone %s: %s", timezone, err.Error())
+		}
+		schedule.location = location
+	}
+	for _, text := range strings.Split(spec, ";") {
+		text = strings.TrimSpace(text)
+		if descriptor, ok := cronDescriptors[text]; ok {
+			text = descriptor
+		}
+		expression, err := parseCronExpression(text)
+		if err != nil {
+			return nil, err
+		}
+		schedule.expressions = append(schedule.expressions, *expression)
+	}
+	return schedule, nil
+}
+
+func parseCronExpression(text string) (*cronExpression, error) {
+	fields := strings.Fields(text)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("The cron expression %q must have %d fields, got %d", text, len(cronFields), len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("Invalid %s in the cron expression %q: %s", cronFields[i].name, text, err.Error())
+		}
+	}
+	//Sunday is either 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronExpression{minutes: bits[0], hours: bits[1], days: bits[2], months: bits[3],
+		weekdays: bits[4], anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}, nil
+}
+
+//parseCronField returns the bits of the values of field matched by text
+func parseCronField(text string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(text, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[slash+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", part[slash+1:])
+			}
+			part = part[:slash]
+		}
+		low, high := field.min, field.max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				//a/step goes from a to the end of the range
+				high = field.max
+			}
+		}
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, field.min, field.max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, value int) bool {
+	return bits&(1<<uint(value)) != 0
+}
+
+//matchesDay returns true if the day of t is matched by the expression
+func (expression cronExpression) matchesDay(t time.Time) bool {
+	day := has(expression.days, t.Day())
+	weekday := has(expression.weekdays, int(t.Weekday()))
+	if expression.anyDay || expression.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+//startOfDay returns the first minute of the day in location. The day
+//starts later than midnight when the clocks go forward at midnight
+func startOfDay(year int, month time.Month, day int, location *time.Location) time.Time {
+	noon := time.Date(year, month, day, 12, 0, 0, 0, location)
+	t := time.Date(noon.Year(), noon.Month(), noon.Day(), 0, 0, 0, 0, location)
+	for t.Day() != noon.Day() {
+		t = t.Add(time.Minute)
+	}
+	return t
+}
+
+//next returns the first time after t matched by the expression. The time
+//jumps over the months, days and hours not matched, so the number of
+//steps does not depend on how far the next run is
+func (expression cronExpression) next(t time.Time) (time.Time, bool) {
+	location := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + maxCronYears
+	for t.Year() <= limit {
+		if !has(expression.months, int(t.Month())) {
+			t = startOfDay(t.Year(), t.Month()+1, 1, location)
+			continue
+		}
+		if !expression.matchesDay(t) {
+			t = startOfDay(t.Year(), t.Month(), t.Day()+1, location)
+			continue
+		}
+		if !has(expression.hours, t.Hour()) {
+			//the hour is left in absolute time, as when the clocks go back
+			//the same local hour comes twice
+			t = t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+			continue
+		}
+		if !has(expression.minutes, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+//Next returns the first run of the schedule after t
+func (schedule *CronSchedule) Next(t time.Time) (time.Time, error) {
+	var next time.Time
+	for _, expression := range schedule.expressions {
+		if run, ok := expression.next(t.In(schedule.location)); ok && (next.IsZero() || run.Before(next)) {
+			next = run
+		}
+	}
+	if next.IsZero() {
+		return next, fmt.Errorf("The cron schedule does not run in the next %d years", maxCronYears)
+	}
+	return next, nil
+}
@@ -0,0 +1,187 @@
+package readingprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+)
+
+func utcForTest(month time.Month, day int, hour int, minute int) time.Time {
+	return time.Date(2016, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestCronNextShouldOk(t *testing.T) {
+	//every 5 minutes during business hours, hourly at night
+	schedule, err := ParseCron("*/5 9-17 * * 1-5; 0 0-8,18-23 * * *", "UTC")
+	if err != nil {
+		t.Fatalf("No error expected when parsing the cron schedule, got %s", err.Error())
+	}
+	runs := []struct {
+		after    time.Time
+		expected time.Time
+	}{
+		{utcForTest(4, 4, 8, 58), utcForTest(4, 4, 9, 0)},
+		{utcForTest(4, 4, 9, 0), utcForTest(4, 4, 9, 5)},
+		{utcForTest(4, 4, 17, 54), utcForTest(4, 4, 17, 55)},
+		{utcForTest(4, 4, 17, 55), utcForTest(4, 4, 18, 0)},
+		{utcForTest(4, 4, 23, 30), utcForTest(4, 5, 0, 0)},
+		//saturday
+		{utcForTest(4, 9, 12, 10), utcForTest(4, 9, 18, 0)},
+		{utcForTest(12, 31, 23, 59), time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, run := range runs {
+		next, err := schedule.Next(run.after)
+		if err != nil || !next.Equal(run.expected) {
+			t.Fatalf("Expected %v after %v, got %v, %v", run.expected, run.after, next, err)
+		}
+	}
+}
+
+func TestCronDaysShouldOk(t *testing.T) {
+	//the 13th or a friday
+	schedule, _ := ParseCron("0 12 13 * 5", "UTC")
+	for _, run := range [][2]time.Time{
+		{utcForTest(4, 1, 13, 0), utcForTest(4, 8, 12, 0)},
+		{utcForTest(4, 8, 12, 0), utcForTest(4, 13, 12, 0)},
+	} {
+		if next, err := schedule.Next(run[0]); err != nil || !next.Equal(run[1]) {
+			t.Fatalf("Expected %v after %v, got %v, %v", run[1], run[0], next, err)
+		}
+	}
+
+	schedule, _ = ParseCron("0 0 29 2 *", "UTC")
+	if next, err := schedule.Next(utcForTest(3, 1, 0, 0)); err != nil ||
+		!next.Equal(time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the next 29th of february, got %v, %v", next, err)
+	}
+	schedule, _ = ParseCron("0 0 30 2 *", "UTC")
+	if _, err := schedule.Next(utcForTest(3, 1, 0, 0)); err == nil {
+		t.Fatal("Expected error for a schedule that never runs, got nil")
+	}
+
+	schedule, _ = ParseCron("@weekly", "UTC")
+	if next, _ := schedule.Next(utcForTest(4, 4, 8, 0)); !next.Equal(utcForTest(4, 10, 0, 0)) {
+		t.Fatalf("Expected sunday at midnight, got %v", next)
+	}
+	schedule, _ = ParseCron("30 6 * * 7", "UTC")
+	if next, _ := schedule.Next(utcForTest(4, 4, 8, 0)); !next.Equal(utcForTest(4, 10, 6, 30)) {
+		t.Fatalf("Expected 7 to be sunday, got %v", next)
+	}
+}
+
+func TestCronTimezoneShouldOk(t *testing.T) {
+	schedule, err := ParseCron("0 9 * * *", "Europe/Bucharest")
+	if err != nil {
+		t.Fatalf("No error expected when parsing the cron schedule, got %s", err.Error())
+	}
+	//9 in Bucharest is 6 UTC in summer and 7 UTC in winter
+	if next, _ := schedule.Next(utcForTest(4, 3, 0, 0)); !next.Equal(utcForTest(4, 3, 6, 0)) {
+		t.Fatalf("Expected 06:00 UTC, got %v", next.UTC())
+	}
+	if next, _ := schedule.Next(utcForTest(1, 3, 0, 0)); !next.Equal(utcForTest(1, 3, 7, 0)) {
+		t.Fatalf("Expected 07:00 UTC, got %v", next.UTC())
+	}
+}
+
+func TestCronDaylightSavingShouldOk(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("No error expected when loading the time zone, got %s", err.Error())
+	}
+	saoPaulo, _ := time.LoadLocation("America/Sao_Paulo")
+	utc := func(year int, month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	runs := []struct {
+		spec     string
+		timezone string
+		after    time.Time
+		expected time.Time
+	}{
+		//the clocks go back from 02:00 EDT to 01:00 EST on the 1st of november 2026
+		{"0 5 * * *", "America/New_York", time.Date(2026, 11, 1, 0, 30, 0, 0, newYork), utc(2026, 11, 1, 10, 0)},
+		{"0 * * * *", "America/New_York", utc(2026, 11, 1, 5, 0), utc(2026, 11, 1, 6, 0)},
+		{"0 * * * *", "America/New_York", utc(2026, 11, 1, 6, 0), utc(2026, 11, 1, 7, 0)},
+		//the clocks go forward from 02:00 EST to 03:00 EDT on the 8th of march 2026
+		{"0 * * * *", "America/New_York", utc(2026, 3, 8, 6, 30), utc(2026, 3, 8, 7, 0)},
+		{"30 2 * * *", "America/New_York", time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), utc(2026, 3, 9, 6, 30)},
+		//the clocks went forward from 00:00 to 01:00 on the 16th of october 2016
+		{"0 12 16 * *", "America/Sao_Paulo", time.Date(2016, 10, 15, 10, 0, 0, 0, saoPaulo), utc(2016, 10, 16, 14, 0)},
+		{"0 * * 11 *", "America/Sao_Paulo", time.Date(2016, 10, 15, 10, 0, 0, 0, saoPaulo), utc(2016, 11, 1, 2, 0)},
+	}
+	for _, run := range runs {
+		schedule, err := ParseCron(run.spec, run.timezone)
+		if err != nil {
+			t.Fatalf("No error expected when parsing %q, got %s", run.spec, err.Error())
+		}
+		if next, err := schedule.Next(run.after); err != nil || !next.Equal(run.expected) {
+			t.Fatalf("Expected %v after %v for %q, got %v, %v", run.expected, run.after.UTC(), run.spec, next.UTC(), err)
+		}
+	}
+}
+
+func TestCronShouldFail(t *testing.T) {
+	for _, spec := range []string{"* * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *",
+		"a * * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "* * * * *;"} {
+		if _, err := ParseCron(spec, ""); err == nil {
+			t.Fatalf("Expected error when parsing %q, got nil", spec)
+		}
+	}
+	if _, err := ParseCron("* * * * *", "Mars/Olympus"); err == nil {
+		t.Fatal("Expected error when using an unknown time zone, got nil")
+	}
+}
+
+func TestIntervalTimerNextRun(t *testing.T) {
+	interval := time.Second
+	firstTime := time.Date(2000, 1, 1, 0, 0, 0, 500, time.UTC)
+	it := IntervalTimer{Interval: &interval, FirstTime: &firstTime}
+	now := time.Now()
+	next, err := it.NextRun(now)
+	if err != nil || next.Before(now) || next.Sub(now) > interval || next.Sub(firstTime)%interval != 0 {
+		t.Fatalf("Expected the next whole interval after %v, got %v, %v", now, next, err)
+	}
+
+	lastRun := now.Add(-500 * time.Millisecond)
+	it.LastRun = &lastRun
+	if next, _ = it.NextRun(now); !next.Equal(lastRun.Add(interval)) {
+		t.Fatalf("Expected an interval after the last run, got %v", next)
+	}
+
+	it = IntervalTimer{Cron: "0 * * * *", Timezone: "UTC"}
+	if next, _ = it.NextRun(utcForTest(4, 3, 12, 10)); !next.Equal(utcForTest(4, 3, 13, 0)) {
+		t.Fatalf("Expected the next hour, got %v", next)
+	}
+}
+
+func TestIntervalTimerCronShouldStop(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
+	interval := time.Minute
+	invalid := []IntervalTimer{
+		IntervalTimer{Cron: "* * * * *", Interval: &interval},
+		IntervalTimer{Cron: "61 * * * *"},
+		IntervalTimer{Interval: &interval, Timezone: "UTC"},
+		IntervalTimer{SensorAddress: 3},
+	}
+	for _, it := range invalid {
+		if err := schprovider.AddTimer(it); err == nil {
+			t.Fatalf("Expected error when adding %v, got nil", it)
+		}
+	}
+
+	if err := schprovider.AddTimer(IntervalTimer{Cron: "@hourly", Timezone: "UTC"}); err != nil {
+		t.Fatalf("No error expected when adding a cron timer, got %s", err.Error())
+	}
+	schprovider.Start()
+	if schprovider.GetTimers()[0].cancel == nil {
+		t.Fatal("Expected the cron timer to be started")
+	}
+	schprovider.Stop()
+	if schprovider.GetTimers()[0].cancel != nil {
+		t.Fatal("Expected the cron timer to be stopped")
+	}
+}
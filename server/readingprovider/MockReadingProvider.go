@@ -10,14 +10,17 @@ import (
 
 //MockReadingProvider is a mock provider for reading sensors. Used in tests
 type MockReadingProvider struct {
-	Conf configprovider.ConfigProvider
+	Conf      configprovider.ConfigProvider
+	BusConfig common.BusConfig
+	Writes    []common.Write
 	ReadingProvider
 }
 
-//NewReadingProvider returns a new reading provider having the configuration
-//provided by "cp"
-func (mockReadingProvider MockReadingProvider) NewReadingProvider(cp *configprovider.ConfigProvider) ReadingProvider {
+//NewReadingProvider returns a new reading provider for the bus "bus"
+//having the configuration provided by "cp"
+func (mockReadingProvider MockReadingProvider) NewReadingProvider(cp *configprovider.ConfigProvider, bus string) ReadingProvider {
 	mockReadingProvider.Conf = *cp
+	mockReadingProvider.BusConfig = common.BusConfig{Name: common.BusName(bus)}
 
 	return &mockReadingProvider
 }
@@ -42,13 +45,63 @@ func (mockReadingProvider *MockReadingProvider) getRandValueForConfiguredValue(c
 //GetReading returns a mock random read from the sensor having address "address"
 func (mockReadingProvider *MockReadingProvider) GetReading(address uint8, readingType string, startLocation uint16, length uint16) (*common.Reading, error) {
 
-	sensor, err := mockReadingProvider.Conf.GetSensorByAddress(address)
+	sensor, err := mockReadingProvider.Conf.GetSensorByAddress(mockReadingProvider.BusConfig.Name, address)
 
 	if err != nil {
 		return nil, err
 	}
 
-	reading := common.Reading{Sensor: sensor.Address, Time: time.Now().Format(common.TimeFormat),
+	reading := common.Reading{Bus: sensor.Bus, Sensor: sensor.Address, Time: time.Now().Format(common.TimeFormat),
+		Type: readingType, StartLocation: startLocation, Count: length,
 		ReadValues: mockReadingProvider.getRandValuesForSensor(*sensor)}
 	return &reading, nil
 }
+
+//SetBusConfig records the bus configuration
+func (mockReadingProvider *MockReadingProvider) SetBusConfig(busConfig common.BusConfig) error {
+	busConfig.Name = mockReadingProvider.BusConfig.Name
+	mockReadingProvider.BusConfig = busConfig
+	return nil
+}
+
+//GetBusConfig returns the recorded bus configuration
+func (mockReadingProvider *MockReadingProvider) GetBusConfig() common.BusConfig {
+	return mockReadingProvider.BusConfig
+}
+
+//write records the write if the sensor having address is configured
+func (mockReadingProvider *MockReadingProvider) write(address uint8, registerType string, startLocation uint16, values []uint16) error {
+	sensor, err := mockReadingProvider.Conf.GetSensorByAddress(mockReadingProvider.BusConfig.Name, address)
+	if err != nil {
+		return err
+	}
+	mockReadingProvider.Writes = append(mockReadingProvider.Writes, common.Write{Bus: sensor.Bus,
+		Sensor: address, Type: registerType, StartLocation: startLocation, Values: values})
+	return nil
+}
+
+//WriteRegister records a write to a holding register of a configured sensor
+func (mockReadingProvider *MockReadingProvider) WriteRegister(address uint8, location uint16, value uint16) error {
+	return mockReadingProvider.write(address, common.Holding, location, []uint16{value})
+}
+
+//WriteRegisters records a write to the holding registers of a configured sensor
+func (mockReadingProvider *MockReadingProvider) WriteRegisters(address uint8, startLocation uint16, values []uint16) error {
+	return mockReadingProvider.write(address, common.Holding, startLocation, values)
+}
+
+//WriteCoil records a write to a coil of a configured sensor
+func (mockReadingProvider *MockReadingProvider) WriteCoil(address uint8, location uint16, value bool) error {
+	return mockReadingProvider.WriteCoils(address, location, []bool{value})
+}
+
+//WriteCoils records a write to the coils of a configured sensor
+func (mockReadingProvider *MockReadingProvider) WriteCoils(address uint8, startLocation uint16, values []bool) error {
+	coils := make([]uint16, len(values))
+	for i, value := range values {
+		if value {
+			coils[i] = 1
+		}
+	}
+	return mockReadingProvider.write(address, common.Coil, startLocation, coils)
+}
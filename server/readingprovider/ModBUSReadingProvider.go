@@ -2,7 +2,9 @@ package readingprovider
 
 import (
 	"fmt"
+	"log"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/adiclepcea/SensInventory/server/common"
@@ -10,27 +12,22 @@ import (
 	"github.com/goburrow/modbus"
 )
 
-//SerialConfig is the struct holding the configuration for the serial port
-type SerialConfig struct {
-	Port     string
-	BaudRate int
-	DataBits int
-	Parity   string
-	StopBits int
-	Timeout  time.Duration
-}
-
 //ModBUSReadingProvider is the type used for reading a modbus bus
 type ModBUSReadingProvider struct {
 	ConfigProvider *configprovider.ConfigProvider
-	serialConfig   *SerialConfig
-	handler        *modbus.RTUClientHandler
+	busName        string
+	busConfig      *common.BusConfig
+	handler        clientHandler
+	handlerErr     error
+	lastRequest    time.Time
+	mutex          *sync.Mutex
 	ReadingProvider
 }
 
 //NewReadingProvider is the function that builds a new ModBUSReadingProvider
-func (modbusProvider ModBUSReadingProvider) NewReadingProvider(configProvider *configprovider.ConfigProvider) ReadingProvider {
-	modbus := ModBUSReadingProvider{ConfigProvider: configProvider}
+//for the bus named "bus"
+func (modbusProvider ModBUSReadingProvider) NewReadingProvider(configProvider *configprovider.ConfigProvider, bus string) ReadingProvider {
+	modbus := ModBUSReadingProvider{ConfigProvider: configProvider, busName: common.BusName(bus)}
 	modbus.initialize()
 	return &modbus
 }
@@ -51,6 +48,25 @@ func getUInt16FromBytes(input []byte) []uint16 {
 	return rez
 }
 
+func getBytesFromUInt16(input []uint16) []byte {
+	rez := make([]byte, len(input)*2)
+	for i, value := range input {
+		rez[i*2] = byte(value >> 8)
+		rez[i*2+1] = byte(value)
+	}
+	return rez
+}
+
+func getBytesFromBits(input []bool) []byte {
+	rez := make([]byte, (len(input)+7)/8)
+	for i, value := range input {
+		if value {
+			rez[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return rez
+}
+
 func getBitFromBytes(input []byte, length int) []uint16 {
 	var rez []uint16
 	for _, byt := range input {
@@ -69,52 +85,66 @@ func getBitFromBytes(input []byte, length int) []uint16 {
 	return rez
 }
 
+//request opens the bus, calls fn with a client for sensor and
+//closes the bus. Only one request at a time is made
+func (modbusProvider *ModBUSReadingProvider) request(sensor uint8, fn func(modbus.Client) error) error {
+	modbusProvider.mutex.Lock()
+	defer modbusProvider.mutex.Unlock()
+	if modbusProvider.handler == nil {
+		return fmt.Errorf("No modbus handler available: %s", modbusProvider.handlerErr)
+	}
+	modbusProvider.waitDelay()
+	defer func() { modbusProvider.lastRequest = time.Now() }()
+	setSlaveID(modbusProvider.handler, sensor)
+	if err := modbusProvider.handler.Connect(); err != nil {
+		return err
+	}
+	defer modbusProvider.handler.Close()
+	return fn(modbus.NewClient(modbusProvider.handler))
+}
+
 //GetReading is the function that will read a sensor and return the reading
 func (modbusProvider *ModBUSReadingProvider) GetReading(sensor uint8, registerType string, startLocation uint16, length uint16) (*common.Reading, error) {
-	modbusProvider.handler.SlaveId = sensor
-	var results []byte
 	var results16 []uint16
 	reading := common.Reading{}
-	err := modbusProvider.handler.Connect()
+	err := modbusProvider.request(sensor, func(client modbus.Client) error {
+		switch registerType {
+		case common.Coil:
+			results, err := client.ReadCoils(startLocation, length)
+			if err != nil {
+				return err
+			}
+			results16 = getBitFromBytes(results, int(length))
+		case common.Holding:
+			results, err := client.ReadHoldingRegisters(startLocation, length)
+			if err != nil {
+				return err
+			}
+			results16 = getUInt16FromBytes(results)
+		case common.Input:
+			results, err := client.ReadInputRegisters(startLocation, length)
+			if err != nil {
+				return err
+			}
+			results16 = getUInt16FromBytes(results)
+		case common.InputDiscrete:
+			results, err := client.ReadDiscreteInputs(startLocation, length)
+			if err != nil {
+				return err
+			}
+			results16 = getBitFromBytes(results, int(length))
+		default:
+			return fmt.Errorf("Register type %s not supported", registerType)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer modbusProvider.handler.Close()
-	client := modbus.NewClient(modbusProvider.handler)
-	switch registerType {
-	case common.Coil:
-		results, err = client.ReadCoils(startLocation, length)
-		if err != nil {
-			return nil, err
-		}
-		results16 = getBitFromBytes(results, int(length))
-		break
-	case common.Holding:
-		results, err = client.ReadHoldingRegisters(startLocation, length)
-		if err != nil {
-			return nil, err
-		}
-		results16 = getUInt16FromBytes(results)
-		break
-	case common.Input:
-		results, err = client.ReadInputRegisters(startLocation, length)
-		if err != nil {
-			return nil, err
-		}
-		results16 = getUInt16FromBytes(results)
-		break
-	case common.InputDiscrete:
-		results, err = client.ReadDiscreteInputs(startLocation, length)
-		if err != nil {
-			return nil, err
-		}
-		results16 = getBitFromBytes(results, int(length))
-		break
-	default:
-		return nil, fmt.Errorf("Register type %s not supported", registerType)
-	}
 
+	reading.Bus = modbusProvider.busName
 	reading.Sensor = sensor
+	reading.Type = registerType
 	reading.StartLocation = startLocation
 	reading.Count = length
 	reading.Time = time.Now().Format(common.TimeFormat)
@@ -122,21 +152,124 @@ func (modbusProvider *ModBUSReadingProvider) GetReading(sensor uint8, registerTy
 	return &reading, nil
 }
 
+//WriteRegister writes value in the holding register found at location
+//on sensor (function 06)
+func (modbusProvider *ModBUSReadingProvider) WriteRegister(sensor uint8, location uint16, value uint16) error {
+	return modbusProvider.request(sensor, func(client modbus.Client) error {
+		_, err := client.WriteSingleRegister(location, value)
+		return err
+	})
+}
+
+//WriteRegisters writes values in the holding registers found from
+//startLocation on sensor (function 16)
+func (modbusProvider *ModBUSReadingProvider) WriteRegisters(sensor uint8, startLocation uint16, values []uint16) error {
+	return modbusProvider.request(sensor, func(client modbus.Client) error {
+		_, err := client.WriteMultipleRegisters(startLocation, uint16(len(values)), getBytesFromUInt16(values))
+		return err
+	})
+}
+
+//WriteCoil sets or resets the coil found at location on sensor (function 05)
+func (modbusProvider *ModBUSReadingProvider) WriteCoil(sensor uint8, location uint16, value bool) error {
+	return modbusProvider.request(sensor, func(client modbus.Client) error {
+		coil := uint16(0x0000)
+		if value {
+			coil = 0xFF00
+		}
+		_, err := client.WriteSingleCoil(location, coil)
+		return err
+	})
+}
+
+//WriteCoils writes values in the coils found from startLocation
+//on sensor (function 15)
+func (modbusProvider *ModBUSReadingProvider) WriteCoils(sensor uint8, startLocation uint16, values []bool) error {
+	return modbusProvider.request(sensor, func(client modbus.Client) error {
+		_, err := client.WriteMultipleCoils(startLocation, uint16(len(values)), getBytesFromBits(values))
+		return err
+	})
+}
+
+//waitDelay keeps the line silent for the configured delay
+//since the end of the previous request
+func (modbusProvider *ModBUSReadingProvider) waitDelay() {
+	wait := modbusProvider.lastRequest.Add(modbusProvider.busConfig.Delay).Sub(time.Now())
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+//SetBusConfig closes the current handler and opens a new one
+//using busConfig. It waits for a reading in progress to finish
+func (modbusProvider *ModBUSReadingProvider) SetBusConfig(busConfig common.BusConfig) error {
+	modbusProvider.mutex.Lock()
+	defer modbusProvider.mutex.Unlock()
+
+	busConfig.Name = modbusProvider.busName
+	applyBusDefaults(&busConfig)
+	handler, err := newClientHandler(&busConfig)
+	if err != nil {
+		return err
+	}
+	if modbusProvider.handler != nil {
+		modbusProvider.handler.Close()
+	}
+	modbusProvider.busConfig = &busConfig
+	modbusProvider.handler = handler
+	modbusProvider.handlerErr = nil
+	log.Printf("Bus %s uses %s on %s\n", busConfig.Name, busConfig.Transport, busConfig.Address)
+	return nil
+}
+
+//GetBusConfig returns the configuration currently used by the provider
+func (modbusProvider *ModBUSReadingProvider) GetBusConfig() common.BusConfig {
+	modbusProvider.mutex.Lock()
+	defer modbusProvider.mutex.Unlock()
+	return *modbusProvider.busConfig
+}
+
+//applyBusDefaults fills in the settings that were not configured
+func applyBusDefaults(busConfig *common.BusConfig) {
+	if busConfig.Timeout == 0 {
+		busConfig.Timeout = defaultTimeout
+	}
+	if !busConfig.IsSerial() {
+		return
+	}
+	if busConfig.BaudRate == 0 {
+		busConfig.BaudRate = 115200
+	}
+	if busConfig.DataBits == 0 {
+		busConfig.DataBits = 8
+	}
+	if busConfig.Parity == "" {
+		busConfig.Parity = "N"
+	}
+	if busConfig.StopBits == 0 {
+		busConfig.StopBits = 1
+	}
+}
+
 func (modbusProvider *ModBUSReadingProvider) initialize() {
-	//TODO this should not be reached
-	//find a method to configure this
-	//perhaps in the configProvider?
-	if modbusProvider.serialConfig == nil {
-		modbusProvider.serialConfig = &SerialConfig{Port: "/dev/ttyUSB1",
-			BaudRate: 115200, DataBits: 8, Parity: "N", StopBits: 1,
-			Timeout: 5 * time.Second}
+	if modbusProvider.mutex == nil {
+		modbusProvider.mutex = &sync.Mutex{}
 	}
+	modbusProvider.busName = common.BusName(modbusProvider.busName)
+	if modbusProvider.busConfig == nil && modbusProvider.ConfigProvider != nil &&
+		*modbusProvider.ConfigProvider != nil {
+		modbusProvider.busConfig, _ = (*modbusProvider.ConfigProvider).GetBus(modbusProvider.busName)
+	}
+	if modbusProvider.busConfig == nil {
+		log.Printf("Bus %s not configured, using rtu on /dev/ttyUSB1\n", modbusProvider.busName)
+		modbusProvider.busConfig = &common.BusConfig{Name: modbusProvider.busName,
+			Transport: common.RTU, Address: "/dev/ttyUSB1"}
+	}
+	applyBusDefaults(modbusProvider.busConfig)
 	if modbusProvider.handler == nil {
-		modbusProvider.handler = modbus.NewRTUClientHandler(modbusProvider.serialConfig.Port)
-		modbusProvider.handler.StopBits = modbusProvider.serialConfig.StopBits
-		modbusProvider.handler.BaudRate = modbusProvider.serialConfig.BaudRate
-		modbusProvider.handler.DataBits = modbusProvider.serialConfig.DataBits
-		modbusProvider.handler.Parity = modbusProvider.serialConfig.Parity
-		modbusProvider.handler.Timeout = modbusProvider.serialConfig.Timeout
+		modbusProvider.handler, modbusProvider.handlerErr = newClientHandler(modbusProvider.busConfig)
+		if modbusProvider.handlerErr != nil {
+			log.Printf("Could not create the modbus handler: %s\n", modbusProvider.handlerErr.Error())
+		}
 	}
 }
@@ -0,0 +1,212 @@
+package readingprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+)
+
+func newModBUSProviderForTest(t *testing.T, transport string, address string) ReadingProvider {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	err := cp.SetBus(common.BusConfig{Name: "line1", Transport: transport,
+		Address: address, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("No error expected when setting the bus config, got %s", err.Error())
+	}
+	return ModBUSReadingProvider{}.NewReadingProvider(&cp, "line1")
+}
+
+func TestModBUSTCPReadingShouldOk(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+	slave.SetInput(3, 100, 23, 56)
+	slave.SetHolding(3, 10, 3)
+	slave.SetCoil(3, 1, true)
+
+	rp := newModBUSProviderForTest(t, common.TCP, slave.Address())
+
+	reading, err := rp.GetReading(3, common.Input, 100, 2)
+	if err != nil {
+		t.Fatalf("No error expected when reading input registers, got %s", err.Error())
+	}
+	if reading.Bus != "line1" || reading.Sensor != 3 || reading.StartLocation != 100 || reading.Count != 2 {
+		t.Fatalf("Expected bus line1, sensor 3, start 100, count 2, got %v", reading)
+	}
+	if len(reading.ReadValues) != 2 || reading.ReadValues[0] != 23 || reading.ReadValues[1] != 56 {
+		t.Fatalf("Expected [23 56], got %v", reading.ReadValues)
+	}
+
+	reading, err = rp.GetReading(3, common.Holding, 10, 1)
+	if err != nil {
+		t.Fatalf("No error expected when reading holding registers, got %s", err.Error())
+	}
+	if reading.ReadValues[0] != 3 {
+		t.Fatalf("Expected [3], got %v", reading.ReadValues)
+	}
+
+	reading, err = rp.GetReading(3, common.Coil, 0, 3)
+	if err != nil {
+		t.Fatalf("No error expected when reading coils, got %s", err.Error())
+	}
+	if len(reading.ReadValues) != 3 || reading.ReadValues[1] != 1 || reading.ReadValues[0] != 0 {
+		t.Fatalf("Expected [0 1 0], got %v", reading.ReadValues)
+	}
+}
+
+func TestModBUSRTUOverTCPReadingShouldOk(t *testing.T) {
+	slave := newTestSlave(t, true)
+	defer slave.Close()
+	slave.SetInput(5, 100, 0x17, 0x38, 2016, 4, 3, 12, 10, 50)
+	slave.SetDiscrete(5, 2, true)
+
+	rp := newModBUSProviderForTest(t, common.RTUOverTCP, slave.Address())
+
+	reading, err := rp.GetReading(5, common.Input, 100, 8)
+	if err != nil {
+		t.Fatalf("No error expected when reading input registers, got %s", err.Error())
+	}
+	expected := []uint16{0x17, 0x38, 2016, 4, 3, 12, 10, 50}
+	for i, v := range expected {
+		if reading.ReadValues[i] != v {
+			t.Fatalf("Expected %v, got %v", expected, reading.ReadValues)
+		}
+	}
+
+	reading, err = rp.GetReading(5, common.InputDiscrete, 0, 4)
+	if err != nil {
+		t.Fatalf("No error expected when reading discrete inputs, got %s", err.Error())
+	}
+	if reading.ReadValues[2] != 1 || reading.ReadValues[3] != 0 {
+		t.Fatalf("Expected [0 0 1 0], got %v", reading.ReadValues)
+	}
+}
+
+func TestModBUSReadingNoSlaveShouldFail(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+	slave.SetHolding(1, 10, 1)
+
+	rp := newModBUSProviderForTest(t, common.TCP, slave.Address())
+
+	if _, err := rp.GetReading(2, common.Holding, 10, 1); err == nil {
+		t.Fatal("Expected error when reading a slave that does not answer, got nil")
+	}
+	if _, err := rp.GetReading(1, "unknown", 10, 1); err == nil {
+		t.Fatal("Expected error when reading an unknown register type, got nil")
+	}
+}
+
+func TestModBUSUnknownTransportShouldFail(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	if err := cp.SetBus(common.BusConfig{Name: "line1", Transport: "udp", Address: "x"}); err == nil {
+		t.Fatal("Expected error when setting an unknown transport, got nil")
+	}
+
+	rp := &ModBUSReadingProvider{busConfig: &common.BusConfig{Transport: "udp"}}
+	rp.initialize()
+	if _, err := rp.GetReading(1, common.Holding, 10, 1); err == nil {
+		t.Fatal("Expected error when reading through an unknown transport, got nil")
+	}
+}
+
+func TestModBUSSetBusConfigShouldReopen(t *testing.T) {
+	slave1 := newTestSlave(t, false)
+	defer slave1.Close()
+	slave1.SetHolding(1, 10, 1)
+	slave2 := newTestSlave(t, true)
+	defer slave2.Close()
+	slave2.SetHolding(1, 10, 2)
+
+	rp := newModBUSProviderForTest(t, common.TCP, slave1.Address())
+	reading, err := rp.GetReading(1, common.Holding, 10, 1)
+	if err != nil || reading.ReadValues[0] != 1 {
+		t.Fatalf("Expected [1] from the first slave, got %v, %v", reading, err)
+	}
+
+	delay := 200 * time.Millisecond
+	err = rp.SetBusConfig(common.BusConfig{Transport: common.RTUOverTCP,
+		Address: slave2.Address(), SerialConfig: common.SerialConfig{Delay: delay}})
+	if err != nil {
+		t.Fatalf("No error expected when changing the bus, got %s", err.Error())
+	}
+	if rp.GetBusConfig().Name != "line1" || rp.GetBusConfig().Timeout != defaultTimeout {
+		t.Fatalf("Expected bus line1 with the default timeout, got %v", rp.GetBusConfig())
+	}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		reading, err = rp.GetReading(1, common.Holding, 10, 1)
+		if err != nil || reading.ReadValues[0] != 2 {
+			t.Fatalf("Expected [2] from the second slave, got %v, %v", reading, err)
+		}
+	}
+	if time.Since(start) < delay {
+		t.Fatalf("Expected at least %v between reads, got %v", delay, time.Since(start))
+	}
+
+	if err = rp.SetBusConfig(common.BusConfig{Transport: "udp"}); err == nil {
+		t.Fatal("Expected error when changing to an unknown transport, got nil")
+	}
+	if rp.GetBusConfig().Transport != common.RTUOverTCP {
+		t.Fatalf("Expected the previous bus to be kept, got %v", rp.GetBusConfig())
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	//read 10 holding registers from 0 on slave 1, sent as 01 03 00 00 00 0A C5 CD
+	frame := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}
+	if crc := crc16(frame); crc != 0xCDC5 {
+		t.Fatalf("Expected crc 0xCDC5, got 0x%X", crc)
+	}
+}
+
+func TestModBUSWriteRegisterShouldOk(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+	slave.SetHolding(4, 10, 4)
+
+	rp := newModBUSProviderForTest(t, common.TCP, slave.Address())
+	if err := rp.WriteRegister(4, 20, 1234); err != nil {
+		t.Fatalf("No error expected when writing a register, got %s", err.Error())
+	}
+	if slave.Holding(4, 20) != 1234 {
+		t.Fatalf("Expected 1234 in register 20, got %d", slave.Holding(4, 20))
+	}
+	if err := rp.WriteRegister(7, 20, 1); err == nil {
+		t.Fatal("Expected error when writing to a slave that does not answer, got nil")
+	}
+}
+
+func TestModBUSWriteRegistersAndCoilsShouldOk(t *testing.T) {
+	slave := newTestSlave(t, true)
+	defer slave.Close()
+	slave.SetHolding(4, 10, 4)
+
+	rp := newModBUSProviderForTest(t, common.RTUOverTCP, slave.Address())
+	if err := rp.WriteRegisters(4, 102, []uint16{2016, 4, 3, 12, 10, 50}); err != nil {
+		t.Fatalf("No error expected when writing registers, got %s", err.Error())
+	}
+	if slave.Holding(4, 102) != 2016 || slave.Holding(4, 107) != 50 {
+		t.Fatalf("Expected 2016 and 50 in registers 102 and 107, got %d and %d",
+			slave.Holding(4, 102), slave.Holding(4, 107))
+	}
+
+	if err := rp.WriteCoil(4, 3, true); err != nil {
+		t.Fatalf("No error expected when writing a coil, got %s", err.Error())
+	}
+	if !slave.Coil(4, 3) {
+		t.Fatal("Expected coil 3 to be set")
+	}
+
+	coils := []bool{true, false, true, true, false, false, false, false, true}
+	if err := rp.WriteCoils(4, 10, coils); err != nil {
+		t.Fatalf("No error expected when writing coils, got %s", err.Error())
+	}
+	for i, coil := range coils {
+		if slave.Coil(4, 10+uint16(i)) != coil {
+			t.Fatalf("Expected coil %d to be %t", 10+i, coil)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package readingprovider
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+//testSlave is an in-process modbus slave stand-in that listens on a local
+//TCP port. It speaks either Modbus TCP or RTU frames over TCP and keeps
+//separate coils and registers for every slave address. When the address
+//register is set, writing it moves the slave to the written address
+type testSlave struct {
+	listener        net.Listener
+	rtu             bool
+	mu              sync.Mutex
+	coils           map[uint8]map[uint16]bool
+	discrete        map[uint8]map[uint16]bool
+	holding         map[uint8]map[uint16]uint16
+	input           map[uint8]map[uint16]uint16
+	addressRegister *uint16
+}
+
+func newTestSlave(t *testing.T, rtu bool) *testSlave {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not start the test slave: %s", err.Error())
+	}
+	slave := &testSlave{listener: listener, rtu: rtu,
+		coils:    make(map[uint8]map[uint16]bool),
+		discrete: make(map[uint8]map[uint16]bool),
+		holding:  make(map[uint8]map[uint16]uint16),
+		input:    make(map[uint8]map[uint16]uint16)}
+	go slave.serve()
+	return slave
+}
+
+func (slave *testSlave) Address() string {
+	return slave.listener.Addr().String()
+}
+
+func (slave *testSlave) Close() {
+	slave.listener.Close()
+}
+
+func (slave *testSlave) SetCoil(address uint8, location uint16, value bool) {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if slave.coils[address] == nil {
+		slave.coils[address] = make(map[uint16]bool)
+	}
+	slave.coils[address][location] = value
+}
+
+func (slave *testSlave) SetDiscrete(address uint8, location uint16, value bool) {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if slave.discrete[address] == nil {
+		slave.discrete[address] = make(map[uint16]bool)
+	}
+	slave.discrete[address][location] = value
+}
+
+func (slave *testSlave) SetHolding(address uint8, location uint16, values ...uint16) {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if slave.holding[address] == nil {
+		slave.holding[address] = make(map[uint16]uint16)
+	}
+	for i, v := range values {
+		slave.holding[address][location+uint16(i)] = v
+	}
+}
+
+func (slave *testSlave) SetInput(address uint8, location uint16, values ...uint16) {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if slave.input[address] == nil {
+		slave.input[address] = make(map[uint16]uint16)
+	}
+	for i, v := range values {
+		slave.input[address][location+uint16(i)] = v
+	}
+}
+
+func (slave *testSlave) SetAddressRegister(location uint16) {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	slave.addressRegister = &location
+}
+
+func (slave *testSlave) Holding(address uint8, location uint16) uint16 {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	return slave.holding[address][location]
+}
+
+func (slave *testSlave) Coil(address uint8, location uint16) bool {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	return slave.coils[address][location]
+}
+
+func (slave *testSlave) serve() {
+	for {
+		conn, err := slave.listener.Accept()
+		if err != nil {
+			return
+		}
+		go slave.handle(conn)
+	}
+}
+
+func (slave *testSlave) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var err error
+		if slave.rtu {
+			err = slave.handleRTU(conn)
+		} else {
+			err = slave.handleTCP(conn)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (slave *testSlave) handleTCP(conn net.Conn) error {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+	if _, err := io.ReadFull(conn, pdu); err != nil {
+		return err
+	}
+	response := slave.process(header[6], pdu)
+	if response == nil {
+		//no such slave, let the client time out
+		return nil
+	}
+	binary.BigEndian.PutUint16(header[4:], uint16(len(response)+1))
+	_, err := conn.Write(append(header, response...))
+	return err
+}
+
+func (slave *testSlave) handleRTU(conn net.Conn) error {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	switch head[1] {
+	case 15, 16:
+		fixed := make([]byte, 5)
+		if _, err := io.ReadFull(conn, fixed); err != nil {
+			return err
+		}
+		body := make([]byte, int(fixed[4])+2)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return err
+		}
+		head = append(head, fixed...)
+		head = append(head, body...)
+	default:
+		body := make([]byte, 6)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return err
+		}
+		head = append(head, body...)
+	}
+	frame := head
+	if crc16(frame[:len(frame)-2]) != binary.LittleEndian.Uint16(frame[len(frame)-2:]) {
+		return nil
+	}
+	response := slave.process(frame[0], frame[1:len(frame)-2])
+	if response == nil {
+		return nil
+	}
+	response = append([]byte{frame[0]}, response...)
+	checksum := make([]byte, 2)
+	binary.LittleEndian.PutUint16(checksum, crc16(response))
+	_, err := conn.Write(append(response, checksum...))
+	return err
+}
+
+//process executes the request pdu for the slave with address
+//and returns the response pdu
+func (slave *testSlave) process(address uint8, pdu []byte) []byte {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+
+	if slave.holding[address] == nil && slave.input[address] == nil &&
+		slave.coils[address] == nil && slave.discrete[address] == nil {
+		return nil
+	}
+	function := pdu[0]
+	location := binary.BigEndian.Uint16(pdu[1:])
+	value := binary.BigEndian.Uint16(pdu[3:])
+	switch function {
+	case 1, 2:
+		bits := slave.coils[address]
+		if function == 2 {
+			bits = slave.discrete[address]
+		}
+		data := make([]byte, (value+7)/8)
+		for i := uint16(0); i < value; i++ {
+			if bits[location+i] {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{function, byte(len(data))}, data...)
+	case 3, 4:
+		registers := slave.holding[address]
+		if function == 4 {
+			registers = slave.input[address]
+		}
+		data := make([]byte, value*2)
+		for i := uint16(0); i < value; i++ {
+			binary.BigEndian.PutUint16(data[i*2:], registers[location+i])
+		}
+		return append([]byte{function, byte(len(data))}, data...)
+	case 5:
+		if slave.coils[address] == nil {
+			slave.coils[address] = make(map[uint16]bool)
+		}
+		slave.coils[address][location] = value == 0xFF00
+		return pdu[:5]
+	case 6:
+		if slave.holding[address] == nil {
+			slave.holding[address] = make(map[uint16]uint16)
+		}
+		slave.holding[address][location] = value
+		if slave.addressRegister != nil && *slave.addressRegister == location {
+			slave.moveTo(address, uint8(value))
+		}
+		return pdu[:5]
+	case 15:
+		if slave.coils[address] == nil {
+			slave.coils[address] = make(map[uint16]bool)
+		}
+		for i := uint16(0); i < value; i++ {
+			slave.coils[address][location+i] = pdu[6+i/8]&(1<<(i%8)) != 0
+		}
+		return pdu[:5]
+	case 16:
+		if slave.holding[address] == nil {
+			slave.holding[address] = make(map[uint16]uint16)
+		}
+		for i := uint16(0); i < value; i++ {
+			slave.holding[address][location+i] = binary.BigEndian.Uint16(pdu[6+i*2:])
+		}
+		return pdu[:5]
+	}
+	//illegal function
+	return []byte{function | 0x80, 1}
+}
+
+//moveTo moves the coils and registers of the slave from address to newAddress
+func (slave *testSlave) moveTo(address uint8, newAddress uint8) {
+	if address == newAddress {
+		return
+	}
+	slave.coils[newAddress], slave.coils[address] = slave.coils[address], nil
+	slave.discrete[newAddress], slave.discrete[address] = slave.discrete[address], nil
+	slave.holding[newAddress], slave.holding[address] = slave.holding[address], nil
+	slave.input[newAddress], slave.input[address] = slave.input[address], nil
+}
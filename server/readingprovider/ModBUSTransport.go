@@ -0,0 +1,211 @@
+package readingprovider
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/goburrow/modbus"
+)
+
+const (
+	rtuMinSize       = 4
+	rtuMaxSize       = 256
+	rtuExceptionSize = 5
+	defaultTimeout   = 5 * time.Second
+)
+
+//clientHandler is what every transport must offer
+//so that ModBUSReadingProvider can use it
+type clientHandler interface {
+	modbus.ClientHandler
+	Connect() error
+	Close() error
+}
+
+//newClientHandler builds the handler for the transport set in busConfig
+func newClientHandler(busConfig *common.BusConfig) (clientHandler, error) {
+	timeout := busConfig.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	switch busConfig.Transport {
+	case common.RTU:
+		handler := modbus.NewRTUClientHandler(busConfig.Address)
+		handler.StopBits = busConfig.StopBits
+		handler.BaudRate = busConfig.BaudRate
+		handler.DataBits = busConfig.DataBits
+		handler.Parity = busConfig.Parity
+		handler.Timeout = timeout
+		return handler, nil
+	case common.ASCII:
+		handler := modbus.NewASCIIClientHandler(busConfig.Address)
+		handler.StopBits = busConfig.StopBits
+		handler.BaudRate = busConfig.BaudRate
+		handler.DataBits = busConfig.DataBits
+		handler.Parity = busConfig.Parity
+		handler.Timeout = timeout
+		return handler, nil
+	case common.TCP:
+		handler := modbus.NewTCPClientHandler(busConfig.Address)
+		handler.Timeout = timeout
+		return handler, nil
+	case common.RTUOverTCP:
+		return &rtuOverTCPClientHandler{Address: busConfig.Address, Timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("Transport %s not supported", busConfig.Transport)
+}
+
+//setSlaveID sets the address of the slave the next request goes to
+func setSlaveID(handler clientHandler, slaveID uint8) {
+	switch h := handler.(type) {
+	case *modbus.RTUClientHandler:
+		h.SlaveId = slaveID
+	case *modbus.ASCIIClientHandler:
+		h.SlaveId = slaveID
+	case *modbus.TCPClientHandler:
+		h.SlaveId = slaveID
+	case *rtuOverTCPClientHandler:
+		h.SlaveId = slaveID
+	}
+}
+
+//rtuOverTCPClientHandler sends RTU frames (with CRC, without the MBAP header)
+//through a TCP connection. This is what most Ethernet to RS485 gateways
+//do when they work in transparent mode
+type rtuOverTCPClientHandler struct {
+	Address string
+	Timeout time.Duration
+	SlaveId byte
+	mu      sync.Mutex
+	conn    net.Conn
+}
+
+//crc16 calculates the modbus RTU checksum of data
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+//Encode builds the RTU frame: slave address, function, data and CRC
+func (handler *rtuOverTCPClientHandler) Encode(pdu *modbus.ProtocolDataUnit) ([]byte, error) {
+	length := len(pdu.Data) + 4
+	if length > rtuMaxSize {
+		return nil, fmt.Errorf("Length of data %d must not be bigger than %d", length, rtuMaxSize)
+	}
+	adu := make([]byte, length)
+	adu[0] = handler.SlaveId
+	adu[1] = pdu.FunctionCode
+	copy(adu[2:], pdu.Data)
+	checksum := crc16(adu[:length-2])
+	adu[length-2] = byte(checksum)
+	adu[length-1] = byte(checksum >> 8)
+	return adu, nil
+}
+
+//Verify checks the response length and the slave address
+func (handler *rtuOverTCPClientHandler) Verify(aduRequest []byte, aduResponse []byte) error {
+	if len(aduResponse) < rtuMinSize {
+		return fmt.Errorf("Response length %d does not meet minimum %d", len(aduResponse), rtuMinSize)
+	}
+	if aduResponse[0] != aduRequest[0] {
+		return fmt.Errorf("Response slave id %d does not match request %d", aduResponse[0], aduRequest[0])
+	}
+	return nil
+}
+
+//Decode checks the CRC and extracts the PDU from the RTU frame
+func (handler *rtuOverTCPClientHandler) Decode(adu []byte) (*modbus.ProtocolDataUnit, error) {
+	length := len(adu)
+	checksum := uint16(adu[length-1])<<8 | uint16(adu[length-2])
+	if expected := crc16(adu[:length-2]); checksum != expected {
+		return nil, fmt.Errorf("Response crc %d does not match expected %d", checksum, expected)
+	}
+	return &modbus.ProtocolDataUnit{FunctionCode: adu[1], Data: adu[2 : length-2]}, nil
+}
+
+//Send writes the request and reads a complete RTU response. As there
+//is no length header, the size of the response is deduced from the function
+func (handler *rtuOverTCPClientHandler) Send(aduRequest []byte) ([]byte, error) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if err := handler.connect(); err != nil {
+		return nil, err
+	}
+	if err := handler.conn.SetDeadline(time.Now().Add(handler.Timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := handler.conn.Write(aduRequest); err != nil {
+		return nil, err
+	}
+
+	var data [rtuMaxSize]byte
+	if _, err := io.ReadFull(handler.conn, data[:3]); err != nil {
+		return nil, err
+	}
+	var length int
+	switch function := data[1]; {
+	case function&0x80 != 0:
+		length = rtuExceptionSize
+	case function == modbus.FuncCodeReadCoils ||
+		function == modbus.FuncCodeReadDiscreteInputs ||
+		function == modbus.FuncCodeReadHoldingRegisters ||
+		function == modbus.FuncCodeReadInputRegisters ||
+		function == modbus.FuncCodeReadWriteMultipleRegisters:
+		length = 3 + int(data[2]) + 2
+	default:
+		length = 8
+	}
+	if length > rtuMaxSize {
+		return nil, fmt.Errorf("Response length %d is bigger than %d", length, rtuMaxSize)
+	}
+	if _, err := io.ReadFull(handler.conn, data[3:length]); err != nil {
+		return nil, err
+	}
+	return data[:length], nil
+}
+
+//Connect opens the TCP connection to the gateway
+func (handler *rtuOverTCPClientHandler) Connect() error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return handler.connect()
+}
+
+func (handler *rtuOverTCPClientHandler) connect() error {
+	if handler.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", handler.Address, handler.Timeout)
+	if err != nil {
+		return err
+	}
+	handler.conn = conn
+	return nil
+}
+
+//Close closes the TCP connection to the gateway
+func (handler *rtuOverTCPClientHandler) Close() error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.conn == nil {
+		return nil
+	}
+	err := handler.conn.Close()
+	handler.conn = nil
+	return err
+}
@@ -6,8 +6,14 @@ import (
 )
 
 //ReadingProvider provides an interface(blueprint) for a provider
-//that reads sensors
+//that reads the sensors found on one bus
 type ReadingProvider interface {
-	NewReadingProvider(*configprovider.ConfigProvider) ReadingProvider
+	NewReadingProvider(*configprovider.ConfigProvider, string) ReadingProvider
 	GetReading(uint8, string, uint16, uint16) (*common.Reading, error)
+	WriteRegister(uint8, uint16, uint16) error
+	WriteRegisters(uint8, uint16, []uint16) error
+	WriteCoil(uint8, uint16, bool) error
+	WriteCoils(uint8, uint16, []bool) error
+	SetBusConfig(common.BusConfig) error
+	GetBusConfig() common.BusConfig
 }
@@ -1,253 +1,846 @@
 package readingprovider
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"sync"
 	"time"
 
+	"github.com/adiclepcea/SensInventory/server/common"
 	"github.com/adiclepcea/SensInventory/server/configprovider"
 	"github.com/adiclepcea/SensInventory/server/persistenceprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
 )
 
+//scheduleItem is the name of the item holding the timers
+//in the persistence provider
+const scheduleItem = "schedule"
+
 //ScheduleProvider is the base structure needed for
-//a scheduled read/write of sensors
+//a scheduled read/write of sensors. Every bus has its own
+//reading provider and its own channel so that the reads on
+//a bus are serialized while different buses are read in parallel.
+//The timers are kept in a registry guarded by timerMutex, every started
+//timer reads in its own goroutine until its context is cancelled. The
+//copies of the timers are saved in the order they are made, under saveMutex
 type ScheduleProvider struct {
-	readingProvider     ReadingProvider
-	readingChannel      chan ReadingProvider
+	readingProviders    map[string]ReadingProvider
+	readingChannels     map[string]chan ReadingProvider
+	busMutex            *sync.RWMutex
+	listeners           []ReadingListener
+	listenerMutex       *sync.RWMutex
 	persistenceProvider *persistenceprovider.PersistenceProvider
 	configProvider      *configprovider.ConfigProvider
-	Timers              []IntervalTimer `json:"timers"`
+	timers              []*IntervalTimer
+	timerMutex          *sync.Mutex
+	saveMutex           *sync.Mutex
+	version             int
+	savedVersion        int
 	idForIntervalTimer  int
-	started             bool
+	ctx                 context.Context
+	cancel              context.CancelFunc
 }
 
-//IntervalTimer defines an interval and a read configuration for that interval
+//ReadingListener is called with every reading done by the
+//schedule provider, after its values are calculated
+type ReadingListener func(common.Reading)
+
+//IntervalTimer defines an interval and a read configuration for that interval.
+//Instead of the interval, the reads can be scheduled with Cron, one or more
+//cron expressions separated by ";" evaluated in Timezone (see ParseCron).
+//Error tells why a loaded timer can not run. Such a timer is kept and
+//saved, but it is not started until it is changed or loaded without error
 type IntervalTimer struct {
+	Bus                 string         `json:"bus,omitempty"`
 	SensorAddress       uint8          `json:"sensorAddress"`
 	ReadType            string         `json:"readType"`
 	StartLocation       uint16         `json:"startLocation"`
 	ReadLength          uint16         `json:"readLength"`
 	Interval            *time.Duration `json:"interval"`
+	Cron                string         `json:"cron,omitempty"`
+	Timezone            string         `json:"timezone,omitempty"`
 	Repeat              bool           `json:"repeat"`
+	Paused              bool           `json:"paused"`
 	FirstTime           *time.Time     `json:"firstTime,omitempty"`
 	Persist             bool           `json:"store"`
 	LastRun             *time.Time     `json:"lastRun,omitempty"`
 	ID                  int            `json:"timer_id"`
+	Error               string         `json:"error,omitempty"`
+	Status              *TimerStatus   `json:"status,omitempty"`
 	schProvider         *ScheduleProvider
-	readingChannel      chan ReadingProvider
 	persistenceProvider *persistenceprovider.PersistenceProvider
-	timer               *time.Timer
-	ticker              *time.Ticker
+	cancel              context.CancelFunc
+	stopped             chan struct{}
+	status              TimerStatus
 }
 
-//Start for IntervalTimer
-//is meant to be called by schedule provider
-//and will start a timer that will perform a read
-func (intervalTimer *IntervalTimer) Start() {
+//TimerStatus tells how the reads of a timer went since the timer was added
+//or loaded. The latency is the average time taken by the reads, without
+//waiting for the bus. NextRun is missing while the timer is not running
+type TimerStatus struct {
+	Reads               int           `json:"reads"`
+	Failures            int           `json:"failures"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	LastSuccess         *time.Time    `json:"lastSuccess,omitempty"`
+	LastFailure         *time.Time    `json:"lastFailure,omitempty"`
+	LastError           string        `json:"lastError,omitempty"`
+	AverageLatency      time.Duration `json:"averageLatency"`
+	NextRun             *time.Time    `json:"nextRun,omitempty"`
+}
 
-	if intervalTimer.FirstTime == nil {
-		intervalTimer.startReading()
-	} else {
-		if intervalTimer.Interval == nil {
-			return
+//add adds to the status a read done at t in latency ending with err
+func (status *TimerStatus) add(t time.Time, latency time.Duration, err error) {
+	status.Reads++
+	status.AverageLatency += (latency - status.AverageLatency) / time.Duration(status.Reads)
+	if err != nil {
+		status.Failures++
+		status.ConsecutiveFailures++
+		status.LastFailure, status.LastError = &t, err.Error()
+		return
+	}
+	status.ConsecutiveFailures = 0
+	status.LastSuccess = &t
+}
+
+//Validate checks that the timer is scheduled either with an
+//interval or with a valid cron schedule
+func (intervalTimer *IntervalTimer) Validate() error {
+	if intervalTimer.Cron != "" {
+		if intervalTimer.Interval != nil || intervalTimer.FirstTime != nil {
+			return errors.New("The timer must have either a cron schedule or an interval, not both")
 		}
-		var firstTime time.Time
-		firstTime = *intervalTimer.FirstTime
-		if intervalTimer.LastRun != nil {
-			firstTime = *intervalTimer.LastRun
+		_, err := ParseCron(intervalTimer.Cron, intervalTimer.Timezone)
+		return err
+	}
+	if intervalTimer.Timezone != "" {
+		return errors.New("The time zone is only used with a cron schedule")
+	}
+	if intervalTimer.Interval == nil {
+		return errors.New("The timer must have either a cron schedule or an interval")
+	}
+	if *intervalTimer.Interval <= 0 {
+		return fmt.Errorf("The interval must be greater than 0, got %v", *intervalTimer.Interval)
+	}
+	return nil
+}
+
+//NextRun returns the first run of the timer after t. With an interval the
+//runs are FirstTime (or LastRun if the timer already ran) plus a whole
+//number of intervals. A timer having an interval that never ran and has
+//no FirstTime runs at t
+func (intervalTimer *IntervalTimer) NextRun(t time.Time) (time.Time, error) {
+	if intervalTimer.Cron != "" {
+		schedule, err := ParseCron(intervalTimer.Cron, intervalTimer.Timezone)
+		if err != nil {
+			return time.Time{}, err
 		}
-		//TODO Find a better method to calculate when to run first
-		//as this can take a lot of time for a FirstTime set well before
-		//and a short interval
-		for firstTime.Before(time.Now()) {
-			firstTime = firstTime.Add(*intervalTimer.Interval)
+		return schedule.Next(t)
+	}
+	if intervalTimer.Interval == nil || *intervalTimer.Interval <= 0 {
+		return time.Time{}, errors.New("The timer has no interval")
+	}
+	var base time.Time
+	switch {
+	case intervalTimer.LastRun != nil:
+		base = *intervalTimer.LastRun
+	case intervalTimer.FirstTime != nil:
+		base = *intervalTimer.FirstTime
+	default:
+		return t, nil
+	}
+	if base.After(t) {
+		return base, nil
+	}
+	interval := *intervalTimer.Interval
+	return base.Add((t.Sub(base)/interval + 1) * interval), nil
+}
+
+//start starts the goroutine reading at every run of the timer until ctx
+//is cancelled. A paused timer or one that can not run is not started. It
+//is called by the schedule provider with the timers locked
+func (intervalTimer *IntervalTimer) start(ctx context.Context) {
+	if intervalTimer.Paused || intervalTimer.Error != "" || intervalTimer.cancel != nil {
+		return
+	}
+	//the goroutine works on a copy, the timer can change while it waits
+	schedule := *intervalTimer
+	ctx, intervalTimer.cancel = context.WithCancel(ctx)
+	intervalTimer.stopped = make(chan struct{})
+	go schedule.run(ctx, intervalTimer.stopped)
+}
+
+//run reads at every run of the timer until ctx is done and closes stopped
+//when it returns. The runs missed while reading are skipped
+func (intervalTimer IntervalTimer) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	next, err := intervalTimer.NextRun(time.Now())
+	for err == nil {
+		intervalTimer.schProvider.setNextRun(stopped, next)
+		wait := time.NewTimer(next.Sub(time.Now()))
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return
+		case <-wait.C:
 		}
-		startIn := firstTime.Sub(time.Now())
-		intervalTimer.timer = time.AfterFunc(startIn, intervalTimer.startReading)
-	}
-}
-
-//startReading is called to start reading periodically
-func (intervalTimer *IntervalTimer) startReading() {
-	if intervalTimer.Interval != nil {
-		intervalTimer.ticker = time.NewTicker(*intervalTimer.Interval)
-		go func() {
-			log.Printf("1 Reading sensor %d, start location=%d, length=%d, type=%s, %v",
-				intervalTimer.SensorAddress, intervalTimer.StartLocation,
-				intervalTimer.ReadLength, intervalTimer.ReadType, time.Now())
-			intervalTimer.Read()
-			for t := range intervalTimer.ticker.C {
-				log.Printf("2 Reading sensor %d, start location=%d, length=%d, type=%s, %v",
-					intervalTimer.SensorAddress, intervalTimer.StartLocation,
-					intervalTimer.ReadLength, intervalTimer.ReadType, t)
-				intervalTimer.Read()
-			}
-		}()
+		log.Printf("Reading bus %s, sensor %d, start location=%d, length=%d, type=%s, %v",
+			intervalTimer.Bus, intervalTimer.SensorAddress, intervalTimer.StartLocation,
+			intervalTimer.ReadLength, intervalTimer.ReadType, next)
+		last := next
+		intervalTimer.LastRun = &last
+		intervalTimer.Read()
+		next, err = intervalTimer.NextRun(time.Now())
 	}
+	log.Printf("The timer %d stopped: %s\n", intervalTimer.ID, err.Error())
+}
 
+//stop cancels the goroutine of the timer and returns a channel closed
+//once it returns, nil if the timer was not started. It is called by the
+//schedule provider with the timers locked
+func (intervalTimer *IntervalTimer) stop() chan struct{} {
+	if intervalTimer.cancel == nil {
+		return nil
+	}
+	log.Printf("Stopping %s, %d, %d,%d, %s\n", intervalTimer.Bus, intervalTimer.SensorAddress,
+		intervalTimer.StartLocation, intervalTimer.ReadLength,
+		intervalTimer.ReadType)
+	intervalTimer.cancel()
+	stopped := intervalTimer.stopped
+	intervalTimer.cancel, intervalTimer.stopped = nil, nil
+	intervalTimer.status.NextRun = nil
+	return stopped
 }
 
-func (schProvider *ScheduleProvider) Read(sensorAddress uint8, readType string, location uint16, length uint16, persist bool, intervalTimer *IntervalTimer) error {
-	if schProvider.readingChannel == nil {
-		log.Println("No reading provider defined.")
-		return fmt.Errorf("No reading channel provided")
+//waitFor waits for the goroutines of the stopped timers to return.
+//It must be called without the timers locked, as a read in progress
+//locks them to set the last run of its timer
+func waitFor(stopped []chan struct{}) {
+	for _, s := range stopped {
+		if s != nil {
+			<-s
+		}
 	}
-	readingProvider := <-schProvider.readingChannel
-	reading, err := readingProvider.GetReading(sensorAddress,
-		readType, location,
-		length)
-	schProvider.readingChannel <- readingProvider
-	now := time.Now()
+}
+
+//Read reads the sensor having sensorAddress on bus. Only one read at a
+//time is done on a bus
+func (schProvider *ScheduleProvider) Read(bus string, sensorAddress uint8, readType string, location uint16, length uint16, persist bool, intervalTimer *IntervalTimer) error {
+	_, err := schProvider.read(bus, sensorAddress, readType, location, length, persist, intervalTimer)
+	return err
+}
+
+//read does the work of Read and returns the reading done. The result
+//of the read is added to the status of intervalTimer, if not nil, and
+//the last run of intervalTimer is kept
+func (schProvider *ScheduleProvider) read(bus string, sensorAddress uint8, readType string, location uint16, length uint16, persist bool, intervalTimer *IntervalTimer) (reading *common.Reading, err error) {
+	var latency time.Duration
 	if intervalTimer != nil {
-		intervalTimer.LastRun = &now
+		defer func() {
+			schProvider.record(intervalTimer.ID, intervalTimer.LastRun, time.Now(), latency, err)
+		}()
 	}
+	err = schProvider.useBus(bus, func(readingProvider ReadingProvider) error {
+		var err error
+		start := time.Now()
+		reading, err = readingProvider.GetReading(sensorAddress,
+			readType, location,
+			length)
+		latency = time.Now().Sub(start)
+		return err
+	})
 	if err != nil {
-		log.Printf("Error: %s, sensor %d, start %d, length %d, type %s\n",
-			err.Error(), sensorAddress, location,
+		log.Printf("Error: %s, bus %s, sensor %d, start %d, length %d, type %s\n",
+			err.Error(), common.BusName(bus), sensorAddress, location,
 			length, readType)
-		return err
+		return nil, err
 	}
+	schProvider.calculate(reading)
+	schProvider.notify(reading)
 	if persist {
 		if reading != nil {
 			err = (*schProvider.persistenceProvider).SaveSensorReading(*reading)
 			if err != nil {
 				log.Printf("Error persisting %s\n", err.Error())
-				return err
+				return reading, err
 			}
 		}
 	}
-	return nil
+	return reading, nil
+}
+
+//calculate fills in the calculated values of reading using the read
+//groups configured for the sensor
+func (schProvider *ScheduleProvider) calculate(reading *common.Reading) {
+	if reading == nil || schProvider.configProvider == nil || *schProvider.configProvider == nil {
+		return
+	}
+	sensor, err := (*schProvider.configProvider).GetSensorByAddress(reading.Bus, reading.Sensor)
+	if err != nil {
+		return
+	}
+	readgroups.Calculate(*sensor, reading)
 }
 
+//AddReadingListener adds listener to the listeners called
+//with every reading done by the schedule provider
+func (schProvider *ScheduleProvider) AddReadingListener(listener ReadingListener) {
+	if schProvider.listenerMutex == nil {
+		schProvider.listenerMutex = &sync.RWMutex{}
+	}
+	schProvider.listenerMutex.Lock()
+	defer schProvider.listenerMutex.Unlock()
+	schProvider.listeners = append(schProvider.listeners, listener)
+}
+
+//notify calls the reading listeners with reading
+func (schProvider *ScheduleProvider) notify(reading *common.Reading) {
+	if reading == nil || schProvider.listenerMutex == nil {
+		return
+	}
+	schProvider.listenerMutex.RLock()
+	listeners := schProvider.listeners
+	schProvider.listenerMutex.RUnlock()
+	for _, listener := range listeners {
+		listener(*reading)
+	}
+}
+
+//ReadReadGroup reads the registers used by the read group starting at
+//startLocation on the sensor having address on bus. The registers are read
+//from the type configured on the sensor at startLocation, input if none.
+//The reading is returned with its calculated values and it is not persisted
+func (schProvider *ScheduleProvider) ReadReadGroup(bus string, address uint8, startLocation uint16) (*common.Reading, error) {
+	if schProvider.configProvider == nil || *schProvider.configProvider == nil {
+		return nil, errors.New("No config provider to find the read group")
+	}
+	sensor, err := (*schProvider.configProvider).GetSensorByAddress(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	var worker common.ReadGroupWorker
+	for _, rg := range sensor.ReadGroups {
+		if rg.StartLocation == startLocation {
+			if worker, err = readgroups.NewWorker(rg); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if worker == nil {
+		err = fmt.Errorf("The sensor %d has no read group starting at %d", address, startLocation)
+		log.Println(err.Error())
+		return nil, err
+	}
+	registerType := common.Input
+	for _, register := range sensor.Registers {
+		if register.Location == startLocation {
+			registerType = register.Type
+			break
+		}
+	}
+
+	var reading *common.Reading
+	err = schProvider.useBus(bus, func(readingProvider ReadingProvider) error {
+		reading, err = readingProvider.GetReading(address, registerType, startLocation, worker.RegisterCount())
+		return err
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	readgroups.Calculate(*sensor, reading)
+	return reading, nil
+}
+
+//Write writes the values of write in the holding registers or the coils
+//of the sensor. The write waits for the read in progress on the bus to finish
+func (schProvider *ScheduleProvider) Write(write common.Write) error {
+	err := schProvider.useBus(write.Bus, func(readingProvider ReadingProvider) error {
+		switch {
+		case len(write.Values) == 0:
+			return fmt.Errorf("Nothing to write")
+		case write.Type == common.Holding && len(write.Values) == 1:
+			return readingProvider.WriteRegister(write.Sensor, write.StartLocation, write.Values[0])
+		case write.Type == common.Holding:
+			return readingProvider.WriteRegisters(write.Sensor, write.StartLocation, write.Values)
+		case write.Type == common.Coil && len(write.Values) == 1:
+			return readingProvider.WriteCoil(write.Sensor, write.StartLocation, write.Values[0] != 0)
+		case write.Type == common.Coil:
+			coils := make([]bool, len(write.Values))
+			for i, value := range write.Values {
+				coils[i] = value != 0
+			}
+			return readingProvider.WriteCoils(write.Sensor, write.StartLocation, coils)
+		}
+		return fmt.Errorf("Registers of type %s can not be written", write.Type)
+	})
+	if err != nil {
+		log.Printf("Error: %s, writing bus %s, sensor %d, start %d, values %v, type %s\n",
+			err.Error(), common.BusName(write.Bus), write.Sensor, write.StartLocation,
+			write.Values, write.Type)
+	}
+	return err
+}
+
+//Read reads what the timer reads, storing the reading if Persist is set
 func (intervalTimer *IntervalTimer) Read() error {
-	return intervalTimer.schProvider.Read(intervalTimer.SensorAddress,
+	return intervalTimer.schProvider.Read(intervalTimer.Bus,
+		intervalTimer.SensorAddress,
 		intervalTimer.ReadType,
 		intervalTimer.StartLocation,
 		intervalTimer.ReadLength,
-		true,
+		intervalTimer.Persist,
 		intervalTimer)
 }
 
-//Stop will stop the ticker so that no more reading will happen
-func (intervalTimer *IntervalTimer) Stop() {
-	log.Printf("Stopping %d, %d,%d, %s\n", intervalTimer.SensorAddress,
-		intervalTimer.StartLocation, intervalTimer.ReadLength,
-		intervalTimer.ReadType)
-	if intervalTimer.ticker != nil {
-		//(*intervalTimer.ticker).Stop()
-		intervalTimer.ticker.Stop()
+//NewScheduleProvider initializes a ScheduleProvider and creates a channel for
+//reading for each of the reading providers. The read groups of the sensors
+//configured in cp are calculated for every reading
+func (ScheduleProvider) NewScheduleProvider(cp *configprovider.ConfigProvider, pp *persistenceprovider.PersistenceProvider, rps ...ReadingProvider) *ScheduleProvider {
+	schProvider := ScheduleProvider{configProvider: cp, persistenceProvider: pp}
+	schProvider.readingProviders = make(map[string]ReadingProvider)
+	schProvider.readingChannels = make(map[string]chan ReadingProvider)
+	schProvider.busMutex = &sync.RWMutex{}
+	schProvider.listenerMutex = &sync.RWMutex{}
+	schProvider.timerMutex = &sync.Mutex{}
+	schProvider.saveMutex = &sync.Mutex{}
+	for _, rp := range rps {
+		schProvider.AddReadingProvider(rp)
 	}
+	return &schProvider
 }
 
-//NewScheduleProvider initializes a ScheduleProvider and creates a channel for
-//reading
-func (ScheduleProvider) NewScheduleProvider(rp ReadingProvider, pp *persistenceprovider.PersistenceProvider) *ScheduleProvider {
-	schProvider := ScheduleProvider{readingProvider: rp, persistenceProvider: pp}
-	schProvider.readingChannel = make(chan ReadingProvider, 1)
-	return &schProvider
+//busChannel returns the channel holding the reading provider of bus
+func (schProvider *ScheduleProvider) busChannel(bus string) (chan ReadingProvider, error) {
+	if schProvider.busMutex == nil {
+		return nil, fmt.Errorf("No reading provider defined!")
+	}
+	schProvider.busMutex.RLock()
+	defer schProvider.busMutex.RUnlock()
+	readingChannel, ok := schProvider.readingChannels[common.BusName(bus)]
+	if !ok {
+		return nil, fmt.Errorf("No reading provider defined for bus %s", common.BusName(bus))
+	}
+	return readingChannel, nil
 }
 
-//AddTimer adds an interval timer to the schedule provider
-func (schProvider *ScheduleProvider) AddTimer(intervalTimer IntervalTimer) error {
-	if schProvider.readingProvider == nil {
-		return fmt.Errorf("No reading provider defined!")
+//useBus waits for the reading provider of bus to be free and calls fn with it.
+//The other reads and writes on bus wait until fn returns
+func (schProvider *ScheduleProvider) useBus(bus string, fn func(ReadingProvider) error) error {
+	readingChannel, err := schProvider.busChannel(bus)
+	if err != nil {
+		return err
+	}
+	readingProvider := <-readingChannel
+	defer func() { readingChannel <- readingProvider }()
+	return fn(readingProvider)
+}
+
+//AddReadingProvider adds the reading provider for a new bus
+func (schProvider *ScheduleProvider) AddReadingProvider(rp ReadingProvider) error {
+	if schProvider.busMutex == nil {
+		return fmt.Errorf("The schedule provider was not initialized")
+	}
+	bus := common.BusName(rp.GetBusConfig().Name)
+	schProvider.busMutex.Lock()
+	defer schProvider.busMutex.Unlock()
+	if _, ok := schProvider.readingProviders[bus]; ok {
+		return fmt.Errorf("There is already a reading provider for bus %s", bus)
+	}
+	readingChannel := make(chan ReadingProvider, 1)
+	readingChannel <- rp
+	schProvider.readingProviders[bus] = rp
+	schProvider.readingChannels[bus] = readingChannel
+	return nil
+}
+
+//RemoveReadingProvider removes the reading provider of bus after
+//the read in progress on that bus finishes. The buses still used
+//by timers can not be removed
+func (schProvider *ScheduleProvider) RemoveReadingProvider(bus string) error {
+	bus = common.BusName(bus)
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	for _, it := range schProvider.timers {
+		if it.Bus == bus {
+			return fmt.Errorf("The timer %d still reads bus %s", it.ID, bus)
+		}
+	}
+	readingChannel, err := schProvider.busChannel(bus)
+	if err != nil {
+		return err
+	}
+	readingProvider := <-readingChannel
+	schProvider.busMutex.Lock()
+	delete(schProvider.readingProviders, bus)
+	delete(schProvider.readingChannels, bus)
+	schProvider.busMutex.Unlock()
+	readingChannel <- readingProvider
+	return nil
+}
+
+//GetBusConfig returns the configuration used by the reading provider of bus
+func (schProvider *ScheduleProvider) GetBusConfig(bus string) (*common.BusConfig, error) {
+	if schProvider.busMutex == nil {
+		return nil, fmt.Errorf("No reading provider defined!")
+	}
+	schProvider.busMutex.RLock()
+	defer schProvider.busMutex.RUnlock()
+	rp, ok := schProvider.readingProviders[common.BusName(bus)]
+	if !ok {
+		return nil, fmt.Errorf("No reading provider defined for bus %s", common.BusName(bus))
+	}
+	busConfig := rp.GetBusConfig()
+	return &busConfig, nil
+}
+
+//SetBusConfig changes the configuration of the bus having the
+//name busConfig.Name. The change happens between two reads
+func (schProvider *ScheduleProvider) SetBusConfig(busConfig common.BusConfig) error {
+	readingChannel, err := schProvider.busChannel(busConfig.Name)
+	if err != nil {
+		return err
+	}
+	readingProvider := <-readingChannel
+	defer func() { readingChannel <- readingProvider }()
+	return readingProvider.SetBusConfig(busConfig)
+}
+
+//checkTimer returns an error if intervalTimer can not be run by the schedule provider
+func (schProvider *ScheduleProvider) checkTimer(intervalTimer IntervalTimer) error {
+	if _, err := schProvider.busChannel(intervalTimer.Bus); err != nil {
+		return err
 	}
 	if intervalTimer.Persist && schProvider.persistenceProvider == nil {
 		return fmt.Errorf("Error adding timer with persistence: No persistece provider defined!")
 	}
-	intervalTimer.readingChannel = schProvider.readingChannel
+	return intervalTimer.Validate()
+}
+
+//install makes intervalTimer read through the schedule provider
+func (schProvider *ScheduleProvider) install(intervalTimer *IntervalTimer) {
+	intervalTimer.Bus = common.BusName(intervalTimer.Bus)
 	intervalTimer.persistenceProvider = schProvider.persistenceProvider
 	intervalTimer.schProvider = schProvider
+	intervalTimer.cancel, intervalTimer.stopped = nil, nil
+	intervalTimer.Status, intervalTimer.status = nil, TimerStatus{}
+	intervalTimer.Error = ""
+}
+
+//AddTimer adds an interval timer to the schedule provider.
+//The timers are saved after every change
+func (schProvider *ScheduleProvider) AddTimer(intervalTimer IntervalTimer) error {
+	if err := schProvider.checkTimer(intervalTimer); err != nil {
+		return err
+	}
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	schProvider.install(&intervalTimer)
 	intervalTimer.ID = schProvider.idForIntervalTimer
+	intervalTimer.LastRun = nil
 	schProvider.idForIntervalTimer++
-	schProvider.Timers = append(schProvider.Timers, intervalTimer)
-	if schProvider.started {
-		go schProvider.Timers[len(schProvider.Timers)-1].Start()
+	schProvider.timers = append(schProvider.timers, &intervalTimer)
+	if schProvider.ctx != nil {
+		intervalTimer.start(schProvider.ctx)
 	}
-	return nil
+	return schProvider.save()
 }
 
-//RemoveTimer removes a timer from the scheduled ones
+//RemoveTimer removes a timer from the scheduled ones. It returns
+//once the read in progress of the timer, if any, is done
 func (schProvider *ScheduleProvider) RemoveTimer(id int) error {
-	for i, it := range schProvider.Timers {
+	var stopped chan struct{}
+	defer func() { waitFor([]chan struct{}{stopped}) }()
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	i := schProvider.timer(id)
+	if i < 0 {
+		return fmt.Errorf("the timer with the ID %d was not found", id)
+	}
+	stopped = schProvider.timers[i].stop()
+	schProvider.timers = append(schProvider.timers[:i], schProvider.timers[i+1:]...)
+	return schProvider.save()
+}
+
+//timer returns the index of the timer having id, -1 if there is none.
+//It is called with the timers locked
+func (schProvider *ScheduleProvider) timer(id int) int {
+	for i, it := range schProvider.timers {
 		if it.ID == id {
-			if schProvider.started {
-				t := schProvider.Timers[i]
-				t.Stop()
-				log.Println("Stopping started")
-			}
-			schProvider.Timers = append(schProvider.Timers[:i], schProvider.Timers[i+1:]...)
-			return nil
+			return i
 		}
 	}
-	return fmt.Errorf("the timer with the ID %d was not found", id)
+	return -1
+}
+
+//record sets the last run of the timer having id, if it still exists, and
+//adds to its status a read done at t in latency ending with err. lastRun is
+//the time the read was scheduled or asked for, so that the runs of an
+//interval timer do not drift by the time taken by the reads
+//The timers are saved after they are unlocked, so that the last run is kept
+func (schProvider *ScheduleProvider) record(id int, lastRun *time.Time, t time.Time, latency time.Duration, err error) {
+	schProvider.timerMutex.Lock()
+	i := schProvider.timer(id)
+	if i < 0 {
+		schProvider.timerMutex.Unlock()
+		return
+	}
+	schProvider.timers[i].LastRun = lastRun
+	schProvider.timers[i].status.add(t, latency, err)
+	version, timers := schProvider.snapshot()
+	schProvider.timerMutex.Unlock()
+	schProvider.write(version, timers)
+}
+
+//setNextRun sets the next run of the timer started with stopped. The
+//timer is found by its channel, as a changed timer keeps its id
+func (schProvider *ScheduleProvider) setNextRun(stopped chan struct{}, nextRun time.Time) {
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	for _, it := range schProvider.timers {
+		if it.stopped == stopped {
+			it.status.NextRun = &nextRun
+			return
+		}
+	}
+}
+
+//GetTimer returns a copy of the timer having id with its status
+func (schProvider *ScheduleProvider) GetTimer(id int) (*IntervalTimer, error) {
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	i := schProvider.timer(id)
+	if i < 0 {
+		return nil, fmt.Errorf("the timer with the ID %d was not found", id)
+	}
+	it := schProvider.timers[i].withStatus()
+	return &it, nil
+}
+
+//GetTimers returns a copy of the timers with their status,
+//sorted by the order they were added in
+func (schProvider *ScheduleProvider) GetTimers() []IntervalTimer {
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	timers := make([]IntervalTimer, len(schProvider.timers))
+	for i, it := range schProvider.timers {
+		timers[i] = it.withStatus()
+	}
+	return timers
+}
+
+//copyTimers returns a copy of the timers. It is called with the timers locked
+func (schProvider *ScheduleProvider) copyTimers() []IntervalTimer {
+	timers := make([]IntervalTimer, len(schProvider.timers))
+	for i, it := range schProvider.timers {
+		timers[i] = *it
+	}
+	return timers
+}
+
+//withStatus returns a copy of the timer having its status set.
+//It is called with the timers locked
+func (intervalTimer *IntervalTimer) withStatus() IntervalTimer {
+	it := *intervalTimer
+	status := intervalTimer.status
+	it.Status = &status
+	return it
+}
+
+//ChangeTimer replaces the timer having id with after. The timer keeps
+//its id, its last run, its status and whether it is paused. A running
+//timer is restarted with the new schedule
+func (schProvider *ScheduleProvider) ChangeTimer(id int, after IntervalTimer) error {
+	if err := schProvider.checkTimer(after); err != nil {
+		return err
+	}
+	var stopped chan struct{}
+	defer func() { waitFor([]chan struct{}{stopped}) }()
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	i := schProvider.timer(id)
+	if i < 0 {
+		return fmt.Errorf("the timer with the ID %d was not found", id)
+	}
+	before := schProvider.timers[i]
+	stopped = before.stop()
+	schProvider.install(&after)
+	after.ID, after.LastRun, after.Paused = before.ID, before.LastRun, before.Paused
+	after.status = before.status
+	schProvider.timers[i] = &after
+	if schProvider.ctx != nil {
+		after.start(schProvider.ctx)
+	}
+	return schProvider.save()
+}
+
+//PauseTimer stops the timer having id until it is resumed. It returns
+//once the read in progress of the timer, if any, is done
+func (schProvider *ScheduleProvider) PauseTimer(id int) error {
+	var stopped chan struct{}
+	defer func() { waitFor([]chan struct{}{stopped}) }()
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	i := schProvider.timer(id)
+	if i < 0 {
+		return fmt.Errorf("the timer with the ID %d was not found", id)
+	}
+	if schProvider.timers[i].Paused {
+		return fmt.Errorf("The timer %d is already paused", id)
+	}
+	stopped = schProvider.timers[i].stop()
+	schProvider.timers[i].Paused = true
+	return schProvider.save()
+}
+
+//ResumeTimer starts again the paused timer having id
+func (schProvider *ScheduleProvider) ResumeTimer(id int) error {
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	i := schProvider.timer(id)
+	if i < 0 {
+		return fmt.Errorf("the timer with the ID %d was not found", id)
+	}
+	if !schProvider.timers[i].Paused {
+		return fmt.Errorf("The timer %d is not paused", id)
+	}
+	schProvider.timers[i].Paused = false
+	if schProvider.ctx != nil {
+		schProvider.timers[i].start(schProvider.ctx)
+	}
+	return schProvider.save()
+}
+
+//RunTimer reads right away what the timer having id reads and returns
+//the reading. The schedule of the timer does not change, paused or not
+func (schProvider *ScheduleProvider) RunTimer(id int) (*common.Reading, error) {
+	it, err := schProvider.GetTimer(id)
+	if err != nil {
+		return nil, err
+	}
+	if it.Error != "" {
+		return nil, fmt.Errorf("The timer %d can not run: %s", id, it.Error)
+	}
+	now := time.Now()
+	it.LastRun = &now
+	return schProvider.read(it.Bus, it.SensorAddress, it.ReadType, it.StartLocation, it.ReadLength, it.Persist, it)
 }
 
 //Start for ScheduleProvider
-//will generate a go routine for each IntervalTimer
+//will generate a go routine for each IntervalTimer.
+//The goroutines run until Stop is called
 func (schProvider *ScheduleProvider) Start() {
-	for _, interval := range schProvider.Timers {
-		//start a go routine for each interval
-		i := interval
-		go i.Start()
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	if schProvider.ctx != nil {
+		return
+	}
+	schProvider.ctx, schProvider.cancel = context.WithCancel(context.Background())
+	for _, it := range schProvider.timers {
+		it.start(schProvider.ctx)
 	}
-	schProvider.started = true
-	schProvider.readingChannel <- schProvider.readingProvider
 }
 
-//Stop send the signal to stop to all IntervalTimers
+//Stop stops all the IntervalTimers. It returns once the reads in progress are done
 func (schProvider *ScheduleProvider) Stop() {
-	for _, interval := range schProvider.Timers {
-		interval.Stop()
+	var stopped []chan struct{}
+	defer func() { waitFor(stopped) }()
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	if schProvider.ctx == nil {
+		return
+	}
+	schProvider.cancel()
+	schProvider.ctx, schProvider.cancel = nil, nil
+	for _, it := range schProvider.timers {
+		stopped = append(stopped, it.stop())
 	}
-	schProvider.started = false
 }
 
-//Save saves the scheduleprovider using the persistence provider
+//Save saves the timers using the persistence provider
 func (schProvider *ScheduleProvider) Save() error {
-	schFile, err := os.Create("schedule.json")
-	if err != nil {
-		return err
+	if schProvider.persistenceProvider == nil || *schProvider.persistenceProvider == nil {
+		return fmt.Errorf("No persistence provider defined to save the schedule")
 	}
-	defer schFile.Close()
-	jsonEncoder := json.NewEncoder(schFile)
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	return schProvider.save()
+}
 
-	if err = jsonEncoder.Encode(schProvider); err != nil {
+//save saves the timers after a change, if there is a persistence
+//provider. It is called with the timers locked
+func (schProvider *ScheduleProvider) save() error {
+	return schProvider.write(schProvider.snapshot())
+}
+
+//snapshot returns a new version of the timers to be saved and a copy
+//of them. It is called with the timers locked
+func (schProvider *ScheduleProvider) snapshot() (int, []IntervalTimer) {
+	schProvider.version++
+	return schProvider.version, schProvider.copyTimers()
+}
+
+//write saves timers, the copy having version, unless a later copy was
+//already saved. It does not need the timers locked
+func (schProvider *ScheduleProvider) write(version int, timers []IntervalTimer) error {
+	if schProvider.persistenceProvider == nil || *schProvider.persistenceProvider == nil {
+		return nil
+	}
+	schProvider.saveMutex.Lock()
+	defer schProvider.saveMutex.Unlock()
+	if version < schProvider.savedVersion {
+		return nil
+	}
+	if err := (*schProvider.persistenceProvider).SaveItem(scheduleItem, timers); err != nil {
+		log.Printf("Error saving the schedule: %s\n", err.Error())
 		return err
 	}
-
+	schProvider.savedVersion = version
 	return nil
-
 }
 
-//Load loads the schedule provider from the provided persistenceprovider
+//Load replaces the timers with the ones saved in the persistence provider.
+//The timers keep their ids and are started if the schedule provider is.
+//Loading again gives the same timers. The saved timers that can no longer
+//run, for example because their bus was removed, are kept with their Error
+//set and are not started
 func (schProvider *ScheduleProvider) Load() error {
-	if _, err := os.Stat("schedule.json"); err != nil {
-		log.Println("Schedule file not found")
-		return fmt.Errorf("No schedule file found")
+	if schProvider.persistenceProvider == nil || *schProvider.persistenceProvider == nil {
+		return fmt.Errorf("No persistence provider defined to load the schedule")
 	}
-
-	schFile, err := os.Open("schedule.json")
+	var timers []IntervalTimer
+	err := persistenceprovider.ReadItemInto(*schProvider.persistenceProvider, scheduleItem, &timers)
 	if err != nil {
-		log.Printf("Error while opening the sch file %s: %s",
-			"shedule.json", err.Error())
 		return err
 	}
-	defer schFile.Close()
-	_, err = schFile.Stat()
-	if err != nil {
-		return err
+
+	var stopped []chan struct{}
+	defer func() { waitFor(stopped) }()
+	schProvider.timerMutex.Lock()
+	defer schProvider.timerMutex.Unlock()
+	loaded := []*IntervalTimer{}
+	for i := range timers {
+		it := &timers[i]
+		schProvider.install(it)
+		if err = schProvider.checkTimer(*it); err != nil {
+			log.Printf("The timer %d can not run: %s\n", it.ID, err.Error())
+			it.Error = err.Error()
+		}
+		loaded = append(loaded, it)
+		if it.ID >= schProvider.idForIntervalTimer {
+			schProvider.idForIntervalTimer = it.ID + 1
+		}
 	}
-	sch := ScheduleProvider{}
-	jsonParser := json.NewDecoder(schFile)
-	if err = jsonParser.Decode(&sch); err != nil {
-		return err
+	for _, it := range schProvider.timers {
+		stopped = append(stopped, it.stop())
 	}
-
-	for _, t := range sch.Timers {
-		schProvider.AddTimer(t)
+	schProvider.timers = loaded
+	if schProvider.ctx != nil {
+		for _, it := range schProvider.timers {
+			it.start(schProvider.ctx)
+		}
 	}
 	return nil
 }
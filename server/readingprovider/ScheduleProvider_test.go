@@ -2,6 +2,8 @@ package readingprovider
 
 import (
 	"fmt"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,8 +23,8 @@ func TestScheduleProviderNotNewShouldFail(t *testing.T) {
 
 func TestScheduleProviderShouldFail(t *testing.T) {
 	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
-	rp := MockReadingProvider{}.NewReadingProvider(&cp)
-	schprovider := ScheduleProvider{}.NewScheduleProvider(rp, nil)
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
 	it := IntervalTimer{}
 	it.Persist = true
 	err := schprovider.AddTimer(it)
@@ -48,9 +50,9 @@ func TestScheduleProviderShouldOk(t *testing.T) {
 		Name: "test ReadValue", Location: 10, Type: common.Holding}}
 	cp.AddSensor(sensor1)
 	cp.AddSensor(sensor2)
-	rp := MockReadingProvider{}.NewReadingProvider(&cp)
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
 	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
-	schprovider := ScheduleProvider{}.NewScheduleProvider(rp, &pp)
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
 	firstRun := time.Now().Add(time.Second * 10)
 	it := IntervalTimer{}
 	it.Persist = true
@@ -87,19 +89,519 @@ func TestScheduleProviderShouldOk(t *testing.T) {
 		t.Fatal("No error expected when saving the schedule provider. Got:", err.Error())
 	}
 
-	schprovider2 := ScheduleProvider{}.NewScheduleProvider(rp, &pp)
+	schprovider2 := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
 	err = schprovider2.Load()
 
 	if err != nil {
 		t.Fatal("No error expected when loading the schedule provider. Got:", err.Error())
 	}
 
-	if schprovider.Timers[0].ReadType != schprovider2.Timers[0].ReadType ||
-		schprovider.Timers[0].FirstTime.String() != schprovider2.Timers[0].FirstTime.String() ||
-		schprovider.Timers[0].Interval.String() != schprovider2.Timers[0].Interval.String() ||
-		schprovider.Timers[0].Persist != schprovider2.Timers[0].Persist ||
-		schprovider.Timers[0].Repeat != schprovider2.Timers[0].Repeat {
+	if schprovider.GetTimers()[0].ReadType != schprovider2.GetTimers()[0].ReadType ||
+		!schprovider.GetTimers()[0].FirstTime.Equal(*schprovider2.GetTimers()[0].FirstTime) ||
+		schprovider.GetTimers()[0].Interval.String() != schprovider2.GetTimers()[0].Interval.String() ||
+		schprovider.GetTimers()[0].Persist != schprovider2.GetTimers()[0].Persist ||
+		schprovider.GetTimers()[0].Repeat != schprovider2.GetTimers()[0].Repeat {
 		t.Fatalf("Expected %v, got %v after load", schprovider, schprovider2)
 	}
 
 }
+
+func TestScheduleProviderSeveralBusesShouldOk(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	cp.SetBus(common.BusConfig{Name: "line2", Transport: common.TCP, Address: "127.0.0.1:502"})
+	sensor := common.Sensor{Bus: "line2", Address: 33, Description: "Mock"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "test ReadValue", Location: 100, Type: common.Holding}}
+	cp.AddSensor(sensor)
+
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+
+	if err := schprovider.Read("line2", 33, common.Holding, 100, 1, false, nil); err == nil {
+		t.Fatal("Expected error when reading from a bus without a reading provider, got nil")
+	}
+	it := IntervalTimer{Bus: "line2", SensorAddress: 33, ReadType: common.Holding,
+		StartLocation: 100, ReadLength: 1}
+	interv := time.Second
+	it.Interval = &interv
+	if err := schprovider.AddTimer(it); err == nil {
+		t.Fatal("Expected error when adding a timer for a bus without a reading provider, got nil")
+	}
+
+	schprovider.AddReadingProvider(MockReadingProvider{}.NewReadingProvider(&cp, "line2"))
+	err := schprovider.Read("line2", 33, common.Holding, 100, 1, true, nil)
+	if err != nil {
+		t.Fatalf("No error expected when reading from line2, got %s", err.Error())
+	}
+	count, _ := pp.GetSensorReadingCountInPeriod("line2", 33,
+		time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	if count != 1 {
+		t.Fatalf("Expected one reading saved for sensor 33 on line2, got %d", count)
+	}
+	if err = schprovider.Read(common.DefaultBus, 33, common.Holding, 100, 1, false, nil); err == nil {
+		t.Fatal("Expected error when reading sensor 33 on the default bus, got nil")
+	}
+
+	if err = schprovider.AddTimer(it); err != nil {
+		t.Fatalf("No error expected when adding a timer for line2, got %s", err.Error())
+	}
+	if err = schprovider.RemoveReadingProvider("line2"); err == nil {
+		t.Fatal("Expected error when removing a bus used by a timer, got nil")
+	}
+}
+
+func TestScheduleProviderWriteShouldOk(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	sensor := common.Sensor{Address: 12, Description: "Mock"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "led", Location: 1, Type: common.Coil}}
+	cp.AddSensor(sensor)
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
+
+	writes := []common.Write{
+		common.Write{Sensor: 12, Type: common.Holding, StartLocation: 10, Values: []uint16{12}},
+		common.Write{Sensor: 12, Type: common.Holding, StartLocation: 102, Values: []uint16{2016, 4}},
+		common.Write{Sensor: 12, Type: common.Coil, StartLocation: 1, Values: []uint16{1}},
+		common.Write{Sensor: 12, Type: common.Coil, StartLocation: 1, Values: []uint16{0, 1}}}
+	for _, write := range writes {
+		if err := schprovider.Write(write); err != nil {
+			t.Fatalf("No error expected when writing %v, got %s", write, err.Error())
+		}
+	}
+	mock := rp.(*MockReadingProvider)
+	if len(mock.Writes) != len(writes) {
+		t.Fatalf("Expected %d writes, got %v", len(writes), mock.Writes)
+	}
+	for i, write := range writes {
+		write.Bus = common.DefaultBus
+		if !reflect.DeepEqual(mock.Writes[i], write) {
+			t.Fatalf("Expected %v, got %v", write, mock.Writes[i])
+		}
+	}
+
+	failing := []common.Write{
+		common.Write{Sensor: 12, Type: common.Input, StartLocation: 100, Values: []uint16{1}},
+		common.Write{Sensor: 12, Type: common.Holding, StartLocation: 10},
+		common.Write{Sensor: 13, Type: common.Holding, StartLocation: 10, Values: []uint16{1}},
+		common.Write{Bus: "line2", Sensor: 12, Type: common.Holding, StartLocation: 10, Values: []uint16{1}}}
+	for _, write := range failing {
+		if err := schprovider.Write(write); err == nil {
+			t.Fatalf("Expected error when writing %v, got nil", write)
+		}
+	}
+}
+
+func TestScheduleProviderReadShouldCalculate(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+	slave.SetInput(3, 100, 0x17, 0x38, 0x07E0, 4, 3, 12, 10, 50)
+
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	cp.SetBus(common.BusConfig{Name: "line1", Transport: common.TCP,
+		Address: slave.Address(), Timeout: time.Second})
+	sensor := common.Sensor{Bus: "line1", Address: 3, Description: "Scale"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "weight", Location: 100, Type: common.Input}}
+	sensor.ReadGroups = []common.ReadGroup{
+		common.ReadGroup{StartLocation: 100, ResultType: common.Hundredths},
+		common.ReadGroup{StartLocation: 102, ResultType: common.Timestamp}}
+	cp.AddSensor(sensor)
+
+	rp := ModBUSReadingProvider{}.NewReadingProvider(&cp, "line1")
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	var heard []common.Reading
+	schprovider.AddReadingListener(func(reading common.Reading) {
+		heard = append(heard, reading)
+	})
+
+	if err := schprovider.Read("line1", 3, common.Input, 100, 8, true, nil); err != nil {
+		t.Fatalf("No error expected when reading, got %s", err.Error())
+	}
+	if len(heard) != 1 || heard[0].CalculatedValues["100"] != 23.56 {
+		t.Fatalf("Expected the listener to get the calculated reading, got %v", heard)
+	}
+	readings, _ := pp.GetSensorReadingsInPeriod("line1", 3,
+		time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	if len(readings) != 1 {
+		t.Fatalf("Expected one saved reading, got %v", readings)
+	}
+	if readings[0].CalculatedValues["100"] != 23.56 || readings[0].SensorTime != "2016-04-03T12:10:50" {
+		t.Fatalf("Expected 23.56 read at 2016-04-03T12:10:50, got %v", readings[0])
+	}
+}
+
+func TestScheduleProviderTimerLifecycle(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	sensor := common.Sensor{Address: 33, Description: "Mock"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "test ReadValue", Location: 100, Type: common.Holding}}
+	cp.AddSensor(sensor)
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+
+	firstRun := time.Now().Add(time.Hour)
+	interval := time.Hour
+	err := schprovider.AddTimer(IntervalTimer{SensorAddress: 33, ReadType: common.Holding,
+		StartLocation: 100, ReadLength: 1, Persist: true, FirstTime: &firstRun, Interval: &interval})
+	if err != nil {
+		t.Fatalf("No error expected when adding the timer, got %s", err.Error())
+	}
+	schprovider.Start()
+	defer schprovider.Stop()
+
+	reading, err := schprovider.RunTimer(0)
+	if err != nil || reading == nil || reading.Sensor != 33 || schprovider.GetTimers()[0].LastRun == nil {
+		t.Fatalf("Expected a reading of sensor 33 and the last run set, got %v, %v", reading, err)
+	}
+	lastRun := *schprovider.GetTimers()[0].LastRun
+	if _, err = schprovider.RunTimer(1); err == nil {
+		t.Fatal("Expected error when running a missing timer, got nil")
+	}
+
+	changed := IntervalTimer{ID: 7, SensorAddress: 33, ReadType: common.Holding,
+		StartLocation: 100, ReadLength: 1, Cron: "@hourly", Timezone: "UTC"}
+	if err = schprovider.ChangeTimer(0, changed); err != nil {
+		t.Fatalf("No error expected when changing the timer, got %s", err.Error())
+	}
+	it, _ := schprovider.GetTimer(0)
+	if it == nil || it.Cron != "@hourly" || it.Interval != nil || it.LastRun == nil ||
+		!it.LastRun.Equal(lastRun) || schprovider.GetTimers()[0].cancel == nil {
+		t.Fatalf("Expected the running timer to keep its id and last run, got %v", it)
+	}
+	changed.Interval = &interval
+	if err = schprovider.ChangeTimer(0, changed); err == nil {
+		t.Fatal("Expected error when changing to a timer with an interval and a cron schedule, got nil")
+	}
+	if err = schprovider.ChangeTimer(1, IntervalTimer{Interval: &interval}); err == nil {
+		t.Fatal("Expected error when changing a missing timer, got nil")
+	}
+
+	if err = schprovider.PauseTimer(0); err != nil || !schprovider.GetTimers()[0].Paused ||
+		schprovider.GetTimers()[0].cancel != nil {
+		t.Fatalf("Expected the timer to be paused, got %v", err)
+	}
+	if err = schprovider.PauseTimer(0); err == nil {
+		t.Fatal("Expected error when pausing a paused timer, got nil")
+	}
+	if _, err = schprovider.RunTimer(0); err != nil {
+		t.Fatalf("No error expected when running a paused timer, got %s", err.Error())
+	}
+	if err = schprovider.ResumeTimer(0); err != nil || schprovider.GetTimers()[0].Paused ||
+		schprovider.GetTimers()[0].cancel == nil {
+		t.Fatalf("Expected the timer to be running again, got %v", err)
+	}
+	if err = schprovider.ResumeTimer(0); err == nil {
+		t.Fatal("Expected error when resuming a running timer, got nil")
+	}
+}
+
+func TestScheduleProviderWithoutPersistence(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	cp.AddSensor(common.Sensor{Address: 33, Description: "Mock", Registers: []common.Register{
+		common.Register{Name: "test ReadValue", Location: 100, Type: common.Holding}}})
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
+	readings := make(chan common.Reading, 10)
+	schprovider.AddReadingListener(func(reading common.Reading) {
+		select {
+		case readings <- reading:
+		default:
+		}
+	})
+	interval := 10 * time.Millisecond
+	err := schprovider.AddTimer(IntervalTimer{SensorAddress: 33, ReadType: common.Holding,
+		StartLocation: 100, ReadLength: 1, Interval: &interval})
+	if err != nil {
+		t.Fatalf("No error expected when adding a timer not storing its readings, got %s", err.Error())
+	}
+	schprovider.Start()
+	defer schprovider.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-readings:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the timer to read without a persistence provider")
+		}
+	}
+	if _, err = schprovider.RunTimer(0); err != nil {
+		t.Fatalf("No error expected when running a timer not storing its readings, got %s", err.Error())
+	}
+}
+
+func TestScheduleProviderShouldLoad(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	interval := time.Hour
+	firstRun := time.Now().Add(time.Hour)
+	timers := []IntervalTimer{
+		IntervalTimer{SensorAddress: 33, Interval: &interval, FirstTime: &firstRun},
+		IntervalTimer{SensorAddress: 34, Cron: "@daily"},
+		IntervalTimer{SensorAddress: 35, Cron: "0 9 * * 1-5", Timezone: "Europe/Bucharest"}}
+	for _, it := range timers {
+		if err := schprovider.AddTimer(it); err != nil {
+			t.Fatalf("No error expected when adding %v, got %s", it, err.Error())
+		}
+	}
+	schprovider.RemoveTimer(1)
+	schprovider.PauseTimer(2)
+
+	loaded := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	loaded.Start()
+	defer loaded.Stop()
+	for i := 0; i < 2; i++ {
+		if err := loaded.Load(); err != nil {
+			t.Fatalf("No error expected when loading the schedule, got %s", err.Error())
+		}
+		if len(loaded.GetTimers()) != 2 || loaded.GetTimers()[0].ID != 0 || loaded.GetTimers()[1].ID != 2 ||
+			!loaded.GetTimers()[0].FirstTime.Equal(firstRun) || *loaded.GetTimers()[0].Interval != interval ||
+			loaded.GetTimers()[1].Timezone != "Europe/Bucharest" || !loaded.GetTimers()[1].Paused {
+			t.Fatalf("Expected the timers 0 and 2 to be loaded, got %v", loaded.GetTimers())
+		}
+	}
+	if err := loaded.AddTimer(IntervalTimer{SensorAddress: 36, Cron: "@hourly"}); err != nil ||
+		loaded.GetTimers()[2].ID != 3 || loaded.GetTimers()[2].cancel == nil {
+		t.Fatalf("Expected the new timer to get the id 3 and to be started, got %v, %v", loaded.GetTimers(), err)
+	}
+
+	schprovider.ChangeTimer(0, IntervalTimer{SensorAddress: 33, Cron: "@hourly"})
+	if err := loaded.Load(); err != nil || len(loaded.GetTimers()) != 2 ||
+		loaded.GetTimers()[0].Cron != "@hourly" || loaded.GetTimers()[0].cancel == nil {
+		t.Fatalf("Expected the changed timer to be loaded and started, got %v, %v", loaded.GetTimers(), err)
+	}
+
+	unsaved := ScheduleProvider{}.NewScheduleProvider(&cp, nil, rp)
+	if err := unsaved.Load(); err == nil {
+		t.Fatal("Expected error when loading without a persistence provider, got nil")
+	}
+}
+
+func TestScheduleProviderLoadKeepsTimersNotRunning(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	sensor := common.Sensor{Address: 33, Description: "Mock", Registers: []common.Register{
+		common.Register{Name: "test ReadValue", Location: 100, Type: common.Holding}}}
+	if err := cp.AddSensor(sensor); err != nil {
+		t.Fatalf("No error expected when adding the sensor, got %s", err.Error())
+	}
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	line1 := MockReadingProvider{}.NewReadingProvider(&cp, "line1")
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp, line1)
+	for _, bus := range []string{common.DefaultBus, "line1"} {
+		if err := schprovider.AddTimer(IntervalTimer{Bus: bus, SensorAddress: 33, ReadType: common.Holding,
+			StartLocation: 100, ReadLength: 1, Cron: "@hourly"}); err != nil {
+			t.Fatalf("No error expected when adding a timer on %s, got %s", bus, err.Error())
+		}
+	}
+
+	//the bus line1 is gone
+	loaded := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	loaded.Start()
+	defer loaded.Stop()
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("No error expected when loading the schedule, got %s", err.Error())
+	}
+	timers := loaded.GetTimers()
+	if len(timers) != 2 || timers[0].Error != "" || timers[0].cancel == nil ||
+		timers[1].Error == "" || timers[1].cancel != nil {
+		t.Fatalf("Expected the timer on line1 to be kept but not started, got %v", timers)
+	}
+	if _, err := loaded.RunTimer(1); err == nil {
+		t.Fatal("Expected error when running a timer that can not run, got nil")
+	}
+
+	if err := loaded.ChangeTimer(1, IntervalTimer{SensorAddress: 33, ReadType: common.Holding,
+		StartLocation: 100, ReadLength: 1, Cron: "@hourly"}); err != nil {
+		t.Fatalf("No error expected when moving the timer to the default bus, got %s", err.Error())
+	}
+	if changed, _ := loaded.GetTimer(1); changed.Error != "" || changed.cancel == nil {
+		t.Fatalf("Expected the changed timer to run, got %v", changed)
+	}
+}
+
+func TestScheduleProviderSavesLastRun(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	cp.AddSensor(common.Sensor{Address: 33, Description: "Mock", Registers: []common.Register{
+		common.Register{Name: "test ReadValue", Location: 100, Type: common.Holding}}})
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	firstRun := time.Now().Add(50 * time.Millisecond)
+	interval := time.Hour
+	schprovider.AddTimer(IntervalTimer{SensorAddress: 33, ReadType: common.Holding,
+		StartLocation: 100, ReadLength: 1, Persist: true, FirstTime: &firstRun, Interval: &interval})
+	schprovider.Start()
+	for i := 0; i < 200 && schprovider.GetTimers()[0].LastRun == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	//the read in progress is done once the timers are stopped
+	schprovider.Stop()
+
+	//the last run is the time the read was scheduled at, not the time it ended
+	if lastRun := schprovider.GetTimers()[0].LastRun; lastRun == nil || !lastRun.Equal(firstRun) {
+		t.Fatalf("Expected the last run to be %v, got %v", firstRun, lastRun)
+	}
+	saved, _ := pp.ReadItem(scheduleItem)
+	if timers := saved.([]IntervalTimer); len(timers) != 1 || timers[0].LastRun == nil ||
+		!timers[0].LastRun.Equal(firstRun) {
+		t.Fatalf("Expected the timer saved with its last run, got %v", timers)
+	}
+}
+
+func TestScheduleProviderConcurrentChanges(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	sensor := common.Sensor{Address: 33, Description: "Mock"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "test ReadValue", Location: 100, Type: common.Holding}}
+	cp.AddSensor(sensor)
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	mutex := &sync.Mutex{}
+	reads := 0
+	schprovider.AddReadingListener(func(reading common.Reading) {
+		mutex.Lock()
+		reads++
+		mutex.Unlock()
+	})
+	countReads := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return reads
+	}
+	schprovider.Start()
+
+	interval := 5 * time.Millisecond
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				schprovider.AddTimer(IntervalTimer{SensorAddress: 33, ReadType: common.Holding,
+					StartLocation: 100, ReadLength: 1, Interval: &interval})
+				timers := schprovider.GetTimers()
+				id := timers[len(timers)-1].ID
+				schprovider.RunTimer(id)
+				schprovider.PauseTimer(id)
+				schprovider.ResumeTimer(id)
+				schprovider.ChangeTimer(id, IntervalTimer{SensorAddress: 33, ReadType: common.Holding,
+					StartLocation: 100, ReadLength: 1, Interval: &interval})
+				schprovider.Save()
+			}
+		}()
+	}
+	wg.Wait()
+	time.Sleep(20 * time.Millisecond)
+	if len(schprovider.GetTimers()) != 40 || countReads() == 0 {
+		t.Fatalf("Expected 40 timers reading, got %d timers and %d reads", len(schprovider.GetTimers()), countReads())
+	}
+	for _, it := range schprovider.GetTimers() {
+		if it.LastRun == nil {
+			t.Fatalf("Expected the last run of the timer %d to be set", it.ID)
+		}
+		if i := it.ID; i%2 == 0 {
+			schprovider.RemoveTimer(i)
+		}
+	}
+	schprovider.Stop()
+	stoppedAt := countReads()
+	time.Sleep(20 * time.Millisecond)
+	if countReads() != stoppedAt {
+		t.Fatalf("Expected no reads after stopping, got %d more", countReads()-stoppedAt)
+	}
+	if err := schprovider.Load(); err != nil || len(schprovider.GetTimers()) != 20 {
+		t.Fatalf("Expected the 20 timers left to be loaded, got %d, %v", len(schprovider.GetTimers()), err)
+	}
+}
+
+func TestScheduleProviderTimerStatus(t *testing.T) {
+	cp, _ := configprovider.MockConfigProvider{}.NewConfigProvider()
+	cp.SetAddressLimits(0, 50)
+	sensor := common.Sensor{Address: 33, Description: "Mock"}
+	sensor.Registers = []common.Register{common.Register{
+		Name: "test ReadValue", Location: 100, Type: common.Holding}}
+	cp.AddSensor(sensor)
+	rp := MockReadingProvider{}.NewReadingProvider(&cp, common.DefaultBus)
+	pp, _ := persistenceprovider.MockPersistenceProvider{}.NewPersistenceProvider()
+	schprovider := ScheduleProvider{}.NewScheduleProvider(&cp, &pp, rp)
+	firstRun := time.Now().Add(time.Hour).Truncate(time.Second)
+	interval := time.Hour
+	for _, address := range []uint8{33, 44} {
+		schprovider.AddTimer(IntervalTimer{SensorAddress: address, ReadType: common.Holding,
+			StartLocation: 100, ReadLength: 1, Persist: true, FirstTime: &firstRun, Interval: &interval})
+	}
+	schprovider.Start()
+	defer schprovider.Stop()
+
+	for i := 0; i < 2; i++ {
+		schprovider.RunTimer(0)
+		schprovider.RunTimer(1)
+	}
+	working, _ := schprovider.GetTimer(0)
+	if working.Status == nil || working.Status.Reads != 2 || working.Status.Failures != 0 ||
+		working.Status.LastSuccess == nil || working.Status.LastFailure != nil || working.Status.LastError != "" {
+		t.Fatalf("Expected two successful reads, got %v", working.Status)
+	}
+	dead, _ := schprovider.GetTimer(1)
+	if dead.Status.Reads != 2 || dead.Status.Failures != 2 || dead.Status.ConsecutiveFailures != 2 ||
+		dead.Status.LastSuccess != nil || dead.Status.LastFailure == nil || dead.Status.LastError == "" {
+		t.Fatalf("Expected two failed reads, got %v", dead.Status)
+	}
+
+	cp.AddSensor(common.Sensor{Address: 44, Description: "Mock", Registers: sensor.Registers})
+	schprovider.RunTimer(1)
+	timers := schprovider.GetTimers()
+	if timers[1].Status.Reads != 3 || timers[1].Status.Failures != 2 ||
+		timers[1].Status.ConsecutiveFailures != 0 || timers[1].Status.LastSuccess == nil {
+		t.Fatalf("Expected the failures to stop after a successful read, got %v", timers[1].Status)
+	}
+
+	//the next run is set by the goroutine of the timer
+	for i := 0; i < 100 && (timers[0].Status.NextRun == nil || timers[1].Status.NextRun == nil); i++ {
+		time.Sleep(10 * time.Millisecond)
+		timers = schprovider.GetTimers()
+	}
+	for _, it := range timers {
+		if it.Status.NextRun == nil || !it.Status.NextRun.After(time.Now()) {
+			t.Fatalf("Expected the next run of the timer %d to be set, got %v", it.ID, it.Status)
+		}
+	}
+	schprovider.PauseTimer(0)
+	if paused, _ := schprovider.GetTimer(0); paused.Status.NextRun != nil || paused.Status.Reads != 2 {
+		t.Fatalf("Expected a paused timer to keep its status without a next run, got %v", paused.Status)
+	}
+
+	saved, _ := pp.ReadItem(scheduleItem)
+	for _, it := range saved.([]IntervalTimer) {
+		if it.Status != nil {
+			t.Fatalf("Expected the status not to be saved, got %v", it.Status)
+		}
+	}
+}
+
+func TestTimerStatusAverageLatency(t *testing.T) {
+	status := TimerStatus{}
+	now := time.Now()
+	for _, latency := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond} {
+		status.add(now, latency, nil)
+	}
+	status.add(now, 40*time.Millisecond, fmt.Errorf("timeout"))
+	if status.AverageLatency != 25*time.Millisecond || status.Reads != 4 || status.Failures != 1 ||
+		status.ConsecutiveFailures != 1 || status.LastError != "timeout" {
+		t.Fatalf("Expected an average latency of 25ms and one failure, got %v", status)
+	}
+}
@@ -0,0 +1,47 @@
+package readingprovider
+
+import (
+	"log"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+	"github.com/adiclepcea/SensInventory/server/configprovider"
+	"github.com/adiclepcea/SensInventory/server/readgroups"
+)
+
+//Tarer sets the tares of the sensors. A tare can be given or captured
+//from the value currently read by the sensor. The tares are saved on the
+//sensors in the config provider
+type Tarer struct {
+	configProvider *configprovider.ConfigProvider
+	schProvider    *ScheduleProvider
+}
+
+//NewTarer returns a Tarer that reads the sensors through
+//schProvider and saves the tares in cp
+func (Tarer) NewTarer(cp *configprovider.ConfigProvider, schProvider *ScheduleProvider) *Tarer {
+	return &Tarer{configProvider: cp, schProvider: schProvider}
+}
+
+//SetTare adds tare to the sensor having address on bus.
+//If tare.Since is not set, the tare is used from now on
+func (tarer *Tarer) SetTare(bus string, address uint8, tare common.Tare) (*common.Tare, error) {
+	return (*tarer.configProvider).AddTare(bus, address, tare)
+}
+
+//TareNow reads the read group starting at startLocation on the sensor having
+//address on bus and uses the value read as the tare from now on
+func (tarer *Tarer) TareNow(bus string, address uint8, startLocation uint16, description string) (*common.Tare, error) {
+	reading, err := tarer.schProvider.ReadReadGroup(bus, address, startLocation)
+	if err != nil {
+		return nil, err
+	}
+	value, err := readgroups.CalculatedValue(reading, common.ReadGroup{StartLocation: startLocation}.Key())
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	log.Printf("Tare %v on read group %d of sensor %d on bus %s\n",
+		value, startLocation, address, common.BusName(bus))
+	return tarer.SetTare(bus, address, common.Tare{StartLocation: startLocation,
+		Value: value, Since: reading.Time, Description: description})
+}
@@ -0,0 +1,53 @@
+package readingprovider
+
+import (
+	"testing"
+
+	"github.com/adiclepcea/SensInventory/server/common"
+)
+
+func TestTareShouldOk(t *testing.T) {
+	slave := newTestSlave(t, false)
+	defer slave.Close()
+
+	cp, calibrator := newCalibratorForTest(t, slave)
+	tarer := Tarer{}.NewTarer(&cp, calibrator.schProvider)
+
+	tare, err := tarer.SetTare("line1", 3, common.Tare{StartLocation: 100, Value: 250,
+		Since: "2016-04-01T00:00:00"})
+	if err != nil {
+		t.Fatalf("No error expected when setting a tare, got %s", err.Error())
+	}
+	if tare.Value != 250 || tare.Since != "2016-04-01T00:00:00" {
+		t.Fatalf("Expected the tare 250 since 2016-04-01, got %v", tare)
+	}
+
+	slave.SetInput(3, 100, 1200)
+	tare, err = tarer.TareNow("line1", 3, 100, "empty barrel")
+	if err != nil {
+		t.Fatalf("No error expected when taring now, got %s", err.Error())
+	}
+	if tare.Value != 1200 || tare.Description != "empty barrel" {
+		t.Fatalf("Expected the tare 1200 read from the sensor, got %v", tare)
+	}
+	sensor, _ := cp.GetSensorByAddress("line1", 3)
+	if len(sensor.Tares) != 2 || sensor.Tares[0].Value != 250 {
+		t.Fatalf("Expected both tares to be kept, got %v", sensor.Tares)
+	}
+
+	slave.SetInput(3, 100, 1500)
+	reading, err := calibrator.schProvider.ReadReadGroup("line1", 3, 100)
+	if err != nil {
+		t.Fatalf("No error expected when reading, got %s", err.Error())
+	}
+	if reading.CalculatedValues["100"] != uint16(1500) || reading.CalculatedValues["100.net"] != 300.0 {
+		t.Fatalf("Expected the gross value 1500 and the net value 300, got %v", reading.CalculatedValues)
+	}
+
+	if _, err = tarer.SetTare("line1", 3, common.Tare{StartLocation: 101}); err == nil {
+		t.Fatal("Expected error when taring a missing read group, got nil")
+	}
+	if _, err = tarer.TareNow("line1", 4, 100, ""); err == nil {
+		t.Fatal("Expected error when taring a missing sensor, got nil")
+	}
+}